@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ClientAccess describes which databases and schemas a network client may query
+type ClientAccess struct {
+	Name      string   `json:"name"`
+	Token     string   `json:"token"`
+	Databases []int    `json:"databases"`
+	Schemas   []string `json:"schemas"`
+	Admin     bool     `json:"admin"`
+}
+
+// clientAccessConfig is the layout of the client access file
+type clientAccessConfig struct {
+	Clients []*ClientAccess `json:"clients"`
+}
+
+// loadClientAccess reads the client access mapping from a JSON file. Tokens may
+// be given inline or as env:/file: secret references.
+func loadClientAccess(path string) ([]*ClientAccess, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client access file: %w", err)
+	}
+
+	var cfg clientAccessConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse client access file: %w", err)
+	}
+
+	for _, client := range cfg.Clients {
+		if isSecretReference(client.Token) {
+			token, err := resolveSecret(client.Token)
+			if err != nil {
+				return nil, fmt.Errorf("client %s: %w", client.Name, err)
+			}
+			client.Token = token
+		}
+		if client.Token == "" {
+			return nil, fmt.Errorf("client %s has no token", client.Name)
+		}
+	}
+	return cfg.Clients, nil
+}
+
+// clientAccessList holds the client access rules, which may be replaced
+// while serving when the client access file is reloaded
+type clientAccessList struct {
+	mu      sync.RWMutex
+	clients []*ClientAccess
+}
+
+// get returns the current client access rules
+func (l *clientAccessList) get() []*ClientAccess {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.clients
+}
+
+// set replaces the client access rules
+func (l *clientAccessList) set(clients []*ClientAccess) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clients = clients
+}
+
+type clientAccessKey struct{}
+
+// withClientAccess attaches the calling client's access rules to the context
+func withClientAccess(ctx context.Context, access *ClientAccess) context.Context {
+	return context.WithValue(ctx, clientAccessKey{}, access)
+}
+
+// clientAccessFromContext returns the calling client's access rules, or nil
+// when the caller is unrestricted (stdio, or no mapping configured)
+func clientAccessFromContext(ctx context.Context) *ClientAccess {
+	access, _ := ctx.Value(clientAccessKey{}).(*ClientAccess)
+	return access
+}
+
+// allowsDatabase reports whether the client may query the database
+func (a *ClientAccess) allowsDatabase(databaseID int) bool {
+	if len(a.Databases) == 0 {
+		return true
+	}
+	for _, id := range a.Databases {
+		if id == databaseID {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsSchema reports whether the client may read tables in the schema
+func (a *ClientAccess) allowsSchema(schema string) bool {
+	if len(a.Schemas) == 0 {
+		return true
+	}
+	for _, allowed := range a.Schemas {
+		if strings.EqualFold(allowed, schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// errAccessDenied is returned when a client reaches outside its configured scope
+var errAccessDenied = errors.New("access denied")
+
+// cteNamePattern matches the names of common table expressions
+var cteNamePattern = regexp.MustCompile(`(?i)(?:\bwith|,)\s+(?:recursive\s+)?([a-zA-Z_]\w*)\s+as\s*\(`)
+
+// unscopedTemplatePattern matches references to saved questions ({{#123}})
+// and snippets ({{snippet: name}}), which Metabase expands into SQL
+var unscopedTemplatePattern = regexp.MustCompile(`(?i)\{\{\s*(#|snippet\s*:)[^}]*\}\}`)
+
+// errDatabasePolicy is returned when a call references a database the
+// profile's database policy does not allow
+var errDatabasePolicy = fmt.Errorf("%w by database policy", errAccessDenied)
+
+// policyName names the policy that rejected a call, for session statistics
+func policyName(err error) string {
+	if errors.Is(err, errDatabasePolicy) {
+		return "database_policy"
+	}
+	return "access_denied"
+}
+
+// restrictsDatabases reports whether the profile has a database policy
+func (p *Profile) restrictsDatabases() bool {
+	return len(p.AllowedDatabases) > 0 || len(p.DeniedDatabases) > 0
+}
+
+// allowsDatabase reports whether the profile's database policy lets calls
+// touch the database. Denied databases win over allowed ones.
+func (p *Profile) allowsDatabase(databaseID int) bool {
+	for _, id := range p.DeniedDatabases {
+		if id == databaseID {
+			return false
+		}
+	}
+	if len(p.AllowedDatabases) == 0 {
+		return true
+	}
+	for _, id := range p.AllowedDatabases {
+		if id == databaseID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDatabasePolicy verifies that the profile's default database and
+// registry databases are allowed by its own database policy
+func (p *Profile) checkDatabasePolicy() error {
+	if !p.allowsDatabase(p.DatabaseID) {
+		return fmt.Errorf("database_id %d is not allowed by the database policy", p.DatabaseID)
+	}
+	for name, id := range p.Databases {
+		if !p.allowsDatabase(id) {
+			return fmt.Errorf("database %s (%d) is not allowed by the database policy", name, id)
+		}
+	}
+	return nil
+}
+
+// checkDatabaseAccess rejects databases outside the profile's database
+// policy or the calling client's scope
+func checkDatabaseAccess(ctx context.Context, databaseID int) error {
+	if profile := profileFromContext(ctx); profile != nil && !profile.allowsDatabase(databaseID) {
+		return fmt.Errorf("%w: profile %s may not touch database %d", errDatabasePolicy, profile.Name, databaseID)
+	}
+	access := clientAccessFromContext(ctx)
+	if access == nil || access.allowsDatabase(databaseID) {
+		return nil
+	}
+	return fmt.Errorf("%w: client %s may not query database %d", errAccessDenied, access.Name, databaseID)
+}
+
+// checkTableAccess rejects tables outside the calling client's scope
+func checkTableAccess(ctx context.Context, databaseID int, schema string) error {
+	if err := checkDatabaseAccess(ctx, databaseID); err != nil {
+		return err
+	}
+	if access := clientAccessFromContext(ctx); access != nil && len(access.Schemas) > 0 && !access.allowsSchema(schema) {
+		return fmt.Errorf("%w: client %s may not read schema %q", errAccessDenied, access.Name, schema)
+	}
+	return nil
+}
+
+// checkQueryAccess rejects native queries touching databases or schemas outside
+// the calling client's scope. When schemas are restricted, every table must be
+// schema-qualified so the check cannot be bypassed through the search path,
+// and table functions, saved question references and snippets, whose tables
+// cannot be checked, are refused.
+func checkQueryAccess(ctx context.Context, databaseID int, sql string) error {
+	if err := checkDatabaseAccess(ctx, databaseID); err != nil {
+		return err
+	}
+	access := clientAccessFromContext(ctx)
+	if access == nil || len(access.Schemas) == 0 || sql == "" {
+		return nil
+	}
+
+	if match := unscopedTemplatePattern.FindString(sql); match != "" {
+		return fmt.Errorf("%w: client %s may not use %s in queries, since the tables it reads cannot be checked", errAccessDenied, access.Name, match)
+	}
+	// The query is checked under both the standard and the MySQL lexical
+	// rules, so text hidden from one of them as a comment or string is still
+	// seen, and a table only counts as a CTE under the rules that found it
+	for _, mysql := range []bool{false, true} {
+		tokens := tokenizeSQL(sql, mysql)
+		ctes := scanCTENames(tokens)
+		for _, ref := range scanTableRefs(tokens) {
+			if err := checkTableRef(access, ref, ctes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkTableRef rejects a table reference outside the client's schemas
+func checkTableRef(access *ClientAccess, ref sqlTableRef, ctes map[string]bool) error {
+	table := ref.name()
+	switch {
+	case ref.function:
+		return fmt.Errorf("%w: client %s may not read from table function %s", errAccessDenied, access.Name, table)
+	case len(ref.parts) == 1 && ctes[table]:
+		return nil
+	case len(ref.parts) < 2:
+		return fmt.Errorf("%w: qualify table %q with one of the allowed schemas (%s)", errAccessDenied, table, strings.Join(access.Schemas, ", "))
+	}
+	if schema := ref.parts[len(ref.parts)-2]; !access.allowsSchema(schema) {
+		return fmt.Errorf("%w: client %s may not read schema %q", errAccessDenied, access.Name, schema)
+	}
+	return nil
+}
+
+// cteNames returns the lowercased names of the common table expressions defined by sql
+func cteNames(sql string) map[string]bool {
+	ctes := make(map[string]bool)
+	for _, match := range cteNamePattern.FindAllStringSubmatch(sql, -1) {
+		ctes[strings.ToLower(match[1])] = true
+	}
+	return ctes
+}
+
+// clientAccessMiddleware identifies network clients by bearer token (or the
+// X-Client-Token header) and attaches their access rules to the request
+func clientAccessMiddleware(clients *clientAccessList, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.Header.Get("X-Client-Token")
+		}
+
+		for _, client := range clients.get() {
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(client.Token)) == 1 {
+				next.ServeHTTP(w, r.WithContext(withClientAccess(r.Context(), client)))
+				return
+			}
+		}
+		http.Error(w, "unknown or missing client token", http.StatusUnauthorized)
+	})
+}
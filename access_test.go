@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCheckQueryAccess(t *testing.T) {
+	ctx := withClientAccess(context.Background(), &ClientAccess{
+		Name:      "finance",
+		Databases: []int{1},
+		Schemas:   []string{"finance"},
+	})
+
+	tests := []struct {
+		name    string
+		sql     string
+		allowed bool
+	}{
+		{"qualified table", "SELECT * FROM finance.orders", true},
+		{"quoted qualified table", `SELECT * FROM "finance"."orders"`, true},
+		{"unqualified table", "SELECT * FROM orders", false},
+		{"other schema", "SELECT * FROM hr.salaries", false},
+		{"join", "SELECT * FROM finance.orders o JOIN hr.salaries s ON o.id = s.id", false},
+		{"allowed join", "SELECT * FROM finance.orders o LEFT JOIN finance.customers c ON o.customer_id = c.id", true},
+		{"comma join", "SELECT * FROM finance.orders, hr.salaries", false},
+		{"comma join after alias", "SELECT * FROM finance.orders AS o, finance.customers c, hr.salaries s", false},
+		{"comma join after join condition", "SELECT * FROM finance.orders o JOIN finance.customers c ON o.id = c.id, hr.salaries", false},
+		{"parenthesized join", "SELECT * FROM (hr.salaries CROSS JOIN finance.orders)", false},
+		{"subquery", "SELECT * FROM (SELECT * FROM hr.salaries) s", false},
+		{"comma join after subquery", "SELECT * FROM (SELECT 1) s, hr.salaries", false},
+		{"scalar subquery", "SELECT (SELECT max(amount) FROM hr.salaries) FROM finance.orders", false},
+		{"exists subquery", "SELECT * FROM finance.orders WHERE EXISTS (SELECT 1 FROM hr.salaries)", false},
+		{"comment between keyword and table", "SELECT * FROM/**/hr.salaries", false},
+		{"line comment hiding a parenthesis", "SELECT * FROM finance.orders -- )\n, hr.salaries", false},
+		{"mysql hash comment", "SELECT * FROM finance.orders # (\n, hr.salaries", false},
+		{"mysql executable comment", "SELECT * FROM finance.orders /*!, hr.salaries */", false},
+		{"table function", "SELECT * FROM dblink('host=other', 'select 1') AS t(a int)", false},
+		{"cte", "WITH recent AS (SELECT * FROM finance.orders) SELECT * FROM recent", true},
+		{"cte reading another schema", "WITH s AS (SELECT * FROM hr.salaries) SELECT * FROM s", false},
+		{"cte name in a comment", "/* WITH orders AS ( */ SELECT * FROM orders", false},
+		{"extract from column", "SELECT extract(year FROM created_at) FROM finance.orders", true},
+		{"is distinct from", "SELECT * FROM finance.orders WHERE amount IS DISTINCT FROM 0", true},
+		{"join using columns", "SELECT * FROM finance.orders JOIN finance.refunds USING (order_id)", true},
+		{"from in a string", "SELECT 'from hr.salaries' FROM finance.orders", true},
+		{"card reference", "SELECT * FROM {{#12-salaries}}", false},
+		{"snippet", "SELECT * FROM finance.orders WHERE {{snippet: recent}}", false},
+		{"field filter", "SELECT * FROM finance.orders WHERE {{created_at}}", true},
+		{"delete using", "DELETE FROM finance.orders USING hr.salaries", false},
+		{"insert", "INSERT INTO hr.salaries SELECT * FROM finance.orders", false},
+		{"update", "UPDATE hr.salaries SET amount = 0", false},
+		{"select for update", "SELECT * FROM finance.orders FOR UPDATE SKIP LOCKED", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkQueryAccess(ctx, 1, tt.sql)
+			if tt.allowed && err != nil {
+				t.Fatalf("checkQueryAccess(%q) = %v, want allowed", tt.sql, err)
+			}
+			if !tt.allowed && !errors.Is(err, errAccessDenied) {
+				t.Fatalf("checkQueryAccess(%q) = %v, want access denied", tt.sql, err)
+			}
+		})
+	}
+}
+
+func TestCheckQueryAccessDatabases(t *testing.T) {
+	ctx := withClientAccess(context.Background(), &ClientAccess{Name: "finance", Databases: []int{1}})
+
+	if err := checkQueryAccess(ctx, 1, "SELECT * FROM orders"); err != nil {
+		t.Fatalf("allowed database rejected: %v", err)
+	}
+	if err := checkQueryAccess(ctx, 2, "SELECT * FROM orders"); !errors.Is(err, errAccessDenied) {
+		t.Fatalf("other database = %v, want access denied", err)
+	}
+	if err := checkQueryAccess(context.Background(), 2, "SELECT * FROM hr.salaries"); err != nil {
+		t.Fatalf("unrestricted caller rejected: %v", err)
+	}
+}
+
+func TestCheckCardTables(t *testing.T) {
+	ctx := withClientAccess(context.Background(), &ClientAccess{
+		Name:      "finance",
+		Databases: []int{1},
+		Schemas:   []string{"finance"},
+	})
+	schemas := map[int]string{10: "finance", 20: "hr"}
+	tableSchema := func(tableID int) (string, error) { return schemas[tableID], nil }
+	tableID := func(id int) *int { return &id }
+	native := func(sql string) json.RawMessage {
+		query, _ := json.Marshal(map[string]interface{}{"type": "native", "native": map[string]interface{}{"query": sql}})
+		return query
+	}
+	mbql := json.RawMessage(`{"type":"query","query":{"source-table":10}}`)
+
+	tests := []struct {
+		name    string
+		card    Card
+		allowed bool
+	}{
+		{"native in scope", Card{DatabaseID: 1, DatasetQuery: native("SELECT * FROM finance.orders")}, true},
+		{"native reading another schema", Card{DatabaseID: 1, DatasetQuery: native("SELECT * FROM hr.salaries")}, false},
+		{"native with a source table", Card{DatabaseID: 1, TableID: tableID(10), DatasetQuery: native("SELECT * FROM hr.salaries")}, false},
+		{"mbql in scope", Card{DatabaseID: 1, TableID: tableID(10), DatasetQuery: mbql}, true},
+		{"mbql on another schema", Card{DatabaseID: 1, TableID: tableID(20), DatasetQuery: mbql}, false},
+		{"mbql without a source table", Card{DatabaseID: 1, DatasetQuery: json.RawMessage(`{"type":"query","query":{"source-table":"card__3"}}`)}, false},
+		{"other database", Card{DatabaseID: 2, TableID: tableID(10), DatasetQuery: mbql}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCardTables(ctx, tt.card, tableSchema)
+			if tt.allowed && err != nil {
+				t.Fatalf("checkCardTables() = %v, want allowed", err)
+			}
+			if !tt.allowed && !errors.Is(err, errAccessDenied) {
+				t.Fatalf("checkCardTables() = %v, want access denied", err)
+			}
+		})
+	}
+
+	// Without a schema scope, questions based on other questions only need their database
+	ctx = withClientAccess(context.Background(), &ClientAccess{Name: "finance", Databases: []int{1}})
+	if err := checkCardTables(ctx, Card{DatabaseID: 1}, tableSchema); err != nil {
+		t.Fatalf("card without a source table rejected: %v", err)
+	}
+}
+
+func TestDatabasePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []int
+		denied  []int
+		want    map[int]bool
+	}{
+		{"no policy", nil, nil, map[int]bool{1: true, 2: true}},
+		{"allow list", []int{1}, nil, map[int]bool{1: true, 2: false}},
+		{"deny list", nil, []int{2}, map[int]bool{1: true, 2: false}},
+		{"deny wins", []int{1, 2}, []int{2}, map[int]bool{1: true, 2: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := &Profile{Name: "default", AllowedDatabases: tt.allowed, DeniedDatabases: tt.denied}
+			ctx := withProfile(context.Background(), profile)
+			for id, want := range tt.want {
+				err := checkDatabaseAccess(ctx, id)
+				if (err == nil) != want {
+					t.Errorf("database %d: checkDatabaseAccess() = %v, want allowed %v", id, err, want)
+				}
+				if err != nil && (!errors.Is(err, errAccessDenied) || policyName(err) != "database_policy") {
+					t.Errorf("database %d: error %v, want a database policy denial", id, err)
+				}
+			}
+		})
+	}
+
+	// The profile's own databases must be allowed
+	for name, env := range map[string]map[string]string{
+		"default database denied": {"METABASE_DENIED_DATABASES": "1"},
+		"not allowed":             {"METABASE_ALLOWED_DATABASES": "2, 3"},
+		"invalid list":            {"METABASE_ALLOWED_DATABASES": "1,sales"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			setMinimalEnv(t)
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			if _, err := loadConfig(""); err == nil {
+				t.Error("loadConfig() succeeded")
+			}
+		})
+	}
+}
+
+func TestDatabasePolicyArgument(t *testing.T) {
+	r := newTestRegistry(Guardrails{}, &bytes.Buffer{})
+	r.config.Profiles["default"].DeniedDatabases = []int{2}
+	called := false
+	r.add(mcp.NewTool("list-tables", mcp.WithNumber("database_id")), func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		return mcp.NewToolResultText("tables"), nil
+	})
+
+	response := callServerTool(t, r, "list-tables", map[string]interface{}{"database_id": 2})
+	if called || !strings.Contains(response, "profile default may not touch database 2") {
+		t.Errorf("denied database: handler called %v, response %s", called, response)
+	}
+	if response := callServerTool(t, r, "list-tables", map[string]interface{}{"database_id": 1}); !called {
+		t.Errorf("allowed database: response %s, want the handler called", response)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a state-changing tool call made through the server
+type AuditRecord struct {
+	Time      time.Time              `json:"time"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Outcome   string                 `json:"outcome"`
+	Message   string                 `json:"message,omitempty"`
+}
+
+// auditSink receives audit records in addition to the audit log
+type auditSink interface {
+	send(rec AuditRecord)
+	close()
+	stats() map[string]int
+}
+
+// auditLogger writes audit records as JSON lines and forwards them to the configured sinks
+type auditLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	sinks []auditSink
+}
+
+// newAuditLogger creates an audit logger writing to the configured log
+// destinations, or stderr when none are set, and shipping to OpenSearch when configured
+func newAuditLogger(cfg Config) (*auditLogger, error) {
+	w, err := openLogSinks(cfg.AuditLogPath, "metabase-mcp-audit")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	logger := &auditLogger{w: w}
+	if cfg.AuditOpenSearchURL != "" {
+		logger.sinks = append(logger.sinks, newOpenSearchSink(cfg))
+	}
+	return logger, nil
+}
+
+// record writes a single audit record
+func (a *auditLogger) record(rec AuditRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	a.w.Write(append(line, '\n'))
+	a.mu.Unlock()
+
+	for _, sink := range a.sinks {
+		sink.send(rec)
+	}
+}
+
+// close flushes the sinks
+func (a *auditLogger) close() {
+	for _, sink := range a.sinks {
+		sink.close()
+	}
+}
+
+// sinkStats reports the delivery statistics of each sink
+func (a *auditLogger) sinkStats() []map[string]int {
+	stats := make([]map[string]int, 0, len(a.sinks))
+	for _, sink := range a.sinks {
+		stats = append(stats, sink.stats())
+	}
+	return stats
+}
+
+// sensitiveArgumentPattern matches argument names whose values must not be logged
+var sensitiveArgumentPattern = regexp.MustCompile(`(?i)password|secret|token|cookie|api_key$`)
+
+// redactArguments copies tool arguments, masking sensitive values
+func redactArguments(arguments map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(arguments))
+	for key, value := range arguments {
+		if sensitiveArgumentPattern.MatchString(key) {
+			value = "[redacted]"
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
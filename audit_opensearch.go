@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openSearchSink ships audit records to OpenSearch or Elasticsearch through the
+// bulk API. Records are buffered and sent in batches; when the buffer is full,
+// callers wait briefly for room before the record is dropped and counted.
+type openSearchSink struct {
+	url        string
+	index      string
+	username   string
+	password   string
+	apiKey     string
+	httpClient *http.Client
+
+	records chan AuditRecord
+	done    chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	dropped int
+	failed  int
+}
+
+// newOpenSearchSink creates a sink shipping to the cluster at url and starts its sender
+func newOpenSearchSink(cfg Config) *openSearchSink {
+	sink := &openSearchSink{
+		url:        strings.TrimRight(cfg.AuditOpenSearchURL, "/"),
+		index:      cfg.AuditOpenSearchIndex,
+		username:   cfg.AuditOpenSearchUsername,
+		password:   cfg.AuditOpenSearchPassword,
+		apiKey:     cfg.AuditOpenSearchAPIKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		records:    make(chan AuditRecord, 1000),
+		done:       make(chan struct{}),
+	}
+	go sink.run()
+	return sink
+}
+
+// send queues a record, waiting up to a second for buffer space
+func (s *openSearchSink) send(rec AuditRecord) {
+	select {
+	case s.records <- rec:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case s.records <- rec:
+	case <-timer.C:
+		s.mu.Lock()
+		s.dropped++
+		s.mu.Unlock()
+		log.Printf("audit: OpenSearch buffer full, dropped record for %s", rec.Tool)
+	}
+}
+
+// close flushes buffered records and stops the sender
+func (s *openSearchSink) close() {
+	s.once.Do(func() {
+		close(s.records)
+		<-s.done
+	})
+}
+
+// run collects records into batches of up to 100, flushing every 5 seconds
+func (s *openSearchSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	batch := make([]AuditRecord, 0, 100)
+	for {
+		select {
+		case rec, ok := <-s.records:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) == cap(batch) {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush sends a batch through the bulk API, retrying with backoff
+func (s *openSearchSink) flush(batch []AuditRecord) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": s.index}})
+	for _, rec := range batch {
+		doc, err := json.Marshal(rec)
+		if err != nil {
+			continue
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err = s.post(body.Bytes()); err == nil {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	s.mu.Lock()
+	s.failed += len(batch)
+	s.mu.Unlock()
+	log.Printf("audit: failed to ship %d records to OpenSearch: %v", len(batch), err)
+}
+
+// post sends one bulk request and checks the per-document results
+func (s *openSearchSink) post(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/_bulk", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case s.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	case s.username != "":
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bulk request returned %s: %s", resp.Status, respBody)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err == nil && result.Errors {
+		log.Printf("audit: OpenSearch rejected some records: %s", respBody)
+	}
+	return nil
+}
+
+// stats reports records that could not be shipped
+func (s *openSearchSink) stats() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]int{
+		"buffered": len(s.records),
+		"dropped":  s.dropped,
+		"failed":   s.failed,
+	}
+}
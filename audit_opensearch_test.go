@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOpenSearchSink(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           Config
+		authorization string
+	}{
+		{"api key", Config{AuditOpenSearchAPIKey: "key"}, "ApiKey key"},
+		{"basic auth", Config{AuditOpenSearchUsername: "audit", AuditOpenSearchPassword: "secret"}, "Basic YXVkaXQ6c2VjcmV0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var bodies []string
+			var authorization string
+			cluster := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				defer mu.Unlock()
+				if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+					t.Errorf("request to %s with content type %s", r.URL.Path, r.Header.Get("Content-Type"))
+				}
+				bodies = append(bodies, string(body))
+				authorization = r.Header.Get("Authorization")
+				w.Write([]byte(`{"errors": false}`))
+			}))
+			defer cluster.Close()
+
+			tt.cfg.AuditOpenSearchURL = cluster.URL + "/"
+			tt.cfg.AuditOpenSearchIndex = "mcp-audit"
+			sink := newOpenSearchSink(tt.cfg)
+			sink.send(AuditRecord{Tool: "create-card", Outcome: "applied"})
+			sink.send(AuditRecord{Tool: "archive-card", Outcome: "previewed"})
+			sink.close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(bodies) != 1 {
+				t.Fatalf("sent %d bulk requests, want the buffered records flushed in one", len(bodies))
+			}
+			lines := strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")
+			if len(lines) != 4 || lines[0] != `{"index":{"_index":"mcp-audit"}}` || lines[2] != lines[0] {
+				t.Fatalf("bulk body = %q", bodies[0])
+			}
+			var rec AuditRecord
+			if err := json.Unmarshal([]byte(lines[3]), &rec); err != nil || rec.Tool != "archive-card" || rec.Outcome != "previewed" {
+				t.Errorf("second document = %s", lines[3])
+			}
+			if authorization != tt.authorization {
+				t.Errorf("Authorization = %q, want %q", authorization, tt.authorization)
+			}
+			if stats := sink.stats(); stats["dropped"] != 0 || stats["failed"] != 0 {
+				t.Errorf("stats = %v", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactArguments(t *testing.T) {
+	arguments := map[string]interface{}{
+		"name":            "etl",
+		"password_secret": "env:DB_PASSWORD",
+		"session_token":   "abc",
+		"api_key":         "mb_key",
+		"api_key_id":      4,
+		"Cookie":          "metabase.SESSION=abc",
+	}
+	got := redactArguments(arguments)
+	want := map[string]interface{}{
+		"name":            "etl",
+		"password_secret": "[redacted]",
+		"session_token":   "[redacted]",
+		"api_key":         "[redacted]",
+		"api_key_id":      4,
+		"Cookie":          "[redacted]",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+	if arguments["api_key"] != "mb_key" {
+		t.Errorf("redactArguments changed the call's arguments")
+	}
+}
+
+func TestAuditLoggerRecord(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &auditLogger{w: &buf}
+	logger.record(AuditRecord{Tool: "add-group-member", Outcome: "applied"})
+	logger.record(AuditRecord{Tool: "revoke-api-key", Outcome: "error", Message: "not found"})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("audit log = %q, want one line per record", buf.String())
+	}
+	var rec AuditRecord
+	if err := json.Unmarshal(lines[1], &rec); err != nil || rec.Tool != "revoke-api-key" || rec.Message != "not found" {
+		t.Errorf("second record = %s, %v", lines[1], err)
+	}
+}
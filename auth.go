@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Authentication schemes selectable per profile
+const (
+	authCookie  = "cookie"
+	authAPIKey  = "api_key"
+	authSession = "session"
+	authBearer  = "bearer"
+)
+
+// AuthProvider authenticates requests to Metabase. Tool handlers never see
+// credentials; the client asks its provider to sign each request and to renew
+// the credentials when Metabase rejects them.
+type AuthProvider interface {
+	// Name identifies the scheme in health and diagnostic output
+	Name() string
+	// Authenticate adds credentials for host to req
+	Authenticate(ctx context.Context, req *http.Request, host string) error
+	// Refresh renews the credentials after host rejected the request, and
+	// reports whether they could be renewed so the request is worth retrying
+	Refresh(ctx context.Context, rejected *http.Request, host string) (bool, error)
+}
+
+// authSchemeFor returns the authentication scheme of a profile: the one it
+// names, or else the one its credentials imply. It fails when the
+// credentials of the scheme are missing.
+func authSchemeFor(profile *Profile) (string, error) {
+	hasCookies := profile.Cookies != "" || profile.CookiesFile != ""
+	hasAPIKey := profile.APIKey != "" || profile.APIKeyFile != ""
+	hasBearerToken := profile.BearerToken != "" || profile.BearerTokenFile != ""
+
+	scheme := profile.Auth
+	if scheme == "" {
+		switch {
+		case hasAPIKey:
+			scheme = authAPIKey
+		case hasBearerToken:
+			scheme = authBearer
+		case profile.Username != "" || profile.Password != "":
+			scheme = authSession
+		default:
+			scheme = authCookie
+		}
+	}
+
+	switch {
+	case scheme == authCookie && !hasCookies:
+		return "", fmt.Errorf("cookie authentication needs cookies")
+	case scheme == authAPIKey && !hasAPIKey:
+		return "", fmt.Errorf("api_key authentication needs an API key")
+	case scheme == authSession && (profile.Username == "" || profile.Password == ""):
+		return "", fmt.Errorf("session authentication needs a username and password")
+	case scheme == authBearer && !hasBearerToken:
+		return "", fmt.Errorf("bearer authentication needs a token")
+	case scheme != authCookie && scheme != authAPIKey && scheme != authSession && scheme != authBearer:
+		return "", fmt.Errorf("unknown authentication scheme %q, expected cookie, api_key, session or bearer", scheme)
+	}
+	return scheme, nil
+}
+
+// newAuthProvider creates the provider of a profile's authentication scheme.
+// Session logins are sent through httpClient.
+func newAuthProvider(profile *Profile, httpClient *http.Client) (AuthProvider, error) {
+	scheme, err := authSchemeFor(profile)
+	if err != nil {
+		return nil, err
+	}
+	var auth headerAuth
+	var path string
+	switch scheme {
+	case authSession:
+		return &sessionAuth{username: profile.Username, password: profile.Password, httpClient: httpClient}, nil
+	case authAPIKey:
+		auth, path = headerAuth{name: authAPIKey, header: "X-API-Key", value: profile.APIKey}, profile.APIKeyFile
+	case authBearer:
+		auth, path = headerAuth{name: authBearer, header: "Authorization", prefix: "Bearer ", value: profile.BearerToken}, profile.BearerTokenFile
+	default:
+		auth, path = headerAuth{name: authCookie, header: "Cookie", value: profile.Cookies}, profile.CookiesFile
+	}
+	if path != "" {
+		if auth.file, err = openSecretFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return auth, nil
+}
+
+// headerAuth sends credentials in a request header: session cookies, an API
+// key or a bearer token. They are fixed, or read from a file that is watched
+// for changes and re-read when Metabase rejects them.
+type headerAuth struct {
+	name   string
+	header string
+	prefix string
+	value  string
+	file   *secretFile
+}
+
+// authCloser is implemented by auth providers holding resources, such as a
+// watched credentials file, that are released once the provider is replaced
+type authCloser interface {
+	close()
+}
+
+// closeAuth releases what an auth provider holds, if anything
+func closeAuth(auth AuthProvider) {
+	if closer, ok := auth.(authCloser); ok {
+		closer.close()
+	}
+}
+
+func (a headerAuth) close() {
+	if a.file != nil {
+		a.file.close()
+	}
+}
+
+func (a headerAuth) Name() string {
+	return a.name
+}
+
+func (a headerAuth) Authenticate(ctx context.Context, req *http.Request, host string) error {
+	value := a.value
+	if a.file != nil {
+		value = a.file.get()
+	}
+	req.Header.Set(a.header, a.prefix+value)
+	return nil
+}
+
+// Refresh picks up credentials rotated since the rejected request was sent
+func (a headerAuth) Refresh(ctx context.Context, rejected *http.Request, host string) (bool, error) {
+	if a.file == nil {
+		return false, nil
+	}
+	if _, err := a.file.reload(); err != nil {
+		return false, err
+	}
+	return rejected.Header.Get(a.header) != a.prefix+a.file.get(), nil
+}
+
+// sessionHeader carries the session token of a username/password login
+const sessionHeader = "X-Metabase-Session"
+
+// sessionLoginPath is the Metabase endpoint exchanging credentials for a session token
+const sessionLoginPath = "/api/session"
+
+// sessionAuth logs in with a username and password and sends the session
+// token, logging in again whenever the session expires. Each host, such as
+// the primary and the failover host, gets a session of its own, since a token
+// issued by one Metabase is not valid on another.
+type sessionAuth struct {
+	username   string
+	password   string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	sessions map[string]string
+}
+
+func (a *sessionAuth) Name() string {
+	return authSession
+}
+
+// Authenticate adds the current session token of host, logging in to host
+// when there is none yet
+func (a *sessionAuth) Authenticate(ctx context.Context, req *http.Request, host string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	session := a.sessions[host]
+	if session == "" {
+		var err error
+		if session, err = a.login(ctx, host); err != nil {
+			return err
+		}
+		a.setSession(host, session)
+	}
+	req.Header.Set(sessionHeader, session)
+	return nil
+}
+
+// Refresh logs in to host again after it rejected the session, unless a
+// concurrent request has already replaced it
+func (a *sessionAuth) Refresh(ctx context.Context, rejected *http.Request, host string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if current := a.sessions[host]; current != "" && current != rejected.Header.Get(sessionHeader) {
+		return true, nil
+	}
+	session, err := a.login(ctx, host)
+	a.setSession(host, session)
+	return true, err
+}
+
+// setSession records the session token of host; an empty token forgets it
+func (a *sessionAuth) setSession(host, session string) {
+	if a.sessions == nil {
+		a.sessions = make(map[string]string)
+	}
+	if session == "" {
+		delete(a.sessions, host)
+		return
+	}
+	a.sessions[host] = session
+}
+
+// login exchanges the configured credentials for a new session token
+func (a *sessionAuth) login(ctx context.Context, host string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"username": a.username, "password": a.password})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode login request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, host+sessionLoginPath, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create login request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read login response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("failed to log in to Metabase as %s: %w", a.username, &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)})
+	}
+
+	var session struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &session); err != nil || session.ID == "" {
+		return "", fmt.Errorf("failed to log in to Metabase as %s: no session token in response", a.username)
+	}
+	return session.ID, nil
+}
+
+// Arguments overriding the server's credentials for a single tool call
+const (
+	overrideSessionArgument = "auth_session_token"
+	overrideAPIKeyArgument  = "auth_api_key"
+)
+
+// credentialOverride is a caller's own credential, used instead of the
+// profile's for one tool call
+type credentialOverride struct {
+	scheme string
+	header string
+	value  string
+}
+
+type credentialOverrideKey struct{}
+
+// withCredentialOverride attaches the credential passed in a tool call's
+// arguments to the context, if there is one
+func withCredentialOverride(ctx context.Context, request mcp.CallToolRequest) context.Context {
+	var override *credentialOverride
+	if apiKey := request.GetString(overrideAPIKeyArgument, ""); apiKey != "" {
+		override = &credentialOverride{scheme: authAPIKey, header: "X-API-Key", value: apiKey}
+	} else if session := request.GetString(overrideSessionArgument, ""); session != "" {
+		override = &credentialOverride{scheme: authSession, header: sessionHeader, value: session}
+	} else {
+		return ctx
+	}
+	return context.WithValue(ctx, credentialOverrideKey{}, override)
+}
+
+// credentialOverrideFromContext returns the caller's credential, or nil when
+// the profile's credentials apply
+func credentialOverrideFromContext(ctx context.Context) *credentialOverride {
+	override, _ := ctx.Value(credentialOverrideKey{}).(*credentialOverride)
+	return override
+}
+
+// withCredentialOverrideArguments adds the credential override arguments to a tool
+func withCredentialOverrideArguments(tool *mcp.Tool) {
+	tool.InputSchema.Properties[overrideSessionArgument] = map[string]interface{}{
+		"type":        "string",
+		"description": "Metabase session token to run this call with instead of the server's credentials",
+	}
+	tool.InputSchema.Properties[overrideAPIKeyArgument] = map[string]interface{}{
+		"type":        "string",
+		"description": "Metabase API key to run this call with instead of the server's credentials",
+	}
+}
+
+// AuthError reports that Metabase rejected the credentials of a request:
+// a 401 response, or an HTML login page served by Metabase or a proxy in
+// front of it where API data was expected
+type AuthError struct {
+	StatusCode int
+	Status     string
+	LoginPage  bool
+	// Scheme is the authentication scheme whose credentials were rejected
+	Scheme string
+	// Relogin is set when renewing the credentials was tried
+	Relogin bool
+	// Cause is the error of the failed login, if any
+	Cause error
+}
+
+func (e *AuthError) Error() string {
+	if e.Status == "" {
+		return fmt.Sprintf("authentication failed: %v", e.Cause)
+	}
+	msg := fmt.Sprintf("authentication expired: Metabase rejected the request (%s)", e.Status)
+	if e.LoginPage {
+		msg = fmt.Sprintf("authentication expired: Metabase answered with a login page instead of data (%s)", e.Status)
+	}
+	switch {
+	case e.Cause != nil:
+		return fmt.Sprintf("%s and logging in again failed: %v", msg, e.Cause)
+	case e.Relogin:
+		return msg + " even after logging in again"
+	default:
+		return msg + "; " + authHints[e.Scheme]
+	}
+}
+
+// authHints tell the user how to renew the credentials of each scheme
+var authHints = map[string]string{
+	authCookie:  "refresh METABASE_COOKIES or set METABASE_USERNAME and METABASE_PASSWORD",
+	authAPIKey:  "check that the API key is valid and has not been revoked",
+	authSession: "check METABASE_USERNAME and METABASE_PASSWORD",
+	authBearer:  "renew the bearer token",
+}
+
+// loginError wraps the failure of the initial login as an *AuthError, unless
+// Metabase could not be reached at all
+func loginError(err error, scheme string) error {
+	var apiErr *APIError
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || (errors.As(err, &apiErr) && apiErr.StatusCode >= 500) {
+		return err
+	}
+	authErr := &AuthError{Scheme: scheme, Relogin: true, Cause: err}
+	if apiErr != nil {
+		authErr.StatusCode = apiErr.StatusCode
+	}
+	return authErr
+}
+
+// authFailure returns the authentication error for a response, or nil when
+// the response is not an authentication failure. Plain 403 responses from
+// Metabase mean missing permissions and are not treated as one.
+func authFailure(resp *http.Response, body []byte) *AuthError {
+	loginPage := isHTMLResponse(resp, body)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return &AuthError{StatusCode: resp.StatusCode, Status: resp.Status, LoginPage: loginPage}
+	case loginPage && (resp.StatusCode == http.StatusForbidden || resp.StatusCode < 300):
+		return &AuthError{StatusCode: resp.StatusCode, Status: resp.Status, LoginPage: true}
+	}
+	return nil
+}
+
+// isHTMLResponse reports whether a response is an HTML page rather than API data
+func isHTMLResponse(resp *http.Response, body []byte) bool {
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		return true
+	}
+	start := strings.ToLower(strings.TrimSpace(string(body[:min(len(body), 64)])))
+	return strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html")
+}
+
+// authFailures collects the authentication errors met while serving a tool call
+type authFailures struct {
+	mu  sync.Mutex
+	err *AuthError
+}
+
+type authFailuresKey struct{}
+
+// trackAuthFailures attaches a collector of authentication errors to the context
+func trackAuthFailures(ctx context.Context) (context.Context, *authFailures) {
+	failures := &authFailures{}
+	return context.WithValue(ctx, authFailuresKey{}, failures), failures
+}
+
+// recordAuthFailure notes an authentication error on the tool call being served
+func recordAuthFailure(ctx context.Context, err *AuthError) {
+	if failures, ok := ctx.Value(authFailuresKey{}).(*authFailures); ok {
+		failures.mu.Lock()
+		failures.err = err
+		failures.mu.Unlock()
+	}
+}
+
+// last returns the most recent authentication error, or nil
+func (f *authFailures) last() *AuthError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// authErrorResult describes an authentication failure to the MCP client in a
+// structured form, so it can tell the user to renew credentials instead of
+// showing a raw Metabase response
+func authErrorResult(profile *Profile, err *AuthError) (*mcp.CallToolResult, error) {
+	result, _ := jsonResult(map[string]interface{}{
+		"error":             "authentication_expired",
+		"profile":           profile.Name,
+		"auth":              err.Scheme,
+		"status_code":       err.StatusCode,
+		"login_page":        err.LoginPage,
+		"relogin_attempted": err.Relogin,
+		"message":           err.Error(),
+	})
+	result.IsError = true
+	return result, nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// sessionMetabase is a fake Metabase issuing session tokens for one user and
+// accepting only the latest token it issued
+type sessionMetabase struct {
+	mu      sync.Mutex
+	session string
+	logins  int
+}
+
+func (m *sessionMetabase) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r.URL.Path == sessionLoginPath {
+		var credentials map[string]string
+		json.NewDecoder(r.Body).Decode(&credentials)
+		if credentials["username"] != "analyst@example.com" || credentials["password"] != "secret" {
+			http.Error(w, `{"errors":{"password":"did not match stored password"}}`, http.StatusUnauthorized)
+			return
+		}
+		m.logins++
+		m.session = fmt.Sprintf("session-%d", m.logins)
+		json.NewEncoder(w).Encode(map[string]string{"id": m.session})
+		return
+	}
+	if m.session == "" || r.Header.Get(sessionHeader) != m.session {
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"email": "analyst@example.com"})
+}
+
+// expire invalidates the current session, as Metabase does after its session timeout
+func (m *sessionMetabase) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.session = "expired"
+}
+
+// loginCount returns how many times the user logged in
+func (m *sessionMetabase) loginCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.logins
+}
+
+// newSessionClient returns a client logging in to a fake Metabase with password
+func newSessionClient(t *testing.T, password string) (*MetabaseClient, *sessionMetabase) {
+	t.Helper()
+	metabase := &sessionMetabase{}
+	server := httptest.NewServer(metabase)
+	t.Cleanup(server.Close)
+
+	client := NewMetabaseClient(server.URL, 1)
+	auth, err := newAuthProvider(&Profile{Username: "analyst@example.com", Password: password}, client.httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.setAuth(auth)
+	return client, metabase
+}
+
+func TestSessionAuth(t *testing.T) {
+	client, metabase := newSessionClient(t, "secret")
+	ctx := context.Background()
+	var user map[string]string
+
+	for i := 0; i < 2; i++ {
+		if err := client.Get(ctx, "/api/user/current", &user); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if logins := metabase.loginCount(); logins != 1 {
+		t.Errorf("logged in %d times for two requests, want once", logins)
+	}
+
+	// An expired session is renewed and the request retried
+	metabase.expire()
+	if err := client.Get(ctx, "/api/user/current", &user); err != nil || user["email"] != "analyst@example.com" {
+		t.Fatalf("request after expiry = %v, %v", user, err)
+	}
+	if logins := metabase.loginCount(); logins != 2 {
+		t.Errorf("logged in %d times, want a second login after expiry", logins)
+	}
+}
+
+func TestSessionAuthLoginFailure(t *testing.T) {
+	client, _ := newSessionClient(t, "wrong")
+	err := client.Get(context.Background(), "/api/user/current", &map[string]string{})
+
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.Scheme != authSession || authErr.StatusCode != http.StatusUnauthorized || authErr.Cause == nil {
+		t.Fatalf("err = %#v, want an authentication error for the failed login", err)
+	}
+	if isHostFailure(err) {
+		t.Errorf("a rejected login counts against the host")
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        bool
+		loginPage   bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, "text/plain", "Unauthenticated", true, false},
+		{"missing permissions", http.StatusForbidden, "text/plain", "You don't have permissions to do that.", false, false},
+		{"login page behind a proxy", http.StatusForbidden, "text/html", "<html><body>Sign in</body></html>", true, true},
+		{"login page without a content type", http.StatusOK, "", "  <!DOCTYPE html><html>", true, true},
+		{"data", http.StatusOK, "application/json", `{"data":{}}`, false, false},
+		{"server error page", http.StatusBadGateway, "text/html", "<html>Bad gateway</html>", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Header: http.Header{"Content-Type": {tt.contentType}}}
+			authErr := authFailure(resp, []byte(tt.body))
+			if (authErr != nil) != tt.want || authErr != nil && authErr.LoginPage != tt.loginPage {
+				t.Errorf("authFailure = %+v, want failure %v with login page %v", authErr, tt.want, tt.loginPage)
+			}
+		})
+	}
+}
+
+func TestAuthErrorResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    []string
+	}{
+		{
+			"expired cookies",
+			func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			},
+			[]string{`\"error\": \"authentication_expired\"`, `\"status_code\": 401`, `\"login_page\": false`, "refresh METABASE_COOKIES"},
+		},
+		{
+			"login page",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte("<html>Sign in to Metabase</html>"))
+			},
+			[]string{`\"error\": \"authentication_expired\"`, `\"login_page\": true`, `\"auth\": \"cookie\"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			r := newTestRegistry(Guardrails{}, nil)
+			r.config.Profiles["default"].client = NewMetabaseClient(server.URL, 1)
+			r.add(mcp.NewTool("current-user"), func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				var user map[string]interface{}
+				if err := client.Get(ctx, "/api/user/current", &user); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				return jsonResult(user)
+			})
+
+			response := callServerTool(t, r, "current-user", nil)
+			for _, want := range tt.want {
+				if !strings.Contains(response, want) {
+					t.Errorf("response %s lacks %s", response, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthSchemeFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		want    string
+		wantErr bool
+	}{
+		{"cookies", Profile{Cookies: "metabase.SESSION=abc"}, authCookie, false},
+		{"api key wins", Profile{APIKey: "mb_key", Cookies: "metabase.SESSION=abc"}, authAPIKey, false},
+		{"api key file", Profile{APIKeyFile: "/run/secrets/key"}, authAPIKey, false},
+		{"bearer token", Profile{BearerToken: "token"}, authBearer, false},
+		{"username and password", Profile{Username: "analyst", Password: "secret"}, authSession, false},
+		{"explicit scheme", Profile{Auth: authCookie, Cookies: "c", APIKey: "mb_key"}, authCookie, false},
+		{"no credentials", Profile{}, "", true},
+		{"password without username", Profile{Password: "secret"}, "", true},
+		{"scheme without its credentials", Profile{Auth: authBearer, APIKey: "mb_key"}, "", true},
+		{"unknown scheme", Profile{Auth: "kerberos", Cookies: "c"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, err := authSchemeFor(&tt.profile)
+			if scheme != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("authSchemeFor = %q, %v, want %q (error %v)", scheme, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeaderAuth(t *testing.T) {
+	tests := []struct {
+		profile Profile
+		header  string
+		value   string
+	}{
+		{Profile{Cookies: "metabase.SESSION=abc"}, "Cookie", "metabase.SESSION=abc"},
+		{Profile{APIKey: "mb_key"}, "X-API-Key", "mb_key"},
+		{Profile{BearerToken: "token"}, "Authorization", "Bearer token"},
+	}
+	for _, tt := range tests {
+		auth, err := newAuthProvider(&tt.profile, http.DefaultClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/user/current", nil)
+		if err := auth.Authenticate(context.Background(), req, "https://metabase.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get(tt.header); got != tt.value {
+			t.Errorf("%s: %s = %q, want %q", auth.Name(), tt.header, got, tt.value)
+		}
+		// Fixed credentials cannot be renewed, so rejected requests are not retried
+		if refreshed, err := auth.Refresh(context.Background(), req, "https://metabase.example.com"); refreshed || err != nil {
+			t.Errorf("%s: Refresh = %v, %v", auth.Name(), refreshed, err)
+		}
+	}
+}
+
+func TestCredentialOverride(t *testing.T) {
+	var mu sync.Mutex
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		if r.Header.Get("X-API-Key") == "revoked-key" {
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"email":"analyst@example.com"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		allow     bool
+		arguments map[string]interface{}
+		header    string
+		value     string
+		requests  int
+	}{
+		{"server credentials", true, nil, "Cookie", "metabase.SESSION=server", 1},
+		{"api key", true, map[string]interface{}{overrideAPIKeyArgument: "caller-key"}, "X-API-Key", "caller-key", 1},
+		{"session token", true, map[string]interface{}{overrideSessionArgument: "caller-session"}, sessionHeader, "caller-session", 1},
+		{"not allowed", false, map[string]interface{}{overrideAPIKeyArgument: "caller-key"}, "Cookie", "metabase.SESSION=server", 1},
+		// A caller's rejected credentials are reported without a retry
+		{"rejected", true, map[string]interface{}{overrideAPIKeyArgument: "revoked-key"}, "X-API-Key", "revoked-key", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			headers = nil
+			mu.Unlock()
+
+			client := NewMetabaseClient(server.URL, 1)
+			client.setAuth(headerAuth{name: authCookie, header: "Cookie", value: "metabase.SESSION=server"})
+			r := newTestRegistry(Guardrails{}, nil)
+			r.config.AllowCredentialOverride = tt.allow
+			r.config.Profiles["default"].client = client
+			r.add(mcp.NewTool("current-user"), func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				var user map[string]interface{}
+				if err := client.Get(ctx, "/api/user/current", &user); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				return jsonResult(user)
+			})
+			callServerTool(t, r, "current-user", tt.arguments)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(headers) != tt.requests {
+				t.Fatalf("sent %d requests, want %d", len(headers), tt.requests)
+			}
+			if got := headers[0].Get(tt.header); got != tt.value {
+				t.Errorf("%s = %q, want %q", tt.header, got, tt.value)
+			}
+			if tt.header != "Cookie" && headers[0].Get("Cookie") != "" {
+				t.Errorf("sent the server's cookies along with the caller's credentials")
+			}
+		})
+	}
+
+	redacted := redactArguments(map[string]interface{}{overrideAPIKeyArgument: "caller-key", overrideSessionArgument: "caller-session"})
+	for name, value := range redacted {
+		if value != "[redacted]" {
+			t.Errorf("audit record holds %s = %v", name, value)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+)
+
+// Ways of returning binary column values
+const (
+	binaryExclude  = "exclude"
+	binaryTruncate = "truncate"
+	binaryBase64   = "base64"
+)
+
+// binaryPreviewBytes is how many leading bytes a truncated value keeps
+const binaryPreviewBytes = 32
+
+// binaryDatabaseTypePattern matches database column types holding raw bytes
+var binaryDatabaseTypePattern = regexp.MustCompile(`(?i)^((tiny|medium|long)?blob|bytea|(var)?binary|image|bytes|(long )?raw)\b`)
+
+// BinaryColumnNote describes how a binary column of a result was handled
+type BinaryColumnNote struct {
+	Name     string `json:"name"`
+	Handling string `json:"handling"`
+	MaxBytes int    `json:"max_bytes"`
+}
+
+// isBinaryColumn reports whether a result column holds raw bytes
+func isBinaryColumn(col Column) bool {
+	return binaryDatabaseTypePattern.MatchString(col.DatabaseType)
+}
+
+// handleBinaryColumns rewrites the binary columns of data according to mode:
+// excluded from the result (the default), truncated to a hex preview with the
+// size, or encoded as base64. It returns a note for each binary column.
+func handleBinaryColumns(data *MetabaseData, mode string) []BinaryColumnNote {
+	var notes []BinaryColumnNote
+	excluded := make(map[int]bool)
+	for i, col := range data.Cols {
+		if !isBinaryColumn(col) {
+			continue
+		}
+		note := BinaryColumnNote{Name: col.Name, Handling: mode}
+		for _, row := range data.Rows {
+			if i >= len(row) || row[i] == nil {
+				continue
+			}
+			value := binaryValue(row[i])
+			if len(value) > note.MaxBytes {
+				note.MaxBytes = len(value)
+			}
+			switch mode {
+			case binaryBase64:
+				row[i] = base64.StdEncoding.EncodeToString(value)
+			case binaryTruncate:
+				row[i] = truncateBinary(value)
+			}
+		}
+		if mode != binaryBase64 && mode != binaryTruncate {
+			note.Handling = binaryExclude
+			excluded[i] = true
+		}
+		notes = append(notes, note)
+	}
+
+	if len(excluded) > 0 {
+		cols := make([]Column, 0, len(data.Cols)-len(excluded))
+		for i, col := range data.Cols {
+			if !excluded[i] {
+				cols = append(cols, col)
+			}
+		}
+		data.Cols = cols
+		for r, row := range data.Rows {
+			kept := make([]interface{}, 0, len(cols))
+			for i, v := range row {
+				if !excluded[i] {
+					kept = append(kept, v)
+				}
+			}
+			data.Rows[r] = kept
+		}
+	}
+	return notes
+}
+
+// binaryValue returns the bytes of a binary value as Metabase serializes it:
+// a base64 string, a plain string or an array of byte values
+func binaryValue(v interface{}) []byte {
+	switch value := v.(type) {
+	case string:
+		if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+			return decoded
+		}
+		return []byte(value)
+	case []interface{}:
+		bytes := make([]byte, 0, len(value))
+		for _, b := range value {
+			if n, ok := b.(float64); ok {
+				bytes = append(bytes, byte(n))
+			}
+		}
+		return bytes
+	default:
+		return []byte(fmt.Sprint(value))
+	}
+}
+
+// truncateBinary formats the leading bytes of value as hex with a size note
+func truncateBinary(value []byte) string {
+	if len(value) <= binaryPreviewBytes {
+		return fmt.Sprintf("0x%x (%d bytes)", value, len(value))
+	}
+	return fmt.Sprintf("0x%x... (%d bytes, truncated)", value[:binaryPreviewBytes], len(value))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// binaryData is a result with an id column and a bytea column
+func binaryData() MetabaseData {
+	return MetabaseData{
+		Cols: []Column{{Name: "id", DatabaseType: "int4"}, {Name: "payload", DatabaseType: "bytea"}},
+		Rows: [][]interface{}{
+			{1.0, "3q2+7w=="},
+			{2.0, nil},
+			{3.0, []interface{}{1.0, 2.0}},
+		},
+	}
+}
+
+func TestHandleBinaryColumns(t *testing.T) {
+	tests := []struct {
+		mode     string
+		handling string
+		cols     int
+		values   []interface{}
+	}{
+		{"", binaryExclude, 1, nil},
+		{binaryExclude, binaryExclude, 1, nil},
+		{binaryTruncate, binaryTruncate, 2, []interface{}{"0xdeadbeef (4 bytes)", nil, "0x0102 (2 bytes)"}},
+		{binaryBase64, binaryBase64, 2, []interface{}{"3q2+7w==", nil, "AQI="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handling+"/"+tt.mode, func(t *testing.T) {
+			data := binaryData()
+			notes := handleBinaryColumns(&data, tt.mode)
+			if want := []BinaryColumnNote{{Name: "payload", Handling: tt.handling, MaxBytes: 4}}; !reflect.DeepEqual(notes, want) {
+				t.Errorf("notes = %+v, want %+v", notes, want)
+			}
+			if len(data.Cols) != tt.cols {
+				t.Fatalf("cols = %+v", data.Cols)
+			}
+			for i, row := range data.Rows {
+				if len(row) != tt.cols {
+					t.Fatalf("row %d = %v", i, row)
+				}
+				if tt.values != nil && row[1] != tt.values[i] {
+					t.Errorf("row %d value = %v, want %v", i, row[1], tt.values[i])
+				}
+			}
+		})
+	}
+
+	data := MetabaseData{Cols: []Column{{Name: "id", DatabaseType: "int4"}}, Rows: [][]interface{}{{1.0}}}
+	if notes := handleBinaryColumns(&data, binaryExclude); notes != nil || len(data.Rows[0]) != 1 {
+		t.Errorf("result without binary columns: notes %v, rows %v", notes, data.Rows)
+	}
+}
+
+func TestIsBinaryColumn(t *testing.T) {
+	for databaseType, want := range map[string]bool{
+		"bytea": true, "BLOB": true, "longblob": true, "VARBINARY(16)": true, "RAW": true, "long raw": true,
+		"varchar": false, "binary_float": false, "text": false, "": false,
+	} {
+		if got := isBinaryColumn(Column{DatabaseType: databaseType}); got != want {
+			t.Errorf("isBinaryColumn(%q) = %v, want %v", databaseType, got, want)
+		}
+	}
+}
+
+func TestTruncateBinary(t *testing.T) {
+	long := truncateBinary(make([]byte, binaryPreviewBytes+1))
+	if !strings.HasPrefix(long, "0x"+strings.Repeat("00", binaryPreviewBytes)+"...") || !strings.HasSuffix(long, "(33 bytes, truncated)") {
+		t.Errorf("truncateBinary = %q", long)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// circuitBreaker stops sending requests to an unhealthy Metabase host after
+// repeated failures, letting a single trial request through once the cooldown
+// passes
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	lastError string
+	// probe is the ticket of the trial request running in the half-open
+	// state, or 0; probes counts the tickets handed out
+	probe  uint64
+	probes uint64
+}
+
+// newCircuitBreaker creates a breaker opening after threshold consecutive failures
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: circuitClosed}
+}
+
+// allow reports whether a request may be sent to the host, and returns the
+// ticket its outcome is recorded with. Once the cooldown has passed, one
+// caller is admitted as the trial request; the others are refused until its
+// outcome is recorded.
+func (b *circuitBreaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitClosed:
+		return 0, true
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return 0, false
+		}
+		b.state = circuitHalfOpen
+	}
+	if b.probe != 0 {
+		return 0, false
+	}
+	b.probes++
+	b.probe = b.probes
+	return b.probe, true
+}
+
+// closed reports whether the host is considered healthy, without taking the
+// place of a trial request
+func (b *circuitBreaker) closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == circuitClosed
+}
+
+// record updates the breaker with the outcome of a request admitted with
+// ticket. While half-open only the trial request counts: requests sent before
+// the breaker opened say nothing about whether the host has recovered.
+func (b *circuitBreaker) record(ticket uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		if ticket == 0 || ticket != b.probe {
+			return
+		}
+		b.probe = 0
+		// A trial request cancelled by its caller says nothing about the host
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+	}
+	b.apply(err)
+}
+
+// recordHealth updates the breaker with the outcome of a health check, which
+// decides the state whatever requests are running
+func (b *circuitBreaker) recordHealth(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probe = 0
+	b.apply(err)
+}
+
+// apply moves the breaker on the outcome of a request. The caller holds b.mu.
+func (b *circuitBreaker) apply(err error) {
+	if !isHostFailure(err) {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// status reports the breaker state for health output
+func (b *circuitBreaker) status() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := map[string]interface{}{
+		"state":                b.state,
+		"consecutive_failures": b.failures,
+	}
+	if b.lastError != "" {
+		status["last_error"] = b.lastError
+	}
+	if b.state == circuitOpen {
+		status["retry_after"] = b.openedAt.Add(b.cooldown).UTC().Format(time.RFC3339)
+	}
+	return status
+}
+
+// isHostFailure reports whether err indicates the host itself is unhealthy:
+// a transport error or a 5xx response, but not a cancelled call, a client
+// error or rejected credentials
+func isHostFailure(err error) bool {
+	var authErr *AuthError
+	if err == nil || errors.Is(err, context.Canceled) || errors.As(err, &authErr) {
+		return false
+	}
+	// A timeout the caller chose says nothing about the host
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) && timeoutErr.PerCall {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return true
+}
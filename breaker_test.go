@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	hostDown := errors.New("connection refused")
+	type step struct {
+		action string // "allow", "closed", "record", "health" or "wait"
+		ticket string // name under which allow keeps its ticket, and record uses it
+		err    error  // outcome passed to record or health
+		want   bool   // result of allow or closed
+		state  string // state after the step
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"closed allows requests", []step{
+			{action: "allow", want: true, state: circuitClosed},
+			{action: "allow", want: true, state: circuitClosed},
+			{action: "closed", want: true, state: circuitClosed},
+		}},
+		{"opens at the threshold", []step{
+			{action: "record", err: hostDown, state: circuitClosed},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "allow", want: false, state: circuitOpen},
+			{action: "closed", want: false, state: circuitOpen},
+		}},
+		{"success resets failures", []step{
+			{action: "record", err: hostDown, state: circuitClosed},
+			{action: "record", state: circuitClosed},
+			{action: "record", err: hostDown, state: circuitClosed},
+		}},
+		{"client errors do not count", []step{
+			{action: "record", err: &APIError{StatusCode: 404}, state: circuitClosed},
+			{action: "record", err: &APIError{StatusCode: 400}, state: circuitClosed},
+			{action: "record", err: context.Canceled, state: circuitClosed},
+			{action: "record", err: &APIError{StatusCode: 502}, state: circuitClosed},
+			{action: "record", err: &APIError{StatusCode: 503}, state: circuitOpen},
+		}},
+		{"half-open admits a single probe", []step{
+			{action: "record", err: hostDown, state: circuitClosed},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "closed", want: false, state: circuitOpen},
+			{action: "allow", ticket: "probe", want: true, state: circuitHalfOpen},
+			{action: "allow", want: false, state: circuitHalfOpen},
+			{action: "allow", want: false, state: circuitHalfOpen},
+		}},
+		{"successful probe closes", []step{
+			{action: "record", err: hostDown},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "allow", ticket: "probe", want: true, state: circuitHalfOpen},
+			{action: "record", ticket: "probe", state: circuitClosed},
+			{action: "allow", want: true, state: circuitClosed},
+			{action: "allow", want: true, state: circuitClosed},
+		}},
+		{"failed probe reopens", []step{
+			{action: "record", err: hostDown},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "allow", ticket: "probe", want: true, state: circuitHalfOpen},
+			{action: "record", ticket: "probe", err: hostDown, state: circuitOpen},
+			{action: "allow", want: false, state: circuitOpen},
+		}},
+		{"cancelled probe is retried", []step{
+			{action: "record", err: hostDown},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "allow", ticket: "probe", want: true, state: circuitHalfOpen},
+			{action: "record", ticket: "probe", err: context.Canceled, state: circuitHalfOpen},
+			{action: "allow", ticket: "retry", want: true, state: circuitHalfOpen},
+			{action: "allow", want: false, state: circuitHalfOpen},
+			{action: "record", ticket: "retry", state: circuitClosed},
+		}},
+		{"requests sent before the breaker opened do not end the probe", []step{
+			{action: "allow", ticket: "early", want: true, state: circuitClosed},
+			{action: "record", err: hostDown},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "allow", ticket: "probe", want: true, state: circuitHalfOpen},
+			{action: "record", ticket: "early", state: circuitHalfOpen},
+			{action: "allow", want: false, state: circuitHalfOpen},
+			{action: "record", ticket: "probe", state: circuitClosed},
+		}},
+		{"stale probe does not end a later probe", []step{
+			{action: "record", err: hostDown},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "allow", ticket: "first", want: true, state: circuitHalfOpen},
+			{action: "health", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "allow", ticket: "second", want: true, state: circuitHalfOpen},
+			{action: "record", ticket: "first", state: circuitHalfOpen},
+			{action: "allow", want: false, state: circuitHalfOpen},
+		}},
+		{"health check decides while half-open", []step{
+			{action: "record", err: hostDown},
+			{action: "record", err: hostDown, state: circuitOpen},
+			{action: "wait", state: circuitOpen},
+			{action: "allow", ticket: "probe", want: true, state: circuitHalfOpen},
+			{action: "health", state: circuitClosed},
+			{action: "allow", want: true, state: circuitClosed},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(2, time.Hour)
+			tickets := make(map[string]uint64)
+			for i, s := range tt.steps {
+				switch s.action {
+				case "allow":
+					ticket, ok := b.allow()
+					if ok != s.want {
+						t.Fatalf("step %d: allow() = %v, want %v", i, ok, s.want)
+					}
+					if s.ticket != "" {
+						tickets[s.ticket] = ticket
+					}
+				case "closed":
+					if got := b.closed(); got != s.want {
+						t.Fatalf("step %d: closed() = %v, want %v", i, got, s.want)
+					}
+				case "record":
+					b.record(tickets[s.ticket], s.err)
+				case "health":
+					b.recordHealth(s.err)
+				case "wait":
+					// Pretend the cooldown has passed
+					b.openedAt = b.openedAt.Add(-b.cooldown)
+				}
+				if s.state != "" && b.state != s.state {
+					t.Fatalf("step %d (%s): state = %q, want %q", i, s.action, b.state, s.state)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Card represents a saved Metabase question as returned by the card API
+type Card struct {
+	ID                int                `json:"id"`
+	Name              string             `json:"name"`
+	Description       *string            `json:"description"`
+	CollectionID      *int               `json:"collection_id"`
+	DatabaseID        int                `json:"database_id"`
+	TableID           *int               `json:"table_id"`
+	QueryType         string             `json:"query_type"`
+	Display           string             `json:"display"`
+	Archived          bool               `json:"archived"`
+	ViewCount         int                `json:"view_count"`
+	LastUsedAt        *string            `json:"last_used_at"`
+	Parameters        []Parameter        `json:"parameters"`
+	ModerationReviews []ModerationReview `json:"moderation_reviews"`
+
+	// Type is question, model or metric on Metabase versions with models
+	Type         string          `json:"type"`
+	DatasetQuery json.RawMessage `json:"dataset_query"`
+	CreatorID    int             `json:"creator_id"`
+	Creator      *CardCreator    `json:"creator"`
+
+	VisualizationSettings map[string]interface{} `json:"visualization_settings"`
+	ResultMetadata        []ResultColumn         `json:"result_metadata"`
+	CollectionPosition    *int                   `json:"collection_position"`
+}
+
+// ResultColumn describes a column of a card's result, as saved with the card
+type ResultColumn struct {
+	ID           *int    `json:"id"`
+	Name         string  `json:"name"`
+	DisplayName  string  `json:"display_name"`
+	BaseType     string  `json:"base_type"`
+	SemanticType *string `json:"semantic_type"`
+	Description  *string `json:"description"`
+}
+
+// CardCreator is the user who created a card, as hydrated by the card API
+type CardCreator struct {
+	ID         int    `json:"id"`
+	CommonName string `json:"common_name"`
+	Email      string `json:"email"`
+}
+
+// ModerationReview represents a verification review attached to a card
+type ModerationReview struct {
+	Status      *string `json:"status"`
+	MostRecent  bool    `json:"most_recent"`
+	ModeratorID int     `json:"moderator_id"`
+	Text        *string `json:"text"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// Verified reports whether the card's most recent moderation review marks it verified
+func (c Card) Verified() bool {
+	for _, review := range c.ModerationReviews {
+		if review.MostRecent && review.Status != nil && *review.Status == "verified" {
+			return true
+		}
+	}
+	return false
+}
+
+// createdBy reports whether the card's creator has the given user ID or
+// email, or a name containing it, matched in lowercase
+func (c Card) createdBy(creator string) bool {
+	if id, err := strconv.Atoi(creator); err == nil {
+		return c.CreatorID == id
+	}
+	if c.Creator == nil {
+		return false
+	}
+	return strings.ToLower(c.Creator.Email) == creator || strings.Contains(strings.ToLower(c.Creator.CommonName), creator)
+}
+
+// Revision is a saved change to a card, as returned by /api/revision
+type Revision struct {
+	ID          int           `json:"id"`
+	Timestamp   string        `json:"timestamp"`
+	Description *string       `json:"description"`
+	Message     *string       `json:"message"`
+	IsCreation  bool          `json:"is_creation"`
+	IsReversion bool          `json:"is_reversion"`
+	User        *CardCreator  `json:"user"`
+	Diff        *RevisionDiff `json:"diff"`
+}
+
+// RevisionDiff holds the fields a revision changed, with their values before and after
+type RevisionDiff struct {
+	Before map[string]json.RawMessage `json:"before"`
+	After  map[string]json.RawMessage `json:"after"`
+}
+
+// nativeQueryOf returns the SQL and template tags of a card's dataset query,
+// from the legacy {"native": {...}} form or the first stage of the pMBQL form.
+// It reports false for cards that are not SQL questions.
+func nativeQueryOf(datasetQuery json.RawMessage) (NativeQuery, bool) {
+	var query struct {
+		Type   string       `json:"type"`
+		Native *NativeQuery `json:"native"`
+		Stages []struct {
+			Native       *string                `json:"native"`
+			TemplateTags map[string]interface{} `json:"template-tags"`
+		} `json:"stages"`
+	}
+	if json.Unmarshal(datasetQuery, &query) != nil {
+		return NativeQuery{}, false
+	}
+	if query.Type == "native" && query.Native != nil {
+		return *query.Native, true
+	}
+	if len(query.Stages) > 0 && query.Stages[0].Native != nil {
+		return NativeQuery{Query: *query.Stages[0].Native, TemplateTags: query.Stages[0].TemplateTags}, true
+	}
+	return NativeQuery{}, false
+}
+
+// listCards fetches all cards visible to the client
+func listCards(ctx context.Context, client *MetabaseClient) ([]Card, error) {
+	var cards []Card
+	if err := client.Get(ctx, "/api/card?f=all", &cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// getCard fetches a single card by ID
+func getCard(ctx context.Context, client *MetabaseClient, cardID int) (Card, error) {
+	var card Card
+	err := client.Get(ctx, fmt.Sprintf("/api/card/%d", cardID), &card)
+	return card, err
+}
+
+// runCard executes a saved question and returns its results
+func runCard(ctx context.Context, client *MetabaseClient, cardID int, parameters []interface{}) (MetabaseResponse, error) {
+	var resp MetabaseResponse
+	if err := checkCardAccess(ctx, client, cardID); err != nil {
+		return resp, err
+	}
+	if parameters == nil {
+		parameters = make([]interface{}, 0)
+	}
+	respBody, err := client.Query(ctx, fmt.Sprintf("/api/card/%d/query", cardID), map[string]interface{}{"parameters": parameters})
+	if err != nil {
+		return resp, err
+	}
+	err = json.Unmarshal(respBody, &resp)
+	return resp, err
+}
+
+// checkCardAccess rejects cards querying databases or schemas outside the
+// profile's database policy or the calling client's scope
+func checkCardAccess(ctx context.Context, client *MetabaseClient, cardID int) error {
+	if profile := profileFromContext(ctx); clientAccessFromContext(ctx) == nil && (profile == nil || !profile.restrictsDatabases()) {
+		return nil
+	}
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return err
+	}
+	return checkCardQueryAccess(ctx, client, card)
+}
+
+// checkCardQueryAccess rejects a card reading databases or schemas outside
+// the profile's database policy or the calling client's scope, looking up the
+// schema of the source table of MBQL questions
+func checkCardQueryAccess(ctx context.Context, client *MetabaseClient, card Card) error {
+	return checkCardTables(ctx, card, func(tableID int) (string, error) {
+		var table MetabaseTable
+		if err := client.Get(ctx, fmt.Sprintf("/api/table/%d", tableID), &table); err != nil {
+			return "", fmt.Errorf("failed to fetch table %d: %w", tableID, err)
+		}
+		return table.Schema, nil
+	})
+}
+
+// checkCardTables checks what a card reads: every table in the SQL of native
+// questions, and the schema of the source table, given by tableSchema, of MBQL
+// questions. When schemas are restricted, questions without a source table,
+// such as those based on other questions, are refused.
+func checkCardTables(ctx context.Context, card Card, tableSchema func(tableID int) (string, error)) error {
+	if native, ok := nativeQueryOf(card.DatasetQuery); ok {
+		return checkQueryAccess(ctx, card.DatabaseID, native.Query)
+	}
+	if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+		return err
+	}
+	access := clientAccessFromContext(ctx)
+	if access == nil || len(access.Schemas) == 0 {
+		return nil
+	}
+	if card.TableID == nil {
+		return fmt.Errorf("%w: client %s may not use card %d, since the tables it reads cannot be checked", errAccessDenied, access.Name, card.ID)
+	}
+	schema, err := tableSchema(*card.TableID)
+	if err != nil {
+		return err
+	}
+	return checkTableAccess(ctx, card.DatabaseID, schema)
+}
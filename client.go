@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetabaseClient performs authenticated requests against the Metabase REST API
+type MetabaseClient struct {
+	host         string
+	failoverHost string
+	auth         AuthProvider
+	httpClient   *http.Client
+	queue        *queryQueue
+	breaker      *circuitBreaker
+	metadata     *metadataCache
+	flights      *flightGroup
+
+	mu           sync.Mutex
+	reconnecting bool
+	timeout      time.Duration
+}
+
+// APIError represents a non-successful response from the Metabase API
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("metabase returned %s: %s", e.Status, e.Body)
+}
+
+// NewMetabaseClient creates a client for the given Metabase host, running at
+// most maxConcurrentQueries queries at a time. Requests are sent without
+// credentials until an AuthProvider is set with setAuth.
+func NewMetabaseClient(host string, maxConcurrentQueries int) *MetabaseClient {
+	return &MetabaseClient{
+		host:       strings.TrimRight(host, "/"),
+		auth:       headerAuth{name: authCookie, header: "Cookie"},
+		httpClient: &http.Client{},
+		queue:      newQueryQueue(maxConcurrentQueries),
+		breaker:    newCircuitBreaker(5, 30*time.Second),
+		flights:    newFlightGroup(),
+		timeout:    120 * time.Second,
+	}
+}
+
+// setTimeout limits how long a request to Metabase may take. It may be
+// changed while requests are running; they keep their original limit.
+func (c *MetabaseClient) setTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = timeout
+}
+
+type timeoutKey struct{}
+
+// withRequestTimeout overrides the request timeout for requests made with ctx
+func withRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// requestTimeout returns the request timeout attached to ctx, or else the
+// client's, and whether it was set for the call
+func (c *MetabaseClient) requestTimeout(ctx context.Context) (time.Duration, bool) {
+	if timeout, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		return timeout, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.timeout, false
+}
+
+// withTimeout bounds ctx by the request timeout
+func (c *MetabaseClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout, _ := c.requestTimeout(ctx)
+	return context.WithTimeout(ctx, timeout)
+}
+
+// TimeoutError reports a request to Metabase that ran out of time
+type TimeoutError struct {
+	Timeout time.Duration
+	// PerCall is set when the timeout came from the call's timeout_seconds
+	PerCall bool
+	Cause   error
+}
+
+func (e *TimeoutError) Error() string {
+	hint := "raise METABASE_TIMEOUT or pass timeout_seconds"
+	if e.PerCall {
+		hint = "pass a larger timeout_seconds"
+	}
+	return fmt.Sprintf("request timed out after %s; %s", e.Timeout, hint)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Cause
+}
+
+// setAuth sets the provider authenticating requests to Metabase. It may be
+// replaced while requests are running; the provider it replaces is closed.
+func (c *MetabaseClient) setAuth(auth AuthProvider) {
+	c.mu.Lock()
+	previous := c.auth
+	c.auth = auth
+	c.mu.Unlock()
+	closeAuth(previous)
+}
+
+// authProvider returns the provider authenticating requests to Metabase
+func (c *MetabaseClient) authProvider() AuthProvider {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.auth
+}
+
+// setFailoverHost configures a standby host serving read-only requests while
+// the primary host is unhealthy
+func (c *MetabaseClient) setFailoverHost(host string) {
+	c.failoverHost = strings.TrimRight(host, "/")
+}
+
+// Do sends a request to the Metabase API and returns the raw response body.
+// A non-nil body is encoded as JSON.
+func (c *MetabaseClient) Do(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	payload, contentType, err := encodeJSONBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, path, contentType, payload, method == http.MethodGet)
+}
+
+// Query posts a query execution request, waiting for a slot in the query queue
+// according to the priority attached to ctx. Identical concurrent queries are
+// coalesced into one request. Queries are read-only, so they may be served by
+// the failover host.
+func (c *MetabaseClient) Query(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	switch query := body.(type) {
+	case MetabaseQuery:
+		if err := checkQueryAccess(ctx, query.Database, query.Native.Query); err != nil {
+			return nil, err
+		}
+	case StructuredQuery:
+		if err := checkDatabaseAccess(ctx, query.Database); err != nil {
+			return nil, err
+		}
+	}
+
+	payload, contentType, err := encodeJSONBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	run := func() ([]byte, error) {
+		release, err := c.queue.acquire(ctx, priorityFromContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("query cancelled while queued: %w", err)
+		}
+		defer release()
+
+		return c.send(ctx, http.MethodPost, path, contentType, payload, true)
+	}
+	if c.flights == nil {
+		return run()
+	}
+	// Calls with their own credentials only share results with the same credentials
+	key := path + "\x00" + string(payload)
+	if override := credentialOverrideFromContext(ctx); override != nil {
+		key += "\x00" + hashBody([]byte(override.value))
+	}
+	return c.flights.do(ctx, key, run)
+}
+
+// Export runs query through Metabase's export endpoint and streams the file
+// in the given format (csv, json or xlsx) to w as it arrives, returning its
+// size. Exports wait in the query queue like other queries.
+func (c *MetabaseClient) Export(ctx context.Context, format string, query MetabaseQuery, w io.Writer) (int64, error) {
+	if err := checkQueryAccess(ctx, query.Database, query.Native.Query); err != nil {
+		return 0, err
+	}
+	encoded, err := json.Marshal(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode request: %w", err)
+	}
+	return c.export(ctx, "/api/dataset/"+format, url.Values{"query": {string(encoded)}}, w)
+}
+
+// ExportCard runs a saved question through Metabase's export endpoint with
+// the given parameter values and streams the file in the given format to w,
+// returning its size
+func (c *MetabaseClient) ExportCard(ctx context.Context, cardID int, format string, parameters []interface{}, w io.Writer) (int64, error) {
+	if err := checkCardAccess(ctx, c, cardID); err != nil {
+		return 0, err
+	}
+	if parameters == nil {
+		parameters = make([]interface{}, 0)
+	}
+	encoded, err := json.Marshal(parameters)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode request: %w", err)
+	}
+	return c.export(ctx, fmt.Sprintf("/api/card/%d/query/%s", cardID, format), url.Values{"parameters": {string(encoded)}}, w)
+}
+
+// export posts form to an export endpoint and streams the response to w once
+// the query queue admits it
+func (c *MetabaseClient) export(ctx context.Context, path string, form url.Values, w io.Writer) (int64, error) {
+	release, err := c.queue.acquire(ctx, priorityFromContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("export cancelled while queued: %w", err)
+	}
+	defer release()
+	sink := &responseSink{w: w}
+	_, err = c.send(context.WithValue(ctx, responseSinkKey{}, sink), http.MethodPost, path, "application/x-www-form-urlencoded", []byte(form.Encode()), true)
+	return sink.written, err
+}
+
+type responseSinkKey struct{}
+
+// responseSink receives the body of a successful response in place of a
+// buffer. It counts what it was given, since a request whose response was
+// partly written cannot be retried.
+type responseSink struct {
+	w       io.Writer
+	written int64
+}
+
+func (s *responseSink) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+// responseSinkFromContext returns the sink attached to ctx, if any
+func responseSinkFromContext(ctx context.Context) *responseSink {
+	sink, _ := ctx.Value(responseSinkKey{}).(*responseSink)
+	return sink
+}
+
+// encodeJSONBody encodes a non-nil request body as JSON
+func encodeJSONBody(body interface{}) ([]byte, string, error) {
+	if body == nil {
+		return nil, "", nil
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	return payload, "application/json", nil
+}
+
+// PostMultipart uploads a file along with form fields and decodes the JSON response into out, if non-nil
+func (c *MetabaseClient) PostMultipart(ctx context.Context, path string, fields map[string]string, fileField, fileName string, file io.Reader, out interface{}) error {
+	var payload bytes.Buffer
+	writer := multipart.NewWriter(&payload)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return fmt.Errorf("failed to encode form field: %w", err)
+		}
+	}
+	part, err := writer.CreateFormFile(fileField, fileName)
+	if err != nil {
+		return fmt.Errorf("failed to encode file: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("failed to encode file: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to encode file: %w", err)
+	}
+
+	respBody, err := c.send(ctx, http.MethodPost, path, writer.FormDataContentType(), payload.Bytes(), false)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// send performs the request against the primary host, routing read-only
+// requests to the failover host while the primary is unhealthy
+func (c *MetabaseClient) send(ctx context.Context, method, path, contentType string, body []byte, readOnly bool) ([]byte, error) {
+	canFailover := readOnly && c.failoverHost != ""
+	ticket, ok := c.breaker.allow()
+	if !ok {
+		if canFailover {
+			return c.sendTo(ctx, c.failoverHost, method, path, contentType, body)
+		}
+		return nil, fmt.Errorf("metabase at %s is unavailable after repeated failures, try again later", c.host)
+	}
+
+	respBody, err := c.sendTo(ctx, c.host, method, path, contentType, body)
+	c.breaker.record(ticket, err)
+	if sink := responseSinkFromContext(ctx); sink != nil && sink.written > 0 {
+		canFailover = false
+	}
+	if canFailover && isHostFailure(err) {
+		return c.sendTo(ctx, c.failoverHost, method, path, contentType, body)
+	}
+	return respBody, err
+}
+
+// disableCoalescing sends every query request separately, even when an
+// identical one is already in flight
+func (c *MetabaseClient) disableCoalescing() {
+	c.flights = nil
+}
+
+// setTransport replaces the transport used for requests to Metabase
+func (c *MetabaseClient) setTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+}
+
+// setMetadataCache configures the cache serving metadata while Metabase is unreachable
+func (c *MetabaseClient) setMetadataCache(cache *metadataCache) {
+	c.metadata = cache
+}
+
+// activeHost returns the host currently serving read-only requests
+func (c *MetabaseClient) activeHost() string {
+	if c.failoverHost != "" && !c.breaker.closed() {
+		return c.failoverHost
+	}
+	return c.host
+}
+
+// sendTo performs the HTTP request against host and returns the body of a
+// successful response. When Metabase rejects the credentials, the auth
+// provider is asked to renew them and the request is retried once.
+// Authentication failures that remain are returned as an *AuthError.
+func (c *MetabaseClient) sendTo(ctx context.Context, host, method, path, contentType string, body []byte) ([]byte, error) {
+	respBody, req, err := c.sendOnce(ctx, host, method, path, contentType, body)
+	var authErr *AuthError
+	if errors.As(err, &authErr) && req != nil && credentialOverrideFromContext(ctx) == nil {
+		refreshCtx, cancel := c.withTimeout(ctx)
+		refreshed, refreshErr := c.authProvider().Refresh(refreshCtx, req, host)
+		cancel()
+		switch {
+		case refreshErr != nil:
+			authErr.Relogin, authErr.Cause = true, refreshErr
+		case refreshed:
+			respBody, _, err = c.sendOnce(ctx, host, method, path, contentType, body)
+			if errors.As(err, &authErr) {
+				authErr.Relogin = true
+			}
+		}
+	}
+	if errors.As(err, &authErr) {
+		recordAuthFailure(ctx, authErr)
+	}
+	return respBody, err
+}
+
+// sendOnce performs a single HTTP request authenticated by the auth provider,
+// returning the request so a rejected one can be renewed
+func (c *MetabaseClient) sendOnce(ctx context.Context, host, method, path, contentType string, body []byte) ([]byte, *http.Request, error) {
+	parent := ctx
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, host+path, reqBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	auth := c.authProvider()
+	scheme := auth.Name()
+	if override := credentialOverrideFromContext(ctx); override != nil {
+		scheme = override.scheme
+		req.Header.Set(override.header, override.value)
+	} else if err := auth.Authenticate(ctx, req, host); err != nil {
+		return nil, nil, loginError(err, scheme)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+			timeout, perCall := c.requestTimeout(parent)
+			return nil, req, &TimeoutError{Timeout: timeout, PerCall: perCall, Cause: err}
+		}
+		return nil, req, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A successful response to a streamed request goes straight to its sink,
+	// once its start shows it is not a login page
+	if sink := responseSinkFromContext(ctx); sink != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		body := bufio.NewReader(resp.Body)
+		start, _ := body.Peek(64)
+		if authErr := authFailure(resp, start); authErr != nil {
+			authErr.Scheme = scheme
+			return nil, req, authErr
+		}
+		if _, err := io.Copy(sink, body); err != nil {
+			return nil, req, fmt.Errorf("failed to stream response: %w", err)
+		}
+		return nil, req, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, req, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if authErr := authFailure(resp, respBody); authErr != nil {
+		authErr.Scheme = scheme
+		return nil, req, authErr
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, req, &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+	}
+
+	return respBody, req, nil
+}
+
+// Get fetches path and decodes the JSON response into out
+func (c *MetabaseClient) Get(ctx context.Context, path string, out interface{}) error {
+	return c.doJSON(ctx, http.MethodGet, path, nil, out)
+}
+
+// Post sends body to path and decodes the JSON response into out, if non-nil
+func (c *MetabaseClient) Post(ctx context.Context, path string, body, out interface{}) error {
+	return c.doJSON(ctx, http.MethodPost, path, body, out)
+}
+
+// Put sends body to path and decodes the JSON response into out, if non-nil
+func (c *MetabaseClient) Put(ctx context.Context, path string, body, out interface{}) error {
+	return c.doJSON(ctx, http.MethodPut, path, body, out)
+}
+
+// Delete sends a DELETE request to path
+func (c *MetabaseClient) Delete(ctx context.Context, path string) error {
+	return c.doJSON(ctx, http.MethodDelete, path, nil, nil)
+}
+
+func (c *MetabaseClient) doJSON(ctx context.Context, method, path string, body, out interface{}) error {
+	respBody, err := c.Do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
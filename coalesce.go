@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// flightCall is a query request in flight, shared by every identical caller
+type flightCall struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// flightGroup coalesces identical concurrent query requests into a single
+// Metabase request whose result is shared by all callers
+type flightGroup struct {
+	mu        sync.Mutex
+	calls     map[string]*flightCall
+	coalesced int
+}
+
+// newFlightGroup creates an empty flight group
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// do runs fn for key unless an identical call is already in flight, in which
+// case it waits for that call's result. A waiting caller gives up when its own
+// context is cancelled, and runs the request itself when the shared call was
+// cancelled by the caller that started it.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	for {
+		call, ok := g.calls[key]
+		if !ok {
+			break
+		}
+		g.coalesced++
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			if !errors.Is(call.err, context.Canceled) && !errors.Is(call.err, context.DeadlineExceeded) {
+				return call.body, call.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		g.mu.Lock()
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.body, call.err = fn()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+
+	return call.body, call.err
+}
+
+// stats reports how many calls are in flight and how many were coalesced
+func (g *flightGroup) stats() map[string]int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return map[string]int{
+		"in_flight": len(g.calls),
+		"coalesced": g.coalesced,
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForFlights polls the group until check holds for its stats
+func waitForFlights(t *testing.T, g *flightGroup, check func(stats map[string]int) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check(g.stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("flight stats = %v", g.stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// flightResult is the outcome of one flightGroup.do call
+type flightResult struct {
+	body []byte
+	err  error
+}
+
+func TestFlightGroupSharesResult(t *testing.T) {
+	g := newFlightGroup()
+	var runs int32
+	release := make(chan struct{})
+	fn := func() ([]byte, error) {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return []byte("rows"), nil
+	}
+
+	results := make(chan flightResult, 2)
+	do := func() {
+		body, err := g.do(context.Background(), "query", fn)
+		results <- flightResult{body, err}
+	}
+	go do()
+	waitForFlights(t, g, func(stats map[string]int) bool { return stats["in_flight"] == 1 })
+	go do()
+	waitForFlights(t, g, func(stats map[string]int) bool { return stats["coalesced"] == 1 })
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if r := <-results; string(r.body) != "rows" || r.err != nil {
+			t.Errorf("caller %d got %q, %v", i, r.body, r.err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("ran the request %d times, want once", runs)
+	}
+	if stats := g.stats(); stats["in_flight"] != 0 {
+		t.Errorf("stats = %v, want nothing in flight", stats)
+	}
+
+	// Once finished, the same request runs again
+	if _, err := g.do(context.Background(), "query", fn); err != nil || runs != 2 {
+		t.Errorf("repeated request: runs = %d, err = %v", runs, err)
+	}
+}
+
+func TestFlightGroupCancellation(t *testing.T) {
+	g := newFlightGroup()
+	release := make(chan struct{})
+	leader := make(chan flightResult, 1)
+	go func() {
+		body, err := g.do(context.Background(), "query", func() ([]byte, error) {
+			<-release
+			return nil, context.Canceled
+		})
+		leader <- flightResult{body, err}
+	}()
+	waitForFlights(t, g, func(stats map[string]int) bool { return stats["in_flight"] == 1 })
+
+	// A waiter whose own context ends gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.do(ctx, "query", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled waiter: err = %v", err)
+	}
+
+	// A waiter whose leader was cancelled runs the request itself
+	follower := make(chan flightResult, 1)
+	go func() {
+		body, err := g.do(context.Background(), "query", func() ([]byte, error) { return []byte("rows"), nil })
+		follower <- flightResult{body, err}
+	}()
+	waitForFlights(t, g, func(stats map[string]int) bool { return stats["coalesced"] == 2 })
+	close(release)
+
+	if r := <-leader; !errors.Is(r.err, context.Canceled) {
+		t.Errorf("leader: err = %v", r.err)
+	}
+	if r := <-follower; string(r.body) != "rows" || r.err != nil {
+		t.Errorf("follower got %q, %v, want its own result", r.body, r.err)
+	}
+}
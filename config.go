@@ -0,0 +1,433 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings read from the environment
+type Config struct {
+	DatabaseID int
+	Host       string
+
+	AllowedDatabases []int
+	DeniedDatabases  []int
+
+	FailoverHost    string
+	Timeout         time.Duration
+	StartupCheck    string
+	Auth            string
+	Cookies         string
+	Username        string
+	Password        string
+	APIKey          string
+	BearerToken     string
+	CookiesFile     string
+	APIKeyFile      string
+	BearerTokenFile string
+
+	AdminToolsEnabled       bool
+	AllowCredentialOverride bool
+	AuditLogPath            string
+	LogDestinations         string
+	LogLevel                string
+
+	ClientCert         string
+	ClientKey          string
+	CACert             string
+	InsecureSkipVerify bool
+
+	Proxy         string
+	ProxyUsername string
+	ProxyPassword string
+	NoProxy       string
+
+	AuditOpenSearchURL      string
+	AuditOpenSearchIndex    string
+	AuditOpenSearchUsername string
+	AuditOpenSearchPassword string
+	AuditOpenSearchAPIKey   string
+
+	MaxConcurrentQueries int
+	CoalesceQueries      bool
+	MaxOutputTokens      int
+	MaxRows              int
+	MaxResponseBytes     int
+	SpillOversizedOutput bool
+	AdaptiveLimit        bool
+	LintQueries          bool
+	BinaryColumns        string
+	JSONColumns          string
+	OutputFormat         string
+	MultiStatement       string
+
+	Transport        string
+	HTTPAddr         string
+	ClientAccessFile string
+
+	MetadataCacheDir string
+	WarmFile         string
+	ExportDir        string
+	UploadDir        string
+
+	SchemaSnapshotInterval time.Duration
+	SchemaDriftNotify      bool
+
+	RecordDir string
+	ReplayDir string
+
+	FaultInjection bool
+	Faults         FaultSpec
+
+	ConfigFile     string
+	Profiles       map[string]*Profile
+	DefaultProfile string
+}
+
+// loadConfig reads the server configuration from environment variables and,
+// when METABASE_CONFIG is set, the profiles defined in the config file.
+// Settings in the settings file at settingsPath, if any, fill in what the
+// environment leaves unset. Command-line flags set their environment
+// variables before this runs.
+func loadConfig(settingsPath string) (Config, error) {
+	var cfg Config
+
+	// The settings file may also define the profiles
+	var fileProfiles *profileFile
+	if settingsPath != "" {
+		profiles, err := applySettingsFile(settingsPath)
+		if err != nil {
+			return cfg, err
+		}
+		fileProfiles = profiles
+	}
+
+	// Get database ID from environment variable
+	if parsedDB, err := strconv.Atoi(os.Getenv("METABASE_DATABASE_ID")); err == nil {
+		cfg.DatabaseID = parsedDB
+	}
+
+	// Optionally restrict the databases tool calls may touch
+	var err error
+	if cfg.AllowedDatabases, err = envIntList("METABASE_ALLOWED_DATABASES"); err != nil {
+		return cfg, err
+	}
+	if cfg.DeniedDatabases, err = envIntList("METABASE_DENIED_DATABASES"); err != nil {
+		return cfg, err
+	}
+
+	// Get authentication cookies from environment variable
+	cfg.Cookies = os.Getenv("METABASE_COOKIES")
+
+	// Or log in with a username and password, renewing the session when it
+	// expires, or send an API key or bearer token
+	cfg.Auth = os.Getenv("METABASE_AUTH")
+	cfg.Username = os.Getenv("METABASE_USERNAME")
+	cfg.Password = os.Getenv("METABASE_PASSWORD")
+	cfg.APIKey = os.Getenv("METABASE_API_KEY")
+	cfg.BearerToken = os.Getenv("METABASE_BEARER_TOKEN")
+
+	// Credentials read from files are reloaded when the files change
+	cfg.CookiesFile = os.Getenv("METABASE_COOKIES_FILE")
+	cfg.APIKeyFile = os.Getenv("METABASE_API_KEY_FILE")
+	cfg.BearerTokenFile = os.Getenv("METABASE_BEARER_TOKEN_FILE")
+	if path := os.Getenv("METABASE_PASSWORD_FILE"); path != "" && cfg.Password == "" {
+		cfg.Password = "file:" + path
+	}
+
+	// Client certificate presented to gateways requiring mutual TLS
+	cfg.ClientCert = os.Getenv("METABASE_CLIENT_CERT")
+	cfg.ClientKey = os.Getenv("METABASE_CLIENT_KEY")
+
+	// Trust internal CAs, or skip verification entirely for self-signed test instances
+	cfg.CACert = os.Getenv("METABASE_CA_CERT")
+	cfg.InsecureSkipVerify = envBool("METABASE_INSECURE_SKIP_VERIFY")
+
+	// Reach Metabase through an explicit HTTP or SOCKS proxy rather than HTTPS_PROXY
+	cfg.Proxy = os.Getenv("METABASE_PROXY")
+	cfg.ProxyUsername = os.Getenv("METABASE_PROXY_USERNAME")
+	cfg.ProxyPassword = os.Getenv("METABASE_PROXY_PASSWORD")
+	cfg.NoProxy = envString("METABASE_NO_PROXY", os.Getenv("NO_PROXY"))
+	if isSecretReference(cfg.ProxyPassword) {
+		password, err := resolveSecret(cfg.ProxyPassword)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.ProxyPassword = password
+	}
+
+	// Callers may pass their own session token or API key per tool call
+	cfg.AllowCredentialOverride = envBool("METABASE_ALLOW_CREDENTIAL_OVERRIDE")
+
+	// Get Metabase URL from environment variable
+	cfg.Host = os.Getenv("METABASE_HOST")
+
+	// Requests to Metabase, including query executions, are abandoned after this long
+	if cfg.Timeout, err = envDuration("METABASE_TIMEOUT", 120*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout <= 0 {
+		return cfg, fmt.Errorf("METABASE_TIMEOUT must be longer than zero, got %s", cfg.Timeout)
+	}
+
+	// Connectivity, credentials and databases are checked before serving
+	cfg.StartupCheck = envString("METABASE_STARTUP_CHECK", startupCheckFail)
+	switch cfg.StartupCheck {
+	case startupCheckFail, startupCheckWarn, startupCheckOff:
+	default:
+		return cfg, fmt.Errorf("unknown METABASE_STARTUP_CHECK %q, expected fail, warn or off", cfg.StartupCheck)
+	}
+
+	// Read-only requests fail over to this host while the primary is unhealthy
+	cfg.FailoverHost = os.Getenv("METABASE_FAILOVER_HOST")
+
+	// Admin tools are opt-in since they expose instance-wide data
+	cfg.AdminToolsEnabled = envBool("METABASE_ENABLE_ADMIN_TOOLS")
+
+	// Application and audit logs go to stderr unless other destinations are configured
+	cfg.LogDestinations = envString("METABASE_LOG", "stderr")
+	cfg.AuditLogPath = os.Getenv("METABASE_AUDIT_LOG")
+
+	// Requests to Metabase are only logged in full when debugging
+	cfg.LogLevel = envString("METABASE_LOG_LEVEL", logLevelInfo)
+	if cfg.LogLevel != logLevelInfo && cfg.LogLevel != logLevelDebug {
+		return cfg, fmt.Errorf("unknown METABASE_LOG_LEVEL %q, expected info or debug", cfg.LogLevel)
+	}
+
+	// Audit records can also be shipped to OpenSearch/Elasticsearch
+	cfg.AuditOpenSearchURL = os.Getenv("METABASE_AUDIT_OPENSEARCH_URL")
+	cfg.AuditOpenSearchIndex = envString("METABASE_AUDIT_OPENSEARCH_INDEX", "metabase-mcp-audit")
+	cfg.AuditOpenSearchUsername = os.Getenv("METABASE_AUDIT_OPENSEARCH_USERNAME")
+	cfg.AuditOpenSearchPassword = os.Getenv("METABASE_AUDIT_OPENSEARCH_PASSWORD")
+	cfg.AuditOpenSearchAPIKey = os.Getenv("METABASE_AUDIT_OPENSEARCH_API_KEY")
+
+	// Limit concurrent queries so batch work cannot swamp the warehouse
+	cfg.MaxConcurrentQueries = envInt("METABASE_MAX_CONCURRENT_QUERIES", 4)
+
+	// Share one request between identical concurrent queries
+	cfg.CoalesceQueries = os.Getenv("METABASE_COALESCE_QUERIES") != "false"
+
+	// Keep responses within the client's context window
+	cfg.MaxOutputTokens = envInt("METABASE_MAX_OUTPUT_TOKENS", 20000)
+	cfg.MaxRows = envInt("METABASE_MAX_ROWS", 0)
+	cfg.MaxResponseBytes = envInt("METABASE_MAX_RESPONSE_BYTES", 0)
+	cfg.SpillOversizedOutput = os.Getenv("METABASE_SPILL_OVERSIZED_OUTPUT") != "false"
+	cfg.AdaptiveLimit = envBool("METABASE_ADAPTIVE_LIMIT")
+
+	// Binary columns are left out of results unless asked for
+	cfg.BinaryColumns = envString("METABASE_BINARY_COLUMNS", binaryExclude)
+
+	// JSON columns are returned as Metabase sends them unless pretty rendering is the default
+	cfg.JSONColumns = envString("METABASE_JSON_COLUMNS", jsonRaw)
+
+	// Results are returned as indented JSON unless another format is the default
+	cfg.OutputFormat = envString("METABASE_OUTPUT_FORMAT", formatJSON)
+	if !validFormat(cfg.OutputFormat) {
+		return cfg, fmt.Errorf("unknown METABASE_OUTPUT_FORMAT %q, expected json, markdown, csv or compact", cfg.OutputFormat)
+	}
+
+	// Queries holding several statements are rejected unless they are to be split
+	cfg.MultiStatement = envString("METABASE_MULTI_STATEMENT", multiStatementReject)
+	if cfg.MultiStatement != multiStatementReject && cfg.MultiStatement != multiStatementSplit {
+		return cfg, fmt.Errorf("unknown METABASE_MULTI_STATEMENT %q, expected reject or split", cfg.MultiStatement)
+	}
+
+	// Attach lint findings to every executed query
+	cfg.LintQueries = envBool("METABASE_LINT_QUERIES")
+
+	// Serve over stdio by default, or streamable HTTP for shared deployments.
+	// HTTP listens on loopback only unless an address is given, since without
+	// a client access file every caller can use every tool
+	cfg.Transport = envString("METABASE_TRANSPORT", "stdio")
+	cfg.HTTPAddr = envString("METABASE_HTTP_ADDR", "127.0.0.1:8080")
+	cfg.ClientAccessFile = os.Getenv("METABASE_CLIENT_ACCESS_FILE")
+
+	// Metadata is cached on disk so schema browsing keeps working offline
+	cfg.MetadataCacheDir = envString("METABASE_METADATA_CACHE_DIR", defaultMetadataCacheDir())
+
+	// Periodic schema snapshots detect drift after migrations
+	if cfg.SchemaSnapshotInterval, err = envDuration("METABASE_SCHEMA_SNAPSHOT_INTERVAL", 0); err != nil {
+		return cfg, err
+	}
+	cfg.SchemaDriftNotify = envBool("METABASE_SCHEMA_DRIFT_NOTIFY")
+
+	// Cards and queries pre-executed by the warm subcommand and tool
+	cfg.WarmFile = os.Getenv("METABASE_WARM_FILE")
+
+	// Exported files are written here for the client to pick up
+	cfg.ExportDir = envString("METABASE_EXPORT_DIR", filepath.Join(os.TempDir(), "metabase-mcp-exports"))
+
+	// upload-csv only reads server files from this directory; unset, it takes inline CSV only
+	cfg.UploadDir = os.Getenv("METABASE_UPLOAD_DIR")
+
+	// Metabase responses and tool calls are recorded to, or replayed from, fixture directories
+	cfg.RecordDir = os.Getenv("METABASE_RECORD")
+	cfg.ReplayDir = os.Getenv("METABASE_REPLAY")
+	if cfg.RecordDir != "" && cfg.ReplayDir != "" {
+		return cfg, errors.New("METABASE_RECORD and METABASE_REPLAY cannot both be set")
+	}
+
+	// Faults are only injected when explicitly enabled, so a stray fault spec
+	// cannot degrade a production deployment
+	cfg.FaultInjection = envBool("METABASE_FAULT_INJECTION")
+	if cfg.FaultInjection {
+		faults, err := parseFaultSpec(os.Getenv("METABASE_FAULTS"))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Faults = faults
+	}
+
+	// Profiles come from the config file or the settings file, or a single
+	// default profile from the environment
+	cfg.ConfigFile = os.Getenv("METABASE_CONFIG")
+	switch {
+	case cfg.ConfigFile != "":
+		if err := loadProfiles(&cfg, cfg.ConfigFile); err != nil {
+			return cfg, err
+		}
+	case fileProfiles != nil:
+		if err := applyProfiles(&cfg, *fileProfiles, settingsPath); err != nil {
+			return cfg, err
+		}
+	default:
+		if cfg.DatabaseID == 0 {
+			return cfg, fmt.Errorf("%w: --database-id or METABASE_DATABASE_ID is not set or invalid", errMissingSetting)
+		}
+		if cfg.Host == "" {
+			return cfg, fmt.Errorf("%w: --host or METABASE_HOST is not set", errMissingSetting)
+		}
+		if err := validateHost("METABASE_HOST", cfg.Host); err != nil {
+			return cfg, err
+		}
+		if cfg.FailoverHost != "" {
+			if err := validateHost("METABASE_FAILOVER_HOST", cfg.FailoverHost); err != nil {
+				return cfg, err
+			}
+		}
+		profile := &Profile{
+			Name:         "default",
+			Host:         cfg.Host,
+			FailoverHost: cfg.FailoverHost,
+			Auth:         cfg.Auth,
+			Cookies:      cfg.Cookies,
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			APIKey:       cfg.APIKey,
+			BearerToken:  cfg.BearerToken,
+			DatabaseID:   cfg.DatabaseID,
+
+			AllowedDatabases: cfg.AllowedDatabases,
+			DeniedDatabases:  cfg.DeniedDatabases,
+
+			CookiesFile:     cfg.CookiesFile,
+			APIKeyFile:      cfg.APIKeyFile,
+			BearerTokenFile: cfg.BearerTokenFile,
+		}
+		if err := profile.resolveSecrets(); err != nil {
+			return cfg, err
+		}
+		if _, err := authSchemeFor(profile); err != nil {
+			return cfg, err
+		}
+		cfg.DefaultProfile = "default"
+		cfg.Profiles = map[string]*Profile{"default": profile}
+	}
+	if name := os.Getenv("METABASE_PROFILE"); name != "" {
+		cfg.DefaultProfile = name
+	}
+	if _, ok := cfg.Profiles[cfg.DefaultProfile]; !ok {
+		return cfg, fmt.Errorf("profile %q is not defined", cfg.DefaultProfile)
+	}
+	for _, profile := range cfg.Profiles {
+		guardrails, err := guardrailsFor(profile.GuardrailLevel, cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+		profile.Guardrails = guardrails
+		if err := profile.checkDatabasePolicy(); err != nil {
+			return cfg, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// defaultMetadataCacheDir returns the per-user cache directory for metadata,
+// or "" to keep the cache in memory when there is none
+func defaultMetadataCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "metabase-mcp")
+}
+
+// validateHost checks that host is an absolute http or https URL
+func validateHost(name, host string) error {
+	parsed, err := url.Parse(host)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s %q is not a valid Metabase URL; expected e.g. https://metabase.example.com", name, host)
+	}
+	return nil
+}
+
+// envBool reports whether the named environment variable is set to a true value
+func envBool(name string) bool {
+	enabled, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && enabled
+}
+
+// envInt reads the named environment variable as an integer, returning def when unset or invalid
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envIntList reads the named environment variable as a comma-separated list
+// of integers
+func envIntList(name string) ([]int, error) {
+	var values []int
+	for _, entry := range splitList(os.Getenv(name)) {
+		value, err := strconv.Atoi(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a database ID", name, entry)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// envDuration reads the named environment variable as a duration such as "6h",
+// or a whole number of seconds, returning def when unset
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def, nil
+	}
+	value, err := time.ParseDuration(raw)
+	if seconds, atoiErr := strconv.Atoi(raw); atoiErr == nil {
+		value, err = time.Duration(seconds)*time.Second, nil
+	}
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s: %q is not a duration such as 90s or 5m, or a number of seconds", name, raw)
+	}
+	return value, nil
+}
+
+// envString reads the named environment variable, returning def when unset
+func envString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
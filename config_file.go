@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileSettings are the environment variables set from the settings file, so
+// a reload can tell them apart from the real environment
+var fileSettings []string
+
+// applySettingsFile reads a YAML, TOML or JSON settings file and sets the
+// environment variables it names that the environment leaves unset, so the
+// environment overrides the file. Nested sections are joined with
+// underscores: audit.opensearch.url sets METABASE_AUDIT_OPENSEARCH_URL. The
+// profiles defined in the file, if any, are returned.
+func applySettingsFile(path string) (*profileFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("settings file %s must end in .yaml, .yml, .toml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse settings file %s: %w", path, err)
+	}
+
+	// Profiles keep the layout of the METABASE_CONFIG file
+	var profiles *profileFile
+	if _, ok := raw["profiles"]; ok {
+		encoded, err := json.Marshal(map[string]interface{}{"profiles": raw["profiles"], "default_profile": raw["default_profile"]})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read profiles from %s: %w", path, err)
+		}
+		profiles = &profileFile{}
+		if err := json.Unmarshal(encoded, profiles); err != nil {
+			return nil, fmt.Errorf("failed to read profiles from %s: %w", path, err)
+		}
+	}
+	delete(raw, "profiles")
+	delete(raw, "default_profile")
+
+	values := map[string]string{}
+	if err := flattenSettings("", raw, values); err != nil {
+		return nil, fmt.Errorf("settings file %s: %w", path, err)
+	}
+
+	// Every key is checked before anything is applied, so a file that fails
+	// to load leaves the settings of the last good one in place
+	envs := make(map[string]string, len(settings))
+	for _, s := range settings {
+		envs[settingKey(s.Env)] = s.Env
+	}
+	var unknown []string
+	for name := range values {
+		if _, ok := envs[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("settings file %s has unknown settings: %s", path, strings.Join(unknown, ", "))
+	}
+
+	for _, env := range fileSettings {
+		os.Unsetenv(env)
+	}
+	fileSettings = nil
+	for name, value := range values {
+		if env := envs[name]; os.Getenv(env) == "" {
+			os.Setenv(env, value)
+			fileSettings = append(fileSettings, env)
+		}
+	}
+	return profiles, nil
+}
+
+// flattenSettings joins nested section names onto their keys and renders
+// each value as it would be written in the environment, with lists joined
+// by commas
+func flattenSettings(prefix string, section map[string]interface{}, out map[string]string) error {
+	for key, value := range section {
+		name := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		switch value := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			if err := flattenSettings(name, value, out); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				rendered, err := settingValue(name, item)
+				if err != nil {
+					return err
+				}
+				items = append(items, rendered)
+			}
+			out[name] = strings.Join(items, ",")
+		default:
+			rendered, err := settingValue(name, value)
+			if err != nil {
+				return err
+			}
+			out[name] = rendered
+		}
+	}
+	return nil
+}
+
+// settingValue renders a scalar setting value
+func settingValue(name string, value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("setting %s has an unsupported value %v", name, value)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSettings writes a settings file and returns its path
+func writeSettings(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearSettingsEnv unsets the variables a test's settings files touch,
+// restoring them and the record of file settings afterwards
+func clearSettingsEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	previous := fileSettings
+	fileSettings = nil
+	t.Cleanup(func() { fileSettings = previous })
+}
+
+func TestApplySettingsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "settings.yaml", "host: https://metabase.example.com\ntimeout: 5m\naudit:\n  opensearch:\n    url: https://search.example.com\n"},
+		{"toml", "settings.toml", "host = \"https://metabase.example.com\"\ntimeout = \"5m\"\n[audit.opensearch]\nurl = \"https://search.example.com\"\n"},
+		{"json", "settings.json", `{"host": "https://metabase.example.com", "timeout": "5m", "audit": {"opensearch": {"url": "https://search.example.com"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearSettingsEnv(t, "METABASE_HOST", "METABASE_TIMEOUT", "METABASE_AUDIT_OPENSEARCH_URL")
+			if _, err := applySettingsFile(writeSettings(t, tt.file, tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			for env, want := range map[string]string{
+				"METABASE_HOST":                 "https://metabase.example.com",
+				"METABASE_TIMEOUT":              "5m",
+				"METABASE_AUDIT_OPENSEARCH_URL": "https://search.example.com",
+			} {
+				if got := os.Getenv(env); got != want {
+					t.Errorf("%s = %q, want %q", env, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplySettingsFileEnvironmentWins(t *testing.T) {
+	clearSettingsEnv(t, "METABASE_HOST", "METABASE_TIMEOUT")
+	t.Setenv("METABASE_TIMEOUT", "30s")
+	if _, err := applySettingsFile(writeSettings(t, "settings.yaml", "host: https://metabase.example.com\ntimeout: 5m\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("METABASE_TIMEOUT"); got != "30s" {
+		t.Errorf("METABASE_TIMEOUT = %q, want the environment's 30s", got)
+	}
+}
+
+func TestApplySettingsFileUnknownKeys(t *testing.T) {
+	clearSettingsEnv(t, "METABASE_HOST", "METABASE_TIMEOUT")
+	if _, err := applySettingsFile(writeSettings(t, "settings.yaml", "host: https://metabase.example.com\ntimeout: 5m\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reload with a bad key fails without applying or dropping anything
+	_, err := applySettingsFile(writeSettings(t, "settings.yaml", "host: https://other.example.com\ntimout: 1m\n"))
+	if err == nil {
+		t.Fatal("unknown key accepted")
+	}
+	if got := os.Getenv("METABASE_HOST"); got != "https://metabase.example.com" {
+		t.Errorf("METABASE_HOST = %q, want the last good file's value", got)
+	}
+	if got := os.Getenv("METABASE_TIMEOUT"); got != "5m" {
+		t.Errorf("METABASE_TIMEOUT = %q, want the last good file's value", got)
+	}
+
+	// A good reload drops settings the new file leaves out
+	if _, err := applySettingsFile(writeSettings(t, "settings.yaml", "host: https://other.example.com\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("METABASE_HOST"); got != "https://other.example.com" {
+		t.Errorf("METABASE_HOST = %q, want the new value", got)
+	}
+	if got := os.Getenv("METABASE_TIMEOUT"); got != "" {
+		t.Errorf("METABASE_TIMEOUT = %q, want it unset", got)
+	}
+}
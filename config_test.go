@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnvDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"unset", "", time.Minute, false},
+		{"duration", "90s", 90 * time.Second, false},
+		{"minutes", "5m", 5 * time.Minute, false},
+		{"bare seconds", "30", 30 * time.Second, false},
+		// Zero turns off optional intervals; METABASE_TIMEOUT refuses it
+		{"zero", "0", 0, false},
+		{"surrounding space", " 2h ", 2 * time.Hour, false},
+		{"negative", "-5s", 0, true},
+		{"negative seconds", "-5", 0, true},
+		{"unit only", "s", 0, true},
+		{"not a duration", "soon", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("METABASE_TEST_DURATION", tt.value)
+			got, err := envDuration("METABASE_TEST_DURATION", time.Minute)
+			if (err != nil) != tt.err {
+				t.Fatalf("envDuration(%q) error = %v, want error %v", tt.value, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("envDuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// setMinimalEnv configures a single default profile from the environment
+func setMinimalEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"METABASE_CONFIG", "METABASE_PROFILE", "METABASE_COOKIES", "METABASE_AUTH",
+		"METABASE_USERNAME", "METABASE_PASSWORD", "METABASE_BEARER_TOKEN",
+		"METABASE_RECORD", "METABASE_REPLAY", "METABASE_FAULTS", "METABASE_TIMEOUT",
+		"METABASE_HTTP_ADDR", "METABASE_SCHEMA_SNAPSHOT_INTERVAL",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("METABASE_HOST", "https://metabase.example.com")
+	t.Setenv("METABASE_DATABASE_ID", "1")
+	t.Setenv("METABASE_API_KEY", "mb_test")
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(t *testing.T, cfg Config)
+		err   bool
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Timeout != 120*time.Second {
+					t.Errorf("Timeout = %v, want 2m0s", cfg.Timeout)
+				}
+				if cfg.HTTPAddr != "127.0.0.1:8080" {
+					t.Errorf("HTTPAddr = %q, want loopback", cfg.HTTPAddr)
+				}
+				if cfg.DefaultProfile != "default" || cfg.Profiles["default"] == nil {
+					t.Errorf("DefaultProfile = %q, profiles = %v", cfg.DefaultProfile, cfg.Profiles)
+				}
+			},
+		},
+		{
+			name: "timeout in seconds",
+			env:  map[string]string{"METABASE_TIMEOUT": "45"},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Timeout != 45*time.Second {
+					t.Errorf("Timeout = %v, want 45s", cfg.Timeout)
+				}
+			},
+		},
+		{
+			name: "zero timeout",
+			env:  map[string]string{"METABASE_TIMEOUT": "0"},
+			err:  true,
+		},
+		{
+			name: "zero snapshot interval turns snapshots off",
+			env:  map[string]string{"METABASE_SCHEMA_SNAPSHOT_INTERVAL": "0"},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.SchemaSnapshotInterval != 0 {
+					t.Errorf("SchemaSnapshotInterval = %v, want 0", cfg.SchemaSnapshotInterval)
+				}
+			},
+		},
+		{
+			name: "invalid timeout",
+			env:  map[string]string{"METABASE_TIMEOUT": "forever"},
+			err:  true,
+		},
+		{
+			name: "invalid snapshot interval",
+			env:  map[string]string{"METABASE_SCHEMA_SNAPSHOT_INTERVAL": "-1h"},
+			err:  true,
+		},
+		{
+			name: "missing host",
+			env:  map[string]string{"METABASE_HOST": ""},
+			err:  true,
+		},
+		{
+			name: "record and replay",
+			env:  map[string]string{"METABASE_RECORD": "/tmp/a", "METABASE_REPLAY": "/tmp/b"},
+			err:  true,
+		},
+		{
+			name: "unknown output format",
+			env:  map[string]string{"METABASE_OUTPUT_FORMAT": "xml"},
+			err:  true,
+		},
+		{
+			name: "unknown profile",
+			env:  map[string]string{"METABASE_PROFILE": "prod"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setMinimalEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := loadConfig("")
+			if (err != nil) != tt.err {
+				t.Fatalf("loadConfig() error = %v, want error %v", err, tt.err)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingSetting(t *testing.T) {
+	setMinimalEnv(t)
+	t.Setenv("METABASE_DATABASE_ID", "")
+	if _, err := loadConfig(""); !errors.Is(err, errMissingSetting) {
+		t.Errorf("loadConfig() error = %v, want errMissingSetting", err)
+	}
+}
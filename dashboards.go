@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Dashboard represents a Metabase dashboard as returned by the dashboard API
+type Dashboard struct {
+	ID           int         `json:"id"`
+	Name         string      `json:"name"`
+	Description  *string     `json:"description"`
+	CollectionID *int        `json:"collection_id"`
+	Parameters   []Parameter `json:"parameters"`
+	Dashcards    []Dashcard  `json:"dashcards"`
+	OrderedCards []Dashcard  `json:"ordered_cards"`
+
+	// CollectionPosition is set when the dashboard is pinned in its collection
+	CollectionPosition *int           `json:"collection_position"`
+	Tabs               []DashboardTab `json:"tabs"`
+	Archived           bool           `json:"archived"`
+}
+
+// DashboardTab is a tab of a dashboard, on Metabase versions with tabs
+type DashboardTab struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+// Dashcard represents a card placed on a dashboard, with any series combined into it
+type Dashcard struct {
+	ID                int                      `json:"id"`
+	CardID            *int                     `json:"card_id"`
+	Card              Card                     `json:"card"`
+	Series            []Card                   `json:"series"`
+	DashboardTabID    *int                     `json:"dashboard_tab_id"`
+	ParameterMappings []map[string]interface{} `json:"parameter_mappings"`
+
+	// Placement on the dashboard grid; text and heading cards keep their
+	// content in the visualization settings
+	Row                   int                    `json:"row"`
+	Col                   int                    `json:"col"`
+	SizeX                 int                    `json:"size_x"`
+	SizeY                 int                    `json:"size_y"`
+	VisualizationSettings map[string]interface{} `json:"visualization_settings"`
+}
+
+// Cards returns the dashboard's cards, supporting both the current and pre-0.47 field names
+func (d Dashboard) Cards() []Dashcard {
+	if len(d.Dashcards) > 0 {
+		return d.Dashcards
+	}
+	return d.OrderedCards
+}
+
+// getDashboard fetches a single dashboard by ID
+func getDashboard(ctx context.Context, client *MetabaseClient, dashboardID int) (Dashboard, error) {
+	var dashboard Dashboard
+	err := client.Get(ctx, fmt.Sprintf("/api/dashboard/%d", dashboardID), &dashboard)
+	return dashboard, err
+}
+
+// runDashcard executes a card in the context of a dashboard, so dashboard-level
+// permissions and parameter mappings apply
+func runDashcard(ctx context.Context, client *MetabaseClient, dashboardID, dashcardID, cardID int, parameters []interface{}) (MetabaseResponse, error) {
+	var resp MetabaseResponse
+	if err := checkCardAccess(ctx, client, cardID); err != nil {
+		return resp, err
+	}
+	path := fmt.Sprintf("/api/dashboard/%d/dashcard/%d/card/%d/query", dashboardID, dashcardID, cardID)
+	if parameters == nil {
+		parameters = make([]interface{}, 0)
+	}
+	respBody, err := client.Query(ctx, path, map[string]interface{}{"parameters": parameters})
+	if err != nil {
+		return resp, err
+	}
+	err = json.Unmarshal(respBody, &resp)
+	return resp, err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Log levels
+const (
+	logLevelInfo  = "info"
+	logLevelDebug = "debug"
+)
+
+// sensitiveHeaders are the request and response headers carrying credentials
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	sessionHeader:         true,
+}
+
+// debugTransport logs every request to Metabase and its response with
+// headers, bodies and timing. Credentials are redacted.
+type debugTransport struct {
+	next http.RoundTripper
+}
+
+// newDebugTransport wraps next, or the default transport when next is nil
+func newDebugTransport(next http.RoundTripper) *debugTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &debugTransport{next: next}
+}
+
+// RoundTrip performs the request and logs it
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	log.Printf("DEBUG request %s %s\n%s%s", req.Method, req.URL.Redacted(), debugHeaders(req.Header), debugBody(req.URL.Path, body))
+
+	startedAt := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(startedAt).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("DEBUG response %s %s failed after %s: %v", req.Method, req.URL.Redacted(), elapsed, err)
+		return nil, err
+	}
+
+	// Streamed bodies may be far too large to hold in memory
+	if responseSinkFromContext(req.Context()) != nil {
+		log.Printf("DEBUG response %s %s %s in %s\n%s  (body streamed, not logged)", req.Method, req.URL.Redacted(), resp.Status, elapsed, debugHeaders(resp.Header))
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	log.Printf("DEBUG response %s %s %s in %s\n%s%s", req.Method, req.URL.Redacted(), resp.Status, elapsed, debugHeaders(resp.Header), debugBody(req.URL.Path, respBody))
+	return resp, nil
+}
+
+// debugHeaders renders headers one per line in sorted order, redacting credentials
+func debugHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", name, value)
+	}
+	return b.String()
+}
+
+// debugBody renders a request or response body. Sensitive fields of JSON
+// bodies are redacted, as is the session ID returned by a login.
+func debugBody(path string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return string(body)
+	}
+	v = redactJSON(v, strings.HasPrefix(path, "/api/session"))
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(encoded)
+}
+
+// redactJSON masks credential fields at any depth of a decoded JSON value,
+// and the id field too when session is set
+func redactJSON(v interface{}, session bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if sensitiveArgumentPattern.MatchString(key) || key == "unmasked_key" || (session && key == "id") {
+				v[key] = "[redacted]"
+			} else {
+				v[key] = redactJSON(value, session)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactJSON(value, session)
+		}
+	}
+	return v
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "metabase.SESSION=secret-session")
+		w.Write([]byte(`{"id":"secret-session"}`))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(previous)
+
+	client := &http.Client{Transport: newDebugTransport(nil)}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/session", strings.NewReader(`{"username":"analyst@example.com","password":"hunter2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", "mb_secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// The caller still reads the whole response
+	if string(body) != `{"id":"secret-session"}` {
+		t.Errorf("response body = %s, want it unchanged", body)
+	}
+	for _, secret := range []string{"hunter2", "mb_secret", "secret-session"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("log contains %q:\n%s", secret, logs.String())
+		}
+	}
+	for _, want := range []string{"DEBUG request POST " + server.URL + "/api/session", `"username":"analyst@example.com"`, "X-Api-Key: [redacted]", "DEBUG response POST", "200 OK"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log is missing %q:\n%s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultSpec configures the faults injected into requests to Metabase
+type FaultSpec struct {
+	Latency        time.Duration
+	ErrorRate      float64
+	MalformedRate  float64
+	AuthExpiryRate float64
+	Path           string
+	Seed           int64
+}
+
+// parseFaultSpec parses a comma-separated list of key=value settings, e.g.
+// "latency=2s,error_rate=0.2,path=/api/dataset"
+func parseFaultSpec(spec string) (FaultSpec, error) {
+	var faults FaultSpec
+	for _, setting := range strings.Split(spec, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(setting, "=")
+
+		var err error
+		switch key {
+		case "latency":
+			faults.Latency, err = time.ParseDuration(value)
+		case "error_rate":
+			faults.ErrorRate, err = parseRate(value)
+		case "malformed_rate":
+			faults.MalformedRate, err = parseRate(value)
+		case "auth_expiry_rate":
+			faults.AuthExpiryRate, err = parseRate(value)
+		case "path":
+			faults.Path = value
+		case "seed":
+			faults.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return faults, fmt.Errorf("unknown fault setting %q", key)
+		}
+		if err != nil {
+			return faults, fmt.Errorf("invalid fault setting %q: %v", setting, err)
+		}
+	}
+	return faults, nil
+}
+
+// parseRate parses a probability between 0 and 1
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate must be between 0 and 1")
+	}
+	return rate, nil
+}
+
+// faultTransport injects latency, server errors, malformed payloads and
+// expired sessions into requests to Metabase, to exercise retries, circuit
+// breaking and error reporting
+type faultTransport struct {
+	spec FaultSpec
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	injected map[string]int
+}
+
+// newFaultTransport wraps next, or the default transport when next is nil
+func newFaultTransport(spec FaultSpec, next http.RoundTripper) *faultTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	seed := spec.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &faultTransport{
+		spec:     spec,
+		next:     next,
+		rand:     rand.New(rand.NewSource(seed)),
+		injected: make(map[string]int),
+	}
+}
+
+// RoundTrip performs the request, injecting at most one fault besides latency
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.spec.Path != "" && !strings.HasPrefix(req.URL.Path, t.spec.Path) {
+		return t.next.RoundTrip(req)
+	}
+
+	t.mu.Lock()
+	delay := time.Duration(0)
+	if t.spec.Latency > 0 {
+		delay = time.Duration(t.rand.Int63n(int64(t.spec.Latency)))
+		t.injected["latency"]++
+	}
+	fault := ""
+	switch roll := t.rand.Float64(); {
+	case roll < t.spec.ErrorRate:
+		fault = "server_error"
+	case roll < t.spec.ErrorRate+t.spec.AuthExpiryRate:
+		fault = "auth_expiry"
+	case roll < t.spec.ErrorRate+t.spec.AuthExpiryRate+t.spec.MalformedRate:
+		fault = "malformed"
+	}
+	if fault != "" {
+		t.injected[fault]++
+	}
+	t.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch fault {
+	case "server_error":
+		return faultResponse(req, http.StatusServiceUnavailable, "Injected fault: service unavailable"), nil
+	case "auth_expiry":
+		return faultResponse(req, http.StatusUnauthorized, "Unauthenticated"), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || fault != "malformed" {
+		return resp, err
+	}
+
+	// Cut the real payload short so it no longer parses
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body = append(body[:len(body)/2], "\x00<injected>"...)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// stats reports the configured faults and how often each was injected
+func (t *faultTransport) stats() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	injected := make(map[string]int, len(t.injected))
+	for fault, n := range t.injected {
+		injected[fault] = n
+	}
+	return map[string]interface{}{
+		"latency":          t.spec.Latency.String(),
+		"error_rate":       t.spec.ErrorRate,
+		"malformed_rate":   t.spec.MalformedRate,
+		"auth_expiry_rate": t.spec.AuthExpiryRate,
+		"path":             t.spec.Path,
+		"injected":         injected,
+	}
+}
+
+// faultResponse builds a response as Metabase would send it for an error
+func faultResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:        http.Header{"Content-Type": []string{"text/plain"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
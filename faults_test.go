@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseFaultSpec(t *testing.T) {
+	spec, err := parseFaultSpec("latency=2s, error_rate=0.2,malformed_rate=0.1,auth_expiry_rate=0.05,path=/api/dataset,seed=7")
+	want := FaultSpec{Latency: 2 * time.Second, ErrorRate: 0.2, MalformedRate: 0.1, AuthExpiryRate: 0.05, Path: "/api/dataset", Seed: 7}
+	if err != nil || spec != want {
+		t.Errorf("parseFaultSpec = %+v, %v, want %+v", spec, err, want)
+	}
+
+	for _, invalid := range []string{"latency=soon", "error_rate=1.5", "malformed_rate=-0.1", "seed=x", "jitter=1s"} {
+		if _, err := parseFaultSpec(invalid); err == nil {
+			t.Errorf("parseFaultSpec(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestFaultTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"completed","row_count":1}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		spec   FaultSpec
+		path   string
+		status int
+		body   string
+		fault  string
+	}{
+		{"server error", FaultSpec{ErrorRate: 1}, "/api/dataset", http.StatusServiceUnavailable, "Injected fault: service unavailable", "server_error"},
+		{"expired session", FaultSpec{AuthExpiryRate: 1}, "/api/dataset", http.StatusUnauthorized, "Unauthenticated", "auth_expiry"},
+		{"malformed payload", FaultSpec{MalformedRate: 1}, "/api/dataset", http.StatusOK, `{"status":"complet` + "\x00<injected>", "malformed"},
+		{"other path", FaultSpec{ErrorRate: 1, Path: "/api/dataset"}, "/api/card", http.StatusOK, `{"status":"completed","row_count":1}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newFaultTransport(tt.spec, nil)
+			client := &http.Client{Transport: transport}
+			resp, err := client.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.status || string(body) != tt.body {
+				t.Errorf("response = %d %q, want %d %q", resp.StatusCode, body, tt.status, tt.body)
+			}
+
+			injected := transport.stats()["injected"].(map[string]int)
+			if tt.fault == "" && len(injected) != 0 || tt.fault != "" && injected[tt.fault] != 1 {
+				t.Errorf("injected = %v, want %q once", injected, tt.fault)
+			}
+		})
+	}
+}
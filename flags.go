@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// setting is a server setting read from an environment variable, which can
+// also be given as a command-line flag or in the settings file
+type setting struct {
+	Env   string
+	Flag  string
+	Bool  bool
+	Usage string
+}
+
+// settings lists every server setting. Its settings file key and, unless
+// named otherwise, its flag are derived from the environment variable name.
+var settings = []setting{
+	{Env: "METABASE_HOST", Usage: "Metabase instance URL"},
+	{Env: "METABASE_DATABASE_ID", Usage: "target database ID in Metabase"},
+	{Env: "METABASE_ALLOWED_DATABASES", Usage: "comma-separated database IDs tool calls may touch (default: all)"},
+	{Env: "METABASE_DENIED_DATABASES", Usage: "comma-separated database IDs tool calls may not touch"},
+	{Env: "METABASE_FAILOVER_HOST", Usage: "standby Metabase URL serving read-only requests while the host is unhealthy"},
+	{Env: "METABASE_PROFILE", Usage: "profile to use by default"},
+	{Env: "METABASE_CONFIG", Flag: "profiles-config", Usage: "JSON file defining environment profiles"},
+	{Env: "METABASE_TIMEOUT", Usage: "how long a request to Metabase may take, e.g. 5m or 300 seconds (default 120s)"},
+	{Env: "METABASE_STARTUP_CHECK", Usage: "check connectivity, credentials and databases before serving: fail, warn or off (default fail)"},
+
+	{Env: "METABASE_AUTH", Usage: "authentication scheme: cookie, session, api_key or bearer"},
+	{Env: "METABASE_COOKIES", Usage: "authentication cookies"},
+	{Env: "METABASE_USERNAME", Usage: "Metabase user to log in as"},
+	{Env: "METABASE_PASSWORD", Usage: "password of the user"},
+	{Env: "METABASE_API_KEY", Usage: "Metabase API key"},
+	{Env: "METABASE_BEARER_TOKEN", Usage: "token sent as Authorization: Bearer"},
+	{Env: "METABASE_COOKIES_FILE", Usage: "file holding the cookies, reloaded when it changes"},
+	{Env: "METABASE_PASSWORD_FILE", Usage: "file holding the password"},
+	{Env: "METABASE_API_KEY_FILE", Usage: "file holding the API key, reloaded when it changes"},
+	{Env: "METABASE_BEARER_TOKEN_FILE", Usage: "file holding the bearer token, reloaded when it changes"},
+	{Env: "METABASE_ALLOW_CREDENTIAL_OVERRIDE", Bool: true, Usage: "let tool calls pass their own session token or API key"},
+
+	{Env: "METABASE_CLIENT_CERT", Usage: "PEM client certificate for mutual TLS"},
+	{Env: "METABASE_CLIENT_KEY", Usage: "PEM private key of the client certificate"},
+	{Env: "METABASE_CA_CERT", Usage: "PEM bundle of CA certificates to trust in addition to the system roots"},
+	{Env: "METABASE_INSECURE_SKIP_VERIFY", Bool: true, Usage: "disable TLS certificate verification"},
+	{Env: "METABASE_PROXY", Usage: "HTTP or SOCKS proxy for requests to Metabase"},
+	{Env: "METABASE_PROXY_USERNAME", Usage: "user name for the proxy"},
+	{Env: "METABASE_PROXY_PASSWORD", Usage: "password for the proxy"},
+	{Env: "METABASE_NO_PROXY", Usage: "comma-separated hosts, domains and CIDR ranges reached without the proxy"},
+
+	{Env: "METABASE_MAX_CONCURRENT_QUERIES", Usage: "maximum queries running against Metabase at once, per profile (default 4)"},
+	{Env: "METABASE_COALESCE_QUERIES", Bool: true, Usage: "share one request between identical concurrent queries (default true)"},
+	{Env: "METABASE_MAX_OUTPUT_TOKENS", Usage: "estimated token budget per tool response, 0 to disable (default 20000)"},
+	{Env: "METABASE_MAX_ROWS", Usage: "maximum rows returned per result, 0 for no cap"},
+	{Env: "METABASE_MAX_RESPONSE_BYTES", Usage: "maximum size of a result response in bytes, 0 for no cap"},
+	{Env: "METABASE_SPILL_OVERSIZED_OUTPUT", Bool: true, Usage: "keep the full result of oversized responses as a resource (default true)"},
+	{Env: "METABASE_ADAPTIVE_LIMIT", Bool: true, Usage: "re-run oversized query results with a smaller LIMIT"},
+	{Env: "METABASE_LINT_QUERIES", Bool: true, Usage: "attach SQL lint findings to every executed query"},
+	{Env: "METABASE_BINARY_COLUMNS", Usage: "handling of binary columns: exclude, truncate or base64 (default exclude)"},
+	{Env: "METABASE_JSON_COLUMNS", Usage: "rendering of JSON columns: raw or pretty (default raw)"},
+	{Env: "METABASE_OUTPUT_FORMAT", Usage: "format of tool results: json, markdown, csv or compact (default json)"},
+	{Env: "METABASE_MULTI_STATEMENT", Usage: "queries holding several statements: reject them or split them and run them in turn (default reject)"},
+	{Env: "METABASE_ENABLE_ADMIN_TOOLS", Bool: true, Usage: "register admin-only tools"},
+
+	{Env: "METABASE_TRANSPORT", Usage: "stdio or http (default stdio)"},
+	{Env: "METABASE_HTTP_ADDR", Usage: "listen address for the HTTP transport (default 127.0.0.1:8080)"},
+	{Env: "METABASE_CLIENT_ACCESS_FILE", Usage: "JSON file mapping HTTP client tokens to the databases and schemas they may query"},
+
+	{Env: "METABASE_LOG", Usage: "destinations for application logs (default stderr)"},
+	{Env: "METABASE_LOG_LEVEL", Usage: "info, or debug to also log requests to Metabase with headers, bodies and timing (default info)"},
+	{Env: "METABASE_AUDIT_LOG", Usage: "destinations for audit records (default stderr)"},
+	{Env: "METABASE_AUDIT_OPENSEARCH_URL", Usage: "OpenSearch/Elasticsearch URL receiving audit records"},
+	{Env: "METABASE_AUDIT_OPENSEARCH_INDEX", Usage: "index for shipped audit records (default metabase-mcp-audit)"},
+	{Env: "METABASE_AUDIT_OPENSEARCH_USERNAME", Usage: "user name for the OpenSearch cluster"},
+	{Env: "METABASE_AUDIT_OPENSEARCH_PASSWORD", Usage: "password for the OpenSearch cluster"},
+	{Env: "METABASE_AUDIT_OPENSEARCH_API_KEY", Usage: "API key for the OpenSearch cluster"},
+
+	{Env: "METABASE_METADATA_CACHE_DIR", Usage: "directory of the persistent metadata cache (default: the user cache directory)"},
+	{Env: "METABASE_EXPORT_DIR", Usage: "directory export-query writes files to (default: metabase-mcp-exports in the temporary directory)"},
+	{Env: "METABASE_UPLOAD_DIR", Usage: "directory upload-csv may read CSV files from (default: none, only inline CSV)"},
+	{Env: "METABASE_WARM_FILE", Usage: "JSON list of cards and queries pre-executed by warm"},
+	{Env: "METABASE_SCHEMA_SNAPSHOT_INTERVAL", Usage: "interval between schema snapshots for drift detection, e.g. 6h"},
+	{Env: "METABASE_SCHEMA_DRIFT_NOTIFY", Bool: true, Usage: "notify connected clients when schema drift is detected"},
+
+	{Env: "METABASE_RECORD", Usage: "directory to record Metabase responses and tool results to"},
+	{Env: "METABASE_REPLAY", Usage: "directory of recorded fixtures to serve Metabase responses from"},
+	{Env: "METABASE_FAULT_INJECTION", Bool: true, Usage: "enable fault injection; never set this in production"},
+	{Env: "METABASE_FAULTS", Usage: "faults to inject, e.g. latency=2s,error_rate=0.2"},
+}
+
+// errMissingSetting reports a required setting that was not given
+var errMissingSetting = errors.New("missing required setting")
+
+// settingKey returns the settings file key of an environment variable
+func settingKey(env string) string {
+	return strings.ToLower(strings.TrimPrefix(env, "METABASE_"))
+}
+
+// flagName returns the command-line flag name of the setting
+func (s setting) flagName() string {
+	if s.Flag != "" {
+		return s.Flag
+	}
+	return strings.ReplaceAll(settingKey(s.Env), "_", "-")
+}
+
+// envFlag is a flag that sets its environment variable, so flags take
+// precedence over the environment and the settings file
+type envFlag struct {
+	setting
+}
+
+func (f *envFlag) String() string {
+	return ""
+}
+
+func (f *envFlag) Set(value string) error {
+	return os.Setenv(f.Env, value)
+}
+
+func (f *envFlag) IsBoolFlag() bool {
+	return f.Bool
+}
+
+// registerSettingFlags adds a flag for every setting to fs and describes the
+// command line in its usage message
+func registerSettingFlags(fs *flag.FlagSet) {
+	for _, s := range settings {
+		fs.Var(&envFlag{s}, s.flagName(), s.Usage+" ("+s.Env+")")
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] [warm|support-bundle|replay [flags]]\n\n", fs.Name())
+		fmt.Fprintln(out, "Serves Metabase to MCP clients. Each flag can also be set with its environment")
+		fmt.Fprintln(out, "variable or in the --config file; flags override both.")
+		fmt.Fprintln(out)
+		fs.PrintDefaults()
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSettingFlags(t *testing.T) {
+	// t.Setenv restores the variables the flags set
+	for _, env := range []string{"METABASE_HOST", "METABASE_CONFIG", "METABASE_ADAPTIVE_LIMIT", "METABASE_COALESCE_QUERIES"} {
+		t.Setenv(env, "")
+	}
+
+	fs := flag.NewFlagSet("metabase-mcp", flag.ContinueOnError)
+	registerSettingFlags(fs)
+	err := fs.Parse([]string{"--host", "https://metabase.example.com", "--profiles-config=/etc/profiles.json", "--adaptive-limit", "--coalesce-queries=false", "warm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for env, want := range map[string]string{
+		"METABASE_HOST":             "https://metabase.example.com",
+		"METABASE_CONFIG":           "/etc/profiles.json",
+		"METABASE_ADAPTIVE_LIMIT":   "true",
+		"METABASE_COALESCE_QUERIES": "false",
+	} {
+		if got := os.Getenv(env); got != want {
+			t.Errorf("%s = %q, want %q", env, got, want)
+		}
+	}
+	if args := fs.Args(); len(args) != 1 || args[0] != "warm" {
+		t.Errorf("remaining arguments = %v, want the subcommand", args)
+	}
+
+	var usage bytes.Buffer
+	fs.SetOutput(&usage)
+	fs.Usage()
+	if !strings.Contains(usage.String(), "-max-rows") || !strings.Contains(usage.String(), "(METABASE_MAX_ROWS)") {
+		t.Errorf("usage lacks the max-rows flag and its variable:\n%s", usage.String())
+	}
+}
+
+func TestSettingNames(t *testing.T) {
+	envs := make(map[string]bool)
+	for _, s := range settings {
+		if !strings.HasPrefix(s.Env, "METABASE_") || envs[s.Env] {
+			t.Errorf("setting %s is duplicated or not a METABASE_ variable", s.Env)
+		}
+		envs[s.Env] = true
+	}
+	if key := settingKey("METABASE_MAX_OUTPUT_TOKENS"); key != "max_output_tokens" {
+		t.Errorf("settings file key = %q", key)
+	}
+	if name := (setting{Env: "METABASE_MAX_OUTPUT_TOKENS"}).flagName(); name != "max-output-tokens" {
+		t.Errorf("flag name = %q", name)
+	}
+}
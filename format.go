@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Output formats of tool results
+const (
+	formatJSON     = "json"
+	formatMarkdown = "markdown"
+	formatCSV      = "csv"
+	formatCompact  = "compact"
+)
+
+// validFormat reports whether format is a known output format
+func validFormat(format string) bool {
+	switch format {
+	case formatJSON, formatMarkdown, formatCSV, formatCompact:
+		return true
+	}
+	return false
+}
+
+// withFormatArgument adds the argument choosing the output format of a call
+func withFormatArgument(tool *mcp.Tool) {
+	tool.InputSchema.Properties["format"] = map[string]interface{}{
+		"type": "string",
+		"enum": []string{formatJSON, formatMarkdown, formatCSV, formatCompact},
+		"description": "Output format: indented json, a markdown table, csv, or compact single-line json; " +
+			"results that are not tables stay json. Defaults to the server's output format",
+	}
+}
+
+// formatResult renders the JSON text of a successful tool result in format.
+// Error results and results that are not JSON are returned unchanged.
+func formatResult(result *mcp.CallToolResult, format string) *mcp.CallToolResult {
+	if result == nil || result.IsError || format == formatJSON || len(result.Content) != 1 {
+		return result
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		return result
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text.Text))
+	decoder.UseNumber()
+	var v interface{}
+	if decoder.Decode(&v) != nil {
+		return result
+	}
+
+	var rendered []string
+	switch format {
+	case formatCompact:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return result
+		}
+		rendered = []string{string(encoded)}
+	case formatMarkdown:
+		rendered = []string{renderMarkdown(v)}
+	case formatCSV:
+		header, rows, rest, ok := tabular(v)
+		if !ok {
+			return result
+		}
+		rendered = []string{renderCSV(header, rows)}
+		// CSV cannot carry the other fields, such as truncation markers
+		if len(rest) > 0 {
+			encoded, err := json.Marshal(rest)
+			if err == nil {
+				rendered = append(rendered, string(encoded))
+			}
+		}
+	default:
+		return result
+	}
+
+	formatted := &mcp.CallToolResult{Result: result.Result}
+	for _, text := range rendered {
+		formatted.Content = append(formatted.Content, mcp.NewTextContent(text))
+	}
+	return formatted
+}
+
+// tabular extracts a table from a decoded result: either an object with
+// columns and rows, as query tools return, or a list of objects. The fields
+// of the object other than the table are returned in rest.
+func tabular(v interface{}) (header []string, rows [][]interface{}, rest map[string]interface{}, ok bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		columns, ok := v["columns"].([]interface{})
+		if !ok {
+			return nil, nil, nil, false
+		}
+		values, ok := v["rows"].([]interface{})
+		if !ok {
+			return nil, nil, nil, false
+		}
+		for _, col := range columns {
+			switch col := col.(type) {
+			case string:
+				header = append(header, col)
+			case map[string]interface{}:
+				name, _ := col["name"].(string)
+				header = append(header, name)
+			default:
+				return nil, nil, nil, false
+			}
+		}
+		for _, value := range values {
+			row, ok := value.([]interface{})
+			if !ok {
+				return nil, nil, nil, false
+			}
+			rows = append(rows, row)
+		}
+		rest = make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if key != "columns" && key != "rows" {
+				rest[key] = value
+			}
+		}
+		return header, rows, rest, true
+
+	case []interface{}:
+		// Columns are the union of the objects' keys, in sorted order
+		seen := map[string]bool{}
+		for _, item := range v {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, nil, nil, false
+			}
+			for key := range object {
+				if !seen[key] {
+					seen[key] = true
+					header = append(header, key)
+				}
+			}
+		}
+		sort.Strings(header)
+		for _, item := range v {
+			object := item.(map[string]interface{})
+			row := make([]interface{}, len(header))
+			for i, key := range header {
+				row[i] = object[key]
+			}
+			rows = append(rows, row)
+		}
+		return header, rows, nil, true
+	}
+	return nil, nil, nil, false
+}
+
+// cellText renders a table cell, with nested values as compact JSON
+func cellText(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return fmt.Sprint(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(encoded)
+	}
+}
+
+// renderCSV writes a table as CSV with a header row
+func renderCSV(header []string, rows [][]interface{}) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = cellText(value)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// renderMarkdown writes a table as a markdown table followed by the other
+// fields of the result, and anything else as a fenced JSON block
+func renderMarkdown(v interface{}) string {
+	header, rows, rest, ok := tabular(v)
+	if !ok {
+		encoded, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return "```json\n" + string(encoded) + "\n```\n"
+	}
+
+	var b strings.Builder
+	if len(header) == 0 {
+		b.WriteString("_No columns_\n")
+	} else {
+		writeMarkdownRow(&b, header)
+		separator := make([]string, len(header))
+		for i := range separator {
+			separator[i] = "---"
+		}
+		writeMarkdownRow(&b, separator)
+		for _, row := range rows {
+			cells := make([]string, len(row))
+			for i, value := range row {
+				cells[i] = cellText(value)
+			}
+			writeMarkdownRow(&b, cells)
+		}
+	}
+
+	keys := make([]string, 0, len(rest))
+	for key := range rest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		b.WriteString("\n")
+	}
+	for _, key := range keys {
+		fmt.Fprintf(&b, "- **%s**: %s\n", key, cellText(rest[key]))
+	}
+	return b.String()
+}
+
+// writeMarkdownRow writes one table row, escaping pipes and line breaks
+func writeMarkdownRow(b *strings.Builder, cells []string) {
+	escaper := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+	b.WriteString("|")
+	for _, cell := range cells {
+		b.WriteString(" " + escaper.Replace(cell) + " |")
+	}
+	b.WriteString("\n")
+}
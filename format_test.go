@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestFormatResult(t *testing.T) {
+	table := `{"columns": ["id", "note"], "rows": [[1, "a|b"], [2, null]], "truncated": true}`
+	list := `[{"name": "Orders", "id": 2}, {"id": 3, "tags": ["x"]}]`
+
+	tests := []struct {
+		name   string
+		text   string
+		format string
+		want   []string
+	}{
+		{"json unchanged", table, formatJSON, []string{table}},
+		{"compact", table, formatCompact, []string{`{"columns":["id","note"],"rows":[[1,"a|b"],[2,null]],"truncated":true}`}},
+		{"csv table", table, formatCSV, []string{"id,note\n1,a|b\n2,\n", `{"truncated":true}`}},
+		{"csv list", list, formatCSV, []string{"id,name,tags\n2,Orders,\n3,,\"[\"\"x\"\"]\"\n"}},
+		{"csv of a non-table", `{"id": 1}`, formatCSV, []string{`{"id": 1}`}},
+		{"markdown table", table, formatMarkdown, []string{"| id | note |\n| --- | --- |\n| 1 | a\\|b |\n| 2 |  |\n\n- **truncated**: true\n"}},
+		{"markdown of a non-table", `{"id": 1}`, formatMarkdown, []string{"```json\n{\n  \"id\": 1\n}\n```\n"}},
+		{"not json", "Card archived", formatCSV, []string{"Card archived"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := formatResult(mcp.NewToolResultText(tt.text), tt.format)
+			var got []string
+			for _, content := range result.Content {
+				got = append(got, content.(mcp.TextContent).Text)
+			}
+			if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+				t.Errorf("formatResult() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	errorResult := mcp.NewToolResultError(`{"error": "failed"}`)
+	if formatResult(errorResult, formatCSV) != errorResult {
+		t.Error("formatResult() changed an error result")
+	}
+}
+
+func TestFormatArgument(t *testing.T) {
+	r := newTestRegistry(Guardrails{}, &bytes.Buffer{})
+	r.config.OutputFormat = formatCompact
+	r.add(mcp.NewTool("list-things"), func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return jsonResult(map[string]interface{}{"columns": []string{"id"}, "rows": [][]interface{}{{1}}})
+	})
+
+	// The server's format applies unless the call asks for another
+	if response := callServerTool(t, r, "list-things", nil); !strings.Contains(response, `{\"columns\":[\"id\"],\"rows\":[[1]]}`) {
+		t.Errorf("default format response = %s, want compact json", response)
+	}
+	if response := callServerTool(t, r, "list-things", map[string]interface{}{"format": formatCSV}); !strings.Contains(response, `"text":"id\n1\n"`) {
+		t.Errorf("csv response = %s, want a csv table", response)
+	}
+}
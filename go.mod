@@ -2,7 +2,12 @@ module metabasemcp
 
 go 1.23.2
 
-require github.com/mark3labs/mcp-go v0.30.1
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/mark3labs/mcp-go v0.30.1
+	golang.org/x/sys v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// fakeRequest is a request received by a fake Metabase
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   map[string]interface{}
+}
+
+// fakeMetabase answers requests with the JSON encoding of responses, keyed by
+// "METHOD /path" or by path for any method, and records the requests. A
+// response given as a func(fakeRequest) interface{} is called for each request.
+type fakeMetabase struct {
+	responses map[string]interface{}
+
+	mu       sync.Mutex
+	requests []fakeRequest
+}
+
+// sent returns the requests received with the given method
+func (f *fakeMetabase) sent(method string) []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var requests []fakeRequest
+	for _, request := range f.requests {
+		if request.Method == method {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func (f *fakeMetabase) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	request := fakeRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Body: body}
+	f.mu.Lock()
+	f.requests = append(f.requests, request)
+	f.mu.Unlock()
+
+	response, ok := f.responses[r.Method+" "+r.URL.Path]
+	if !ok {
+		response, ok = f.responses[r.URL.Path]
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if respond, ok := response.(func(fakeRequest) interface{}); ok {
+		response = respond(request)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// newFakeMetabase returns a client for a fake Metabase serving responses
+func newFakeMetabase(t *testing.T, responses map[string]interface{}) (*MetabaseClient, *fakeMetabase) {
+	t.Helper()
+	fake := &fakeMetabase{responses: responses}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewMetabaseClient(server.URL, 1), fake
+}
+
+// newTestClient returns a client for a fake Metabase serving responses
+func newTestClient(t *testing.T, responses map[string]interface{}) *MetabaseClient {
+	t.Helper()
+	client, _ := newFakeMetabase(t, responses)
+	return client
+}
+
+// callTool calls a tool handler with the given arguments
+func callTool(t *testing.T, ctx context.Context, handler toolHandler, client *MetabaseClient, arguments map[string]interface{}) *mcp.CallToolResult {
+	t.Helper()
+	result, err := handler(ctx, client, newRequest(arguments))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	return result
+}
+
+// newRequest builds a tool call request with the given arguments
+func newRequest(arguments map[string]interface{}) mcp.CallToolRequest {
+	var request mcp.CallToolRequest
+	request.Params.Arguments = arguments
+	return request
+}
+
+// decodeResult decodes the JSON text of a successful tool result
+func decodeResult(t *testing.T, result *mcp.CallToolResult) map[string]interface{} {
+	t.Helper()
+	if result.IsError {
+		t.Fatalf("tool returned error: %s", resultText(result))
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(resultText(result)), &decoded); err != nil {
+		t.Fatalf("failed to decode result %q: %v", resultText(result), err)
+	}
+	return decoded
+}
+
+// testSession is a client session of a given ID
+type testSession string
+
+func (s testSession) Initialize()                                         {}
+func (s testSession) Initialized() bool                                   { return true }
+func (s testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return nil }
+func (s testSession) SessionID() string                                   { return string(s) }
+
+// sessionContext returns the context of a tool call made in session id
+func sessionContext(id string) context.Context {
+	return server.NewMCPServer("test", "0").WithContext(context.Background(), testSession(id))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryHistoryEntry records a query executed through the server. Profiles
+// may point at different Metabase instances, so database IDs are only
+// meaningful together with the profile.
+type QueryHistoryEntry struct {
+	Profile    string        `json:"profile"`
+	DatabaseID int           `json:"database_id"`
+	Query      string        `json:"query"`
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   time.Duration `json:"duration"`
+	RowCount   int           `json:"row_count"`
+	Status     string        `json:"status"`
+}
+
+// queryHistory is a bounded in-memory log of executed queries
+type queryHistory struct {
+	mu      sync.Mutex
+	entries []QueryHistoryEntry
+	limit   int
+}
+
+// newQueryHistory creates a history retaining at most limit entries
+func newQueryHistory(limit int) *queryHistory {
+	return &queryHistory{limit: limit}
+}
+
+// record appends an entry, dropping the oldest once the limit is reached
+func (h *queryHistory) record(entry QueryHistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+}
+
+// snapshot returns a copy of the recorded entries, oldest first
+func (h *queryHistory) snapshot() []QueryHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]QueryHistoryEntry, len(h.entries))
+	copy(entries, h.entries)
+	return entries
+}
+
+// referencedTables extracts the lowercased names of the tables a SQL query reads from
+func referencedTables(query string) []string {
+	var tables []string
+	for _, ref := range queryTableRefs(query) {
+		if !ref.function {
+			tables = append(tables, ref.name())
+		}
+	}
+	return tables
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Query job states
+const (
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// queryJob is a query running in the background on behalf of a client session
+type queryJob struct {
+	ID         string
+	Session    string
+	Query      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	State      string
+	Result     *mcp.CallToolResult
+	cancel     context.CancelFunc
+}
+
+// jobStore keeps the query jobs of each client session, forgetting the
+// oldest finished jobs beyond its limit
+type jobStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*queryJob
+	order []string
+	limit int
+}
+
+// newJobStore creates a store keeping at most limit jobs
+func newJobStore(limit int) *jobStore {
+	return &jobStore{jobs: make(map[string]*queryJob), limit: limit}
+}
+
+// start runs fn in the background as a job of the session. The job keeps
+// running when the call that started it returns.
+func (s *jobStore) start(ctx context.Context, session, query string, fn func(ctx context.Context) (*mcp.CallToolResult, error)) *queryJob {
+	id := make([]byte, 8)
+	rand.Read(id)
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job := &queryJob{
+		ID:        hex.EncodeToString(id),
+		Session:   session,
+		Query:     query,
+		StartedAt: time.Now().UTC(),
+		State:     jobRunning,
+		cancel:    cancel,
+	}
+
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	s.evict()
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		result, err := fn(ctx)
+		if err != nil {
+			result = mcp.NewToolResultError(err.Error())
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if job.State != jobRunning {
+			return
+		}
+		job.FinishedAt = time.Now().UTC()
+		job.Result = result
+		job.State = jobCompleted
+		if result == nil || result.IsError {
+			job.State = jobFailed
+		}
+	}()
+	return job
+}
+
+// evict forgets the oldest finished jobs while the store is over its limit
+func (s *jobStore) evict() {
+	for i := 0; len(s.jobs) > s.limit && i < len(s.order); {
+		if job := s.jobs[s.order[i]]; job.State != jobRunning {
+			delete(s.jobs, job.ID)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// get returns a copy of the session's job with the given ID
+func (s *jobStore) get(session, id string) (queryJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Session != session {
+		return queryJob{}, false
+	}
+	return *job, true
+}
+
+// cancelJob stops a running job of the session
+func (s *jobStore) cancelJob(session, id string) (queryJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Session != session {
+		return queryJob{}, false
+	}
+	if job.State == jobRunning {
+		job.cancel()
+		job.State = jobCancelled
+		job.FinishedAt = time.Now().UTC()
+	}
+	return *job, true
+}
+
+// clear cancels and forgets the jobs of a session that has ended
+func (s *jobStore) clear(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order := s.order[:0]
+	for _, id := range s.order {
+		job := s.jobs[id]
+		if job.Session != session {
+			order = append(order, id)
+			continue
+		}
+		job.cancel()
+		delete(s.jobs, id)
+	}
+	s.order = order
+}
+
+// status describes the job without its result
+func (j queryJob) status() map[string]interface{} {
+	status := map[string]interface{}{
+		"job_id":     j.ID,
+		"state":      j.State,
+		"query":      j.Query,
+		"started_at": j.StartedAt,
+	}
+	if j.FinishedAt.IsZero() {
+		status["elapsed_ms"] = time.Since(j.StartedAt).Milliseconds()
+	} else {
+		status["finished_at"] = j.FinishedAt
+		status["elapsed_ms"] = j.FinishedAt.Sub(j.StartedAt).Milliseconds()
+	}
+	if j.State == jobFailed && j.Result != nil {
+		status["error"] = resultText(j.Result)
+	}
+	return status
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// waitForJob waits until the session's job has finished
+func waitForJob(t *testing.T, s *jobStore, session, id string) queryJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, ok := s.get(session, id)
+		if !ok {
+			t.Fatalf("job %s is gone", id)
+		}
+		if job.State != jobRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still running", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestJobStore(t *testing.T) {
+	s := newJobStore(10)
+
+	completed := s.start(context.Background(), "a", "SELECT 1", func(ctx context.Context) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("done"), nil
+	})
+	failed := s.start(context.Background(), "a", "SELECT 2", func(ctx context.Context) (*mcp.CallToolResult, error) {
+		return nil, errors.New("connection reset")
+	})
+	if job := waitForJob(t, s, "a", completed.ID); job.State != jobCompleted || resultText(job.Result) != "done" {
+		t.Errorf("completed job = %s, %v", job.State, job.Result)
+	}
+	job := waitForJob(t, s, "a", failed.ID)
+	if job.State != jobFailed || job.status()["error"] != "connection reset" {
+		t.Errorf("failed job = %v", job.status())
+	}
+
+	// Jobs belong to the session that started them
+	if _, ok := s.get("b", completed.ID); ok {
+		t.Error("another session found the job")
+	}
+	if _, ok := s.cancelJob("b", completed.ID); ok {
+		t.Error("another session cancelled the job")
+	}
+}
+
+func TestJobStoreCancel(t *testing.T) {
+	s := newJobStore(10)
+	release := make(chan struct{})
+	stopped := make(chan struct{})
+	job := s.start(context.Background(), "a", "SELECT pg_sleep(600)", func(ctx context.Context) (*mcp.CallToolResult, error) {
+		<-ctx.Done()
+		close(stopped)
+		<-release
+		return mcp.NewToolResultText("late"), nil
+	})
+
+	cancelled, ok := s.cancelJob("a", job.ID)
+	if !ok || cancelled.State != jobCancelled {
+		t.Fatalf("cancelJob() = %v, %v, want cancelled", cancelled.State, ok)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job's context was not cancelled")
+	}
+
+	// A result arriving after the cancellation is dropped
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	if got, _ := s.get("a", job.ID); got.State != jobCancelled || got.Result != nil {
+		t.Errorf("job after cancellation = %s, %v", got.State, got.Result)
+	}
+}
+
+func TestJobStoreLimit(t *testing.T) {
+	s := newJobStore(2)
+	block := make(chan struct{})
+	defer close(block)
+	running := s.start(context.Background(), "a", "SELECT 1", func(ctx context.Context) (*mcp.CallToolResult, error) {
+		<-block
+		return mcp.NewToolResultText("done"), nil
+	})
+	var finished []string
+	for i := 0; i < 3; i++ {
+		job := s.start(context.Background(), "a", "SELECT 2", func(ctx context.Context) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("done"), nil
+		})
+		waitForJob(t, s, "a", job.ID)
+		finished = append(finished, job.ID)
+	}
+
+	// The oldest finished jobs go first; running jobs are kept
+	if _, ok := s.get("a", running.ID); !ok {
+		t.Error("the running job was evicted")
+	}
+	if _, ok := s.get("a", finished[0]); ok {
+		t.Error("the oldest finished job was kept")
+	}
+
+	s.clear("a")
+	if _, ok := s.get("a", running.ID); ok {
+		t.Error("clear kept the session's jobs")
+	}
+}
+
+func TestJobTools(t *testing.T) {
+	r, client, _ := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} { return datasetResponse(3) })
+	r.jobs = newJobStore(10)
+	ctx := withProfile(sessionContext("a"), &Profile{Name: "default", DatabaseID: 1})
+
+	started := decodeResult(t, callTool(t, ctx, r.handleStartQuery, client, map[string]interface{}{"query": "SELECT id, name FROM customers"}))
+	id, _ := started["job_id"].(string)
+	if started["state"] != jobRunning || id == "" {
+		t.Fatalf("start-query = %v, want a running job", started)
+	}
+
+	waitForJob(t, r.jobs, "a", id)
+	status := decodeResult(t, callTool(t, ctx, r.handleQueryStatus, client, map[string]interface{}{"job_id": id}))
+	if status["state"] != jobCompleted {
+		t.Errorf("query-status = %v, want completed", status)
+	}
+	result := decodeResult(t, callTool(t, ctx, r.handleFetchResult, client, map[string]interface{}{"job_id": id}))
+	if result["row_count"] != 3.0 {
+		t.Errorf("fetch-result = %v, want the query's 3 rows", result)
+	}
+
+	other := callTool(t, withProfile(sessionContext("b"), &Profile{Name: "default", DatabaseID: 1}), r.handleFetchResult, client, map[string]interface{}{"job_id": id})
+	if !other.IsError || !strings.Contains(resultText(other), "unknown job") {
+		t.Errorf("fetch-result from another session = %s, want unknown job", resultText(other))
+	}
+}
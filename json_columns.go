@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Ways of returning JSON column values
+const (
+	jsonRaw    = "raw"
+	jsonPretty = "pretty"
+)
+
+// jsonBaseTypes are the Metabase types of semi-structured JSON columns
+var jsonBaseTypes = map[string]bool{
+	"type/JSON":           true,
+	"type/SerializedJSON": true,
+	"type/Structured":     true,
+}
+
+// jsonDatabaseTypePattern matches database column types holding JSON documents
+var jsonDatabaseTypePattern = regexp.MustCompile(`(?i)^jsonb?$`)
+
+// JSONColumnOptions selects how the JSON columns of a result are rendered
+type JSONColumnOptions struct {
+	// Mode is raw to keep values as returned, or pretty to return them as nested JSON
+	Mode string
+	// Flatten lists columns whose top-level keys become columns, or
+	// column:$.path entries adding one column per path
+	Flatten []string
+	// Extract maps columns to a JSONPath replacing each value with its match
+	Extract map[string]string
+}
+
+// JSONColumnNote describes how a JSON column of a result was handled
+type JSONColumnNote struct {
+	Name        string   `json:"name"`
+	Handling    string   `json:"handling"`
+	Path        string   `json:"path,omitempty"`
+	Added       []string `json:"added_columns,omitempty"`
+	InvalidRows int      `json:"invalid_rows,omitempty"`
+}
+
+// isJSONColumn reports whether a result column holds JSON documents
+func isJSONColumn(col Column) bool {
+	return jsonBaseTypes[col.BaseType] || jsonBaseTypes[col.EffectiveType] || jsonDatabaseTypePattern.MatchString(col.DatabaseType)
+}
+
+// parseJSONColumnOptions reads the json_* arguments of a query tool call
+func parseJSONColumnOptions(arguments map[string]interface{}, defaultMode string) JSONColumnOptions {
+	opts := JSONColumnOptions{Mode: defaultMode, Extract: make(map[string]string)}
+	if mode, ok := arguments["json_columns"].(string); ok && mode != "" {
+		opts.Mode = mode
+	}
+	if flatten, ok := arguments["json_flatten"].([]interface{}); ok {
+		for _, entry := range flatten {
+			if s, ok := entry.(string); ok && s != "" {
+				opts.Flatten = append(opts.Flatten, s)
+			}
+		}
+	}
+	if extract, ok := arguments["json_extract"].(map[string]interface{}); ok {
+		for column, path := range extract {
+			if s, ok := path.(string); ok {
+				opts.Extract[column] = s
+			}
+		}
+	}
+	return opts
+}
+
+// handleJSONColumns applies opts to the JSON columns of data: flattened paths
+// are appended as new columns, extracted paths replace the column values, and
+// in pretty mode the remaining JSON values are returned as nested JSON rather
+// than escaped strings. Flatten and extract may name any column holding JSON.
+func handleJSONColumns(data *MetabaseData, opts JSONColumnOptions) ([]JSONColumnNote, error) {
+	columnIndex := make(map[string]int, len(data.Cols))
+	for i, col := range data.Cols {
+		columnIndex[col.Name] = i
+	}
+	lookup := func(name string) (int, error) {
+		i, ok := columnIndex[name]
+		if !ok {
+			return 0, fmt.Errorf("json column %q is not in the result", name)
+		}
+		return i, nil
+	}
+
+	// Parse each JSON value once; values that do not parse are left as they are
+	parsed := make(map[int][]interface{})
+	invalid := make(map[int]int)
+	parse := func(i int) []interface{} {
+		if values, ok := parsed[i]; ok {
+			return values
+		}
+		values := make([]interface{}, len(data.Rows))
+		for r, row := range data.Rows {
+			if i >= len(row) || row[i] == nil {
+				continue
+			}
+			value, ok := parseJSONValue(row[i])
+			if !ok {
+				invalid[i]++
+				value = row[i]
+			}
+			values[r] = value
+		}
+		parsed[i] = values
+		return values
+	}
+
+	var notes []JSONColumnNote
+	handled := make(map[int]bool)
+
+	// Flatten: new columns at the end of the result
+	for _, entry := range opts.Flatten {
+		column, path, hasPath := strings.Cut(entry, ":")
+		i, err := lookup(column)
+		if err != nil {
+			return nil, err
+		}
+		values := parse(i)
+
+		var paths []string
+		if hasPath {
+			paths = []string{path}
+		} else {
+			paths = topLevelKeyPaths(values)
+		}
+
+		note := JSONColumnNote{Name: column, Handling: "flatten", Path: path}
+		for _, p := range paths {
+			steps, err := parseJSONPath(p)
+			if err != nil {
+				return nil, err
+			}
+			name := column + "." + strings.TrimPrefix(strings.TrimPrefix(p, "$"), ".")
+			data.Cols = append(data.Cols, Column{Name: name, DisplayName: name, Source: "json_path", BaseType: "type/*"})
+			for r := range data.Rows {
+				data.Rows[r] = append(data.Rows[r], evalJSONPath(values[r], steps))
+			}
+			note.Added = append(note.Added, name)
+		}
+		notes = append(notes, note)
+	}
+
+	// Extract: the column value becomes the match of its path
+	extracted := make([]string, 0, len(opts.Extract))
+	for column := range opts.Extract {
+		extracted = append(extracted, column)
+	}
+	sort.Strings(extracted)
+	for _, column := range extracted {
+		i, err := lookup(column)
+		if err != nil {
+			return nil, err
+		}
+		steps, err := parseJSONPath(opts.Extract[column])
+		if err != nil {
+			return nil, err
+		}
+		values := parse(i)
+		for r, row := range data.Rows {
+			if i < len(row) {
+				row[i] = evalJSONPath(values[r], steps)
+			}
+		}
+		handled[i] = true
+		notes = append(notes, JSONColumnNote{Name: column, Handling: "extract", Path: opts.Extract[column]})
+	}
+
+	// Pretty: remaining JSON columns become nested JSON
+	if opts.Mode == jsonPretty {
+		for i, col := range data.Cols {
+			if handled[i] || !isJSONColumn(col) {
+				continue
+			}
+			values := parse(i)
+			for r, row := range data.Rows {
+				if i < len(row) {
+					row[i] = values[r]
+				}
+			}
+			notes = append(notes, JSONColumnNote{Name: col.Name, Handling: jsonPretty})
+		}
+	}
+
+	for n := range notes {
+		notes[n].InvalidRows = invalid[columnIndex[notes[n].Name]]
+	}
+	return notes, nil
+}
+
+// parseJSONValue decodes a JSON document serialized as a string. Values that
+// are already structured are returned unchanged.
+func parseJSONValue(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return v, true
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// topLevelKeyPaths returns a path for every top-level key of the object values, sorted
+func topLevelKeyPaths(values []interface{}) []string {
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if object, ok := value.(map[string]interface{}); ok {
+			for key := range object {
+				seen[key] = true
+			}
+		}
+	}
+	paths := make([]string, 0, len(seen))
+	for key := range seen {
+		paths = append(paths, "$."+key)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// jsonPathStep is one step of a JSONPath: an object key, an array index, or a wildcard
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// jsonPathStepPattern matches one step of the supported JSONPath subset:
+// .key, ['key'], [n] and [*] or .*
+var jsonPathStepPattern = regexp.MustCompile(`^(?:\.([A-Za-z_][\w-]*|\*)|\['([^']*)'\]|\[(\d+|\*)\])`)
+
+// parseJSONPath parses a JSONPath such as $.items[0].sku or $['user id'][*]
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	var steps []jsonPathStep
+	for rest != "" {
+		m := jsonPathStepPattern.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("invalid JSONPath %q near %q", path, rest)
+		}
+		rest = rest[len(m[0]):]
+		switch {
+		case m[1] == "*" || m[3] == "*":
+			steps = append(steps, jsonPathStep{wildcard: true})
+		case m[1] != "":
+			steps = append(steps, jsonPathStep{key: m[1]})
+		case m[3] != "":
+			index, _ := strconv.Atoi(m[3])
+			steps = append(steps, jsonPathStep{index: index, isIndex: true})
+		default:
+			steps = append(steps, jsonPathStep{key: m[2]})
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns the value at steps within v, or nil when it is absent.
+// Wildcards return an array of the matches.
+func evalJSONPath(v interface{}, steps []jsonPathStep) interface{} {
+	for n, step := range steps {
+		switch {
+		case step.wildcard:
+			var children []interface{}
+			switch value := v.(type) {
+			case []interface{}:
+				children = value
+			case map[string]interface{}:
+				keys := make([]string, 0, len(value))
+				for key := range value {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					children = append(children, value[key])
+				}
+			default:
+				return nil
+			}
+			matches := make([]interface{}, 0, len(children))
+			for _, child := range children {
+				if match := evalJSONPath(child, steps[n+1:]); match != nil {
+					matches = append(matches, match)
+				}
+			}
+			return matches
+		case step.isIndex:
+			array, ok := v.([]interface{})
+			if !ok || step.index >= len(array) {
+				return nil
+			}
+			v = array[step.index]
+		default:
+			object, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = object[step.key]
+		}
+	}
+	return v
+}
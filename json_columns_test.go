@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEvalJSONPath(t *testing.T) {
+	var document interface{}
+	json.Unmarshal([]byte(`{"user id": 7, "items": [{"sku": "A", "qty": 2}, {"sku": "B"}], "tags": {"b": 2, "a": 1}}`), &document)
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"$['user id']", 7.0},
+		{"$.items[0].sku", "A"},
+		{"items[1].sku", "B"},
+		{"$.items[*].qty", []interface{}{2.0}},
+		{"$.tags.*", []interface{}{1.0, 2.0}},
+		{"$.items[5].sku", nil},
+		{"$.missing.key", nil},
+		{"$", document},
+	}
+	for _, tt := range tests {
+		steps, err := parseJSONPath(tt.path)
+		if err != nil {
+			t.Errorf("parseJSONPath(%q): %v", tt.path, err)
+			continue
+		}
+		if got := evalJSONPath(document, steps); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("evalJSONPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"$.items[x]", "$..sku", "$['open"} {
+		if _, err := parseJSONPath(invalid); err == nil {
+			t.Errorf("parseJSONPath(%q) succeeded", invalid)
+		}
+	}
+}
+
+// jsonData is a result with an id column and a JSON column serialized as strings
+func jsonData() MetabaseData {
+	return MetabaseData{
+		Cols: []Column{{Name: "id", BaseType: "type/Integer"}, {Name: "attrs", BaseType: "type/JSON"}},
+		Rows: [][]interface{}{
+			{1.0, `{"plan": "pro", "seats": 5}`},
+			{2.0, `{"plan": "free"}`},
+			{3.0, `not json`},
+		},
+	}
+}
+
+func TestHandleJSONColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    JSONColumnOptions
+		cols    []string
+		values  []interface{}
+		handled string
+	}{
+		{
+			"raw",
+			JSONColumnOptions{Mode: jsonRaw},
+			[]string{"id", "attrs"},
+			[]interface{}{`{"plan": "pro", "seats": 5}`, `{"plan": "free"}`, `not json`},
+			"",
+		},
+		{
+			"pretty",
+			JSONColumnOptions{Mode: jsonPretty},
+			[]string{"id", "attrs"},
+			[]interface{}{map[string]interface{}{"plan": "pro", "seats": 5.0}, map[string]interface{}{"plan": "free"}, `not json`},
+			jsonPretty,
+		},
+		{
+			"extract",
+			JSONColumnOptions{Extract: map[string]string{"attrs": "$.plan"}},
+			[]string{"id", "attrs"},
+			[]interface{}{"pro", "free", nil},
+			"extract",
+		},
+		{
+			"flatten every key",
+			JSONColumnOptions{Flatten: []string{"attrs"}},
+			[]string{"id", "attrs", "attrs.plan", "attrs.seats"},
+			[]interface{}{5.0, nil, nil},
+			"flatten",
+		},
+		{
+			"flatten one path",
+			JSONColumnOptions{Flatten: []string{"attrs:$.seats"}},
+			[]string{"id", "attrs", "attrs.seats"},
+			[]interface{}{5.0, nil, nil},
+			"flatten",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := jsonData()
+			notes, err := handleJSONColumns(&data, tt.opts)
+			if err != nil {
+				t.Fatalf("handleJSONColumns: %v", err)
+			}
+
+			cols := make([]string, len(data.Cols))
+			for i, col := range data.Cols {
+				cols[i] = col.Name
+			}
+			if !reflect.DeepEqual(cols, tt.cols) {
+				t.Errorf("cols = %v, want %v", cols, tt.cols)
+			}
+			// The last column holds the values of interest
+			for r, row := range data.Rows {
+				if got := row[len(row)-1]; !reflect.DeepEqual(got, tt.values[r]) {
+					t.Errorf("row %d = %v, want %v", r, got, tt.values[r])
+				}
+			}
+
+			if tt.handled == "" {
+				if len(notes) != 0 {
+					t.Errorf("notes = %+v, want none", notes)
+				}
+				return
+			}
+			if len(notes) != 1 || notes[0].Name != "attrs" || notes[0].Handling != tt.handled || notes[0].InvalidRows != 1 {
+				t.Errorf("notes = %+v, want attrs %s with one invalid row", notes, tt.handled)
+			}
+		})
+	}
+
+	data := jsonData()
+	if _, err := handleJSONColumns(&data, JSONColumnOptions{Extract: map[string]string{"profile": "$.plan"}}); err == nil {
+		t.Errorf("extracted from a column missing from the result")
+	}
+}
+
+func TestParseJSONColumnOptions(t *testing.T) {
+	opts := parseJSONColumnOptions(map[string]interface{}{
+		"json_flatten": []interface{}{"attrs", "", "meta:$.a"},
+		"json_extract": map[string]interface{}{"attrs": "$.plan", "ignored": 1.0},
+	}, jsonRaw)
+	want := JSONColumnOptions{Mode: jsonRaw, Flatten: []string{"attrs", "meta:$.a"}, Extract: map[string]string{"attrs": "$.plan"}}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("options = %+v, want %+v", opts, want)
+	}
+	if opts := parseJSONColumnOptions(map[string]interface{}{"json_columns": jsonPretty}, jsonRaw); opts.Mode != jsonPretty {
+		t.Errorf("mode = %q, want the argument to override the default", opts.Mode)
+	}
+}
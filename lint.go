@@ -0,0 +1,142 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// LintFinding describes a potential problem found in a SQL query
+type LintFinding struct {
+	Rule       string `json:"rule"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// lintRule matches a warehouse anti-pattern in a normalized query
+type lintRule struct {
+	name       string
+	severity   string
+	pattern    *regexp.Regexp
+	applies    func(sql string) bool
+	message    string
+	suggestion string
+}
+
+var (
+	sqlLineCommentPattern  = regexp.MustCompile(`--[^\n]*`)
+	sqlBlockCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	sqlStringPattern       = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlWhitespacePattern   = regexp.MustCompile(`\s+`)
+	sqlLimitPattern        = regexp.MustCompile(`(?i)\b(limit|top|fetch\s+first)\b`)
+	sqlAggregatePattern    = regexp.MustCompile(`(?i)\b(count|sum|avg|min|max)\s*\(|\bgroup\s+by\b`)
+)
+
+// lintRules are checked in order against every query
+var lintRules = []lintRule{
+	{
+		name:       "function-on-filtered-column",
+		severity:   "warning",
+		pattern:    regexp.MustCompile(`(?i)\b(where|and|or)\s+(lower|upper|trim|substr|substring|coalesce|cast|to_char|concat)\s*\(\s*[a-z_][\w.]*`),
+		message:    "A function is applied to a column in the WHERE clause, which prevents index use and partition pruning",
+		suggestion: "Compare the raw column against a transformed constant, or filter on a precomputed/normalized column",
+	},
+	{
+		name:       "non-sargable-date-filter",
+		severity:   "warning",
+		pattern:    regexp.MustCompile(`(?i)\b(where|and|or)\s+((date|year|month|day|date_trunc|date_format|extract|to_date)\s*\(|[a-z_][\w.]*\s*::\s*date\b)`),
+		message:    "The date filter wraps the column in a function, so the warehouse has to scan every row",
+		suggestion: "Use a half-open range on the raw column, e.g. created_at >= '2024-01-01' AND created_at < '2024-02-01'",
+	},
+	{
+		name:       "implicit-cross-join",
+		severity:   "warning",
+		pattern:    regexp.MustCompile(`(?i)\bfrom\s+[\w."]+(\s+(as\s+)?\w+)?\s*,\s*[\w."]+`),
+		message:    "Tables are listed with commas in FROM; a missing join condition silently produces a cross join",
+		suggestion: "Use explicit JOIN ... ON syntax so every join has a visible condition",
+	},
+	{
+		name:       "distinct-without-limit",
+		severity:   "warning",
+		pattern:    regexp.MustCompile(`(?i)\bselect\s+distinct\b`),
+		applies:    func(sql string) bool { return !sqlLimitPattern.MatchString(sql) },
+		message:    "SELECT DISTINCT over an unbounded result forces a full sort or hash of every row",
+		suggestion: "Add a LIMIT, filter first, or use GROUP BY on the columns you actually need",
+	},
+	{
+		name:       "leading-wildcard-like",
+		severity:   "warning",
+		pattern:    regexp.MustCompile(`(?i)\blike\s+'%`),
+		message:    "LIKE with a leading wildcard cannot use an index",
+		suggestion: "Anchor the pattern at the start, or use the warehouse's full-text search",
+	},
+	{
+		name:       "not-in-subquery",
+		severity:   "warning",
+		pattern:    regexp.MustCompile(`(?i)\bnot\s+in\s*\(\s*select\b`),
+		message:    "NOT IN with a subquery returns no rows if the subquery yields a NULL and is often slow",
+		suggestion: "Use NOT EXISTS or a LEFT JOIN ... WHERE key IS NULL",
+	},
+	{
+		name:       "order-by-random",
+		severity:   "warning",
+		pattern:    regexp.MustCompile(`(?i)\border\s+by\s+(rand|random|newid)\s*\(`),
+		message:    "Ordering by a random value sorts the entire table",
+		suggestion: "Use TABLESAMPLE or filter on a hash of the key to sample rows",
+	},
+	{
+		name:       "select-star",
+		severity:   "info",
+		pattern:    regexp.MustCompile(`(?i)\bselect\s+(\w+\.)?\*`),
+		message:    "SELECT * reads every column, which is costly on columnar warehouses",
+		suggestion: "List only the columns you need",
+	},
+	{
+		name:     "unbounded-result",
+		severity: "info",
+		pattern:  regexp.MustCompile(`(?i)^\s*(with\b.*)?select\b`),
+		applies: func(sql string) bool {
+			return !sqlLimitPattern.MatchString(sql) && !sqlAggregatePattern.MatchString(sql)
+		},
+		message:    "The query has no LIMIT and no aggregation, so it may return a very large result",
+		suggestion: "Add a LIMIT while exploring",
+	},
+}
+
+// lintQuery checks a SQL query for common warehouse anti-patterns
+func lintQuery(query string) []LintFinding {
+	// Comments never matter; string literals only matter for LIKE patterns
+	withoutComments := sqlBlockCommentPattern.ReplaceAllString(sqlLineCommentPattern.ReplaceAllString(query, " "), " ")
+	normalized := sqlWhitespacePattern.ReplaceAllString(withoutComments, " ")
+	withoutStrings := sqlStringPattern.ReplaceAllString(normalized, "''")
+
+	findings := make([]LintFinding, 0)
+	for _, rule := range lintRules {
+		sql := withoutStrings
+		if rule.name == "leading-wildcard-like" {
+			sql = normalized
+		}
+		if !rule.pattern.MatchString(sql) {
+			continue
+		}
+		if rule.applies != nil && !rule.applies(sql) {
+			continue
+		}
+		findings = append(findings, LintFinding{
+			Rule:       rule.name,
+			Severity:   rule.severity,
+			Message:    rule.message,
+			Suggestion: rule.suggestion,
+		})
+	}
+	return findings
+}
+
+// lintSummary counts findings per severity
+func lintSummary(findings []LintFinding) map[string]int {
+	summary := make(map[string]int)
+	for _, finding := range findings {
+		summary[strings.ToLower(finding.Severity)]++
+	}
+	return summary
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		rules []string
+	}{
+		{"clean", "SELECT id, total FROM orders WHERE created_at >= '2024-01-01' LIMIT 10", []string{}},
+		{"aggregate without limit", "SELECT status, count(*) FROM orders GROUP BY status", []string{}},
+		{"function on filtered column", "SELECT id FROM users WHERE lower(email) = 'a@b.c' LIMIT 1", []string{"function-on-filtered-column"}},
+		{"non-sargable date filter", "SELECT id FROM orders WHERE created_at::date = '2024-01-01' LIMIT 5", []string{"non-sargable-date-filter"}},
+		{"implicit cross join", "SELECT o.id FROM orders o, users u LIMIT 5", []string{"implicit-cross-join"}},
+		{"distinct without limit", "SELECT DISTINCT country FROM users", []string{"distinct-without-limit", "unbounded-result"}},
+		{"leading wildcard like", "SELECT id FROM users WHERE name LIKE '%son' LIMIT 5", []string{"leading-wildcard-like"}},
+		{"not in subquery", "SELECT id FROM users WHERE id NOT IN (SELECT user_id FROM bans) LIMIT 5", []string{"not-in-subquery"}},
+		{"order by random", "SELECT id FROM users ORDER BY random() LIMIT 5", []string{"order-by-random"}},
+		{"select star", "SELECT u.* FROM users u LIMIT 5", []string{"select-star"}},
+		{"comments are ignored", "-- SELECT DISTINCT x FROM y\nSELECT id FROM users /* , other */ LIMIT 5", []string{}},
+		{"strings are ignored", "SELECT id FROM users WHERE note = 'where lower(x)' LIMIT 5", []string{}},
+		{"not a select", "UPDATE users SET name = 'x'", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := make([]string, 0)
+			for _, finding := range lintQuery(tt.query) {
+				rules = append(rules, finding.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("lintQuery(%q) = %v, want %v", tt.query, rules, tt.rules)
+			}
+		})
+	}
+}
+
+func TestLintSummary(t *testing.T) {
+	summary := lintSummary(lintQuery("SELECT * FROM users ORDER BY random()"))
+	want := map[string]int{"warning": 1, "info": 2}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("lintSummary = %v, want %v", summary, want)
+	}
+}
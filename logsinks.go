@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openLogSinks opens a comma-separated list of log destinations and returns a
+// writer fanning out to all of them. Supported destinations:
+//
+//	stderr
+//	file:/path?max_size_mb=100&max_backups=5&max_age=168h (a bare path is a file too)
+//	syslog or syslog:tag, journald (the local syslog socket, which journald serves)
+func openLogSinks(specs, tag string) (io.Writer, error) {
+	var writers []io.Writer
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		w, err := openLogSink(spec, tag)
+		if err != nil {
+			return nil, fmt.Errorf("log destination %q: %w", spec, err)
+		}
+		writers = append(writers, w)
+	}
+
+	switch len(writers) {
+	case 0:
+		return os.Stderr, nil
+	case 1:
+		return writers[0], nil
+	default:
+		return io.MultiWriter(writers...), nil
+	}
+}
+
+// openLogSink opens a single log destination
+func openLogSink(spec, tag string) (io.Writer, error) {
+	scheme, target, _ := strings.Cut(spec, ":")
+	switch scheme {
+	case "stderr":
+		return os.Stderr, nil
+	case "syslog", "journald":
+		if target != "" {
+			tag = target
+		}
+		return openSyslog(tag)
+	case "file":
+		return openRotatingFile(target)
+	default:
+		return openRotatingFile(spec)
+	}
+}
+
+// rotatingFile is a log file that is rotated once it reaches a size limit,
+// keeping a bounded number of backups for a bounded time
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens a file destination of the form /path?max_size_mb=..&max_backups=..&max_age=..
+func openRotatingFile(spec string) (*rotatingFile, error) {
+	path, rawQuery, _ := strings.Cut(spec, "?")
+	if path == "" {
+		return nil, fmt.Errorf("missing file path")
+	}
+	options, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	f := &rotatingFile{path: path, maxBackups: 5}
+	if value := options.Get("max_size_mb"); value != "" {
+		mb, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_size_mb %q", value)
+		}
+		f.maxSize = int64(mb) << 20
+	}
+	if value := options.Get("max_backups"); value != "" {
+		if f.maxBackups, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid max_backups %q", value)
+		}
+	}
+	if value := options.Get("max_age"); value != "" {
+		if f.maxAge, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid max_age %q", value)
+		}
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file for appending
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first when it would exceed the size limit
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file to a timestamped backup, opens a fresh one
+// and prunes backups beyond the count or age limits
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	backup := f.path + "." + time.Now().UTC().Format("20060102T150405.000")
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	backups, _ := filepath.Glob(f.path + ".*")
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, name := range backups {
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		expired := f.maxAge > 0 && time.Since(info.ModTime()) > f.maxAge
+		if (f.maxBackups > 0 && i >= f.maxBackups) || expired {
+			os.Remove(name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenLogSinks(t *testing.T) {
+	dir := t.TempDir()
+	if w, err := openLogSinks(" ", "metabase-mcp"); err != nil || w != os.Stderr {
+		t.Errorf("no destinations = %v, %v, want stderr", w, err)
+	}
+	if w, err := openLogSinks("stderr", "metabase-mcp"); err != nil || w != os.Stderr {
+		t.Errorf("stderr = %v, %v", w, err)
+	}
+
+	first, second := filepath.Join(dir, "logs", "first.log"), filepath.Join(dir, "second.log")
+	w, err := openLogSinks("file:"+first+"?max_size_mb=1, "+second, "metabase-mcp")
+	if err != nil {
+		t.Fatalf("openLogSinks: %v", err)
+	}
+	fmt.Fprintln(w, "started")
+	for _, path := range []string{first, second} {
+		if data, _ := os.ReadFile(path); string(data) != "started\n" {
+			t.Errorf("%s holds %q", path, data)
+		}
+	}
+
+	for _, spec := range []string{"file:", "file:" + first + "?max_size_mb=big", "file:" + first + "?max_backups=x", "file:" + first + "?max_age=week"} {
+		if _, err := openLogSinks(spec, "metabase-mcp"); err == nil {
+			t.Errorf("opened %q without an error", spec)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	f, err := openRotatingFile(path + "?max_backups=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.maxSize = 10
+
+	for i := 0; i < 4; i++ {
+		// Backups are named to the millisecond
+		time.Sleep(2 * time.Millisecond)
+		if _, err := f.Write([]byte(fmt.Sprintf("line %d..\n", i))); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	f.file.Close()
+
+	if data, _ := os.ReadFile(path); string(data) != "line 3..\n" {
+		t.Errorf("current file holds %q, want only the last line", data)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want the newest two", backups)
+	}
+	for i, backup := range backups {
+		if data, _ := os.ReadFile(backup); !strings.HasPrefix(string(data), fmt.Sprintf("line %d", i+1)) {
+			t.Errorf("backup %s holds %q", backup, data)
+		}
+	}
+}
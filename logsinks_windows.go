@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// openSyslog is not available on Windows; use a file or stderr destination
+func openSyslog(tag string) (io.Writer, error) {
+	return nil, errors.New("syslog is not supported on Windows")
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -22,6 +24,14 @@ type MetabaseQuery struct {
 	Database   int           `json:"database"`
 	Native     NativeQuery   `json:"native"`
 	Parameters []interface{} `json:"parameters"`
+	// Constraints caps the rows Metabase returns, when set
+	Constraints *QueryConstraints `json:"constraints,omitempty"`
+}
+
+// QueryConstraints are the result limits applied by Metabase's constraints middleware
+type QueryConstraints struct {
+	MaxResults         int `json:"max-results"`
+	MaxResultsBareRows int `json:"max-results-bare-rows"`
 }
 
 // NativeQuery represents the native query part of a Metabase query
@@ -62,6 +72,7 @@ type Column struct {
 	Name          string        `json:"name"`
 	BaseType      string        `json:"base_type"`
 	EffectiveType string        `json:"effective_type"`
+	DatabaseType  string        `json:"database_type"`
 }
 
 // NativeForm represents the native form of the executed query
@@ -98,13 +109,23 @@ type GlobalFingerprint struct {
 	NilPercent    float64 `json:"nil%"`
 }
 
-// TypeFingerprint represents type-specific fingerprint data
+// TypeFingerprint represents type-specific fingerprint data. Text columns
+// carry the percentages and average length, numeric columns the
+// statistics, and temporal columns the earliest and latest values.
 type TypeFingerprint struct {
 	PercentJSON   float64 `json:"percent-json"`
 	PercentURL    float64 `json:"percent-url"`
 	PercentEmail  float64 `json:"percent-email"`
 	PercentState  float64 `json:"percent-state"`
 	AverageLength float64 `json:"average-length"`
+
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	Avg *float64 `json:"avg,omitempty"`
+	SD  *float64 `json:"sd,omitempty"`
+
+	Earliest *string `json:"earliest,omitempty"`
+	Latest   *string `json:"latest,omitempty"`
 }
 
 // JSONQuery represents the JSON query that was executed
@@ -116,155 +137,314 @@ type JSONQuery struct {
 }
 
 func main() {
-	fmt.Println("Metabase MCP Server starting...")
-
-	// Get database ID from environment variable
-	var databaseID int
-	dbEnv := os.Getenv("METABASE_DATABASE_ID")
-	if dbEnv == "" {
-		log.Fatalln("Database ID not set or invalid")
-	}
-
-	if parsedDB, err := strconv.Atoi(dbEnv); err == nil {
-		databaseID = parsedDB
-	}
+	os.Exit(run())
+}
 
-	// Get authentication cookies from environment variable
-	cookies := os.Getenv("METABASE_COOKIES")
-	if cookies == "" {
-		log.Fatalln("METABASE_COOKIES not set")
+// run sets up the server and serves it until the client disconnects or the
+// process is asked to stop, returning the process exit code
+func run() int {
+	settingsPath := flag.String("config", "", "YAML, TOML or JSON settings file; environment variables override its values")
+	registerSettingFlags(flag.CommandLine)
+	flag.Parse()
+	cfg, err := loadConfig(*settingsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errMissingSetting) {
+			fmt.Fprintf(os.Stderr, "Run %s --help for the available settings\n", filepath.Base(os.Args[0]))
+		}
+		return 2
 	}
 
-	// Get Metabase URL from environment variable
-	metabaseHost := os.Getenv("METABASE_HOST")
-	if metabaseHost == "" {
-		log.Fatalln("METABASE_HOST is not set")
+	// Route application logs to the configured destinations
+	logOutput, err := openLogSinks(cfg.LogDestinations, "metabase-mcp")
+	if err != nil {
+		log.Fatalln(err)
 	}
+	log.SetOutput(logOutput)
+
+	// Keep a local record of executed queries for usage reporting
+	history := newQueryHistory(1000)
+
+	// Virtual views, query jobs and execution statistics live as long as their client session
+	views := newViewStore()
+	jobs := newJobStore(100)
+	stats := newSessionStatsStore()
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		views.clear(session.SessionID())
+		jobs.clear(session.SessionID())
+		stats.clear(session.SessionID())
+	})
 
 	// Create a new MCP server
 	s := server.NewMCPServer(
 		"metabase-mcp",
-		"1.0.0",
+		version,
 		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, true),
 		server.WithRecovery(),
+		server.WithHooks(hooks),
 	)
 
-	// Add API invocation tool
-	apiTool := mcp.NewTool(
-		"metabase-tool",
-		mcp.WithDescription("Metabase mcp can access dashboards, execute queries"),
-		mcp.WithString(
-			"query",
-			mcp.Required(),
-			mcp.Description("The query to execute against the the db"),
-		),
-	)
+	// Oversized results are trimmed to the output budget, optionally keeping
+	// the full result available as a resource
+	budget := &outputBudget{limits: outputLimitsFor(cfg)}
+	if cfg.SpillOversizedOutput {
+		budget.store = newResultStore(s, 50)
+	}
 
-	// Add API tool handler
-	s.AddTool(apiTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// Convert arguments to map[string]interface{}
-		arguments, ok := request.Params.Arguments.(map[string]interface{})
-		if !ok {
-			return mcp.NewToolResultError("invalid arguments format"), nil
+	// Record state-changing admin tool calls
+	audit, err := newAuditLogger(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer audit.close()
+
+	// Serve Metabase over the configured TLS settings, or from recorded
+	// fixtures, inject faults for resilience testing, log requests when
+	// debugging, and record Metabase traffic and tool results, in that order
+	// so logs and recordings capture what the tools saw
+	base, err := newHTTPTransport(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var transport http.RoundTripper = base
+	if cfg.ReplayDir != "" {
+		replayer, err := newReplayTransport(cfg.ReplayDir)
+		if err != nil {
+			log.Fatalln(err)
 		}
-
-		// Extract query (required)
-		query, ok := arguments["query"].(string)
-		if !ok || query == "" {
-			return mcp.NewToolResultError("query is required and must be a string"), nil
+		transport = replayer
+	}
+	var faults *faultTransport
+	if cfg.FaultInjection {
+		log.Printf("WARNING: fault injection is enabled: %+v", cfg.Faults)
+		faults = newFaultTransport(cfg.Faults, transport)
+		transport = faults
+	}
+	if cfg.LogLevel == logLevelDebug {
+		log.Println("WARNING: debug logging is enabled; query text and results are written to the log")
+		transport = newDebugTransport(transport)
+	}
+	if cfg.RecordDir != "" {
+		recorder, err := newRecordingTransport(cfg.RecordDir, transport)
+		if err != nil {
+			log.Fatalln(err)
 		}
+		hooks.AddAfterCallTool(func(ctx context.Context, id any, message *mcp.CallToolRequest, result *mcp.CallToolResult) {
+			recorder.recordTool(message, result)
+		})
+		transport = recorder
+	}
 
-		// Create MetabaseQuery struct with the provided query
-		metabaseQuery := MetabaseQuery{
-			Type:     "native",
-			Database: databaseID,
-			Native: NativeQuery{
-				Query:        query,
-				TemplateTags: make(map[string]interface{}),
-			},
-			Parameters: make([]interface{}, 0),
+	// Each profile gets its own client and query queue; the concurrency limit
+	// applies to each profile's Metabase separately
+	for _, profile := range cfg.Profiles {
+		profile.client = NewMetabaseClient(profile.Host, cfg.MaxConcurrentQueries)
+		auth, err := newAuthProvider(profile, profile.client.httpClient)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		profile.client.setAuth(auth)
+		profile.client.setTimeout(cfg.Timeout)
+		if profile.FailoverHost != "" {
+			profile.client.setFailoverHost(profile.FailoverHost)
 		}
+		if !cfg.CoalesceQueries {
+			profile.client.disableCoalescing()
+		}
+		profile.client.setTransport(transport)
 
-		// Convert the query struct to JSON
-		queryJSON, err := json.Marshal(metabaseQuery)
+		// Replays must not fall back to metadata cached by earlier runs
+		cachePath := ""
+		if cfg.MetadataCacheDir != "" && cfg.ReplayDir == "" {
+			cachePath = filepath.Join(cfg.MetadataCacheDir, "metadata-"+profile.Name+".json")
+		}
+		cache, err := openMetadataCache(cachePath)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to create query JSON: %v", err)), nil
+			log.Fatalln(err)
 		}
+		profile.client.setMetadataCache(cache)
+	}
 
-		// Extract timeout (optional, defaults to 120 seconds)
-		timeout := 120 * time.Second
-
-		// Create HTTP client with timeout
-		client := &http.Client{
-			Timeout: timeout,
+	// Register the tool groups against the profile clients
+	registry := &toolRegistry{
+		server:  s,
+		config:  cfg,
+		history: history,
+		audit:   audit,
+		budget:  budget,
+		exports: newResultStore(s, 50),
+		views:   views,
+		stats:   stats,
+		jobs:    jobs,
+
+		snapshots: newSnapshotStore(cfg.MetadataCacheDir, 20),
+		faults:    faults,
+	}
+	registerQueryTools(registry)
+	registerStructuredQueryTools(registry)
+	registerJobTools(registry)
+	registerExportTools(registry)
+	registerBatchTools(registry)
+	registerExplainTools(registry)
+	registerExploreTools(registry)
+	registerLintTools(registry)
+	registerSecurityTools(registry)
+	registerInstanceTools(registry)
+	registerCardTools(registry)
+	registerCollectionTools(registry)
+	registerDashboardTools(registry)
+	registerModerationTools(registry)
+	registerMetricTools(registry)
+	registerNotificationTools(registry)
+	registerUsageTools(registry)
+	registerParameterTools(registry)
+	registerSeriesTools(registry)
+	registerAPIKeyTools(registry)
+	registerUploadTools(registry)
+	registerDatabaseTools(registry)
+	registerMetadataTools(registry)
+	registerCacheTools(registry)
+	registerPermissionTools(registry)
+	registerGroupTools(registry)
+	registerProfileTools(registry)
+	registerHealthTools(registry)
+	registerSchemaTools(registry)
+	registerViewTools(registry)
+	registerStatsTools(registry)
+	registerWarmTools(registry)
+	registerSchemaResources(registry)
+
+	// Subcommands run once against the configured profiles instead of serving
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "warm":
+			return runWarmCommand(registry, args[1:])
+		case "support-bundle":
+			return runSupportBundleCommand(registry, args[1:])
+		case "replay":
+			if cfg.ReplayDir == "" {
+				log.Println("replay requires METABASE_REPLAY to name the fixture directory")
+				return 2
+			}
+			return runReplayCommand(s, cfg.ReplayDir, args[1:])
 		}
+	}
 
-		// Create request with the query JSON as body
-		reqBody := strings.NewReader(string(queryJSON))
-		metabaseURL := fmt.Sprintf("%s/api/dataset", metabaseHost)
-		fmt.Println(metabaseURL)
-		req, err := http.NewRequestWithContext(ctx, "POST", metabaseURL, reqBody)
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to create request: %v", err)), nil
-		}
+	// Table schemas are listed as resources once the metadata is fetched
+	go registry.publishSchemaResources(context.Background())
 
-		// Set headers
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Cookie", cookies)
+	if cfg.SchemaSnapshotInterval > 0 {
+		go watchSchemaDrift(s, registry.snapshots, cfg.Profiles, cfg.SchemaSnapshotInterval, cfg.SchemaDriftNotify)
+	}
 
-		// Make the request
-		resp, err := client.Do(req)
+	// Report rejected credentials and missing databases now rather than
+	// inside the first tool call. Replays have no live Metabase to check.
+	if cfg.StartupCheck != startupCheckOff && cfg.ReplayDir == "" {
+		checkCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := selfTest(checkCtx, cfg.Profiles)
+		cancel()
+		if err != nil && cfg.StartupCheck == startupCheckFail {
+			log.Println(err)
+			return 1
+		}
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("request failed: %v", err)), nil
+			log.Printf("WARNING: %v", err)
 		}
-		defer resp.Body.Close()
+	}
 
-		// Read response body
-		respBody, err := io.ReadAll(resp.Body)
+	// HTTP clients are identified by the client access file
+	var access *clientAccessList
+	if cfg.Transport == "http" && cfg.ClientAccessFile != "" {
+		clients, err := loadClientAccess(cfg.ClientAccessFile)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to read response: %v", err)), nil
+			log.Fatalln(err)
 		}
+		access = &clientAccessList{clients: clients}
+	}
 
-		// Try to parse the response into the MetabaseResponse struct
-		var metabaseResp MetabaseResponse
-		if err := json.Unmarshal(respBody, &metabaseResp); err == nil {
-			// Successfully parsed as MetabaseResponse, format nicely
-			formattedResponse := map[string]interface{}{
-				"status":       metabaseResp.Status,
-				"row_count":    metabaseResp.RowCount,
-				"running_time": metabaseResp.RunningTime,
-				"database_id":  metabaseResp.DatabaseID,
-				"cached":       metabaseResp.Cached,
-				"rows":         metabaseResp.Data.Rows,
-				"columns":      metabaseResp.Data.Cols,
-				"query_sent":   metabaseQuery,
-			}
-
-			responseJSON, err := json.MarshalIndent(formattedResponse, "", "  ")
-			if err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("failed to format response: %v", err)), nil
-			}
-			return mcp.NewToolResultText(string(responseJSON)), nil
+	// Settings that can change while serving are re-applied on SIGHUP and
+	// when the configuration files change
+	var watched []string
+	for _, path := range []string{*settingsPath, cfg.ConfigFile, cfg.ClientAccessFile} {
+		if path != "" {
+			watched = append(watched, path)
 		}
-
-		// Fallback: if parsing as MetabaseResponse fails, return raw response
-		response := map[string]interface{}{
-			"status_code": resp.StatusCode,
-			"status":      resp.Status,
-			"body":        string(respBody),
-			"query_sent":  metabaseQuery,
+	}
+	go watchConfig(watched, func() {
+		if err := registry.reloadConfig(*settingsPath, access); err != nil {
+			log.Printf("Configuration reload failed, keeping the current settings: %v", err)
+			return
 		}
+		log.Println("Configuration reloaded")
+	})
 
-		responseJSON, err := json.MarshalIndent(response, "", "  ")
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to format response: %v", err)), nil
+	serve := func(ctx context.Context) error {
+		if cfg.Transport == "http" {
+			return serveHTTP(ctx, s, cfg, access)
 		}
+		return serveStdio(ctx, s)
+	}
 
-		return mcp.NewToolResultText(string(responseJSON)), nil
-	})
+	// Under the Windows service manager the server runs until the service is stopped
+	if handled, code := runAsService(serve); handled {
+		return code
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Metabase MCP Server starting (%s transport)", cfg.Transport)
+	startWatchdog()
+	err = serve(ctx)
+	sdNotify("STOPPING=1")
+	if err != nil {
+		log.Printf("Server error: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// serveStdio serves the MCP server over stdin/stdout until the client closes
+// the stream or ctx is cancelled. Nothing else may write to stdout.
+func serveStdio(ctx context.Context, s *server.MCPServer) error {
+	stdio := server.NewStdioServer(s)
+	stdio.SetErrorLogger(log.Default())
+	sdNotify("READY=1")
+	if err := stdio.Listen(ctx, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
 
-	// Start the stdio server
-	if err := server.ServeStdio(s); err != nil {
-		fmt.Printf("Server error: %v\n", err)
+// serveHTTP serves the MCP server over streamable HTTP until ctx is
+// cancelled, restricting clients according to the client access rules when
+// they are configured
+func serveHTTP(ctx context.Context, s *server.MCPServer, cfg Config, access *clientAccessList) error {
+	var handler http.Handler = server.NewStreamableHTTPServer(s)
+	if access != nil {
+		handler = clientAccessMiddleware(access, handler)
+	} else {
+		log.Printf("WARNING: METABASE_CLIENT_ACCESS_FILE is not set, so HTTP clients on %s are not authenticated", cfg.HTTPAddr)
+	}
+
+	listener, err := net.Listen("tcp", cfg.HTTPAddr)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving MCP over HTTP on %s/mcp", cfg.HTTPAddr)
+	sdNotify("READY=1")
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
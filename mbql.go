@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StructuredQuery is an MBQL query, which Metabase compiles to the SQL
+// dialect of the database
+type StructuredQuery struct {
+	Type       string                 `json:"type"`
+	Database   int                    `json:"database"`
+	Query      map[string]interface{} `json:"query"`
+	Parameters []interface{}          `json:"parameters"`
+}
+
+// QuerySpec describes a structured query over one table in terms of column
+// names, as given to the structured-query tool
+type QuerySpec struct {
+	Filters      []FilterSpec      `json:"filters"`
+	Aggregations []AggregationSpec `json:"aggregations"`
+	Breakouts    []string          `json:"breakouts"`
+	OrderBy      []OrderSpec       `json:"order_by"`
+	Fields       []string          `json:"fields"`
+	Limit        int               `json:"limit"`
+}
+
+// FilterSpec compares a column with a value
+type FilterSpec struct {
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+	Unit     string      `json:"unit"`
+}
+
+// AggregationSpec applies an aggregate function to a column
+type AggregationSpec struct {
+	Function string `json:"function"`
+	Field    string `json:"field"`
+}
+
+// OrderSpec sorts by a column, or by an aggregation given by its index
+type OrderSpec struct {
+	Field       string `json:"field"`
+	Aggregation *int   `json:"aggregation"`
+	Direction   string `json:"direction"`
+}
+
+// mbqlOperators maps filter operators to MBQL clauses and the number of
+// values each takes, -1 meaning one or more
+var mbqlOperators = map[string]struct {
+	clause string
+	values int
+}{
+	"=":                {"=", -1},
+	"!=":               {"!=", -1},
+	"<":                {"<", 1},
+	"<=":               {"<=", 1},
+	">":                {">", 1},
+	">=":               {">=", 1},
+	"between":          {"between", 2},
+	"contains":         {"contains", 1},
+	"does-not-contain": {"does-not-contain", 1},
+	"starts-with":      {"starts-with", 1},
+	"ends-with":        {"ends-with", 1},
+	"is-null":          {"is-null", 0},
+	"not-null":         {"not-null", 0},
+	"time-interval":    {"time-interval", 1},
+}
+
+// mbqlAggregations are the aggregate functions accepted, and whether they take a column
+var mbqlAggregations = map[string]bool{
+	"count":    false,
+	"sum":      true,
+	"avg":      true,
+	"min":      true,
+	"max":      true,
+	"distinct": true,
+	"median":   true,
+	"stddev":   true,
+}
+
+// temporalUnits are the units a date column can be bucketed by or a time interval counted in
+var temporalUnits = map[string]bool{
+	"minute": true, "hour": true, "day": true, "week": true,
+	"month": true, "quarter": true, "year": true,
+}
+
+// buildStructuredQuery resolves the column names of spec against the fields
+// of table and builds the MBQL query
+func buildStructuredQuery(databaseID int, table TableMetadata, spec QuerySpec) (StructuredQuery, error) {
+	fields := make(map[string]Field, len(table.Fields))
+	for _, field := range table.Fields {
+		fields[strings.ToLower(field.Name)] = field
+	}
+	ref := func(name string) ([]interface{}, error) {
+		// A breakout column may name a temporal unit: created_at:month
+		name, unit, _ := strings.Cut(name, ":")
+		field, ok := fields[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("column %q not found in table %s", name, table.qualifiedName())
+		}
+		if unit == "" {
+			return []interface{}{"field", field.ID, nil}, nil
+		}
+		if !temporalUnits[unit] {
+			return nil, fmt.Errorf("unknown temporal unit %q for column %s", unit, name)
+		}
+		return []interface{}{"field", field.ID, map[string]interface{}{"temporal-unit": unit}}, nil
+	}
+
+	query := map[string]interface{}{"source-table": table.ID}
+
+	var filters []interface{}
+	for _, filter := range spec.Filters {
+		column, err := ref(filter.Field)
+		if err != nil {
+			return StructuredQuery{}, err
+		}
+		operator := filter.Operator
+		if operator == "" {
+			operator = "="
+		}
+		op, ok := mbqlOperators[operator]
+		if !ok {
+			return StructuredQuery{}, fmt.Errorf("unknown filter operator %q", operator)
+		}
+		values, _ := filter.Value.([]interface{})
+		if filter.Value != nil && values == nil {
+			values = []interface{}{filter.Value}
+		}
+		switch {
+		case op.values == -1 && len(values) == 0,
+			op.values >= 0 && len(values) != op.values:
+			return StructuredQuery{}, fmt.Errorf("filter %s %s takes %s", filter.Field, operator, valueCount(op.values))
+		}
+		clause := append([]interface{}{op.clause, column}, values...)
+		if operator == "time-interval" {
+			if !temporalUnits[filter.Unit] {
+				return StructuredQuery{}, fmt.Errorf("filter %s time-interval needs a unit such as day or month", filter.Field)
+			}
+			clause = append(clause, filter.Unit)
+		}
+		filters = append(filters, clause)
+	}
+	switch len(filters) {
+	case 0:
+	case 1:
+		query["filter"] = filters[0]
+	default:
+		query["filter"] = append([]interface{}{"and"}, filters...)
+	}
+
+	var aggregations []interface{}
+	for _, aggregation := range spec.Aggregations {
+		takesColumn, ok := mbqlAggregations[aggregation.Function]
+		if !ok {
+			return StructuredQuery{}, fmt.Errorf("unknown aggregation %q", aggregation.Function)
+		}
+		if !takesColumn {
+			aggregations = append(aggregations, []interface{}{aggregation.Function})
+			continue
+		}
+		column, err := ref(aggregation.Field)
+		if err != nil {
+			return StructuredQuery{}, fmt.Errorf("aggregation %s: %w", aggregation.Function, err)
+		}
+		aggregations = append(aggregations, []interface{}{aggregation.Function, column})
+	}
+	if len(aggregations) > 0 {
+		query["aggregation"] = aggregations
+	}
+
+	var breakouts []interface{}
+	for _, name := range spec.Breakouts {
+		column, err := ref(name)
+		if err != nil {
+			return StructuredQuery{}, err
+		}
+		breakouts = append(breakouts, column)
+	}
+	if len(breakouts) > 0 {
+		query["breakout"] = breakouts
+	}
+
+	if len(spec.Fields) > 0 {
+		if len(aggregations) > 0 || len(breakouts) > 0 {
+			return StructuredQuery{}, fmt.Errorf("fields cannot be combined with aggregations or breakouts")
+		}
+		var columns []interface{}
+		for _, name := range spec.Fields {
+			column, err := ref(name)
+			if err != nil {
+				return StructuredQuery{}, err
+			}
+			columns = append(columns, column)
+		}
+		query["fields"] = columns
+	}
+
+	var orderBy []interface{}
+	for _, order := range spec.OrderBy {
+		direction := strings.ToLower(order.Direction)
+		if direction == "" {
+			direction = "asc"
+		}
+		if direction != "asc" && direction != "desc" {
+			return StructuredQuery{}, fmt.Errorf("order direction must be asc or desc, not %q", order.Direction)
+		}
+		var target []interface{}
+		if order.Aggregation != nil {
+			if *order.Aggregation < 0 || *order.Aggregation >= len(aggregations) {
+				return StructuredQuery{}, fmt.Errorf("order_by refers to aggregation %d, but %d are given", *order.Aggregation, len(aggregations))
+			}
+			target = []interface{}{"aggregation", *order.Aggregation}
+		} else {
+			column, err := ref(order.Field)
+			if err != nil {
+				return StructuredQuery{}, err
+			}
+			target = column
+		}
+		orderBy = append(orderBy, []interface{}{direction, target})
+	}
+	if len(orderBy) > 0 {
+		query["order-by"] = orderBy
+	}
+
+	if spec.Limit > 0 {
+		query["limit"] = spec.Limit
+	}
+
+	return StructuredQuery{Type: "query", Database: databaseID, Query: query, Parameters: make([]interface{}, 0)}, nil
+}
+
+// valueCount describes how many values a filter operator takes
+func valueCount(n int) string {
+	switch n {
+	case -1:
+		return "one or more values"
+	case 0:
+		return "no value"
+	case 1:
+		return "one value"
+	default:
+		return fmt.Sprintf("%d values", n)
+	}
+}
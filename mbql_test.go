@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// ordersTable is public.orders as described by ordersMetadata
+func ordersTable() TableMetadata {
+	return TableMetadata{
+		MetabaseTable: MetabaseTable{ID: 3, Name: "orders", Schema: "public"},
+		Fields: []Field{
+			{ID: 10, Name: "id"},
+			{ID: 11, Name: "created_at"},
+			{ID: 12, Name: "status"},
+		},
+	}
+}
+
+func TestBuildStructuredQuery(t *testing.T) {
+	first := 0
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{
+			"fields and limit",
+			`{"fields": ["ID", "status"], "limit": 10}`,
+			`{"fields":[["field",10,null],["field",12,null]],"limit":10,"source-table":3}`,
+		},
+		{
+			"filters",
+			`{"filters": [{"field": "status", "value": ["paid", "shipped"]}, {"field": "created_at", "operator": "time-interval", "value": -30, "unit": "day"}]}`,
+			`{"filter":["and",["=",["field",12,null],"paid","shipped"],["time-interval",["field",11,null],-30,"day"]],"source-table":3}`,
+		},
+		{
+			"grouped aggregation",
+			`{"aggregations": [{"function": "count"}, {"function": "max", "field": "id"}], "breakouts": ["created_at:month"], "order_by": [{"aggregation": 0, "direction": "desc"}]}`,
+			`{"aggregation":[["count"],["max",["field",10,null]]],"breakout":[["field",11,{"temporal-unit":"month"}]],"order-by":[["desc",["aggregation",0]]],"source-table":3}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec QuerySpec
+			if err := json.Unmarshal([]byte(tt.spec), &spec); err != nil {
+				t.Fatal(err)
+			}
+			query, err := buildStructuredQuery(1, ordersTable(), spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(query.Query)
+			if string(got) != tt.want {
+				t.Errorf("query = %s, want %s", got, tt.want)
+			}
+			if query.Type != "query" || query.Database != 1 {
+				t.Errorf("query type %s, database %d, want an MBQL query on database 1", query.Type, query.Database)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name string
+		spec QuerySpec
+		want string
+	}{
+		{"unknown column", QuerySpec{Fields: []string{"total"}}, `column "total" not found in table public.orders`},
+		{"unknown unit", QuerySpec{Breakouts: []string{"created_at:fortnight"}}, `unknown temporal unit "fortnight"`},
+		{"unknown operator", QuerySpec{Filters: []FilterSpec{{Field: "id", Operator: "like", Value: 1}}}, `unknown filter operator "like"`},
+		{"value count", QuerySpec{Filters: []FilterSpec{{Field: "id", Operator: "between", Value: 1}}}, "filter id between takes 2 values"},
+		{"interval unit", QuerySpec{Filters: []FilterSpec{{Field: "created_at", Operator: "time-interval", Value: -1}}}, "needs a unit"},
+		{"unknown aggregation", QuerySpec{Aggregations: []AggregationSpec{{Function: "mode"}}}, `unknown aggregation "mode"`},
+		{"fields with aggregation", QuerySpec{Fields: []string{"id"}, Aggregations: []AggregationSpec{{Function: "count"}}}, "fields cannot be combined"},
+		{"aggregation index", QuerySpec{OrderBy: []OrderSpec{{Aggregation: &first}}}, "refers to aggregation 0, but 0 are given"},
+		{"direction", QuerySpec{OrderBy: []OrderSpec{{Field: "id", Direction: "up"}}}, "must be asc or desc"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildStructuredQuery(1, ordersTable(), tt.spec); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("buildStructuredQuery() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructuredQueryTool(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} { return datasetResponse(2) })
+	fake.responses["/api/database/1/metadata"] = ordersMetadata()
+
+	result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleStructuredQuery, client, map[string]interface{}{
+		"table":   "public.orders",
+		"filters": []interface{}{map[string]interface{}{"field": "status", "value": "paid"}},
+		"limit":   2,
+	}))
+	if result["table"] != "public.orders" || result["row_count"] != 2.0 {
+		t.Errorf("result = %v, want 2 rows of public.orders", result)
+	}
+
+	var sent fakeRequest
+	for _, request := range fake.sent("POST") {
+		if request.Path == "/api/dataset" {
+			sent = request
+		}
+	}
+	query, _ := sent.Body["query"].(map[string]interface{})
+	if sent.Body["type"] != "query" || query["source-table"] != 3.0 || query["limit"] != 2.0 {
+		t.Errorf("sent %v, want an MBQL query on table 3", sent.Body)
+	}
+
+	missing := callTool(t, queryContext(Guardrails{}), r.handleStructuredQuery, client, map[string]interface{}{"table": "invoices"})
+	if !missing.IsError || !strings.Contains(resultText(missing), `table "invoices" not found in database 1`) {
+		t.Errorf("unknown table = %s, want an error", resultText(missing))
+	}
+}
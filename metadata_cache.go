@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cachedResponse is a metadata response kept for offline use
+type cachedResponse struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// metadataCache persists Metabase metadata responses on disk so schema
+// browsing keeps working while Metabase is unreachable
+type metadataCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]cachedResponse
+}
+
+// openMetadataCache loads the cache stored at path. An empty path keeps the
+// cache in memory only.
+func openMetadataCache(path string) (*metadataCache, error) {
+	cache := &metadataCache{path: path, entries: make(map[string]cachedResponse)}
+	if path == "" {
+		return cache, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// get returns the cached response for path
+func (c *metadataCache) get(path string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	return entry, ok
+}
+
+// put stores a fresh response for path and writes the cache to disk
+func (c *metadataCache) put(path string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[path] = cachedResponse{FetchedAt: time.Now().UTC(), Body: append(json.RawMessage(nil), body...)}
+	if c.path == "" {
+		return
+	}
+	if err := c.save(); err != nil {
+		log.Printf("metadata cache: %v", err)
+	}
+}
+
+// stats reports the number of cached responses and the age of the oldest one
+func (c *metadataCache) stats() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := map[string]interface{}{
+		"path":    c.path,
+		"entries": len(c.entries),
+	}
+	var oldest time.Time
+	for _, entry := range c.entries {
+		if oldest.IsZero() || entry.FetchedAt.Before(oldest) {
+			oldest = entry.FetchedAt
+		}
+	}
+	if !oldest.IsZero() {
+		stats["oldest_fetched_at"] = oldest
+	}
+	return stats
+}
+
+// save writes the cache atomically so a crash cannot leave a truncated file
+func (c *metadataCache) save() error {
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create metadata cache directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write metadata cache: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// GetMetadata fetches a metadata path and decodes it into out. While Metabase
+// is unreachable the last cached copy is served instead and a reconnect check
+// is queued; the returned time is then the moment the copy was fetched.
+func (c *MetabaseClient) GetMetadata(ctx context.Context, path string, out interface{}) (*time.Time, error) {
+	var cachedAt *time.Time
+	respBody, err := c.Do(ctx, http.MethodGet, path, nil)
+
+	// The cache holds what the profile's credentials may see, so calls with
+	// their own credentials neither fill nor read it
+	cache := c.metadata
+	if credentialOverrideFromContext(ctx) != nil {
+		cache = nil
+	}
+	switch {
+	case err == nil:
+		if cache != nil {
+			cache.put(path, respBody)
+		}
+	case cache != nil && isHostFailure(err):
+		entry, ok := cache.get(path)
+		if !ok {
+			return nil, fmt.Errorf("%w (no cached metadata available offline)", err)
+		}
+		c.scheduleReconnect()
+		respBody = entry.Body
+		cachedAt = &entry.FetchedAt
+	default:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return cachedAt, nil
+}
+
+// scheduleReconnect starts a background check that polls the primary host
+// until it answers again, closing the circuit breaker once it does
+func (c *MetabaseClient) scheduleReconnect() {
+	c.mu.Lock()
+	if c.reconnecting {
+		c.mu.Unlock()
+		return
+	}
+	c.reconnecting = true
+	c.mu.Unlock()
+
+	go func() {
+		for {
+			time.Sleep(30 * time.Second)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			_, err := c.sendTo(ctx, c.host, http.MethodGet, "/api/health", "", nil)
+			cancel()
+			c.breaker.recordHealth(err)
+			if err == nil {
+				break
+			}
+		}
+		c.mu.Lock()
+		c.reconnecting = false
+		c.mu.Unlock()
+	}()
+}
+
+// offline reports whether cached data is being served while a reconnect check is pending
+func (c *MetabaseClient) offline() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reconnecting
+}
+
+// offlineNotice labels a response built from cached metadata
+func offlineNotice(cachedAt time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"cached":    true,
+		"cached_at": cachedAt.Format(time.RFC3339),
+		"message":   "Metabase is unreachable; this data comes from the local metadata cache and may be stale. A reconnect check has been queued",
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetadataCachePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "metadata.json")
+	cache, err := openMetadataCache(path)
+	if err != nil {
+		t.Fatalf("openMetadataCache: %v", err)
+	}
+	cache.put("/api/database/1/metadata", []byte(`{"id":1}`))
+
+	reopened, err := openMetadataCache(path)
+	if err != nil {
+		t.Fatalf("reopening the cache: %v", err)
+	}
+	entry, ok := reopened.get("/api/database/1/metadata")
+	if !ok || string(entry.Body) != `{"id":1}` || entry.FetchedAt.IsZero() {
+		t.Errorf("reopened entry = %+v, %v", entry, ok)
+	}
+	if stats := reopened.stats(); stats["entries"] != 1 || stats["oldest_fetched_at"] == nil {
+		t.Errorf("stats = %v", stats)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openMetadataCache(path); err == nil {
+		t.Errorf("opened a corrupt cache without an error")
+	}
+}
+
+func TestGetMetadataOffline(t *testing.T) {
+	client, _ := newFakeMetabase(t, map[string]interface{}{
+		"/api/database/1/metadata": map[string]interface{}{"id": 1, "name": "Warehouse"},
+	})
+	cache, _ := openMetadataCache("")
+	client.setMetadataCache(cache)
+
+	var metadata DatabaseMetadata
+	cachedAt, err := client.GetMetadata(context.Background(), "/api/database/1/metadata", &metadata)
+	if err != nil || cachedAt != nil {
+		t.Fatalf("online GetMetadata = %v, %v", cachedAt, err)
+	}
+
+	// Nothing listens on port 1, so every request now fails
+	client.host = "http://127.0.0.1:1"
+
+	metadata = DatabaseMetadata{}
+	cachedAt, err = client.GetMetadata(context.Background(), "/api/database/1/metadata", &metadata)
+	if err != nil || cachedAt == nil || metadata.Name != "Warehouse" {
+		t.Fatalf("offline GetMetadata = %v, %+v, %v, want the cached copy", cachedAt, metadata, err)
+	}
+	if !client.offline() {
+		t.Errorf("client is not offline after serving cached metadata")
+	}
+
+	if _, err := client.GetMetadata(context.Background(), "/api/database/2/metadata", &metadata); err == nil || !strings.Contains(err.Error(), "no cached metadata available offline") {
+		t.Errorf("uncached GetMetadata error = %v", err)
+	}
+
+	request := newRequest(map[string]interface{}{overrideAPIKeyArgument: "caller-key"})
+	ctx := withCredentialOverride(context.Background(), request)
+	if _, err := client.GetMetadata(ctx, "/api/database/1/metadata", &metadata); err == nil {
+		t.Errorf("served cached metadata to a call with its own credentials")
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// estimateTokens approximates the token count of text at four characters per token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// exportChunkSize is the most one read of an export resource returns.
+// Larger exports are offered as numbered parts.
+const exportChunkSize = 8 << 20
+
+// resultStore keeps oversized results and exported files available as MCP resources
+type resultStore struct {
+	mu      sync.Mutex
+	server  *server.MCPServer
+	results [][]string
+	limit   int
+}
+
+// storedResource is a resource and the handler reading it
+type storedResource struct {
+	resource mcp.Resource
+	handler  server.ResourceHandlerFunc
+}
+
+// resourceOwner identifies the HTTP client and MCP session that created a
+// stored result. Resources are listed server-wide, so reads by anyone else
+// are refused.
+type resourceOwner struct {
+	client  string
+	session string
+}
+
+// ownerOf returns the owner of resources created by a call
+func ownerOf(ctx context.Context) resourceOwner {
+	owner := resourceOwner{session: sessionID(ctx)}
+	if access := clientAccessFromContext(ctx); access != nil {
+		owner.client = access.Name
+	}
+	return owner
+}
+
+// guard refuses reads of the resource at uri by anyone but the owner
+func (o resourceOwner) guard(uri string, handler server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		if ownerOf(ctx) != o {
+			return nil, fmt.Errorf("%w: %s was created by another client or session", errAccessDenied, uri)
+		}
+		return handler(ctx, request)
+	}
+}
+
+// newResultStore creates a store registering resources on s, keeping at most limit results
+func newResultStore(s *server.MCPServer, limit int) *resultStore {
+	return &resultStore{server: s, limit: limit}
+}
+
+// put registers content as a resource readable by the caller and returns its
+// URI, evicting the oldest result when full
+func (s *resultStore) put(ctx context.Context, name, content string) string {
+	uri := fmt.Sprintf("metabase://results/%d", time.Now().UnixNano())
+	s.add(ownerOf(ctx), storedResource{
+		resource: mcp.NewResource(uri, name, mcp.WithMIMEType("application/json")),
+		handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: content},
+			}, nil
+		},
+	})
+	return uri
+}
+
+// putFile registers a file of the given size as resources readable by the
+// caller, read from disk on demand, and returns their URIs: one for a file up
+// to exportChunkSize, or one per chunk of a larger file, to be read and joined
+// in order. Text files are served as text, others base64-encoded.
+func (s *resultStore) putFile(ctx context.Context, path, mimeType string, text bool, size int64) []string {
+	base := filepath.Base(path)
+	parts := int((size + exportChunkSize - 1) / exportChunkSize)
+	if parts == 0 {
+		parts = 1
+	}
+
+	resources := make([]storedResource, parts)
+	uris := make([]string, parts)
+	for i := range resources {
+		uri, name := "metabase://exports/"+base, base
+		if parts > 1 {
+			uri = fmt.Sprintf("%s/part-%d", uri, i+1)
+			name = fmt.Sprintf("%s (part %d of %d)", base, i+1, parts)
+		}
+		index := i
+		uris[i] = uri
+		resources[i] = storedResource{
+			resource: mcp.NewResource(uri, name, mcp.WithMIMEType(mimeType)),
+			handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+				data, err := readChunk(path, index, text)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read export: %w", err)
+				}
+				if text {
+					return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: mimeType, Text: string(data)}}, nil
+				}
+				return []mcp.ResourceContents{mcp.BlobResourceContents{URI: uri, MIMEType: mimeType, Blob: base64.StdEncoding.EncodeToString(data)}}, nil
+			},
+		}
+	}
+	s.add(ownerOf(ctx), resources...)
+	return uris
+}
+
+// readChunk reads the index-th chunk of exportChunkSize bytes of a file.
+// Chunks of text files are moved to the next character boundary, so that
+// each is valid UTF-8 and together they still cover the whole file.
+func readChunk(path string, index int, text bool) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, exportChunkSize+utf8.UTFMax)
+	n, err := f.ReadAt(buf, int64(index)*exportChunkSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	start, end := 0, min(n, exportChunkSize)
+	if text {
+		for index > 0 && start < min(n, utf8.UTFMax) && !utf8.RuneStart(buf[start]) {
+			start++
+		}
+		for end < n && !utf8.RuneStart(buf[end]) {
+			end++
+		}
+	}
+	return buf[start:end], nil
+}
+
+// add registers the resources making up one result, readable only by owner,
+// evicting the oldest result when full
+func (s *resultStore) add(owner resourceOwner, resources ...storedResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uris := make([]string, len(resources))
+	for i, r := range resources {
+		s.server.AddResource(r.resource, owner.guard(r.resource.URI, r.handler))
+		uris[i] = r.resource.URI
+	}
+	s.results = append(s.results, uris)
+	if len(s.results) > s.limit {
+		for _, uri := range s.results[0] {
+			s.server.RemoveResource(uri)
+		}
+		s.results = s.results[1:]
+	}
+}
+
+// outputLimits bound what a tool response may contain. Zero disables a limit.
+type outputLimits struct {
+	Tokens int
+	Rows   int
+	Bytes  int
+}
+
+// outputLimitsFor returns the output limits configured in cfg
+func outputLimitsFor(cfg Config) outputLimits {
+	return outputLimits{Tokens: cfg.MaxOutputTokens, Rows: cfg.MaxRows, Bytes: cfg.MaxResponseBytes}
+}
+
+// within reports whether text stays within the token and byte limits
+func (l outputLimits) within(text string) bool {
+	return (l.Tokens <= 0 || estimateTokens(text) <= l.Tokens) && (l.Bytes <= 0 || len(text) <= l.Bytes)
+}
+
+// outputBudget keeps tool responses within a token budget, a row cap and a
+// byte budget so large results don't overflow the client's context window
+type outputBudget struct {
+	mu     sync.Mutex
+	limits outputLimits
+	store  *resultStore
+}
+
+// setLimits changes the limits of later responses
+func (b *outputBudget) setLimits(limits outputLimits) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limits = limits
+}
+
+// current returns the current limits
+func (b *outputBudget) current() outputLimits {
+	if b == nil {
+		return outputLimits{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limits
+}
+
+// apply formats result as JSON within the limits. Rows beyond the row cap
+// are dropped first. A response still exceeding the token or byte budget is
+// shrunk by switching to a compact layout, then by spilling the full result
+// to a resource and truncating rows. The steps taken are reported in the
+// response, and truncated results are marked with truncated: true.
+func (b *outputBudget) apply(ctx context.Context, result map[string]interface{}) (*mcp.CallToolResult, error) {
+	limits := b.current()
+	if rows, ok := result["rows"].([][]interface{}); ok && limits.Rows > 0 && len(rows) > limits.Rows {
+		capped := make(map[string]interface{}, len(result)+2)
+		for key, value := range result {
+			capped[key] = value
+		}
+		capped["rows"] = rows[:limits.Rows]
+		capped["truncated"] = true
+		capped["row_limit"] = map[string]interface{}{
+			"max_rows":   limits.Rows,
+			"total_rows": len(rows),
+		}
+		result = capped
+	}
+
+	full, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to format response: %v", err)), nil
+	}
+	if limits.within(string(full)) {
+		return mcp.NewToolResultText(string(full)), nil
+	}
+
+	report := map[string]interface{}{
+		"estimated_tokens": estimateTokens(string(full)),
+		"bytes":            len(full),
+	}
+	if limits.Tokens > 0 {
+		report["budget_tokens"] = limits.Tokens
+	}
+	if limits.Bytes > 0 {
+		report["budget_bytes"] = limits.Bytes
+	}
+	actions := make([]string, 0, 3)
+
+	// Compact layout: column names only, no echoed query, no indentation
+	compact := make(map[string]interface{}, len(result))
+	for key, value := range result {
+		compact[key] = value
+	}
+	if columns, ok := compact["columns"].([]Column); ok {
+		names := make([]string, 0, len(columns))
+		for _, col := range columns {
+			names = append(names, col.Name)
+		}
+		compact["columns"] = names
+	}
+	delete(compact, "query_sent")
+	compact["output_budget"] = report
+	actions = append(actions, "compact_format")
+	report["actions"] = actions
+
+	if ok, text := fits(compact, limits); ok {
+		return mcp.NewToolResultText(text), nil
+	}
+
+	if b.store != nil {
+		report["full_result_uri"] = b.store.put(ctx, "Full query result", string(full))
+		actions = append(actions, "spilled_to_resource")
+	}
+
+	rows, ok := compact["rows"].([][]interface{})
+	if !ok {
+		// Not a tabular result: keep only the scalar fields
+		for key, value := range compact {
+			switch value.(type) {
+			case string, int, float64, bool, nil:
+			default:
+				if key != "output_budget" {
+					delete(compact, key)
+				}
+			}
+		}
+		actions = append(actions, "dropped_nested_fields")
+		report["actions"] = actions
+		_, text := fits(compact, limits)
+		return mcp.NewToolResultText(text), nil
+	}
+
+	// Keep the largest prefix of rows that fits the budget
+	actions = append(actions, "truncated_rows")
+	report["actions"] = actions
+	report["total_rows"] = len(rows)
+	compact["truncated"] = true
+	lo, hi := 0, len(rows)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		compact["rows"] = rows[:mid]
+		report["rows_returned"] = mid
+		if ok, _ := fits(compact, limits); ok {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	compact["rows"] = rows[:lo]
+	report["rows_returned"] = lo
+
+	_, text := fits(compact, limits)
+	return mcp.NewToolResultText(text), nil
+}
+
+// fits encodes v compactly and reports whether it is within the limits
+func fits(v interface{}, limits outputLimits) (bool, string) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return false, ""
+	}
+	return limits.within(string(encoded)), string(encoded)
+}
+
+// rowsWithinBudget estimates how many rows of a tabular result fit the limits
+// in compact form. It returns -1 when the result fits as is or is not tabular.
+func (b *outputBudget) rowsWithinBudget(result map[string]interface{}) int {
+	limits := b.current()
+	rows, ok := result["rows"].([][]interface{})
+	if !ok || len(rows) == 0 {
+		return -1
+	}
+	encoded, err := json.Marshal(rows)
+	if err != nil {
+		return -1
+	}
+
+	// Leave a quarter of each budget for column metadata and other fields
+	limit := -1
+	reduce := func(size, budget int) {
+		available := budget * 3 / 4
+		if budget <= 0 || size <= available {
+			return
+		}
+		if n := available / (size/len(rows) + 1); limit < 0 || n < limit {
+			limit = n
+		}
+	}
+	reduce(estimateTokens(string(encoded)), limits.Tokens)
+	reduce(len(encoded), limits.Bytes)
+	if limits.Rows > 0 && len(rows) > limits.Rows && (limit < 0 || limits.Rows < limit) {
+		limit = limits.Rows
+	}
+	return limit
+}
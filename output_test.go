@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// readResource reads a resource through the server as the caller in ctx,
+// returning the JSON-RPC response
+func readResource(t *testing.T, ctx context.Context, s *server.MCPServer, uri string) string {
+	t.Helper()
+	message := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":%q}}`, uri)
+	response, err := json.Marshal(s.HandleMessage(ctx, []byte(message)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(response)
+}
+
+func TestResultStoreOwnership(t *testing.T) {
+	s := server.NewMCPServer("test", "1.0", server.WithResourceCapabilities(false, false))
+	store := newResultStore(s, 10)
+	finance := withClientAccess(context.Background(), &ClientAccess{Name: "finance"})
+	platform := withClientAccess(context.Background(), &ClientAccess{Name: "platform"})
+
+	uri := store.put(finance, "Full query result", `{"rows":[[1]]}`)
+	if response := readResource(t, finance, s, uri); !strings.Contains(response, `rows`) {
+		t.Errorf("owner read = %s, want the result", response)
+	}
+	if response := readResource(t, platform, s, uri); strings.Contains(response, `rows`) || !strings.Contains(response, "access denied") {
+		t.Errorf("other client read = %s, want access denied", response)
+	}
+	if response := readResource(t, context.Background(), s, uri); strings.Contains(response, `rows`) {
+		t.Errorf("unauthenticated read = %s, want access denied", response)
+	}
+}
+
+// budgetRows returns n rows of one numbered column
+func budgetRows(n int) [][]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = []interface{}{i, fmt.Sprintf("customer number %d", i)}
+	}
+	return rows
+}
+
+func TestOutputBudget(t *testing.T) {
+	s := server.NewMCPServer("test", "1.0", server.WithResourceCapabilities(false, false))
+	ctx := withClientAccess(context.Background(), &ClientAccess{Name: "finance"})
+
+	tests := []struct {
+		name    string
+		limits  outputLimits
+		result  map[string]interface{}
+		actions []string
+		rows    int
+	}{
+		{"within the budget", outputLimits{Tokens: 10000}, map[string]interface{}{"rows": budgetRows(10)}, nil, 10},
+		{"row cap", outputLimits{Rows: 3}, map[string]interface{}{"rows": budgetRows(10)}, nil, 3},
+		{"compact layout", outputLimits{Tokens: 120}, map[string]interface{}{
+			"rows":       budgetRows(5),
+			"query_sent": strings.Repeat("SELECT id, name FROM customers ", 10),
+		}, []string{"compact_format"}, 5},
+		{"truncated rows", outputLimits{Tokens: 200}, map[string]interface{}{"rows": budgetRows(100)},
+			[]string{"compact_format", "spilled_to_resource", "truncated_rows"}, -1},
+		{"byte budget", outputLimits{Bytes: 500}, map[string]interface{}{"rows": budgetRows(100)},
+			[]string{"compact_format", "spilled_to_resource", "truncated_rows"}, -1},
+		{"nested fields", outputLimits{Tokens: 80}, map[string]interface{}{
+			"card_id": 5,
+			"tables":  []string{strings.Repeat("orders ", 100)},
+		}, []string{"compact_format", "spilled_to_resource", "dropped_nested_fields"}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newResultStore(s, 10)
+			budget := &outputBudget{limits: tt.limits, store: store}
+			result, err := budget.apply(ctx, tt.result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := resultText(result)
+			if !tt.limits.within(text) {
+				t.Errorf("response of %d bytes is over the budget: %s", len(text), text)
+			}
+			var got struct {
+				Rows         [][]interface{} `json:"rows"`
+				Truncated    bool            `json:"truncated"`
+				OutputBudget *struct {
+					Actions       []string `json:"actions"`
+					FullResultURI string   `json:"full_result_uri"`
+				} `json:"output_budget"`
+			}
+			if err := json.Unmarshal([]byte(text), &got); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+
+			var actions []string
+			if got.OutputBudget != nil {
+				actions = got.OutputBudget.Actions
+			}
+			if strings.Join(actions, ",") != strings.Join(tt.actions, ",") {
+				t.Errorf("actions = %v, want %v", actions, tt.actions)
+			}
+			switch {
+			case tt.rows >= 0 && len(got.Rows) != tt.rows:
+				t.Errorf("rows = %d, want %d", len(got.Rows), tt.rows)
+			case tt.rows < 0 && tt.result["rows"] != nil && (len(got.Rows) == 0 || len(got.Rows) >= 100 || !got.Truncated):
+				t.Errorf("rows = %d, truncated %v, want a truncated prefix", len(got.Rows), got.Truncated)
+			}
+			if got.OutputBudget != nil && got.OutputBudget.FullResultURI != "" {
+				if response := readResource(t, ctx, s, got.OutputBudget.FullResultURI); !strings.Contains(response, "customer number 99") && !strings.Contains(response, "card_id") {
+					t.Errorf("full result = %s, want every row", response)
+				}
+			}
+		})
+	}
+}
+
+func TestRowLimit(t *testing.T) {
+	setMinimalEnv(t)
+	t.Setenv("METABASE_MAX_ROWS", "3")
+	t.Setenv("METABASE_MAX_RESPONSE_BYTES", "100000")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := outputLimitsFor(cfg)
+	if limits.Rows != 3 || limits.Bytes != 100000 {
+		t.Fatalf("limits = %+v, want 3 rows and 100000 bytes", limits)
+	}
+
+	// The first rows are kept in order, so repeated calls return the same rows
+	budget := &outputBudget{limits: limits}
+	result := map[string]interface{}{"rows": budgetRows(10)}
+	for i := 0; i < 2; i++ {
+		response, err := budget.apply(context.Background(), result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Rows      [][]interface{} `json:"rows"`
+			Truncated bool            `json:"truncated"`
+			RowLimit  struct {
+				MaxRows   int `json:"max_rows"`
+				TotalRows int `json:"total_rows"`
+			} `json:"row_limit"`
+		}
+		if err := json.Unmarshal([]byte(resultText(response)), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Rows) != 3 || got.Rows[0][0] != 0.0 || got.Rows[2][0] != 2.0 || !got.Truncated {
+			t.Errorf("rows = %v, truncated %v, want the first 3 rows", got.Rows, got.Truncated)
+		}
+		if got.RowLimit.MaxRows != 3 || got.RowLimit.TotalRows != 10 {
+			t.Errorf("row_limit = %+v, want 3 of 10 rows", got.RowLimit)
+		}
+	}
+	if rows := result["rows"].([][]interface{}); len(rows) != 10 {
+		t.Errorf("apply changed the result to %d rows", len(rows))
+	}
+}
+
+func TestReadChunk(t *testing.T) {
+	// A two-byte character straddles the end of the first chunk
+	content := strings.Repeat("a", exportChunkSize-1) + "é€ and more text"
+	path := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var joined []byte
+	for index := 0; index < 2; index++ {
+		chunk, err := readChunk(path, index, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utf8.Valid(chunk) {
+			t.Errorf("text chunk %d is not valid UTF-8", index)
+		}
+		joined = append(joined, chunk...)
+	}
+	if string(joined) != content {
+		t.Errorf("text chunks join to %d bytes, want the %d bytes of the file", len(joined), len(content))
+	}
+
+	first, err := readChunk(path, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := readChunk(path, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != exportChunkSize || string(first)+string(second) != content {
+		t.Errorf("binary chunks = %d and %d bytes, want the file split at %d", len(first), len(second), exportChunkSize)
+	}
+
+	s := server.NewMCPServer("test", "1.0", server.WithResourceCapabilities(false, false))
+	uris := newResultStore(s, 10).putFile(context.Background(), path, "text/csv", true, int64(len(content)))
+	if len(uris) != 2 || !strings.HasSuffix(uris[1], "/part-2") {
+		t.Errorf("putFile = %v, want two parts", uris)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dateRangePattern matches the value of a date/range parameter, two ISO
+// dates separated by a tilde
+var dateRangePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}~\d{4}-\d{2}-\d{2}$`)
+
+// Parameter represents a filter declared on a dashboard or card
+type Parameter struct {
+	ID                  string      `json:"id"`
+	Name                string      `json:"name"`
+	Slug                string      `json:"slug"`
+	Type                string      `json:"type"`
+	Default             interface{} `json:"default"`
+	Required            bool        `json:"required"`
+	FilteringParameters []string    `json:"filteringParameters"`
+	ValuesSourceType    *string     `json:"values_source_type"`
+	ValuesQueryType     string      `json:"values_query_type"`
+	Target              interface{} `json:"target"`
+}
+
+// ParameterValues represents the valid values returned for a parameter
+type ParameterValues struct {
+	Values        [][]interface{} `json:"values"`
+	HasMoreValues bool            `json:"has_more_values"`
+}
+
+// findParameter looks up a parameter by ID, slug, or name
+func findParameter(parameters []Parameter, key string) (Parameter, bool) {
+	for _, p := range parameters {
+		if p.ID == key || p.Slug == key || p.Name == key {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// linkedParameterQuery builds the query string constraining a parameter by the
+// current values of the parameters that filter it. Values for parameters the
+// target is not linked to are ignored, matching the Metabase UI.
+func linkedParameterQuery(parameters []Parameter, target Parameter, values map[string]interface{}) (url.Values, error) {
+	query := url.Values{}
+	linked := make(map[string]bool, len(target.FilteringParameters))
+	for _, id := range target.FilteringParameters {
+		linked[id] = true
+	}
+
+	for key, value := range values {
+		p, ok := findParameter(parameters, key)
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+		if !linked[p.ID] {
+			continue
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				query.Add(p.ID, fmt.Sprint(item))
+			}
+		default:
+			query.Add(p.ID, fmt.Sprint(v))
+		}
+	}
+	return query, nil
+}
+
+// dashboardParameterValues fetches the valid values for a dashboard parameter,
+// constrained by the values of linked filters and an optional search string
+func dashboardParameterValues(ctx context.Context, client *MetabaseClient, dashboardID int, parameters []Parameter, key, search string, values map[string]interface{}) (Parameter, ParameterValues, error) {
+	var result ParameterValues
+
+	target, ok := findParameter(parameters, key)
+	if !ok {
+		return target, result, fmt.Errorf("dashboard %d has no parameter %q", dashboardID, key)
+	}
+
+	query, err := linkedParameterQuery(parameters, target, values)
+	if err != nil {
+		return target, result, err
+	}
+
+	path := fmt.Sprintf("/api/dashboard/%d/params/%s/values", dashboardID, url.PathEscape(target.ID))
+	if search != "" {
+		path = fmt.Sprintf("/api/dashboard/%d/params/%s/search/%s", dashboardID, url.PathEscape(target.ID), url.PathEscape(search))
+	}
+	if encoded := query.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+
+	if err := client.Get(ctx, path, &result); err != nil {
+		return target, result, err
+	}
+	return target, result, nil
+}
+
+// cardParameterValues fetches the valid values for a card parameter
+func cardParameterValues(ctx context.Context, client *MetabaseClient, cardID int, parameters []Parameter, key, search string) (Parameter, ParameterValues, error) {
+	var result ParameterValues
+
+	target, ok := findParameter(parameters, key)
+	if !ok {
+		return target, result, fmt.Errorf("card %d has no parameter %q", cardID, key)
+	}
+
+	path := fmt.Sprintf("/api/card/%d/params/%s/values", cardID, url.PathEscape(target.ID))
+	if search != "" {
+		path = fmt.Sprintf("/api/card/%d/params/%s/search/%s", cardID, url.PathEscape(target.ID), url.PathEscape(search))
+	}
+
+	if err := client.Get(ctx, path, &result); err != nil {
+		return target, result, err
+	}
+	return target, result, nil
+}
+
+// cardParameterEntries maps values keyed by parameter ID, slug or name onto
+// the parameters a card declares, in the form the card query API expects.
+// Values are checked against the parameter types, and required parameters
+// without a value or default are reported.
+func cardParameterEntries(parameters []Parameter, values map[string]interface{}) ([]interface{}, error) {
+	entries := make([]interface{}, 0, len(values))
+	given := make(map[string]bool, len(values))
+	for key, value := range values {
+		p, ok := findParameter(parameters, key)
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %q; the card declares: %s", key, parameterNames(parameters))
+		}
+		if err := checkParameterValue(p, value); err != nil {
+			return nil, err
+		}
+		given[p.ID] = true
+		entries = append(entries, map[string]interface{}{
+			"id":     p.ID,
+			"type":   p.Type,
+			"target": p.Target,
+			"value":  value,
+		})
+	}
+	for _, p := range parameters {
+		if p.Required && p.Default == nil && !given[p.ID] {
+			return nil, fmt.Errorf("parameter %q is required", p.Slug)
+		}
+	}
+	return entries, nil
+}
+
+// checkParameterValue rejects values that do not fit the parameter type
+func checkParameterValue(p Parameter, value interface{}) error {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		switch {
+		case strings.HasPrefix(p.Type, "number/"):
+			if _, ok := v.(float64); !ok {
+				return fmt.Errorf("parameter %q takes numbers, got %v", p.Slug, v)
+			}
+		case p.Type == "date/single":
+			if text, ok := v.(string); !ok || !isoDatePattern.MatchString(text) {
+				return fmt.Errorf("parameter %q takes a date such as 2024-01-31, got %v", p.Slug, v)
+			}
+		case p.Type == "date/range":
+			if text, ok := v.(string); !ok || !dateRangePattern.MatchString(text) {
+				return fmt.Errorf("parameter %q takes a range such as 2024-01-01~2024-01-31, got %v", p.Slug, v)
+			}
+		case strings.HasPrefix(p.Type, "date/"):
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("parameter %q takes a date filter such as past30days or 2024-01, got %v", p.Slug, v)
+			}
+		}
+	}
+	return nil
+}
+
+// parameterNames lists the slugs of parameters with their types
+func parameterNames(parameters []Parameter) string {
+	if len(parameters) == 0 {
+		return "no parameters"
+	}
+	names := make([]string, 0, len(parameters))
+	for _, p := range parameters {
+		names = append(names, fmt.Sprintf("%s (%s)", p.Slug, p.Type))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Profile bundles the connection, database registry and guardrails of one
+// Metabase environment, such as dev, staging or production
+type Profile struct {
+	Name         string `json:"-"`
+	Host         string `json:"host"`
+	FailoverHost string `json:"failover_host"`
+	Auth         string `json:"auth"`
+	Cookies      string `json:"cookies"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	APIKey       string `json:"api_key"`
+	BearerToken  string `json:"bearer_token"`
+
+	CookiesFile     string         `json:"cookies_file"`
+	APIKeyFile      string         `json:"api_key_file"`
+	BearerTokenFile string         `json:"bearer_token_file"`
+	DatabaseID      int            `json:"database_id"`
+	Databases       map[string]int `json:"databases"`
+	GuardrailLevel  string         `json:"guardrails"`
+	Guardrails      Guardrails     `json:"-"`
+
+	AllowedDatabases []int `json:"allowed_databases"`
+	DeniedDatabases  []int `json:"denied_databases"`
+
+	client *MetabaseClient
+}
+
+// Guardrails are the query safety settings applied to a profile
+type Guardrails struct {
+	ReadOnly      bool `json:"read_only"`
+	LintQueries   bool `json:"lint_queries"`
+	AdaptiveLimit bool `json:"adaptive_limit"`
+}
+
+// guardrailsFor expands a guardrail strictness level. The standard level
+// follows the environment settings; strict and relaxed override them.
+func guardrailsFor(level string, cfg Config) (Guardrails, error) {
+	switch level {
+	case "", "standard":
+		return Guardrails{LintQueries: cfg.LintQueries, AdaptiveLimit: cfg.AdaptiveLimit}, nil
+	case "strict":
+		return Guardrails{ReadOnly: true, LintQueries: true, AdaptiveLimit: true}, nil
+	case "relaxed":
+		return Guardrails{}, nil
+	default:
+		return Guardrails{}, fmt.Errorf("unknown guardrail level %q, expected strict, standard or relaxed", level)
+	}
+}
+
+// profileFile is the layout of the profiles config file
+type profileFile struct {
+	DefaultProfile string              `json:"default_profile"`
+	Profiles       map[string]*Profile `json:"profiles"`
+}
+
+// loadProfiles reads the profiles from a JSON config file into cfg
+func loadProfiles(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file profileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return applyProfiles(cfg, file, path)
+}
+
+// applyProfiles validates the profiles read from path and sets them on cfg
+func applyProfiles(cfg *Config, file profileFile, path string) error {
+	if len(file.Profiles) == 0 {
+		return fmt.Errorf("config file %s defines no profiles", path)
+	}
+
+	for name, profile := range file.Profiles {
+		profile.Name = name
+		if err := profile.resolveSecrets(); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		if profile.Host == "" || profile.DatabaseID == 0 {
+			return fmt.Errorf("profile %s needs host and database_id", name)
+		}
+		if err := validateHost("host", profile.Host); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		if profile.FailoverHost != "" {
+			if err := validateHost("failover_host", profile.FailoverHost); err != nil {
+				return fmt.Errorf("profile %s: %w", name, err)
+			}
+		}
+		if _, err := authSchemeFor(profile); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+
+	cfg.Profiles = file.Profiles
+	cfg.DefaultProfile = file.DefaultProfile
+	if cfg.DefaultProfile == "" && len(file.Profiles) == 1 {
+		for name := range file.Profiles {
+			cfg.DefaultProfile = name
+		}
+	}
+	return nil
+}
+
+// resolveSecrets replaces secret references in the profile's credentials
+// with the secrets. File references to header credentials are watched for
+// rotation rather than read once.
+func (p *Profile) resolveSecrets() error {
+	for secret, file := range map[*string]*string{&p.Cookies: &p.CookiesFile, &p.APIKey: &p.APIKeyFile, &p.BearerToken: &p.BearerTokenFile} {
+		if path, ok := strings.CutPrefix(*secret, "file:"); ok && *file == "" {
+			*secret, *file = "", path
+		}
+	}
+	for _, secret := range []*string{&p.Cookies, &p.Password, &p.APIKey, &p.BearerToken} {
+		if isSecretReference(*secret) {
+			value, err := resolveSecret(*secret)
+			if err != nil {
+				return err
+			}
+			*secret = value
+		}
+	}
+	return nil
+}
+
+type profileKey struct{}
+
+// withProfile attaches the profile serving a tool call to the context
+func withProfile(ctx context.Context, profile *Profile) context.Context {
+	return context.WithValue(ctx, profileKey{}, profile)
+}
+
+// profileFromContext returns the profile serving the current tool call
+func profileFromContext(ctx context.Context) *Profile {
+	profile, _ := ctx.Value(profileKey{}).(*Profile)
+	return profile
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGuardrailsFor(t *testing.T) {
+	cfg := Config{LintQueries: true}
+	tests := []struct {
+		level string
+		want  Guardrails
+		err   bool
+	}{
+		{"", Guardrails{LintQueries: true}, false},
+		{"standard", Guardrails{LintQueries: true}, false},
+		{"strict", Guardrails{ReadOnly: true, LintQueries: true, AdaptiveLimit: true}, false},
+		{"relaxed", Guardrails{}, false},
+		{"paranoid", Guardrails{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			got, err := guardrailsFor(tt.level, cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("guardrailsFor(%q) error = %v, want error %v", tt.level, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("guardrailsFor(%q) = %+v, want %+v", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		wantDefault string
+		err         bool
+	}{
+		{"single profile is the default", `{"profiles": {"prod": {"host": "https://prod.example.com", "database_id": 1, "api_key": "k"}}}`, "prod", false},
+		{"named default", `{"default_profile": "dev", "profiles": {
+			"dev": {"host": "https://dev.example.com", "database_id": 1, "api_key": "k"},
+			"prod": {"host": "https://prod.example.com", "database_id": 2, "api_key": "k", "guardrails": "strict"}}}`, "dev", false},
+		{"no profiles", `{"profiles": {}}`, "", true},
+		{"missing database", `{"profiles": {"prod": {"host": "https://prod.example.com", "api_key": "k"}}}`, "", true},
+		{"invalid host", `{"profiles": {"prod": {"host": "prod.example.com", "database_id": 1, "api_key": "k"}}}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "profiles.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			var cfg Config
+			err := loadProfiles(&cfg, path)
+			if (err != nil) != tt.err {
+				t.Fatalf("loadProfiles() error = %v, want error %v", err, tt.err)
+			}
+			if cfg.DefaultProfile != tt.wantDefault {
+				t.Errorf("DefaultProfile = %q, want %q", cfg.DefaultProfile, tt.wantDefault)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// QueryPriority is the scheduling class of a query waiting for a free slot
+type QueryPriority int
+
+const (
+	// PriorityInteractive is used for queries a user is actively waiting on
+	PriorityInteractive QueryPriority = iota
+	// PriorityBatch is used for background, bulk or scheduled queries
+	PriorityBatch
+)
+
+// parsePriority converts a tool argument into a priority, defaulting to interactive
+func parsePriority(value string) QueryPriority {
+	if value == "batch" {
+		return PriorityBatch
+	}
+	return PriorityInteractive
+}
+
+func (p QueryPriority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+type priorityKey struct{}
+
+// withPriority attaches a query priority to the context
+func withPriority(ctx context.Context, priority QueryPriority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFromContext returns the query priority attached to ctx, defaulting to interactive
+func priorityFromContext(ctx context.Context) QueryPriority {
+	if priority, ok := ctx.Value(priorityKey{}).(QueryPriority); ok {
+		return priority
+	}
+	return PriorityInteractive
+}
+
+// queryQueue limits how many queries run against Metabase at once. Waiting
+// interactive queries are always admitted before batch queries, and one slot is
+// kept free of batch work so a user is never stuck behind background queries.
+type queryQueue struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	batch   int
+	waiting [2][]chan struct{}
+}
+
+// newQueryQueue creates a queue allowing limit concurrent queries
+func newQueryQueue(limit int) *queryQueue {
+	if limit < 1 {
+		limit = 1
+	}
+	return &queryQueue{limit: limit}
+}
+
+// acquire blocks until a slot is available for the given priority and returns
+// a function releasing it
+func (q *queryQueue) acquire(ctx context.Context, priority QueryPriority) (func(), error) {
+	q.mu.Lock()
+	if q.canRun(priority) && len(q.waiting[PriorityInteractive]) == 0 && len(q.waiting[priority]) == 0 {
+		q.start(priority)
+		q.mu.Unlock()
+		return func() { q.release(priority) }, nil
+	}
+
+	ready := make(chan struct{})
+	q.waiting[priority] = append(q.waiting[priority], ready)
+	q.mu.Unlock()
+
+	select {
+	case <-ready:
+		return func() { q.release(priority) }, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		for i, ch := range q.waiting[priority] {
+			if ch == ready {
+				q.waiting[priority] = append(q.waiting[priority][:i], q.waiting[priority][i+1:]...)
+				q.mu.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		q.mu.Unlock()
+
+		// The slot was granted while the context was being cancelled
+		q.release(priority)
+		return nil, ctx.Err()
+	}
+}
+
+// canRun reports whether a query of the given priority may start now
+func (q *queryQueue) canRun(priority QueryPriority) bool {
+	if q.running >= q.limit {
+		return false
+	}
+	if priority == PriorityBatch && q.limit > 1 && q.batch >= q.limit-1 {
+		return false
+	}
+	return true
+}
+
+func (q *queryQueue) start(priority QueryPriority) {
+	q.running++
+	if priority == PriorityBatch {
+		q.batch++
+	}
+}
+
+// release frees a slot and hands it to the next waiting query
+func (q *queryQueue) release(priority QueryPriority) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	if priority == PriorityBatch {
+		q.batch--
+	}
+
+	for _, next := range []QueryPriority{PriorityInteractive, PriorityBatch} {
+		for len(q.waiting[next]) > 0 && q.canRun(next) {
+			ready := q.waiting[next][0]
+			q.waiting[next] = q.waiting[next][1:]
+			q.start(next)
+			close(ready)
+		}
+	}
+}
+
+// stats reports the current queue occupancy
+func (q *queryQueue) stats() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return map[string]int{
+		"limit":               q.limit,
+		"running":             q.running,
+		"running_batch":       q.batch,
+		"waiting_interactive": len(q.waiting[PriorityInteractive]),
+		"waiting_batch":       len(q.waiting[PriorityBatch]),
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForQueue polls the queue until check holds for its stats
+func waitForQueue(t *testing.T, q *queryQueue, check func(stats map[string]int) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check(q.stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue stats = %v", q.stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueryQueueKeepsSlotForInteractive(t *testing.T) {
+	q := newQueryQueue(2)
+	ctx := context.Background()
+
+	releaseBatch, err := q.acquire(ctx, PriorityBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last slot is kept free of batch work
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.acquire(short, PriorityBatch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second batch query: err = %v, want it to wait", err)
+	}
+	if stats := q.stats(); stats["waiting_batch"] != 0 {
+		t.Errorf("stats = %v, want the cancelled query removed", stats)
+	}
+	releaseInteractive, err := q.acquire(ctx, PriorityInteractive)
+	if err != nil {
+		t.Fatalf("interactive query: %v", err)
+	}
+	releaseInteractive()
+	releaseBatch()
+
+	if stats := q.stats(); stats["running"] != 0 || stats["running_batch"] != 0 {
+		t.Errorf("stats = %v, want every slot released", stats)
+	}
+}
+
+func TestQueryQueueAdmitsInteractiveFirst(t *testing.T) {
+	q := newQueryQueue(1)
+	ctx := context.Background()
+	release, err := q.acquire(ctx, PriorityInteractive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan QueryPriority, 2)
+	run := func(priority QueryPriority) {
+		release, err := q.acquire(ctx, priority)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		order <- priority
+		release()
+	}
+	go run(PriorityBatch)
+	waitForQueue(t, q, func(stats map[string]int) bool { return stats["waiting_batch"] == 1 })
+	go run(PriorityInteractive)
+	waitForQueue(t, q, func(stats map[string]int) bool { return stats["waiting_interactive"] == 1 })
+
+	release()
+	if first, second := <-order, <-order; first != PriorityInteractive || second != PriorityBatch {
+		t.Errorf("ran %v then %v, want the interactive query first", first, second)
+	}
+}
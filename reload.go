@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// reloadConfig re-reads the settings file, the profiles and the client access
+// file and applies what can change while serving: request timeouts, the
+// output limits and format, column handling defaults, guardrails, the default
+// profile, profile credentials and client access rules. Added profiles,
+// changed hosts and the remaining settings take effect on restart. Nothing is
+// applied when the new configuration is invalid.
+func (r *toolRegistry) reloadConfig(settingsPath string, access *clientAccessList) error {
+	next, err := loadConfig(settingsPath)
+	if err != nil {
+		return err
+	}
+	current := r.currentConfig()
+
+	var clients []*ClientAccess
+	if access != nil && next.ClientAccessFile != "" {
+		if clients, err = loadClientAccess(next.ClientAccessFile); err != nil {
+			return err
+		}
+	}
+
+	// Profiles keep their clients, so queues, caches and circuit breakers
+	// carry over; only changed credentials get a new auth provider
+	profiles := make(map[string]*Profile, len(current.Profiles))
+	for name, profile := range current.Profiles {
+		profiles[name] = profile
+		if _, ok := next.Profiles[name]; !ok {
+			log.Printf("Reload: profile %s was removed; restart to apply", name)
+		}
+	}
+	auths := make(map[*MetabaseClient]AuthProvider)
+	for name, profile := range next.Profiles {
+		previous, ok := current.Profiles[name]
+		if !ok || previous.Host != profile.Host || previous.FailoverHost != profile.FailoverHost {
+			log.Printf("Reload: profile %s is new or changed host; restart to apply", name)
+			continue
+		}
+		profile.client = previous.client
+		if credentialsChanged(previous, profile) {
+			auth, err := newAuthProvider(profile, previous.client.httpClient)
+			if err != nil {
+				// Providers created for other profiles are not used either
+				for _, created := range auths {
+					closeAuth(created)
+				}
+				return fmt.Errorf("profile %s: %w", name, err)
+			}
+			auths[profile.client] = auth
+		}
+		profiles[name] = profile
+	}
+
+	for client, auth := range auths {
+		client.setAuth(auth)
+	}
+	for _, profile := range profiles {
+		profile.client.setTimeout(next.Timeout)
+	}
+	r.budget.setLimits(outputLimitsFor(next))
+	if clients != nil {
+		access.set(clients)
+	}
+
+	updated := current
+	updated.Profiles = profiles
+	if _, ok := profiles[next.DefaultProfile]; ok {
+		updated.DefaultProfile = next.DefaultProfile
+	}
+	updated.Timeout = next.Timeout
+	updated.MaxOutputTokens = next.MaxOutputTokens
+	updated.MaxRows = next.MaxRows
+	updated.MaxResponseBytes = next.MaxResponseBytes
+	updated.LintQueries = next.LintQueries
+	updated.AdaptiveLimit = next.AdaptiveLimit
+	updated.BinaryColumns = next.BinaryColumns
+	updated.JSONColumns = next.JSONColumns
+	updated.OutputFormat = next.OutputFormat
+	updated.MultiStatement = next.MultiStatement
+
+	r.mu.Lock()
+	r.config = updated
+	r.mu.Unlock()
+	return nil
+}
+
+// credentialsChanged reports whether the credentials of a profile differ
+func credentialsChanged(a, b *Profile) bool {
+	return a.Auth != b.Auth || a.Cookies != b.Cookies || a.Username != b.Username || a.Password != b.Password ||
+		a.APIKey != b.APIKey || a.BearerToken != b.BearerToken ||
+		a.CookiesFile != b.CookiesFile || a.APIKeyFile != b.APIKeyFile || a.BearerTokenFile != b.BearerTokenFile
+}
+
+// watchConfig calls reload on SIGHUP and whenever one of paths changes
+func watchConfig(paths []string, reload func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		modTimes[path] = modTime(path)
+	}
+	ticker := time.NewTicker(5 * time.Second)
+	for {
+		select {
+		case <-hangup:
+			reload()
+		case <-ticker.C:
+			changed := false
+			for _, path := range paths {
+				if t := modTime(path); !t.Equal(modTimes[path]) {
+					modTimes[path] = t
+					changed = true
+				}
+			}
+			if changed {
+				reload()
+			}
+		}
+	}
+}
+
+// modTime returns the modification time of path, or the zero time when it
+// cannot be read
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
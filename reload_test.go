@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newReloadRegistry returns a registry serving the configuration in the
+// environment, as main sets it up
+func newReloadRegistry(t *testing.T) *toolRegistry {
+	t.Helper()
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range cfg.Profiles {
+		profile.client = NewMetabaseClient(profile.Host, 1)
+		auth, err := newAuthProvider(profile, profile.client.httpClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile.client.setAuth(auth)
+	}
+	return &toolRegistry{config: cfg, budget: &outputBudget{limits: outputLimitsFor(cfg)}}
+}
+
+func TestReloadConfig(t *testing.T) {
+	setMinimalEnv(t)
+	r := newReloadRegistry(t)
+	client := r.currentConfig().Profiles["default"].client
+
+	t.Setenv("METABASE_TIMEOUT", "5s")
+	t.Setenv("METABASE_MAX_ROWS", "10")
+	t.Setenv("METABASE_OUTPUT_FORMAT", formatCSV)
+	t.Setenv("METABASE_API_KEY", "mb_rotated")
+	if err := r.reloadConfig("", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := r.currentConfig()
+	if cfg.Timeout != 5*time.Second || cfg.MaxRows != 10 || cfg.OutputFormat != formatCSV {
+		t.Errorf("reloaded timeout %s, max rows %d, format %s; want 5s, 10, csv", cfg.Timeout, cfg.MaxRows, cfg.OutputFormat)
+	}
+	if got := r.budget.current().Rows; got != 10 {
+		t.Errorf("output budget rows = %d, want 10", got)
+	}
+	profile := cfg.Profiles["default"]
+	if profile.client != client {
+		t.Error("reload replaced the profile's client")
+	}
+	if client.timeout != 5*time.Second {
+		t.Errorf("client timeout = %s, want 5s", client.timeout)
+	}
+	if auth, ok := client.authProvider().(headerAuth); !ok || auth.value != "mb_rotated" {
+		t.Errorf("client auth = %#v, want the rotated API key", client.authProvider())
+	}
+}
+
+func TestReloadConfigHostChange(t *testing.T) {
+	setMinimalEnv(t)
+	r := newReloadRegistry(t)
+
+	// A changed host waits for a restart, keeping the profile as it was
+	t.Setenv("METABASE_HOST", "https://other.example.com")
+	t.Setenv("METABASE_API_KEY", "mb_rotated")
+	if err := r.reloadConfig("", nil); err != nil {
+		t.Fatal(err)
+	}
+	profile := r.currentConfig().Profiles["default"]
+	if profile.Host != "https://metabase.example.com" || profile.APIKey != "mb_test" {
+		t.Errorf("profile host %s, API key %s; want the original profile", profile.Host, profile.APIKey)
+	}
+	if auth, ok := profile.client.authProvider().(headerAuth); !ok || auth.value != "mb_test" {
+		t.Errorf("client auth = %#v, want the original API key", profile.client.authProvider())
+	}
+}
+
+func TestReloadConfigInvalid(t *testing.T) {
+	setMinimalEnv(t)
+	r := newReloadRegistry(t)
+
+	t.Setenv("METABASE_MAX_ROWS", "10")
+	t.Setenv("METABASE_TIMEOUT", "forever")
+	if err := r.reloadConfig("", nil); err == nil {
+		t.Fatal("reloadConfig() succeeded with an invalid timeout")
+	}
+	cfg := r.currentConfig()
+	if cfg.MaxRows != 0 || cfg.Timeout != 120*time.Second {
+		t.Errorf("max rows %d, timeout %s; want the configuration before the failed reload", cfg.MaxRows, cfg.Timeout)
+	}
+	if got := r.budget.current().Rows; got != 0 {
+		t.Errorf("output budget rows = %d, want 0", got)
+	}
+}
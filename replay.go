@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Fixture files written in record mode and read in replay mode
+const (
+	metabaseFixtureFile = "metabase.jsonl"
+	toolFixtureFile     = "tools.jsonl"
+)
+
+// HTTPFixture is a recorded Metabase request and its response
+type HTTPFixture struct {
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	BodyHash string `json:"body_hash,omitempty"`
+	Status   int    `json:"status"`
+	Response string `json:"response"`
+}
+
+// ToolFixture is a recorded tool call and its result
+type ToolFixture struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Result    string                 `json:"result"`
+	IsError   bool                   `json:"is_error"`
+}
+
+// fixtureKey identifies a request by method, host and path, and body
+func fixtureKey(method, url, bodyHash string) string {
+	return method + " " + url + " " + bodyHash
+}
+
+// hashBody returns a short digest of a request body
+func hashBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// fixtureURL strips the scheme so fixtures replay against any scheme
+func fixtureURL(req *http.Request) string {
+	return req.URL.Host + req.URL.RequestURI()
+}
+
+// recordingTransport passes requests through to Metabase and appends each
+// request and response to the fixture directory
+type recordingTransport struct {
+	mu    sync.Mutex
+	next  http.RoundTripper
+	http  *os.File
+	tools *os.File
+}
+
+// newRecordingTransport creates a recorder writing fixtures to dir and
+// passing requests to next, or the default transport when next is nil
+func newRecordingTransport(dir string, next http.RoundTripper) (*recordingTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	httpFile, err := os.OpenFile(filepath.Join(dir, metabaseFixtureFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture file: %w", err)
+	}
+	toolFile, err := os.OpenFile(filepath.Join(dir, toolFixtureFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		httpFile.Close()
+		return nil, fmt.Errorf("failed to open fixture file: %w", err)
+	}
+	return &recordingTransport{next: next, http: httpFile, tools: toolFile}, nil
+}
+
+// RoundTrip performs the request and records it
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	t.write(t.http, HTTPFixture{
+		Method:   req.Method,
+		URL:      fixtureURL(req),
+		BodyHash: hashBody(redactFixture(req.URL.Path, body)),
+		Status:   resp.StatusCode,
+		Response: string(redactFixture(req.URL.Path, respBody)),
+	})
+	return resp, nil
+}
+
+// recordTool records a completed tool call
+func (t *recordingTransport) recordTool(request *mcp.CallToolRequest, result *mcp.CallToolResult) {
+	if result == nil {
+		return
+	}
+	t.write(t.tools, ToolFixture{
+		Tool:      request.Params.Name,
+		Arguments: redactArguments(request.GetArguments()),
+		Result:    string(redactFixture("", []byte(resultText(result)))),
+		IsError:   result.IsError,
+	})
+}
+
+// redactFixture masks credentials in a recorded JSON body as the debug log
+// does, including the session ID returned by a login, so fixtures can be
+// shared. Request headers are never recorded. Numbers are kept as written, and
+// bodies that are not JSON are returned unchanged.
+func redactFixture(path string, body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return body
+	}
+	encoded, err := json.Marshal(redactJSON(v, strings.HasPrefix(path, "/api/session")))
+	if err != nil {
+		return body
+	}
+	return encoded
+}
+
+// write appends a fixture as a JSON line
+func (t *recordingTransport) write(f *os.File, fixture interface{}) {
+	line, err := json.Marshal(fixture)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f.Write(append(line, '\n'))
+}
+
+// replayTransport answers requests from recorded fixtures without touching
+// Metabase. Identical requests get their recorded responses in order, the
+// last one repeating once they run out.
+type replayTransport struct {
+	mu        sync.Mutex
+	responses map[string][]HTTPFixture
+}
+
+// newReplayTransport loads the Metabase fixtures from dir
+func newReplayTransport(dir string) (*replayTransport, error) {
+	t := &replayTransport{responses: make(map[string][]HTTPFixture)}
+	err := readFixtures(filepath.Join(dir, metabaseFixtureFile), func(line []byte) error {
+		var fixture HTTPFixture
+		if err := json.Unmarshal(line, &fixture); err != nil {
+			return err
+		}
+		key := fixtureKey(fixture.Method, fixture.URL, fixture.BodyHash)
+		t.responses[key] = append(t.responses[key], fixture)
+		return nil
+	})
+	return t, err
+}
+
+// RoundTrip returns the recorded response to the request
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	key := fixtureKey(req.Method, fixtureURL(req), hashBody(redactFixture(req.URL.Path, body)))
+
+	t.mu.Lock()
+	fixtures := t.responses[key]
+	if len(fixtures) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded response for %s %s", req.Method, fixtureURL(req))
+	}
+	fixture := fixtures[0]
+	if len(fixtures) > 1 {
+		t.responses[key] = fixtures[1:]
+	}
+	t.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: fixture.Status,
+		Status:     fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(fixture.Response)),
+		Request:    req,
+	}, nil
+}
+
+// readFixtures calls fn for each line of a JSON-lines fixture file
+func readFixtures(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open fixtures: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return fmt.Errorf("invalid fixture in %s: %w", path, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// runReplayCommand implements the replay subcommand: every recorded tool call
+// is executed again against the recorded Metabase responses, and the results
+// are compared with the recorded ones. It returns 1 when any result differs.
+func runReplayCommand(s *server.MCPServer, dir string, args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "print the expected and actual result of mismatches")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var calls []ToolFixture
+	err := readFixtures(filepath.Join(dir, toolFixtureFile), func(line []byte) error {
+		var call ToolFixture
+		if err := json.Unmarshal(line, &call); err != nil {
+			return err
+		}
+		calls = append(calls, call)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := 0
+	for i, call := range calls {
+		message, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": mcp.JSONRPC_VERSION,
+			"id":      i + 1,
+			"method":  "tools/call",
+			"params":  map[string]interface{}{"name": call.Tool, "arguments": call.Arguments},
+		})
+
+		actual := ""
+		isError := false
+		switch response := s.HandleMessage(context.Background(), message).(type) {
+		case mcp.JSONRPCResponse:
+			if result, ok := response.Result.(mcp.CallToolResult); ok {
+				actual, isError = resultText(&result), result.IsError
+			}
+		case mcp.JSONRPCError:
+			actual, isError = response.Error.Message, true
+		}
+
+		// Results are compared as recorded, with credentials redacted
+		actual = string(redactFixture("", []byte(actual)))
+		status := "ok"
+		if actual != call.Result || isError != call.IsError {
+			status = "MISMATCH"
+			failed++
+		}
+		fmt.Printf("%-8s %d %s\n", status, i+1, call.Tool)
+		if status != "ok" && *verbose {
+			fmt.Printf("--- expected\n%s\n--- actual\n%s\n", call.Result, actual)
+		}
+	}
+
+	fmt.Printf("%d calls replayed, %d mismatches\n", len(calls), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
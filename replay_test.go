@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactFixture(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{"login", "/api/session", `{"username":"ana","password":"hunter2"}`, `{"password":"[redacted]","username":"ana"}`},
+		{"session ID", "/api/session", `{"id":"4f3c-session"}`, `{"id":"[redacted]"}`},
+		{"other IDs", "/api/card/5", `{"id":5,"name":"Orders"}`, `{"id":5,"name":"Orders"}`},
+		{"nested", "/api/database/1", `{"details":{"password":"pw","host":"db"}}`, `{"details":{"host":"db","password":"[redacted]"}}`},
+		{"API keys", "/api/api-key", `[{"unmasked_key":"mb_abc","name":"ci"}]`, `[{"name":"ci","unmasked_key":"[redacted]"}]`},
+		{"numbers as written", "/api/dataset", `{"rows":[[12345678901234567890,1.50]]}`, `{"rows":[[12345678901234567890,1.50]]}`},
+		{"not JSON", "/api/card/5/query/csv", "id,name\n5,Orders\n", "id,name\n5,Orders\n"},
+		{"several values", "/api/session", `{"id":"a"} {"id":"b"}`, `{"id":"a"} {"id":"b"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(redactFixture(tt.path, []byte(tt.body))); got != tt.want {
+				t.Errorf("redactFixture(%q) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordedFixturesReplay(t *testing.T) {
+	metabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"4f3c-session"}`)
+	}))
+	defer metabase.Close()
+	dir := t.TempDir()
+
+	recorder, err := newRecordingTransport(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.http.Close()
+	defer recorder.tools.Close()
+	login := `{"username":"ana","password":"hunter2"}`
+	request, _ := http.NewRequest("POST", metabase.URL+"/api/session", strings.NewReader(login))
+	response, err := recorder.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(response.Body); string(body) != `{"id":"4f3c-session"}` {
+		t.Errorf("recorded response = %s, want Metabase's", body)
+	}
+
+	fixtures, err := os.ReadFile(filepath.Join(dir, metabaseFixtureFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(fixtures), "4f3c-session") || strings.Contains(string(fixtures), "hunter2") {
+		t.Errorf("fixtures hold credentials: %s", fixtures)
+	}
+
+	// Replay matches the login on its redacted body, whatever the password
+	replay, err := newReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ = http.NewRequest("POST", metabase.URL+"/api/session", strings.NewReader(`{"username":"ana","password":"other"}`))
+	response, err = replay.RoundTrip(request)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if body, _ := io.ReadAll(response.Body); string(body) != `{"id":"[redacted]"}` {
+		t.Errorf("replayed response = %s", body)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// SchemaSnapshot records the tables and column types of a database at one point in time
+type SchemaSnapshot struct {
+	DatabaseID int                          `json:"database_id"`
+	TakenAt    time.Time                    `json:"taken_at"`
+	Tables     map[string]map[string]string `json:"tables"`
+}
+
+// ColumnTypeChange describes a column whose type changed between snapshots
+type ColumnTypeChange struct {
+	Column string `json:"column"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// SchemaDiff lists the differences between two schema snapshots
+type SchemaDiff struct {
+	AddedTables    []string           `json:"added_tables"`
+	DroppedTables  []string           `json:"dropped_tables"`
+	AddedColumns   []string           `json:"added_columns"`
+	DroppedColumns []string           `json:"dropped_columns"`
+	TypeChanges    []ColumnTypeChange `json:"type_changes"`
+}
+
+// Empty reports whether the snapshots were identical
+func (d SchemaDiff) Empty() bool {
+	return len(d.AddedTables)+len(d.DroppedTables)+len(d.AddedColumns)+len(d.DroppedColumns)+len(d.TypeChanges) == 0
+}
+
+// snapshotFromMetadata builds a schema snapshot from database metadata
+func snapshotFromMetadata(metadata DatabaseMetadata) SchemaSnapshot {
+	snapshot := SchemaSnapshot{DatabaseID: metadata.ID, TakenAt: time.Now().UTC(), Tables: make(map[string]map[string]string)}
+	for _, table := range metadata.Tables {
+		columns := make(map[string]string, len(table.Fields))
+		for _, field := range table.Fields {
+			columns[field.Name] = field.BaseType
+		}
+		snapshot.Tables[table.qualifiedName()] = columns
+	}
+	return snapshot
+}
+
+// diffSnapshots compares a previous snapshot with a current one
+func diffSnapshots(previous, current SchemaSnapshot) SchemaDiff {
+	diff := SchemaDiff{
+		AddedTables:    []string{},
+		DroppedTables:  []string{},
+		AddedColumns:   []string{},
+		DroppedColumns: []string{},
+		TypeChanges:    []ColumnTypeChange{},
+	}
+	for table, columns := range current.Tables {
+		before, ok := previous.Tables[table]
+		if !ok {
+			diff.AddedTables = append(diff.AddedTables, table)
+			continue
+		}
+		for column, baseType := range columns {
+			oldType, ok := before[column]
+			switch {
+			case !ok:
+				diff.AddedColumns = append(diff.AddedColumns, table+"."+column)
+			case oldType != baseType:
+				diff.TypeChanges = append(diff.TypeChanges, ColumnTypeChange{Column: table + "." + column, From: oldType, To: baseType})
+			}
+		}
+		for column := range before {
+			if _, ok := columns[column]; !ok {
+				diff.DroppedColumns = append(diff.DroppedColumns, table+"."+column)
+			}
+		}
+	}
+	for table := range previous.Tables {
+		if _, ok := current.Tables[table]; !ok {
+			diff.DroppedTables = append(diff.DroppedTables, table)
+		}
+	}
+
+	sort.Strings(diff.AddedTables)
+	sort.Strings(diff.DroppedTables)
+	sort.Strings(diff.AddedColumns)
+	sort.Strings(diff.DroppedColumns)
+	sort.Slice(diff.TypeChanges, func(i, j int) bool { return diff.TypeChanges[i].Column < diff.TypeChanges[j].Column })
+	return diff
+}
+
+// snapshotStore keeps the recent schema snapshots of each profile database,
+// persisted next to the metadata cache when a directory is configured
+type snapshotStore struct {
+	mu        sync.Mutex
+	dir       string
+	limit     int
+	snapshots map[string][]SchemaSnapshot
+}
+
+// newSnapshotStore creates a store keeping at most limit snapshots per database
+func newSnapshotStore(dir string, limit int) *snapshotStore {
+	return &snapshotStore{dir: dir, limit: limit, snapshots: make(map[string][]SchemaSnapshot)}
+}
+
+// file returns the path of the snapshot file of a profile database
+func (s *snapshotStore) file(key string) string {
+	return filepath.Join(s.dir, "schema-"+key+".json")
+}
+
+// load returns the snapshots of a profile database, oldest first. The caller must hold s.mu.
+func (s *snapshotStore) load(key string) []SchemaSnapshot {
+	if snapshots, ok := s.snapshots[key]; ok || s.dir == "" {
+		return snapshots
+	}
+	var snapshots []SchemaSnapshot
+	if data, err := os.ReadFile(s.file(key)); err == nil {
+		if err := json.Unmarshal(data, &snapshots); err != nil {
+			log.Printf("schema snapshots %s: %v", key, err)
+		}
+	}
+	s.snapshots[key] = snapshots
+	return snapshots
+}
+
+// list returns the snapshots of a profile database, oldest first
+func (s *snapshotStore) list(profile string, databaseID int) []SchemaSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshots := s.load(fmt.Sprintf("%s-%d", profile, databaseID))
+	return append([]SchemaSnapshot(nil), snapshots...)
+}
+
+// add appends a snapshot, dropping the oldest once the limit is reached
+func (s *snapshotStore) add(profile string, snapshot SchemaSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fmt.Sprintf("%s-%d", profile, snapshot.DatabaseID)
+	snapshots := append(s.load(key), snapshot)
+	if len(snapshots) > s.limit {
+		snapshots = snapshots[len(snapshots)-s.limit:]
+	}
+	s.snapshots[key] = snapshots
+	if s.dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(snapshots)
+	if err == nil {
+		err = os.MkdirAll(s.dir, 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(s.file(key), data, 0o600)
+	}
+	if err != nil {
+		log.Printf("schema snapshots %s: %v", key, err)
+	}
+}
+
+// checkSchemaDrift takes a fresh snapshot of a database and diffs it against
+// the latest snapshot taken at or before since, or the latest one when since
+// is zero. The fresh snapshot is stored when the schema changed.
+func checkSchemaDrift(ctx context.Context, store *snapshotStore, profile *Profile, databaseID int, since time.Time) (*SchemaSnapshot, SchemaSnapshot, SchemaDiff, error) {
+	var metadata DatabaseMetadata
+	cachedAt, err := profile.client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), &metadata)
+	if err != nil {
+		return nil, SchemaSnapshot{}, SchemaDiff{}, err
+	}
+	if cachedAt != nil {
+		return nil, SchemaSnapshot{}, SchemaDiff{}, fmt.Errorf("metabase is unreachable, cannot snapshot the current schema")
+	}
+	current := snapshotFromMetadata(metadata)
+	current.DatabaseID = databaseID
+
+	snapshots := store.list(profile.Name, databaseID)
+	var baseline *SchemaSnapshot
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if since.IsZero() || !snapshots[i].TakenAt.After(since) {
+			baseline = &snapshots[i]
+			break
+		}
+	}
+
+	var diff SchemaDiff
+	if baseline != nil {
+		diff = diffSnapshots(*baseline, current)
+	}
+	if len(snapshots) == 0 || !diffSnapshots(snapshots[len(snapshots)-1], current).Empty() {
+		store.add(profile.Name, current)
+	}
+	return baseline, current, diff, nil
+}
+
+// watchSchemaDrift snapshots the default database of every profile at each
+// interval, logging drift and notifying connected clients when notify is set
+func watchSchemaDrift(s *server.MCPServer, store *snapshotStore, profiles map[string]*Profile, interval time.Duration, notify bool) {
+	for {
+		for _, profile := range profiles {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			baseline, _, diff, err := checkSchemaDrift(ctx, store, profile, profile.DatabaseID, time.Time{})
+			cancel()
+			if err != nil {
+				log.Printf("schema drift check for profile %s: %v", profile.Name, err)
+				continue
+			}
+			if baseline == nil || diff.Empty() {
+				continue
+			}
+
+			log.Printf("schema drift in profile %s database %d: %d tables added, %d dropped, %d columns added, %d dropped, %d type changes",
+				profile.Name, profile.DatabaseID, len(diff.AddedTables), len(diff.DroppedTables), len(diff.AddedColumns), len(diff.DroppedColumns), len(diff.TypeChanges))
+			if notify {
+				s.SendNotificationToAllClients("notifications/message", map[string]any{
+					"level":  "warning",
+					"logger": "schema-drift",
+					"data": map[string]any{
+						"profile":     profile.Name,
+						"database_id": profile.DatabaseID,
+						"since":       baseline.TakenAt,
+						"changes":     diff,
+					},
+				})
+			}
+		}
+		time.Sleep(interval)
+	}
+}
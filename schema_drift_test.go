@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	previous := SchemaSnapshot{Tables: map[string]map[string]string{
+		"public.orders":  {"id": "type/Integer", "status": "type/Text"},
+		"public.legacy":  {"id": "type/Integer"},
+		"public.regions": {"code": "type/Text"},
+	}}
+	current := SchemaSnapshot{Tables: map[string]map[string]string{
+		"public.orders":  {"id": "type/BigInteger", "total": "type/Float"},
+		"public.refunds": {"id": "type/Integer"},
+		"public.regions": {"code": "type/Text"},
+	}}
+
+	diff := diffSnapshots(previous, current)
+	want := SchemaDiff{
+		AddedTables:    []string{"public.refunds"},
+		DroppedTables:  []string{"public.legacy"},
+		AddedColumns:   []string{"public.orders.total"},
+		DroppedColumns: []string{"public.orders.status"},
+		TypeChanges:    []ColumnTypeChange{{Column: "public.orders.id", From: "type/Integer", To: "type/BigInteger"}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %+v, want %+v", diff, want)
+	}
+	if !diffSnapshots(current, current).Empty() {
+		t.Errorf("identical snapshots differ")
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	dir := t.TempDir()
+	store := newSnapshotStore(dir, 2)
+	for i := 1; i <= 3; i++ {
+		store.add("default", SchemaSnapshot{DatabaseID: 1, TakenAt: time.Unix(int64(i), 0).UTC()})
+	}
+	store.add("default", SchemaSnapshot{DatabaseID: 2})
+
+	reopened := newSnapshotStore(dir, 2)
+	snapshots := reopened.list("default", 1)
+	if len(snapshots) != 2 || snapshots[0].TakenAt.Unix() != 2 || snapshots[1].TakenAt.Unix() != 3 {
+		t.Errorf("snapshots = %+v, want the latest two, oldest first", snapshots)
+	}
+	if len(reopened.list("default", 2)) != 1 || len(reopened.list("staging", 1)) != 0 {
+		t.Errorf("snapshots are not kept per profile database")
+	}
+}
+
+func TestCheckSchemaDrift(t *testing.T) {
+	var mu sync.Mutex
+	fields := []interface{}{map[string]interface{}{"name": "id", "base_type": "type/Integer"}}
+	client := newTestClient(t, map[string]interface{}{
+		"/api/database/1/metadata": func(fakeRequest) interface{} {
+			mu.Lock()
+			defer mu.Unlock()
+			return map[string]interface{}{"id": 1, "tables": []interface{}{
+				map[string]interface{}{"name": "orders", "schema": "public", "fields": fields},
+			}}
+		},
+	})
+	profile := &Profile{Name: "default", DatabaseID: 1, client: client}
+	store := newSnapshotStore("", 10)
+	ctx := context.Background()
+
+	baseline, _, _, err := checkSchemaDrift(ctx, store, profile, 1, time.Time{})
+	if err != nil || baseline != nil || len(store.list("default", 1)) != 1 {
+		t.Fatalf("first check: baseline %v, err %v, want the first snapshot stored", baseline, err)
+	}
+
+	baseline, _, diff, err := checkSchemaDrift(ctx, store, profile, 1, time.Time{})
+	if err != nil || baseline == nil || !diff.Empty() || len(store.list("default", 1)) != 1 {
+		t.Errorf("unchanged check: baseline %v, diff %+v, err %v, want no drift and nothing stored", baseline, diff, err)
+	}
+
+	mu.Lock()
+	fields = append(fields, map[string]interface{}{"name": "total", "base_type": "type/Float"})
+	mu.Unlock()
+	_, _, diff, err = checkSchemaDrift(ctx, store, profile, 1, time.Time{})
+	if err != nil || !reflect.DeepEqual(diff.AddedColumns, []string{"public.orders.total"}) || len(store.list("default", 1)) != 2 {
+		t.Errorf("changed check: diff %+v, err %v, want the added column and a new snapshot", diff, err)
+	}
+
+	// No snapshot is old enough to compare with
+	baseline, _, _, err = checkSchemaDrift(ctx, store, profile, 1, time.Now().Add(-time.Hour))
+	if err != nil || baseline != nil {
+		t.Errorf("check since an hour ago: baseline %v, err %v", baseline, err)
+	}
+}
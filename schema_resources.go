@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// tableResourceTemplate addresses the schema of one table as an MCP resource
+const tableResourceTemplate = "metabase://db/{database_id}/table/{table}"
+
+// registerSchemaResources makes the schema of every table readable as a
+// resource of the default profile, so clients can attach it as context
+// without a tool call
+func registerSchemaResources(r *toolRegistry) {
+	r.server.AddResourceTemplate(
+		mcp.NewResourceTemplate(
+			tableResourceTemplate,
+			"Table schema",
+			mcp.WithTemplateDescription("Columns of a table with their types, semantic types, descriptions and foreign keys, as returned by describe-table. The table is given by name, schema.name or ID"),
+			mcp.WithTemplateMIMEType("application/json"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			databaseID, err := strconv.Atoi(resourceArgument(request, "database_id"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid database ID in %s", request.Params.URI)
+			}
+			return r.readTableResource(ctx, request.Params.URI, databaseID, resourceArgument(request, "table"))
+		},
+	)
+}
+
+// publishSchemaResources lists the tables of the default profile's database
+// as resources. Tables created later stay readable through the template.
+// The resource list is the same for every client, so it is not published
+// when HTTP clients have their own access rules: table names and descriptions
+// from schemas a client may not read would show up in it.
+func (r *toolRegistry) publishSchemaResources(ctx context.Context) {
+	cfg := r.currentConfig()
+	profile := cfg.Profiles[cfg.DefaultProfile]
+	if profile == nil || profile.DatabaseID == 0 {
+		return
+	}
+	if cfg.Transport == "http" && cfg.ClientAccessFile != "" {
+		log.Printf("Not listing table schemas as resources, since clients have their own access rules; tables stay readable through %s", tableResourceTemplate)
+		return
+	}
+	ctx, cancel := context.WithTimeout(withProfile(ctx, profile), time.Minute)
+	defer cancel()
+
+	var metadata DatabaseMetadata
+	if _, err := profile.client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", profile.DatabaseID), &metadata); err != nil {
+		log.Printf("Listing table schemas as resources failed: %v", err)
+		return
+	}
+
+	// Tables are named without their schema unless the name is ambiguous
+	names := make(map[string]int)
+	for _, table := range metadata.Tables {
+		names[strings.ToLower(table.Name)]++
+	}
+	for _, table := range metadata.Tables {
+		name := table.Name
+		if names[strings.ToLower(table.Name)] > 1 {
+			name = table.Schema + "." + table.Name
+		}
+		uri := fmt.Sprintf("metabase://db/%d/table/%s", metadata.ID, url.PathEscape(name))
+		options := []mcp.ResourceOption{mcp.WithMIMEType("application/json")}
+		if table.Description != nil && *table.Description != "" {
+			options = append(options, mcp.WithResourceDescription(*table.Description))
+		}
+		databaseID, tableName := metadata.ID, name
+		r.server.AddResource(mcp.NewResource(uri, table.qualifiedName(), options...), func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return r.readTableResource(ctx, uri, databaseID, tableName)
+		})
+	}
+}
+
+// readTableResource returns the describe-table result of a table as resource contents
+func (r *toolRegistry) readTableResource(ctx context.Context, uri string, databaseID int, table string) ([]mcp.ResourceContents, error) {
+	cfg := r.currentConfig()
+	profile := cfg.Profiles[cfg.DefaultProfile]
+	ctx = withProfile(ctx, profile)
+	if err := checkDatabaseAccess(ctx, databaseID); err != nil {
+		return nil, err
+	}
+
+	var request mcp.CallToolRequest
+	request.Params.Name = "describe-table"
+	request.Params.Arguments = map[string]interface{}{"table": table, "database_id": float64(databaseID)}
+	result, err := handleDescribeTable(ctx, profile.client, request)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		return nil, fmt.Errorf("%s", resultText(result))
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: resultText(result)}}, nil
+}
+
+// resourceArgument returns a variable matched in a resource URI, unescaped
+func resourceArgument(request mcp.ReadResourceRequest, name string) string {
+	var value string
+	switch v := request.Params.Arguments[name].(type) {
+	case string:
+		value = v
+	case []string:
+		if len(v) > 0 {
+			value = v[0]
+		}
+	}
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
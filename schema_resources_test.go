@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestPublishSchemaResources(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": testMetadata})
+	newRegistry := func(cfg Config) *toolRegistry {
+		cfg.DefaultProfile = "default"
+		cfg.Profiles = map[string]*Profile{"default": {Name: "default", DatabaseID: 1, client: client}}
+		r := &toolRegistry{
+			server: server.NewMCPServer("test", "1.0", server.WithResourceCapabilities(false, false)),
+			config: cfg,
+		}
+		registerSchemaResources(r)
+		r.publishSchemaResources(context.Background())
+		return r
+	}
+	listed := func(r *toolRegistry) int {
+		response, _ := json.Marshal(r.server.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`)))
+		return strings.Count(string(response), `"uri"`)
+	}
+
+	if n := listed(newRegistry(Config{Transport: "stdio"})); n != 2 {
+		t.Errorf("stdio lists %d tables, want 2", n)
+	}
+
+	r := newRegistry(Config{Transport: "http", ClientAccessFile: "clients.json"})
+	if n := listed(r); n != 0 {
+		t.Errorf("with client access rules %d tables are listed, want none", n)
+	}
+	finance := withClientAccess(context.Background(), &ClientAccess{Name: "finance", Schemas: []string{"finance"}})
+	if response := readResource(t, finance, r.server, "metabase://db/1/table/finance.orders"); !strings.Contains(response, "employee_id") {
+		t.Errorf("finance.orders = %s, want its columns", response)
+	}
+	if response := readResource(t, finance, r.server, "metabase://db/1/table/hr.salaries"); !strings.Contains(response, "access denied") {
+		t.Errorf("hr.salaries = %s, want access denied", response)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretCommandTimeout bounds the keychain and secret service lookups
+const secretCommandTimeout = 10 * time.Second
+
+// secretSchemes are the prefixes of secret references
+var secretSchemes = []string{"env:", "file:", "keychain:", "secret-service:"}
+
+// isSecretReference reports whether value refers to a secret rather than being one
+func isSecretReference(value string) bool {
+	for _, scheme := range secretSchemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecret reads a secret from a reference of the form "env:NAME",
+// "file:/path", "keychain:service[/account]" (the macOS Keychain) or
+// "secret-service:attribute=value[,attribute=value]" (the Linux secret
+// service), so credentials never have to be passed in plain text
+func resolveSecret(ref string) (string, error) {
+	scheme, target, ok := strings.Cut(ref, ":")
+	if !ok || target == "" {
+		return "", fmt.Errorf("invalid secret reference %q, expected env:NAME, file:/path, keychain:service[/account] or secret-service:attribute=value", ref)
+	}
+
+	switch scheme {
+	case "env":
+		value, ok := os.LookupEnv(target)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", target)
+		}
+		return value, nil
+	case "file":
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "keychain":
+		service, account, _ := strings.Cut(target, "/")
+		args := []string{"find-generic-password", "-s", service, "-w"}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		return secretCommand("security", args...)
+	case "secret-service":
+		args := []string{"lookup"}
+		for _, attribute := range strings.Split(target, ",") {
+			key, value, ok := strings.Cut(attribute, "=")
+			if !ok {
+				return "", fmt.Errorf("invalid secret service attribute %q, expected attribute=value", attribute)
+			}
+			args = append(args, key, value)
+		}
+		return secretCommand("secret-tool", args...)
+	default:
+		return "", fmt.Errorf("unsupported secret reference scheme %q", scheme)
+	}
+}
+
+// secretCommand runs a credential store's command line tool and returns the
+// secret it prints
+func secretCommand(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret with %s: %v %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	secret := strings.TrimRight(string(out), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s returned an empty secret", name)
+	}
+	return secret, nil
+}
+
+// secretFileInterval is how often watched secret files are checked for changes
+const secretFileInterval = 5 * time.Second
+
+// secretFile is a credential read from a file and re-read whenever the file
+// changes, so an external process can rotate it without a restart
+type secretFile struct {
+	path string
+	stop chan struct{}
+	once sync.Once
+
+	mu      sync.Mutex
+	value   string
+	modTime time.Time
+	size    int64
+}
+
+// openSecretFile reads the secret in path and watches the file for changes
+func openSecretFile(path string) (*secretFile, error) {
+	f := &secretFile{path: path, stop: make(chan struct{})}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	go f.watch(secretFileInterval)
+	return f, nil
+}
+
+// get returns the current secret
+func (f *secretFile) get() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.value
+}
+
+// reload re-reads the file if it changed since it was last read, reporting
+// whether the secret changed. An empty file keeps the previous secret, since
+// it is usually caught halfway through being rewritten.
+func (f *secretFile) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		if f.value == "" {
+			return false, fmt.Errorf("secret file %s is empty", f.path)
+		}
+		return false, nil
+	}
+
+	f.modTime, f.size = info.ModTime(), info.Size()
+	changed := value != f.value
+	f.value = value
+	return changed, nil
+}
+
+// watch reloads the secret every interval until the file is closed
+func (f *secretFile) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+		changed, err := f.reload()
+		switch {
+		case err != nil:
+			log.Printf("secret file %s: %v", f.path, err)
+		case changed:
+			log.Printf("reloaded credentials from %s", f.path)
+		}
+	}
+}
+
+// close stops watching the file. The last secret read stays available, and
+// reload still re-reads the file on demand.
+func (f *secretFile) close() {
+	f.once.Do(func() { close(f.stop) })
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSecretFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openSecretFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.close()
+	if got := f.get(); got != "first" {
+		t.Fatalf("get() = %q, want first", got)
+	}
+
+	// An empty file is caught halfway through a rewrite and keeps the secret
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := f.reload(); changed || err != nil || f.get() != "first" {
+		t.Fatalf("empty file: reload() = %v, %v, get() = %q", changed, err, f.get())
+	}
+
+	if err := os.WriteFile(path, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := f.reload(); !changed || err != nil || f.get() != "second" {
+		t.Fatalf("rotated file: reload() = %v, %v, get() = %q", changed, err, f.get())
+	}
+}
+
+func TestReplacedAuthStopsWatching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(path, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	profile := &Profile{Name: "default", APIKeyFile: path}
+	client := NewMetabaseClient("https://metabase.example.com", 1)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		auth, err := newAuthProvider(profile, client.httpClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.setAuth(auth)
+	}
+	client.setAuth(headerAuth{name: authCookie, header: "Cookie"})
+
+	// The watchers exit once they see their file closed
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines after replacing the providers, want at most %d", n, before)
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("TEST_DB_PASSWORD", "s3cret")
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("from-file\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"env:TEST_DB_PASSWORD", "s3cret", false},
+		{"file:" + path, "from-file", false},
+		{"env:TEST_DB_PASSWORD_UNSET", "", true},
+		{"file:" + filepath.Join(t.TempDir(), "missing"), "", true},
+		{"s3cret", "", true},
+		{"env:", "", true},
+		{"vault:db/password", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSecret(%q) = %q, %v, want %q (error %v)", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveSecretFromStores(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential store tools are shell scripts")
+	}
+	// Fake security and secret-tool commands print the arguments they were given
+	dir := t.TempDir()
+	for _, name := range []string{"security", "secret-tool"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\necho \"$*\"\n"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"keychain:metabase", "find-generic-password -s metabase -w", false},
+		{"keychain:metabase/analyst", "find-generic-password -s metabase -w -a analyst", false},
+		{"secret-service:service=metabase,user=analyst", "lookup service metabase user analyst", false},
+		{"secret-service:metabase", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSecret(%q) = %q, %v, want %q (error %v)", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err := resolveSecret("keychain:metabase"); err == nil {
+		t.Errorf("resolved a keychain secret without the security tool")
+	}
+}
+
+func TestProfileResolveSecrets(t *testing.T) {
+	t.Setenv("TEST_METABASE_PASSWORD", "s3cret")
+	profile := &Profile{Username: "analyst", Password: "env:TEST_METABASE_PASSWORD", APIKey: "file:/run/secrets/metabase-key"}
+	if err := profile.resolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Password != "s3cret" {
+		t.Errorf("password = %q, want the resolved secret", profile.Password)
+	}
+	// Header credentials in files are watched rather than read once
+	if profile.APIKey != "" || profile.APIKeyFile != "/run/secrets/metabase-key" {
+		t.Errorf("api key = %q from file %q", profile.APIKey, profile.APIKeyFile)
+	}
+
+	if err := (&Profile{Password: "env:TEST_METABASE_PASSWORD_UNSET"}).resolveSecrets(); err == nil {
+		t.Errorf("resolved an unset environment variable")
+	}
+}
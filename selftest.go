@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Startup check modes
+const (
+	startupCheckFail = "fail"
+	startupCheckWarn = "warn"
+	startupCheckOff  = "off"
+)
+
+// selfTest checks every profile against Metabase before serving: that its
+// credentials are accepted and that its databases exist and are visible to
+// the user. An unreachable host is only logged, since cached metadata and the
+// failover host can still serve; other problems are returned.
+func selfTest(ctx context.Context, profiles map[string]*Profile) error {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		if err := checkProfile(ctx, profiles[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("profile %s: %v", name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("startup check failed:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkProfile logs in as the profile's user and looks up its databases
+func checkProfile(ctx context.Context, profile *Profile) error {
+	client := profile.client
+
+	var user MetabaseUser
+	if err := client.Get(ctx, "/api/user/current", &user); err != nil {
+		var authErr *AuthError
+		switch {
+		case errors.As(err, &authErr):
+			return err
+		case isHostFailure(err):
+			log.Printf("Startup check: profile %s cannot reach %s yet (%v); tools will retry and serve cached metadata meanwhile", profile.Name, client.host, err)
+			return nil
+		default:
+			return fmt.Errorf("failed to fetch the current user from %s: %w", client.host, err)
+		}
+	}
+
+	databaseIDs := []int{profile.DatabaseID}
+	for _, id := range profile.Databases {
+		if id != profile.DatabaseID {
+			databaseIDs = append(databaseIDs, id)
+		}
+	}
+	sort.Ints(databaseIDs[1:])
+
+	var names []string
+	for _, id := range databaseIDs {
+		var database MetabaseDatabase
+		err := client.Get(ctx, fmt.Sprintf("/api/database/%d", id), &database)
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			names = append(names, fmt.Sprintf("%d (%s)", database.ID, database.Name))
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("database %d does not exist on %s; %s", id, client.host, availableDatabases(ctx, client))
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden:
+			return fmt.Errorf("%s may not access database %d; grant the user's group access in Metabase or choose another database (%s)", user.Email, id, availableDatabases(ctx, client))
+		default:
+			return fmt.Errorf("failed to fetch database %d: %w", id, err)
+		}
+	}
+
+	log.Printf("Startup check: profile %s connected to %s as %s, database %s", profile.Name, client.host, user.Email, strings.Join(names, ", "))
+	return nil
+}
+
+// availableDatabases describes the databases the user can see, to suggest a
+// valid database ID
+func availableDatabases(ctx context.Context, client *MetabaseClient) string {
+	databases, err := listDatabases(ctx, client)
+	if err != nil {
+		return "the available databases could not be listed"
+	}
+	if len(databases) == 0 {
+		return "the user can see no databases"
+	}
+
+	available := make([]string, 0, len(databases))
+	for _, database := range databases {
+		available = append(available, fmt.Sprintf("%d (%s)", database.ID, database.Name))
+	}
+	return "available databases: " + strings.Join(available, ", ")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Header.Get("X-API-Key") == "revoked":
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		case r.URL.Path == "/api/user/current":
+			w.Write([]byte(`{"email":"analyst@example.com"}`))
+		case r.URL.Path == "/api/database":
+			w.Write([]byte(`{"data":[{"id":1,"name":"Sample"},{"id":2,"name":"Finance"}]}`))
+		case r.URL.Path == "/api/database/1":
+			w.Write([]byte(`{"id":1,"name":"Sample"}`))
+		case r.URL.Path == "/api/database/2":
+			http.Error(w, "You don't have permissions to do that.", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		host      string
+		apiKey    string
+		databases map[string]int
+		want      string
+	}{
+		{name: "connected", host: server.URL, apiKey: "mb_test"},
+		{name: "rejected credentials", host: server.URL, apiKey: "revoked", want: "401"},
+		{name: "missing database", host: server.URL, apiKey: "mb_test", databases: map[string]int{"archive": 9}, want: "database 9 does not exist on " + server.URL + "; available databases: 1 (Sample), 2 (Finance)"},
+		{name: "forbidden database", host: server.URL, apiKey: "mb_test", databases: map[string]int{"finance": 2}, want: "analyst@example.com may not access database 2"},
+		// An unreachable host is only logged
+		{name: "unreachable", host: "http://127.0.0.1:1", apiKey: "mb_test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewMetabaseClient(tt.host, 1)
+			client.setAuth(headerAuth{name: authAPIKey, header: "X-API-Key", value: tt.apiKey})
+			profile := &Profile{Name: "default", DatabaseID: 1, Databases: tt.databases, client: client}
+
+			err := selfTest(context.Background(), map[string]*Profile{"default": profile})
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("selfTest() = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("selfTest() = %v, want error containing %q", err, tt.want)
+			case err != nil && !strings.HasPrefix(err.Error(), "startup check failed:\n  profile default: "):
+				t.Errorf("selfTest() = %v, want the failing profile named", err)
+			}
+		})
+	}
+}
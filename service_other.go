@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "context"
+
+// runAsService reports that no service manager wrapper applies; under systemd
+// the server runs in the foreground and signals readiness with sd_notify
+func runAsService(run func(ctx context.Context) error) (bool, int) {
+	return false, 0
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotify listens on a systemd notification socket set as NOTIFY_SOCKET
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", socket)
+	return conn
+}
+
+// readNotify returns the next notification, or "" when none arrives within timeout
+func readNotify(conn *net.UnixConn, timeout time.Duration) string {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	conn := listenNotify(t)
+	sdNotify("READY=1")
+	// A watchdog started by an earlier test run may ping the socket too
+	state := readNotify(conn, time.Second)
+	for state == "WATCHDOG=1" {
+		state = readNotify(conn, time.Second)
+	}
+	if state != "READY=1" {
+		t.Errorf("notified %q, want READY=1", state)
+	}
+
+	// Without a unit socket nothing is sent
+	t.Setenv("NOTIFY_SOCKET", "")
+	sdNotify("STOPPING=1")
+	if state := readNotify(conn, 50*time.Millisecond); state == "STOPPING=1" {
+		t.Errorf("notified %q without NOTIFY_SOCKET", state)
+	}
+}
+
+func TestStartWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	startWatchdog()
+	if state := readNotify(conn, time.Second); state != "WATCHDOG=1" {
+		t.Errorf("notified %q, want WATCHDOG=1", state)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"log"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// windowsService adapts the server to the Windows service control manager
+type windowsService struct {
+	run      func(ctx context.Context) error
+	exitCode uint32
+}
+
+// Execute runs the server until the service manager asks it to stop
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() { done <- s.run(ctx) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("Server error: %v", err)
+				s.exitCode = 1
+			}
+			return false, s.exitCode
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// runAsService runs the server under the Windows service control manager when
+// the process was started by it. It reports whether it did, and the exit code.
+func runAsService(run func(ctx context.Context) error) (bool, int) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, 0
+	}
+
+	service := &windowsService{run: run}
+	if err := svc.Run("metabase-mcp", service); err != nil {
+		log.Printf("Service error: %v", err)
+		return true, 1
+	}
+	return true, int(service.exitCode)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"strings"
+)
+
+// sqlTokenKind classifies the tokens of a SQL query
+type sqlTokenKind int
+
+const (
+	sqlWord     sqlTokenKind = iota // keyword, bare identifier or number
+	sqlQuoted                       // quoted identifier
+	sqlString                       // string literal
+	sqlTemplate                     // Metabase {{...}} template tag
+	sqlPunct                        // any other character
+)
+
+// sqlToken is one token of a SQL query. Words are lowercased; quoted
+// identifiers keep their case without the quotes.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// is reports whether the token is the given bare word or punctuation
+func (t sqlToken) is(text string) bool {
+	return (t.kind == sqlWord || t.kind == sqlPunct) && t.text == text
+}
+
+// identifier reports whether the token can name a table or schema
+func (t sqlToken) identifier() bool {
+	return t.kind == sqlQuoted || (t.kind == sqlWord && t.text != "" && !isDigit(t.text[0]))
+}
+
+// tokenizeSQL splits a query into tokens, dropping whitespace and comments.
+// The lexical rules of databases differ, so mysql selects MySQL's: # starts a
+// comment, backslashes escape quotes in strings, and /*! ... */ comments hold
+// code. Otherwise the standard rules apply, with PostgreSQL's E” and
+// dollar-quoted strings.
+func tokenizeSQL(query string, mysql bool) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+		case c == '-' && strings.HasPrefix(query[i:], "--"),
+			c == '#' && mysql:
+			i = skipUntil(query, i+1, "\n") - 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*!") && mysql:
+			// MySQL runs the body of executable comments, so only the markers are dropped
+			for i += 3; i < len(query) && isDigit(query[i]); i++ {
+			}
+			i--
+		case c == '*' && strings.HasPrefix(query[i:], "*/") && mysql:
+			i++
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = skipUntil(query, i+2, "*/") - 1
+		case c == '{' && strings.HasPrefix(query[i:], "{{"):
+			end := skipUntil(query, i+2, "}}")
+			tokens = append(tokens, sqlToken{kind: sqlTemplate, text: strings.TrimSuffix(query[i+2:end], "}}")})
+			i = end - 1
+		case c == '[' && strings.HasPrefix(query[i:], "[["),
+			c == ']' && strings.HasPrefix(query[i:], "]]"):
+			// Metabase optional clause markers
+			i++
+		case c == '"' || c == '`' || c == '[':
+			end := skipIdentifier(query, i, mysql)
+			tokens = append(tokens, sqlToken{kind: sqlQuoted, text: unquoteIdentifier(query[i : end+1])})
+			i = end
+		case c == '\'':
+			i = skipString(query, i, mysql)
+			tokens = append(tokens, sqlToken{kind: sqlString})
+		case (c == 'e' || c == 'E') && !mysql && strings.HasPrefix(query[i+1:], "'"):
+			i = skipString(query, i+1, true)
+			tokens = append(tokens, sqlToken{kind: sqlString})
+		case c == '$' && !mysql && dollarQuotePattern.MatchString(query[i:]):
+			tag := dollarQuotePattern.FindString(query[i:])
+			i = skipUntil(query, i+len(tag), tag) - 1
+			tokens = append(tokens, sqlToken{kind: sqlString})
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: strings.ToLower(query[start:i])})
+			i--
+		default:
+			tokens = append(tokens, sqlToken{kind: sqlPunct, text: string(c)})
+		}
+	}
+	return tokens
+}
+
+// skipIdentifier returns the index of the character closing the quoted
+// identifier opening at i
+func skipIdentifier(query string, i int, mysql bool) int {
+	if query[i] == '[' {
+		if end := strings.IndexByte(query[i:], ']'); end >= 0 {
+			return i + end
+		}
+		return len(query) - 1
+	}
+	if mysql && query[i] == '"' {
+		// Without ANSI_QUOTES MySQL reads double quotes as a string
+		return skipString(query, i, true)
+	}
+	return skipQuoted(query, i, query[i])
+}
+
+// skipString returns the index of the quote closing the string literal
+// opening at i, honouring backslash escapes when backslashes is set
+func skipString(query string, i int, backslashes bool) int {
+	quote := query[i]
+	for i++; i < len(query); i++ {
+		switch {
+		case backslashes && query[i] == '\\':
+			i++
+		case query[i] != quote:
+		case i+1 < len(query) && query[i+1] == quote:
+			i++
+		default:
+			return i
+		}
+	}
+	return len(query) - 1
+}
+
+// unquoteIdentifier strips the quotes from a quoted identifier
+func unquoteIdentifier(quoted string) string {
+	if len(quoted) < 2 {
+		return ""
+	}
+	quote := quoted[:1]
+	inner := quoted[1 : len(quoted)-1]
+	if quote == "[" {
+		return inner
+	}
+	return strings.ReplaceAll(inner, quote+quote, quote)
+}
+
+// isWordByte reports whether c can be part of a keyword, bare identifier or number
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// sqlWriteKeywords lists the keywords that write data, or lock rows, from
+// within a statement starting with SELECT or WITH: data-modifying CTEs and
+// statements following a CTE list, SELECT ... INTO and SELECT ... FOR UPDATE
+var sqlWriteKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true, "into": true,
+}
+
+// sqlWriteKeyword returns the first keyword in tokens that writes data, or ""
+// when there is none. Words followed by a parenthesis are function calls and
+// do not count.
+func sqlWriteKeyword(tokens []sqlToken) string {
+	for i, t := range tokens {
+		if t.kind != sqlWord || !sqlWriteKeywords[t.text] {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].is("(") {
+			continue
+		}
+		// Qualified names such as t.set are columns
+		if i > 0 && tokens[i-1].is(".") {
+			continue
+		}
+		return t.text
+	}
+	return ""
+}
+
+// sqlTableRef is a table, or table function, a query reads from, given by
+// the parts of its possibly schema-qualified name
+type sqlTableRef struct {
+	parts    []string
+	function bool
+}
+
+// name returns the lowercased, dot-joined name of the table
+func (t sqlTableRef) name() string {
+	return strings.ToLower(strings.Join(t.parts, "."))
+}
+
+// sqlClauseEnds lists the keywords ending a FROM list
+var sqlClauseEnds = map[string]bool{
+	"where": true, "group": true, "having": true, "order": true, "limit": true,
+	"offset": true, "union": true, "intersect": true, "except": true, "minus": true,
+	"window": true, "qualify": true, "fetch": true, "for": true, "returning": true,
+	"set": true, "select": true, "values": true, "connect": true, "start": true,
+	"pivot": true, "unpivot": true,
+}
+
+// sqlFrame describes the text inside a pair of parentheses: a query (or the
+// query itself, or a parenthesized join) in which FROM and JOIN name tables,
+// or an expression such as function arguments, in which they do not
+type sqlFrame struct {
+	query    bool
+	fromList bool
+}
+
+// scanTableRefs returns every table named in a FROM list (including each item
+// of comma joins and parenthesized joins), a JOIN, or after UPDATE, INTO,
+// TABLE and USING, at any subquery depth
+func scanTableRefs(tokens []sqlToken) []sqlTableRef {
+	var refs []sqlTableRef
+	frames := []sqlFrame{{query: true}}
+	expect := false
+	previous := func(i int, words ...string) bool {
+		if i < 1 {
+			return false
+		}
+		for _, word := range words {
+			if tokens[i-1].is(word) {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		frame := &frames[len(frames)-1]
+		switch {
+		case t.is("("):
+			next := sqlToken{}
+			if i+1 < len(tokens) {
+				next = tokens[i+1]
+			}
+			subquery := next.is("select") || next.is("with") || next.is("values") || next.is("table")
+			// A parenthesized join keeps listing tables; a subquery starts its own query
+			frames = append(frames, sqlFrame{query: subquery || expect, fromList: expect && !subquery})
+			expect = expect && !subquery
+		case t.is(")"):
+			if len(frames) > 1 {
+				frames = frames[:len(frames)-1]
+			}
+			expect = false
+		case t.is(";"):
+			frames = []sqlFrame{{query: true}}
+			expect = false
+		case !frame.query:
+			// FROM in expressions such as EXTRACT(year FROM col) names no table
+		case t.is(","):
+			expect = frame.fromList
+		case t.is("from") && previous(i, "distinct"):
+			// IS [NOT] DISTINCT FROM compares values
+			expect = false
+		case t.is("from") || t.is("join") || t.is("apply"):
+			frame.fromList = true
+			expect = true
+		case (t.is("update") && !previous(i, "for", "key")) || t.is("into") || t.is("table"):
+			frame.fromList = false
+			expect = true
+		case t.is("using"):
+			// JOIN ... USING (columns) names columns, DELETE ... USING names tables
+			if i+1 < len(tokens) && !tokens[i+1].is("(") {
+				frame.fromList = true
+				expect = true
+			}
+		case expect && (t.is("lateral") || t.is("only")):
+		case t.kind == sqlWord && sqlClauseEnds[t.text]:
+			frame.fromList = false
+			expect = false
+		case expect && t.identifier():
+			ref := sqlTableRef{parts: []string{t.text}}
+			for i+2 < len(tokens) && tokens[i+1].is(".") && tokens[i+2].identifier() {
+				ref.parts = append(ref.parts, tokens[i+2].text)
+				i += 2
+			}
+			ref.function = i+1 < len(tokens) && tokens[i+1].is("(")
+			refs = append(refs, ref)
+			expect = false
+		default:
+			expect = false
+		}
+	}
+	return refs
+}
+
+// scanCTENames returns the lowercased names of the common table expressions
+// a query defines
+func scanCTENames(tokens []sqlToken) map[string]bool {
+	ctes := make(map[string]bool)
+	for i := 1; i+1 < len(tokens); i++ {
+		if !tokens[i].identifier() || !(tokens[i-1].is("with") || tokens[i-1].is("recursive") || tokens[i-1].is(",")) {
+			continue
+		}
+		j := i + 1
+		if tokens[j].is("(") {
+			// Column list
+			for j < len(tokens) && !tokens[j].is(")") {
+				j++
+			}
+			j++
+		}
+		if j >= len(tokens) || !tokens[j].is("as") {
+			continue
+		}
+		for j++; j < len(tokens) && (tokens[j].is("not") || tokens[j].is("materialized")); j++ {
+		}
+		if j < len(tokens) && tokens[j].is("(") {
+			ctes[strings.ToLower(tokens[i].text)] = true
+		}
+	}
+	return ctes
+}
+
+// queryTableRefs returns the tables a query reads from. The query is scanned
+// under both the standard and the MySQL lexical rules, so text hidden from one
+// of them as a comment or string is still seen.
+func queryTableRefs(query string) []sqlTableRef {
+	seen := make(map[string]bool)
+	var refs []sqlTableRef
+	for _, mysql := range []bool{false, true} {
+		for _, ref := range scanTableRefs(tokenizeSQL(query, mysql)) {
+			key := ref.name()
+			if ref.function {
+				key += "()"
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Handling of queries holding several statements
+const (
+	multiStatementReject = "reject"
+	multiStatementSplit  = "split"
+)
+
+// dollarQuotePattern matches the opening tag of a PostgreSQL dollar-quoted string
+var dollarQuotePattern = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// splitStatements splits a query at the semicolons ending its statements.
+// Semicolons in string literals, quoted identifiers, comments and
+// dollar-quoted bodies are kept. Statements holding only whitespace and
+// comments are dropped, so a trailing semicolon does not count as another
+// statement.
+func splitStatements(query string) []string {
+	var statements []string
+	start, blank := 0, true
+	flush := func(end int) {
+		if !blank {
+			statements = append(statements, strings.TrimSpace(query[start:end]))
+		}
+		start, blank = end+1, true
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ';':
+			flush(i)
+			continue
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			i = skipUntil(query, i+2, "\n") - 1
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = skipUntil(query, i+2, "*/") - 1
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(query, i, c)
+		case c == '$':
+			if tag := dollarQuotePattern.FindString(query[i:]); tag != "" {
+				i = skipUntil(query, i+len(tag), tag) - 1
+			}
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			blank = false
+		}
+	}
+	flush(len(query))
+	return statements
+}
+
+// skipUntil returns the index just past the first end found from i, or the
+// end of the query
+func skipUntil(query string, i int, end string) int {
+	if n := strings.Index(query[i:], end); n >= 0 {
+		return i + n + len(end)
+	}
+	return len(query)
+}
+
+// skipQuoted returns the index of the quote closing the quoted text opening
+// at i. A doubled quote stands for the quote itself.
+func skipQuoted(query string, i int, quote byte) int {
+	for i++; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(query) - 1
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}},
+		{"trailing semicolon", "SELECT 1;\n", []string{"SELECT 1"}},
+		{"two statements", "SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"string literal", "SELECT ';' AS s; SELECT 'it''s;'", []string{"SELECT ';' AS s", "SELECT 'it''s;'"}},
+		{"quoted identifiers", "SELECT \"a;b\", `c;d` FROM t", []string{"SELECT \"a;b\", `c;d` FROM t"}},
+		{"line comment", "SELECT 1 -- first; second\n; SELECT 2", []string{"SELECT 1 -- first; second", "SELECT 2"}},
+		{"block comment", "SELECT /* ; */ 1", []string{"SELECT /* ; */ 1"}},
+		{"comment-only statement", "SELECT 1; -- done;\n", []string{"SELECT 1"}},
+		{"dollar quoting", "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql; SELECT f()", []string{"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql", "SELECT f()"}},
+		{"empty", " ; ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.query); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiStatementPolicy(t *testing.T) {
+	arguments := map[string]interface{}{
+		"query":      "SELECT id, name FROM customers WHERE id = {{id}}; SELECT id, name FROM orders",
+		"parameters": map[string]interface{}{"id": 7},
+	}
+
+	r, client, fake := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} { return datasetResponse(1) })
+	rejected := callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, arguments)
+	if !rejected.IsError || !strings.Contains(resultText(rejected), "the query holds 2 statements") {
+		t.Errorf("rejected query = %s, want an error", resultText(rejected))
+	}
+	if sent := fake.sent("POST"); len(sent) != 0 {
+		t.Errorf("rejected query sent %d queries", len(sent))
+	}
+
+	// Split statements run in turn, each with its own parameters
+	r.config.MultiStatement = multiStatementSplit
+	result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, arguments))
+	if result["succeeded"] != 2.0 {
+		t.Errorf("split query = %v, want both statements run", result)
+	}
+	var sent []string
+	for _, request := range fake.sent("POST") {
+		if request.Path == "/api/dataset" {
+			parameters, _ := request.Body["parameters"].([]interface{})
+			sent = append(sent, fmt.Sprintf("%s with %d parameters", sentSQL(request), len(parameters)))
+		}
+	}
+	want := []string{
+		"SELECT id, name FROM customers WHERE id = {{id}} with 1 parameters",
+		"SELECT id, name FROM orders with 0 parameters",
+	}
+	if strings.Join(sent, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionStats aggregates the query activity of one client session
+type SessionStats struct {
+	Session           string         `json:"session,omitempty"`
+	StartedAt         time.Time      `json:"started_at"`
+	Queries           int            `json:"queries"`
+	FailedQueries     int            `json:"failed_queries"`
+	CachedQueries     int            `json:"cached_queries"`
+	WarehouseTimeMS   int            `json:"warehouse_time_ms"`
+	RowsReturned      int            `json:"rows_returned"`
+	PoliciesTriggered map[string]int `json:"policies_triggered"`
+}
+
+// CacheHitRate returns the share of queries answered from the Metabase cache
+func (s SessionStats) CacheHitRate() float64 {
+	if s.Queries == 0 {
+		return 0
+	}
+	return float64(s.CachedQueries) / float64(s.Queries)
+}
+
+// sessionStatsStore keeps execution statistics per client session
+type sessionStatsStore struct {
+	mu       sync.Mutex
+	sessions map[string]*SessionStats
+}
+
+// newSessionStatsStore creates an empty statistics store
+func newSessionStatsStore() *sessionStatsStore {
+	return &sessionStatsStore{sessions: make(map[string]*SessionStats)}
+}
+
+// session returns the statistics of the calling session, creating them on first use.
+// The caller must hold s.mu.
+func (s *sessionStatsStore) session(ctx context.Context) *SessionStats {
+	id := sessionID(ctx)
+	stats, ok := s.sessions[id]
+	if !ok {
+		stats = &SessionStats{Session: id, StartedAt: time.Now().UTC(), PoliciesTriggered: make(map[string]int)}
+		s.sessions[id] = stats
+	}
+	return stats
+}
+
+// recordQuery adds an executed query to the calling session's statistics
+func (s *sessionStatsStore) recordQuery(ctx context.Context, response MetabaseResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.session(ctx)
+	stats.Queries++
+	if response.Status == "failed" {
+		stats.FailedQueries++
+	}
+	if response.Cached {
+		stats.CachedQueries++
+	}
+	stats.WarehouseTimeMS += response.RunningTime
+	stats.RowsReturned += response.RowCount
+}
+
+// recordPolicy counts a guardrail or access policy that acted on a call
+func (s *sessionStatsStore) recordPolicy(ctx context.Context, policy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session(ctx).PoliciesTriggered[policy]++
+}
+
+// clear forgets the statistics of a session that has ended
+func (s *sessionStatsStore) clear(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, session)
+}
+
+// get returns a copy of the calling session's statistics
+func (s *sessionStatsStore) get(ctx context.Context) SessionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyStats(*s.session(ctx))
+}
+
+// all returns a copy of the statistics of every active session, oldest first
+func (s *sessionStatsStore) all() []SessionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make([]SessionStats, 0, len(s.sessions))
+	for _, stats := range s.sessions {
+		all = append(all, copyStats(*stats))
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].StartedAt.Before(all[j].StartedAt) })
+	return all
+}
+
+// copyStats copies stats so they can be read without holding the store lock
+func copyStats(stats SessionStats) SessionStats {
+	policies := make(map[string]int, len(stats.PoliciesTriggered))
+	for policy, count := range stats.PoliciesTriggered {
+		policies[policy] = count
+	}
+	stats.PoliciesTriggered = policies
+	return stats
+}
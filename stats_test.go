@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionStats(t *testing.T) {
+	stats := newSessionStatsStore()
+	first, second := sessionContext("first"), sessionContext("second")
+
+	stats.recordQuery(first, MetabaseResponse{Status: "completed", RowCount: 10, RunningTime: 40, Cached: true})
+	stats.recordQuery(first, MetabaseResponse{Status: "failed", RunningTime: 5})
+	stats.recordPolicy(first, "read_only")
+	stats.recordPolicy(first, "read_only")
+	stats.recordQuery(second, MetabaseResponse{Status: "completed", RowCount: 3, RunningTime: 7})
+
+	got := stats.get(first)
+	if got.Queries != 2 || got.FailedQueries != 1 || got.CachedQueries != 1 || got.RowsReturned != 10 || got.WarehouseTimeMS != 45 {
+		t.Errorf("first session = %+v", got)
+	}
+	if got.CacheHitRate() != 0.5 || got.PoliciesTriggered["read_only"] != 2 {
+		t.Errorf("cache hit rate = %v, policies = %v", got.CacheHitRate(), got.PoliciesTriggered)
+	}
+
+	// Returned statistics are copies
+	got.PoliciesTriggered["read_only"] = 0
+	if stats.get(first).PoliciesTriggered["read_only"] != 2 {
+		t.Errorf("changing a copy changed the store")
+	}
+
+	if all := stats.all(); len(all) != 2 || all[0].StartedAt.After(all[1].StartedAt) {
+		t.Errorf("all sessions = %+v, want both, oldest first", all)
+	}
+	stats.clear("first")
+	if all := stats.all(); len(all) != 1 || all[0].Session != "second" {
+		t.Errorf("sessions after clear = %+v", all)
+	}
+}
+
+func TestSessionStatsTool(t *testing.T) {
+	r := &toolRegistry{stats: newSessionStatsStore()}
+	stats := r.stats
+	stats.recordQuery(sessionContext("first"), MetabaseResponse{Status: "completed", RowCount: 10, Cached: true})
+	stats.recordQuery(sessionContext("second"), MetabaseResponse{Status: "completed", RowCount: 3})
+
+	own := decodeResult(t, callTool(t, sessionContext("first"), r.handleSessionStats, nil, nil))
+	if own["session"] != "first" || own["queries"] != 1.0 || own["cache_hit_rate"] != 1.0 {
+		t.Errorf("session stats = %v", own)
+	}
+
+	all := decodeResult(t, callTool(t, context.Background(), r.handleSessionStats, nil, map[string]interface{}{"scope": "all"}))
+	total := all["total"].(map[string]interface{})
+	if total["queries"] != 2.0 || total["rows_returned"] != 13.0 || total["cache_hit_rate"] != 0.5 || total["started_at"] != nil {
+		t.Errorf("total = %v", total)
+	}
+
+	ctx := withClientAccess(sessionContext("first"), &ClientAccess{Name: "analyst"})
+	if result := callTool(t, ctx, r.handleSessionStats, nil, map[string]interface{}{"scope": "all"}); !result.IsError {
+		t.Errorf("a non-admin client viewed every session")
+	}
+	if got := stats.get(sessionContext("first")).PoliciesTriggered["access_denied"]; got != 1 {
+		t.Errorf("access_denied recorded %d times", got)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// version is the server version, overridable at build time with
+// -ldflags "-X main.version=..."
+var version = "1.0.0"
+
+// buildInfo describes the binary for bug reports
+func buildInfo() map[string]interface{} {
+	info := map[string]interface{}{
+		"version":    version,
+		"go_version": runtime.Version(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				info[setting.Key] = setting.Value
+			}
+		}
+		deps := make(map[string]string, len(build.Deps))
+		for _, dep := range build.Deps {
+			deps[dep.Path] = dep.Version
+		}
+		info["dependencies"] = deps
+	}
+	return info
+}
+
+// sanitizedConfig returns the configuration with credentials masked
+func sanitizedConfig(cfg Config) map[string]interface{} {
+	mask := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return "[redacted]"
+	}
+
+	profiles := make(map[string]interface{}, len(cfg.Profiles))
+	for name, profile := range cfg.Profiles {
+		profiles[name] = map[string]interface{}{
+			"host":              profile.Host,
+			"failover_host":     profile.FailoverHost,
+			"auth":              profile.Auth,
+			"cookies":           mask(profile.Cookies),
+			"username":          profile.Username,
+			"password":          mask(profile.Password),
+			"api_key":           mask(profile.APIKey),
+			"bearer_token":      mask(profile.BearerToken),
+			"cookies_file":      profile.CookiesFile,
+			"api_key_file":      profile.APIKeyFile,
+			"bearer_token_file": profile.BearerTokenFile,
+			"database_id":       profile.DatabaseID,
+			"databases":         profile.Databases,
+			"guardrail_level":   profile.GuardrailLevel,
+			"guardrails":        profile.Guardrails,
+		}
+	}
+
+	sanitized := cfg
+	sanitized.Cookies = mask(cfg.Cookies)
+	sanitized.Password = mask(cfg.Password)
+	sanitized.APIKey = mask(cfg.APIKey)
+	sanitized.BearerToken = mask(cfg.BearerToken)
+	sanitized.ProxyPassword = mask(cfg.ProxyPassword)
+	if proxyURL, err := url.Parse(cfg.Proxy); err == nil {
+		sanitized.Proxy = proxyURL.Redacted()
+	}
+	sanitized.AuditOpenSearchPassword = mask(cfg.AuditOpenSearchPassword)
+	sanitized.AuditOpenSearchAPIKey = mask(cfg.AuditOpenSearchAPIKey)
+	sanitized.Profiles = nil
+
+	var fields map[string]interface{}
+	encoded, _ := json.Marshal(sanitized)
+	json.Unmarshal(encoded, &fields)
+	fields["Profiles"] = profiles
+	return fields
+}
+
+// logFiles returns the file paths among a comma-separated list of log destinations
+func logFiles(specs string) []string {
+	var files []string
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		scheme, target, _ := strings.Cut(spec, ":")
+		switch scheme {
+		case "", "stderr", "syslog", "journald":
+			continue
+		case "file":
+			spec = target
+		}
+		path, _, _ := strings.Cut(spec, "?")
+		files = append(files, path)
+	}
+	return files
+}
+
+// tailFile returns the last n lines of a file
+func tailFile(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make([]string, 0, n)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// healthReport checks every profile's hosts and reports the client state
+func healthReport(ctx context.Context, cfg Config) []map[string]interface{} {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		client := cfg.Profiles[name].client
+		status := map[string]interface{}{
+			"name":           name,
+			"host":           client.host,
+			"primary_health": hostHealth(ctx, client, client.host),
+			"circuit":        client.breaker.status(),
+		}
+		if client.failoverHost != "" {
+			status["failover_health"] = hostHealth(ctx, client, client.failoverHost)
+		}
+		var props SessionProperties
+		if body, err := client.sendTo(ctx, client.host, http.MethodGet, "/api/session/properties", "", nil); err == nil && json.Unmarshal(body, &props) == nil {
+			status["metabase_version"] = props.Version
+		}
+		report = append(report, status)
+	}
+	return report
+}
+
+// cacheReport describes the local metadata caches and schema snapshots
+func (r *toolRegistry) cacheReport() map[string]interface{} {
+	profiles := make(map[string]interface{}, len(r.config.Profiles))
+	for name, profile := range r.config.Profiles {
+		entry := map[string]interface{}{}
+		if profile.client.metadata != nil {
+			entry["metadata_cache"] = profile.client.metadata.stats()
+		}
+		entry["schema_snapshots"] = len(r.snapshots.list(name, profile.DatabaseID))
+		profiles[name] = entry
+	}
+	return map[string]interface{}{
+		"metadata_cache_dir": r.config.MetadataCacheDir,
+		"profiles":           profiles,
+	}
+}
+
+// runSupportBundleCommand implements the support-bundle subcommand, writing a
+// zip archive with sanitized configuration, build information, recent logs,
+// health checks and cache statistics
+func runSupportBundleCommand(r *toolRegistry, args []string) int {
+	flags := flag.NewFlagSet("support-bundle", flag.ContinueOnError)
+	output := flags.String("o", fmt.Sprintf("metabase-mcp-support-%s.zip", time.Now().UTC().Format("20060102-150405")), "archive to write")
+	logLines := flags.Int("log-lines", 1000, "number of recent lines to include from each log file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	files := map[string]interface{}{
+		"config.json": sanitizedConfig(r.config),
+		"build.json":  buildInfo(),
+		"health.json": healthReport(ctx, r.config),
+		"caches.json": r.cacheReport(),
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create support bundle: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	archive := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", name, err)
+			return 1
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(content); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", name, err)
+			return 1
+		}
+	}
+
+	// Application logs only; audit records stay with the audit destinations
+	for _, path := range logFiles(r.config.LogDestinations) {
+		lines, err := tailFile(path, *logLines)
+		if err != nil {
+			lines = []string{fmt.Sprintf("failed to read %s: %v", path, err)}
+		}
+		w, err := archive.Create("logs/" + filepath.Base(path))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write logs: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(w, strings.Join(lines, "\n"))
+	}
+
+	if err := archive.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write support bundle: %v\n", err)
+		return 1
+	}
+	fmt.Println(*output)
+	return 0
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// templateTagPattern matches {{name}} variables in a native query
+var templateTagPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_]\w*)\s*\}\}`)
+
+// isoDatePattern matches values that look like ISO dates or timestamps
+var isoDatePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2})?.*)?$`)
+
+// TemplateParameter is a value supplied for a {{name}} variable, optionally
+// with an explicit type and, for field filters, the target column
+type TemplateParameter struct {
+	Value interface{}
+	Type  string
+	Field string
+}
+
+// TemplateTagInfo reports how the type of a template tag was chosen
+type TemplateTagInfo struct {
+	Type       string `json:"type"`
+	WidgetType string `json:"widget_type,omitempty"`
+	Column     string `json:"column,omitempty"`
+	Source     string `json:"source"`
+}
+
+// parseTemplateParameters reads the parameters argument, accepting either
+// plain values or objects with value, type and field keys
+func parseTemplateParameters(args map[string]interface{}) map[string]TemplateParameter {
+	params := make(map[string]TemplateParameter, len(args))
+	for name, raw := range args {
+		spec, ok := raw.(map[string]interface{})
+		if !ok {
+			params[name] = TemplateParameter{Value: raw}
+			continue
+		}
+		param := TemplateParameter{Value: spec["value"]}
+		param.Type, _ = spec["type"].(string)
+		param.Field, _ = spec["field"].(string)
+		params[name] = param
+	}
+	return params
+}
+
+// columnComparisonPattern returns a pattern matching a column compared to the
+// {{name}} variable, e.g. created_at >= {{start}}
+func columnComparisonPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)([a-zA-Z_][\w."]*)\s*(?:=|<>|!=|<=|>=|<|>|\blike|\bin\s*\(?)\s*\{\{\s*` + regexp.QuoteMeta(name) + `\s*\}\}`)
+}
+
+// fieldFilterPattern returns a pattern matching {{name}} used as a whole
+// condition, which Metabase only accepts for field filters
+func fieldFilterPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b(?:where|and|or)\s+\{\{\s*` + regexp.QuoteMeta(name) + `\s*\}\}`)
+}
+
+// templateTypeForBaseType maps a Metabase base type to a template tag type
+func templateTypeForBaseType(baseType string) string {
+	switch {
+	case strings.HasPrefix(baseType, "type/Date"), strings.HasPrefix(baseType, "type/Time"):
+		return "date"
+	case strings.HasPrefix(baseType, "type/Integer"), strings.HasPrefix(baseType, "type/BigInteger"),
+		strings.HasPrefix(baseType, "type/Float"), strings.HasPrefix(baseType, "type/Decimal"),
+		strings.HasPrefix(baseType, "type/Number"):
+		return "number"
+	default:
+		return "text"
+	}
+}
+
+// templateTypeForValue guesses a template tag type from the supplied value
+func templateTypeForValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64, int:
+		return "number"
+	case string:
+		if isoDatePattern.MatchString(v) {
+			return "date"
+		}
+	}
+	return "text"
+}
+
+// widgetTypeFor returns the field filter widget matching a template tag type
+func widgetTypeFor(tagType string) string {
+	switch tagType {
+	case "date":
+		return "date/all-options"
+	case "number":
+		return "number/="
+	default:
+		return "string/="
+	}
+}
+
+// findColumn looks up a possibly qualified column among the tables a query
+// reads, or among all tables when none of them are known
+func findColumn(metadata DatabaseMetadata, query, column string) (TableMetadata, Field, bool) {
+	column = strings.ToLower(strings.ReplaceAll(column, `"`, ""))
+	qualifier := ""
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		qualifier, column = column[:i], column[i+1:]
+	}
+
+	referenced := make(map[string]bool)
+	for _, table := range referencedTables(query) {
+		referenced[table] = true
+	}
+	candidates := make([]TableMetadata, 0, len(metadata.Tables))
+	for _, table := range metadata.Tables {
+		if referenced[strings.ToLower(table.Name)] || referenced[table.qualifiedName()] {
+			candidates = append(candidates, table)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = metadata.Tables
+	}
+
+	// A qualifier that names no table is taken to be an alias and ignored
+	for _, qualified := range []bool{true, false} {
+		for _, table := range candidates {
+			if qualified && qualifier != strings.ToLower(table.Name) && qualifier != table.qualifiedName() {
+				continue
+			}
+			for _, field := range table.Fields {
+				if strings.ToLower(field.Name) == column {
+					return table, field, true
+				}
+			}
+		}
+	}
+	return TableMetadata{}, Field{}, false
+}
+
+// buildTemplateTags turns the supplied parameters into template tags and
+// query parameters. Types not given explicitly are inferred from the metadata
+// of the column each variable is compared to, then from the value itself.
+// Variables used as a whole condition become field filters on that column.
+func buildTemplateTags(ctx context.Context, client *MetabaseClient, databaseID int, query string, params map[string]TemplateParameter) (map[string]interface{}, []interface{}, map[string]TemplateTagInfo, error) {
+	tags := make(map[string]interface{})
+	values := make([]interface{}, 0, len(params))
+	infos := make(map[string]TemplateTagInfo, len(params))
+
+	used := make(map[string]bool)
+	for _, match := range templateTagPattern.FindAllStringSubmatch(query, -1) {
+		used[match[1]] = true
+	}
+	for name := range params {
+		if !used[name] {
+			return nil, nil, nil, fmt.Errorf("parameter %q is not used as {{%s}} in the query", name, name)
+		}
+	}
+
+	var metadata *DatabaseMetadata
+	lookup := func(column string) (TableMetadata, Field, bool) {
+		if metadata == nil {
+			metadata = &DatabaseMetadata{}
+			if _, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), metadata); err != nil {
+				return TableMetadata{}, Field{}, false
+			}
+		}
+		return findColumn(*metadata, query, column)
+	}
+
+	for name, param := range params {
+		info := TemplateTagInfo{Type: param.Type, Source: "explicit"}
+		column := param.Field
+		if column == "" {
+			if match := columnComparisonPattern(name).FindStringSubmatch(query); match != nil {
+				column = match[1]
+			}
+		}
+		fieldFilter := param.Type == "field" || param.Type == "dimension" || fieldFilterPattern(name).MatchString(query)
+
+		var table TableMetadata
+		var field Field
+		var found bool
+		if column != "" {
+			table, field, found = lookup(column)
+		}
+		if found {
+			info.Column = table.qualifiedName() + "." + strings.ToLower(field.Name)
+		}
+
+		if fieldFilter {
+			if !found {
+				return nil, nil, nil, fmt.Errorf("parameter %q is a field filter: give its column as {\"field\": \"table.column\"}", name)
+			}
+			if param.Type == "" {
+				info.Source = "column"
+			}
+			info.Type = "dimension"
+			info.WidgetType = widgetTypeFor(templateTypeForBaseType(field.BaseType))
+			tags[name] = map[string]interface{}{
+				"id":           name,
+				"name":         name,
+				"display-name": name,
+				"type":         "dimension",
+				"dimension":    []interface{}{"field", field.ID, nil},
+				"widget-type":  info.WidgetType,
+			}
+			value := param.Value
+			if _, ok := value.([]interface{}); !ok && info.WidgetType != "date/all-options" {
+				value = []interface{}{value}
+			}
+			values = append(values, map[string]interface{}{
+				"type":   info.WidgetType,
+				"target": []interface{}{"dimension", []interface{}{"template-tag", name}},
+				"value":  value,
+			})
+			infos[name] = info
+			continue
+		}
+
+		switch {
+		case info.Type != "":
+		case found:
+			info.Type, info.Source = templateTypeForBaseType(field.BaseType), "column"
+		default:
+			info.Type, info.Source = templateTypeForValue(param.Value), "value"
+		}
+
+		tags[name] = map[string]interface{}{
+			"id":           name,
+			"name":         name,
+			"display-name": name,
+			"type":         info.Type,
+		}
+		parameterType := map[string]string{"text": "category", "number": "number/=", "date": "date/single"}[info.Type]
+		if parameterType == "" {
+			return nil, nil, nil, fmt.Errorf("parameter %q has unsupported type %q (use text, number, date or field)", name, info.Type)
+		}
+		values = append(values, map[string]interface{}{
+			"type":   parameterType,
+			"target": []interface{}{"variable", []interface{}{"template-tag", name}},
+			"value":  param.Value,
+		})
+		infos[name] = info
+	}
+
+	// Variables without a value still need a tag; optional [[...]] clauses
+	// referencing them are then left out
+	for name := range used {
+		if _, ok := tags[name]; !ok {
+			tags[name] = map[string]interface{}{"id": name, "name": name, "display-name": name, "type": "text"}
+		}
+	}
+
+	return tags, values, infos, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ordersMetadata is the metadata of a database holding public.orders
+func ordersMetadata() map[string]interface{} {
+	return map[string]interface{}{
+		"id": 1,
+		"tables": []interface{}{
+			map[string]interface{}{
+				"id": 3, "name": "orders", "schema": "public",
+				"fields": []interface{}{
+					map[string]interface{}{"id": 10, "name": "id", "base_type": "type/Integer"},
+					map[string]interface{}{"id": 11, "name": "created_at", "base_type": "type/DateTime"},
+					map[string]interface{}{"id": 12, "name": "status", "base_type": "type/Text"},
+				},
+			},
+		},
+	}
+}
+
+func TestBuildTemplateTags(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": ordersMetadata()})
+
+	tests := []struct {
+		name      string
+		query     string
+		params    map[string]interface{}
+		info      TemplateTagInfo
+		parameter map[string]interface{}
+	}{
+		{
+			"date from the compared column",
+			"SELECT * FROM orders WHERE created_at >= {{start}}",
+			map[string]interface{}{"start": "2024-01-01"},
+			TemplateTagInfo{Type: "date", Column: "public.orders.created_at", Source: "column"},
+			map[string]interface{}{"type": "date/single", "value": "2024-01-01"},
+		},
+		{
+			"number through an alias",
+			"SELECT * FROM orders o WHERE o.id = {{start}}",
+			map[string]interface{}{"start": "42"},
+			TemplateTagInfo{Type: "number", Column: "public.orders.id", Source: "column"},
+			map[string]interface{}{"type": "number/=", "value": "42"},
+		},
+		{
+			"type from the value",
+			"SELECT {{start}} AS n",
+			map[string]interface{}{"start": 3.0},
+			TemplateTagInfo{Type: "number", Source: "value"},
+			map[string]interface{}{"type": "number/=", "value": 3.0},
+		},
+		{
+			"explicit type",
+			"SELECT * FROM orders WHERE id = {{start}}",
+			map[string]interface{}{"start": map[string]interface{}{"value": "42", "type": "text"}},
+			TemplateTagInfo{Type: "text", Column: "public.orders.id", Source: "explicit"},
+			map[string]interface{}{"type": "category", "value": "42"},
+		},
+		{
+			"field filter",
+			"SELECT * FROM orders WHERE {{start}}",
+			map[string]interface{}{"start": map[string]interface{}{"value": "paid", "field": "orders.status"}},
+			TemplateTagInfo{Type: "dimension", WidgetType: "string/=", Column: "public.orders.status", Source: "column"},
+			map[string]interface{}{"type": "string/=", "value": []interface{}{"paid"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, values, infos, err := buildTemplateTags(context.Background(), client, 1, tt.query, parseTemplateParameters(tt.params))
+			if err != nil {
+				t.Fatalf("buildTemplateTags: %v", err)
+			}
+			if infos["start"] != tt.info {
+				t.Errorf("info = %+v, want %+v", infos["start"], tt.info)
+			}
+			if len(values) != 1 {
+				t.Fatalf("values = %v", values)
+			}
+			value := values[0].(map[string]interface{})
+			for key, want := range tt.parameter {
+				if !reflect.DeepEqual(value[key], want) {
+					t.Errorf("parameter %s = %v, want %v", key, value[key], want)
+				}
+			}
+			tag := tags["start"].(map[string]interface{})
+			if tt.info.Type == "dimension" && !reflect.DeepEqual(tag["dimension"], []interface{}{"field", 12, nil}) {
+				t.Errorf("field filter tag = %v", tag)
+			}
+		})
+	}
+}
+
+func TestBuildTemplateTagsErrors(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": ordersMetadata()})
+
+	tests := []struct {
+		name   string
+		query  string
+		params map[string]interface{}
+		want   string
+	}{
+		{"unused parameter", "SELECT 1", map[string]interface{}{"start": 1.0}, "is not used as {{start}}"},
+		{"field filter without a column", "SELECT * FROM orders WHERE {{start}}", map[string]interface{}{"start": "paid"}, "is a field filter"},
+		{"unsupported type", "SELECT {{start}}", map[string]interface{}{"start": map[string]interface{}{"value": 1.0, "type": "boolean"}}, "unsupported type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := buildTemplateTags(context.Background(), client, 1, tt.query, parseTemplateParameters(tt.params))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// Variables without a value still get a text tag
+	tags, values, _, err := buildTemplateTags(context.Background(), client, 1, "SELECT * FROM orders [[WHERE status = {{status}}]]", nil)
+	if err != nil || len(values) != 0 || tags["status"].(map[string]interface{})["type"] != "text" {
+		t.Errorf("optional variable: tags = %v, values = %v, err = %v", tags, values, err)
+	}
+}
+
+func TestNativeQueryParameters(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} { return datasetResponse(1) })
+	fake.responses["/api/database/1/metadata"] = ordersMetadata()
+
+	result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, map[string]interface{}{
+		"query":      "SELECT * FROM orders WHERE status = {{status}} AND created_at >= {{start}}",
+		"parameters": map[string]interface{}{"status": "paid", "start": "2024-01-01"},
+	}))
+
+	var dataset fakeRequest
+	for _, request := range fake.sent("POST") {
+		if request.Path == "/api/dataset" {
+			dataset = request
+		}
+	}
+	native, _ := dataset.Body["native"].(map[string]interface{})
+	tags, _ := native["template-tags"].(map[string]interface{})
+	for name, want := range map[string]string{"status": "text", "start": "date"} {
+		tag, _ := tags[name].(map[string]interface{})
+		if tag["type"] != want {
+			t.Errorf("template tag %s = %v, want type %s", name, tag, want)
+		}
+	}
+	if parameters, _ := dataset.Body["parameters"].([]interface{}); len(parameters) != 2 {
+		t.Errorf("sent parameters = %v, want both values", dataset.Body["parameters"])
+	}
+
+	types, _ := result["parameter_types"].(map[string]interface{})
+	if status, _ := types["status"].(map[string]interface{}); status["column"] != "public.orders.status" {
+		t.Errorf("parameter_types = %v, want status inferred from public.orders.status", types)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// toolHandler handles a tool call using the shared Metabase client
+type toolHandler func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+
+// toolRegistry registers tools on the MCP server
+type toolRegistry struct {
+	server *server.MCPServer
+	// mu guards config, which is replaced when the configuration is reloaded
+	mu      sync.RWMutex
+	config  Config
+	history *queryHistory
+	audit   *auditLogger
+	budget  *outputBudget
+	exports *resultStore
+	views   *viewStore
+	jobs    *jobStore
+	stats   *sessionStatsStore
+
+	snapshots *snapshotStore
+	faults    *faultTransport
+}
+
+// add registers a tool that is always available
+func (r *toolRegistry) add(tool mcp.Tool, handler toolHandler) {
+	allowOverride := r.config.AllowCredentialOverride
+	if allowOverride {
+		withCredentialOverrideArguments(&tool)
+	}
+	if len(r.config.Profiles) > 1 {
+		withProfileArgument(&tool, r.profileNames())
+	}
+	withFormatArgument(&tool)
+	r.server.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if allowOverride {
+			ctx = withCredentialOverride(ctx, request)
+		}
+		profile, err := r.profile(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ctx = withProfile(ctx, profile)
+		// Handlers defaulting to the profile's database check it through requestedDatabase
+		if databaseID := request.GetInt("database_id", 0); databaseID != 0 {
+			if err := checkDatabaseAccess(ctx, databaseID); err != nil {
+				r.stats.recordPolicy(ctx, policyName(err))
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+
+		// Report rejected credentials in a structured form rather than the handler's error text
+		ctx, failures := trackAuthFailures(ctx)
+		result, err := handler(ctx, profile.client, request)
+		if authErr := failures.last(); authErr != nil && result != nil && result.IsError {
+			return authErrorResult(profile, authErr)
+		}
+		return formatResult(result, request.GetString("format", r.currentConfig().OutputFormat)), err
+	})
+}
+
+// currentConfig returns the configuration as last loaded or reloaded
+func (r *toolRegistry) currentConfig() Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// profile returns the profile selected by the call's profile argument, or the default profile
+func (r *toolRegistry) profile(request mcp.CallToolRequest) (*Profile, error) {
+	cfg := r.currentConfig()
+	name := request.GetString("profile", cfg.DefaultProfile)
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return profile, nil
+}
+
+// profileNames returns the names of the configured profiles in order
+func (r *toolRegistry) profileNames() []string {
+	profiles := r.currentConfig().Profiles
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withProfileArgument adds the argument selecting the Metabase environment a
+// call runs against
+func withProfileArgument(tool *mcp.Tool, names []string) {
+	tool.InputSchema.Properties["profile"] = map[string]interface{}{
+		"type":        "string",
+		"enum":        names,
+		"description": "Named environment profile (e.g. dev, staging, prod) to run against; defaults to the server's active profile",
+	}
+}
+
+// addAdmin registers a tool only when admin tools are enabled
+func (r *toolRegistry) addAdmin(tool mcp.Tool, handler toolHandler) {
+	if !r.config.AdminToolsEnabled {
+		return
+	}
+	r.add(tool, func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if access := clientAccessFromContext(ctx); access != nil && !access.Admin {
+			r.stats.recordPolicy(ctx, "access_denied")
+			return mcp.NewToolResultError(fmt.Sprintf("access denied: client %s may not use admin tools", access.Name)), nil
+		}
+		return handler(ctx, client, request)
+	})
+}
+
+// addAdminWrite registers an admin tool that changes Metabase state. Calls are
+// refused on read-only profiles, and every call is written to the audit log,
+// noting whether the change was only previewed.
+func (r *toolRegistry) addAdminWrite(tool mcp.Tool, handler toolHandler) {
+	r.addAdmin(tool, r.audited(tool, r.writable(handler)))
+}
+
+// addWrite registers a tool that changes Metabase state and is available
+// without admin tools. Calls are refused on read-only profiles and, like admin
+// writes, written to the audit log.
+func (r *toolRegistry) addWrite(tool mcp.Tool, handler toolHandler) {
+	r.add(tool, r.audited(tool, r.writable(handler)))
+}
+
+// audited writes every call of a tool to the audit log, noting whether the
+// change was only previewed
+func (r *toolRegistry) audited(tool mcp.Tool, handler toolHandler) toolHandler {
+	_, previews := tool.InputSchema.Properties["confirm"]
+	return func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := handler(ctx, client, request)
+
+		rec := AuditRecord{
+			Time:      time.Now().UTC(),
+			Tool:      tool.Name,
+			Arguments: redactArguments(request.GetArguments()),
+			Outcome:   "applied",
+		}
+		switch {
+		case err != nil:
+			rec.Outcome = "error"
+			rec.Message = err.Error()
+		case result != nil && result.IsError:
+			rec.Outcome = "error"
+			rec.Message = resultText(result)
+		case previews && !confirmed(request):
+			rec.Outcome = "previewed"
+		}
+		r.audit.record(rec)
+
+		return result, err
+	}
+}
+
+// writable refuses calls that would change Metabase state on a read-only profile
+func (r *toolRegistry) writable(handler toolHandler) toolHandler {
+	return func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if profile := profileFromContext(ctx); profile != nil && profile.Guardrails.ReadOnly {
+			r.stats.recordPolicy(ctx, "read_only")
+			return mcp.NewToolResultError(fmt.Sprintf("profile %s is read-only: changes to Metabase are not allowed", profile.Name)), nil
+		}
+		return handler(ctx, client, request)
+	}
+}
+
+// resultText returns the text content of a tool result
+func resultText(result *mcp.CallToolResult) string {
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
+
+// jsonResult formats v as an indented JSON tool result
+func jsonResult(v interface{}) (*mcp.CallToolResult, error) {
+	responseJSON, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to format response: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(responseJSON)), nil
+}
+
+// withConfirm adds the confirm argument used by tools that change Metabase state
+func withConfirm() mcp.ToolOption {
+	return mcp.WithBoolean(
+		"confirm",
+		mcp.Description("Set to true to apply the change. Without it the tool only previews what would change"),
+	)
+}
+
+// confirmed reports whether the caller asked to apply a change
+func confirmed(request mcp.CallToolRequest) bool {
+	return request.GetBool("confirm", false)
+}
+
+// previewResult describes a pending change that was not applied because confirm was not set
+func previewResult(action string, changes interface{}) (*mcp.CallToolResult, error) {
+	return jsonResult(map[string]interface{}{
+		"applied": false,
+		"action":  action,
+		"changes": changes,
+		"message": "Review the changes and call the tool again with confirm=true to apply them",
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// APIKey represents a Metabase API key; the full key is only returned on creation
+type APIKey struct {
+	ID          int                    `json:"id"`
+	Name        string                 `json:"name"`
+	Group       map[string]interface{} `json:"group"`
+	MaskedKey   string                 `json:"masked_key"`
+	UnmaskedKey string                 `json:"unmasked_key,omitempty"`
+	CreatedAt   string                 `json:"created_at"`
+	UpdatedAt   string                 `json:"updated_at"`
+}
+
+// registerAPIKeyTools adds the API key administration tools
+func registerAPIKeyTools(r *toolRegistry) {
+	r.addAdmin(mcp.NewTool(
+		"list-api-keys",
+		mcp.WithDescription("List the Metabase API keys with their permission group and masked key"),
+	), handleListAPIKeys)
+
+	r.addAdminWrite(mcp.NewTool(
+		"create-api-key",
+		mcp.WithDescription("Create a Metabase API key scoped to a permission group. The full key is only shown once in the response"),
+		mcp.WithString(
+			"name",
+			mcp.Required(),
+			mcp.Description("Descriptive name for the key, e.g. the integration using it"),
+		),
+		mcp.WithNumber(
+			"group_id",
+			mcp.Required(),
+			mcp.Description("Permission group the key acts as"),
+		),
+	), handleCreateAPIKey)
+
+	r.addAdminWrite(mcp.NewTool(
+		"revoke-api-key",
+		mcp.WithDescription("Permanently delete a Metabase API key"),
+		mcp.WithNumber(
+			"api_key_id",
+			mcp.Required(),
+			mcp.Description("ID of the API key to revoke"),
+		),
+	), handleRevokeAPIKey)
+}
+
+func handleListAPIKeys(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var keys []APIKey
+	if err := client.Get(ctx, "/api/api-key", &keys); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list API keys: %v", err)), nil
+	}
+	return jsonResult(keys)
+}
+
+func handleCreateAPIKey(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	groupID, err := request.RequireInt("group_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var key APIKey
+	body := map[string]interface{}{"name": name, "group_id": groupID}
+	if err := client.Post(ctx, "/api/api-key", body, &key); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to create API key: %v", err)), nil
+	}
+	return jsonResult(key)
+}
+
+func handleRevokeAPIKey(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	keyID, err := request.RequireInt("api_key_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := client.Delete(ctx, fmt.Sprintf("/api/api-key/%d", keyID)); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to revoke API key: %v", err)), nil
+	}
+	return jsonResult(map[string]interface{}{"revoked": keyID})
+}
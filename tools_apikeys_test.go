@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// newAPIKeyRegistry returns a registry serving the API key tools from a fake Metabase
+func newAPIKeyRegistry(t *testing.T, guardrails Guardrails) (*toolRegistry, *fakeMetabase, *bytes.Buffer) {
+	var audit bytes.Buffer
+	r := newTestRegistry(guardrails, &audit)
+	client, fake := newFakeMetabase(t, map[string]interface{}{
+		"GET /api/api-key":      []interface{}{map[string]interface{}{"id": 1, "name": "ci", "masked_key": "mb_AbC…"}},
+		"POST /api/api-key":     map[string]interface{}{"id": 2, "name": "etl", "masked_key": "mb_XyZ…", "unmasked_key": "mb_XyZsecret"},
+		"DELETE /api/api-key/1": map[string]interface{}{},
+	})
+	r.config.Profiles["default"].client = client
+	registerAPIKeyTools(r)
+	return r, fake, &audit
+}
+
+func TestAPIKeyTools(t *testing.T) {
+	r, fake, audit := newAPIKeyRegistry(t, Guardrails{})
+
+	if response := callServerTool(t, r, "list-api-keys", nil); !strings.Contains(response, "mb_AbC") {
+		t.Errorf("list-api-keys = %s", response)
+	}
+
+	// The full key is shown once, to the caller, and never audited
+	response := callServerTool(t, r, "create-api-key", map[string]interface{}{"name": "etl", "group_id": 3})
+	if !strings.Contains(response, "mb_XyZsecret") {
+		t.Errorf("create-api-key = %s, want the full key", response)
+	}
+	if posts := fake.sent("POST"); len(posts) != 1 || posts[0].Body["name"] != "etl" || posts[0].Body["group_id"] != float64(3) {
+		t.Errorf("created %v", posts)
+	}
+	if strings.Contains(audit.String(), "mb_XyZsecret") || !strings.Contains(audit.String(), `"tool":"create-api-key"`) {
+		t.Errorf("audit log = %q, want the creation without the key", audit.String())
+	}
+
+	if response := callServerTool(t, r, "revoke-api-key", map[string]interface{}{"api_key_id": 1}); !strings.Contains(response, `\"revoked\": 1`) {
+		t.Errorf("revoke-api-key = %s", response)
+	}
+	if deletes := fake.sent("DELETE"); len(deletes) != 1 || deletes[0].Path != "/api/api-key/1" {
+		t.Errorf("deleted %v", deletes)
+	}
+}
+
+func TestAPIKeyToolsReadOnly(t *testing.T) {
+	r, fake, _ := newAPIKeyRegistry(t, Guardrails{ReadOnly: true})
+	for _, call := range []struct {
+		tool      string
+		arguments map[string]interface{}
+	}{
+		{"create-api-key", map[string]interface{}{"name": "etl", "group_id": 3}},
+		{"revoke-api-key", map[string]interface{}{"api_key_id": 1}},
+	} {
+		if response := callServerTool(t, r, call.tool, call.arguments); !strings.Contains(response, "is read-only") {
+			t.Errorf("%s = %s, want a read-only refusal", call.tool, response)
+		}
+	}
+	if len(fake.sent("POST"))+len(fake.sent("DELETE")) != 0 {
+		t.Errorf("read-only profile changed API keys")
+	}
+}
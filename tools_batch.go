@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits of one batch-query call
+const (
+	maxBatchStatements  = 20
+	maxBatchConcurrency = 8
+)
+
+// batchStatement is one query of a batch-query call
+type batchStatement struct {
+	Label      string                 `json:"label"`
+	Query      string                 `json:"query"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// registerBatchTools adds the tool running several queries in one call
+func registerBatchTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"batch-query",
+		mcp.WithDescription("Run several native queries in one call and return their results labeled, in the order given. Use it for multi-step analyses instead of calling metabase-tool once per query. Each statement is checked and run as by metabase-tool; a failing statement does not stop the others unless stop_on_error is set"),
+		mcp.WithArray(
+			"statements",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("The queries to run, at most %d", maxBatchStatements)),
+			mcp.Items(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"label":      map[string]interface{}{"type": "string", "description": "Name of the result; defaults to statement_<n>"},
+					"query":      map[string]interface{}{"type": "string", "description": "The query to run"},
+					"parameters": map[string]interface{}{"type": "object", "description": "Values for the statement's {{variable}} template tags, as for metabase-tool"},
+				},
+				"required": []string{"query"},
+			}),
+		),
+		mcp.WithNumber(
+			"concurrency",
+			mcp.Description(fmt.Sprintf("How many statements may run at once, up to %d (default 1: one after the other)", maxBatchConcurrency)),
+		),
+		mcp.WithBoolean(
+			"stop_on_error",
+			mcp.Description("Skip the statements not yet started once one fails"),
+		),
+		mcp.WithNumber(
+			"max_rows",
+			mcp.Description("Return at most this many rows per statement, as for metabase-tool"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to run the statements against; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database to run the statements against, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleBatchQuery)
+}
+
+func (r *toolRegistry) handleBatchQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var statements []batchStatement
+	encoded, err := json.Marshal(request.GetArguments()["statements"])
+	if err == nil {
+		err = json.Unmarshal(encoded, &statements)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("statements must be a list of {label, query, parameters} objects: %v", err)), nil
+	}
+	switch {
+	case len(statements) == 0:
+		return mcp.NewToolResultError("statements is required and must list at least one query"), nil
+	case len(statements) > maxBatchStatements:
+		return mcp.NewToolResultError(fmt.Sprintf("a batch may hold at most %d statements, got %d", maxBatchStatements, len(statements))), nil
+	}
+	labels := make(map[string]bool, len(statements))
+	for i := range statements {
+		if strings.TrimSpace(statements[i].Query) == "" {
+			return mcp.NewToolResultError(fmt.Sprintf("statement %d has no query", i+1)), nil
+		}
+		if statements[i].Label == "" {
+			statements[i].Label = fmt.Sprintf("statement_%d", i+1)
+		}
+		if labels[statements[i].Label] {
+			return mcp.NewToolResultError(fmt.Sprintf("label %q is used by more than one statement", statements[i].Label)), nil
+		}
+		labels[statements[i].Label] = true
+	}
+	concurrency := max(1, min(request.GetInt("concurrency", 1), maxBatchConcurrency))
+
+	// Statements share the batch's database, row limit, priority and timeout
+	shared := make(map[string]interface{})
+	for _, name := range []string{"database_id", "database", "max_rows", "priority", "timeout_seconds"} {
+		if value, ok := request.GetArguments()[name]; ok {
+			shared[name] = value
+		}
+	}
+	return r.runStatements(ctx, client, shared, statements, concurrency, request.GetBool("stop_on_error", false))
+}
+
+// runStatements runs statements as metabase-tool calls with the shared
+// arguments, at most concurrency at a time, and returns their labeled results
+// in order. With stopOnError, statements not started when one fails are skipped.
+func (r *toolRegistry) runStatements(ctx context.Context, client *MetabaseClient, shared map[string]interface{}, statements []batchStatement, concurrency int, stopOnError bool) (*mcp.CallToolResult, error) {
+	results := make([]map[string]interface{}, len(statements))
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	slots := make(chan struct{}, concurrency)
+	startedAt := time.Now()
+	for i, statement := range statements {
+		slots <- struct{}{}
+		mu.Lock()
+		skip := stopOnError && failed
+		mu.Unlock()
+		if skip || ctx.Err() != nil {
+			<-slots
+			results[i] = map[string]interface{}{"label": statement.Label, "status": "skipped"}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, statement batchStatement) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = r.runBatchStatement(ctx, client, shared, statement)
+			if results[i]["status"] == "error" {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(i, statement)
+	}
+	wg.Wait()
+
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result["status"].(string)]++
+	}
+	return r.budget.apply(ctx, map[string]interface{}{
+		"results":     results,
+		"succeeded":   counts["ok"],
+		"failed":      counts["error"],
+		"skipped":     counts["skipped"],
+		"concurrency": concurrency,
+		"duration_ms": time.Since(startedAt).Milliseconds(),
+	})
+}
+
+// runBatchStatement runs one statement as a metabase-tool call with the shared arguments
+func (r *toolRegistry) runBatchStatement(ctx context.Context, client *MetabaseClient, shared map[string]interface{}, statement batchStatement) map[string]interface{} {
+	args := make(map[string]interface{}, len(shared)+2)
+	for name, value := range shared {
+		args[name] = value
+	}
+	args["query"] = statement.Query
+	if len(statement.Parameters) > 0 {
+		args["parameters"] = statement.Parameters
+	}
+	var request mcp.CallToolRequest
+	request.Params.Name = "metabase-tool"
+	request.Params.Arguments = args
+
+	entry := map[string]interface{}{"label": statement.Label, "query": statement.Query}
+	startedAt := time.Now()
+	result, err := r.handleNativeQuery(ctx, client, request)
+	entry["duration_ms"] = time.Since(startedAt).Milliseconds()
+	switch {
+	case err != nil:
+		entry["status"], entry["error"] = "error", err.Error()
+	case result.IsError:
+		entry["status"], entry["error"] = "error", resultText(result)
+	default:
+		entry["status"] = "ok"
+		var decoded interface{}
+		decoder := json.NewDecoder(strings.NewReader(resultText(result)))
+		decoder.UseNumber()
+		if decoder.Decode(&decoded) != nil {
+			decoded = resultText(result)
+		}
+		entry["result"] = decoded
+		// A query Metabase ran but rejected is reported as failed in the body
+		if body, ok := decoded.(map[string]interface{}); ok && body["status"] == "failed" {
+			entry["status"], entry["error"] = "error", "Metabase reported the query as failed"
+		}
+	}
+	return entry
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// batchAnswer answers dataset queries with one row, failing queries on the
+// broken table
+func batchAnswer(request fakeRequest) interface{} {
+	if strings.Contains(sentSQL(request), "broken") {
+		return map[string]interface{}{"status": "failed", "error": `Table "BROKEN" not found`}
+	}
+	return datasetResponse(1)
+}
+
+func TestBatchQuery(t *testing.T) {
+	statements := []interface{}{
+		map[string]interface{}{"label": "customers", "query": "SELECT id, name FROM customers"},
+		map[string]interface{}{"query": "SELECT * FROM broken"},
+		map[string]interface{}{"query": "SELECT id, name FROM orders"},
+	}
+	tests := []struct {
+		name        string
+		stopOnError bool
+		want        []string
+	}{
+		{"keep going", false, []string{"customers ok", "statement_2 error", "statement_3 ok"}},
+		{"stop on error", true, []string{"customers ok", "statement_2 error", "statement_3 skipped"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, client, _ := newQueryRegistry(t, outputLimits{}, batchAnswer)
+			result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleBatchQuery, client, map[string]interface{}{
+				"statements":    statements,
+				"stop_on_error": tt.stopOnError,
+			}))
+
+			results, _ := result["results"].([]interface{})
+			var got []string
+			for _, entry := range results {
+				entry := entry.(map[string]interface{})
+				got = append(got, fmt.Sprintf("%s %s", entry["label"], entry["status"]))
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchQueryRefusals(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, batchAnswer)
+	tooMany := make([]interface{}, maxBatchStatements+1)
+	for i := range tooMany {
+		tooMany[i] = map[string]interface{}{"query": "SELECT 1"}
+	}
+
+	tests := []struct {
+		name       string
+		statements interface{}
+		want       string
+	}{
+		{"none", []interface{}{}, "must list at least one query"},
+		{"too many", tooMany, fmt.Sprintf("at most %d statements", maxBatchStatements)},
+		{"empty query", []interface{}{map[string]interface{}{"query": " "}}, "statement 1 has no query"},
+		{"duplicate label", []interface{}{
+			map[string]interface{}{"label": "a", "query": "SELECT 1"},
+			map[string]interface{}{"label": "a", "query": "SELECT 2"},
+		}, `label "a" is used by more than one statement`},
+		{"not a list", "SELECT 1", "statements must be a list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, queryContext(Guardrails{}), r.handleBatchQuery, client, map[string]interface{}{"statements": tt.statements})
+			if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+				t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+			}
+		})
+	}
+	if sent := fake.sent("POST"); len(sent) != 0 {
+		t.Errorf("refused batches sent %d queries", len(sent))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// CacheConfig represents a cache policy returned by /api/cache
+type CacheConfig struct {
+	Model    string                 `json:"model"`
+	ModelID  int                    `json:"model_id"`
+	Strategy map[string]interface{} `json:"strategy"`
+}
+
+// legacyCacheSettings are the instance settings used before per-item cache policies existed
+var legacyCacheSettings = []string{"enable-query-caching", "query-caching-ttl-ratio", "query-caching-min-ttl", "query-caching-max-kb"}
+
+// registerCacheTools adds the caching configuration tools
+func registerCacheTools(r *toolRegistry) {
+	r.addAdmin(mcp.NewTool(
+		"get-cache-config",
+		mcp.WithDescription("Show Metabase's result caching configuration: the default policy and any per-database, per-dashboard or per-question policies"),
+		mcp.WithString(
+			"model",
+			mcp.Enum("root", "database", "dashboard", "question"),
+			mcp.Description("Only show policies of this kind (default: all)"),
+		),
+	), handleGetCacheConfig)
+
+	r.addAdminWrite(mcp.NewTool(
+		"set-cache-policy",
+		mcp.WithDescription("Set the caching policy of the instance default, a database, a dashboard or a question. Previews the change unless confirm is true"),
+		mcp.WithString(
+			"model",
+			mcp.Required(),
+			mcp.Enum("root", "database", "dashboard", "question"),
+			mcp.Description("What the policy applies to; root is the instance default"),
+		),
+		mcp.WithNumber(
+			"model_id",
+			mcp.Description("ID of the database, dashboard or question (ignored for root)"),
+		),
+		mcp.WithString(
+			"strategy",
+			mcp.Required(),
+			mcp.Enum("nocache", "ttl", "duration", "schedule", "inherit"),
+			mcp.Description("nocache disables caching, ttl caches relative to query runtime, duration caches for a fixed time, schedule invalidates on a cron schedule, inherit removes the policy"),
+		),
+		mcp.WithNumber(
+			"duration_hours",
+			mcp.Description("Cache lifetime in hours for the duration strategy"),
+		),
+		mcp.WithNumber(
+			"multiplier",
+			mcp.Description("Cache lifetime as a multiple of the average query runtime for the ttl strategy"),
+		),
+		mcp.WithNumber(
+			"min_duration_seconds",
+			mcp.Description("Only cache queries running longer than this for the ttl strategy"),
+		),
+		mcp.WithString(
+			"schedule",
+			mcp.Description("Quartz cron expression for the schedule strategy, e.g. \"0 0 6 * * ?\""),
+		),
+		withConfirm(),
+	), handleSetCachePolicy)
+}
+
+func handleGetCacheConfig(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query := url.Values{}
+	if model := request.GetString("model", ""); model != "" {
+		query.Add("model", model)
+	} else {
+		for _, model := range []string{"root", "database", "dashboard", "question"} {
+			query.Add("model", model)
+		}
+	}
+
+	var configs struct {
+		Data []CacheConfig `json:"data"`
+	}
+	err := client.Get(ctx, "/api/cache?"+query.Encode(), &configs)
+	if err == nil {
+		return jsonResult(map[string]interface{}{"policies": configs.Data})
+	}
+
+	// Versions without /api/cache only have instance-wide settings
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch cache configuration: %v", err)), nil
+	}
+
+	settings := make(map[string]interface{})
+	for _, key := range legacyCacheSettings {
+		var value interface{}
+		if err := client.Get(ctx, "/api/setting/"+key, &value); err == nil {
+			settings[key] = value
+		}
+	}
+	return jsonResult(map[string]interface{}{"legacy_settings": settings})
+}
+
+func handleSetCachePolicy(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	model, err := request.RequireString("model")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	strategyType, err := request.RequireString("strategy")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	modelID := request.GetInt("model_id", 0)
+	if model != "root" && modelID == 0 {
+		return mcp.NewToolResultError("model_id is required unless model is root"), nil
+	}
+	if model == "root" {
+		modelID = 0
+	}
+
+	strategy := map[string]interface{}{"type": strategyType}
+	switch strategyType {
+	case "duration":
+		hours := request.GetInt("duration_hours", 0)
+		if hours <= 0 {
+			return mcp.NewToolResultError("duration_hours is required for the duration strategy"), nil
+		}
+		strategy["duration"] = hours
+		strategy["unit"] = "hours"
+	case "ttl":
+		strategy["multiplier"] = request.GetInt("multiplier", 10)
+		strategy["min_duration_ms"] = request.GetInt("min_duration_seconds", 1) * 1000
+	case "schedule":
+		schedule := request.GetString("schedule", "")
+		if schedule == "" {
+			return mcp.NewToolResultError("schedule is required for the schedule strategy"), nil
+		}
+		strategy["schedule"] = schedule
+	}
+
+	action := fmt.Sprintf("set cache policy of %s %d", model, modelID)
+	if !confirmed(request) {
+		return previewResult(action, map[string]interface{}{"strategy": strategy})
+	}
+
+	if strategyType == "inherit" {
+		body := map[string]interface{}{"model": model, "model_id": []int{modelID}}
+		if _, err := client.Do(ctx, http.MethodDelete, "/api/cache", body); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to remove cache policy: %v", err)), nil
+		}
+	} else {
+		body := map[string]interface{}{"model": model, "model_id": modelID, "strategy": strategy}
+		if err := client.Put(ctx, "/api/cache", body, nil); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to set cache policy: %v", err)), nil
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"applied":  true,
+		"action":   action,
+		"strategy": strategy,
+	})
+}
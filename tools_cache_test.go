@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGetCacheConfig(t *testing.T) {
+	policies := map[string]interface{}{"data": []interface{}{map[string]interface{}{"model": "root", "model_id": 0, "strategy": map[string]interface{}{"type": "nocache"}}}}
+	client, fake := newFakeMetabase(t, map[string]interface{}{"/api/cache": policies})
+	result := decodeResult(t, callTool(t, context.Background(), handleGetCacheConfig, client, nil))
+	if list, _ := result["policies"].([]interface{}); len(list) != 1 {
+		t.Errorf("policies = %v", result)
+	}
+	if models := fake.sent("GET")[0].Query["model"]; !reflect.DeepEqual(models, []string{"root", "database", "dashboard", "question"}) {
+		t.Errorf("requested models %v, want all", models)
+	}
+
+	// Metabase versions without /api/cache only have instance settings
+	client = newTestClient(t, map[string]interface{}{
+		"/api/setting/enable-query-caching":  true,
+		"/api/setting/query-caching-min-ttl": 60,
+	})
+	result = decodeResult(t, callTool(t, context.Background(), handleGetCacheConfig, client, nil))
+	want := map[string]interface{}{"enable-query-caching": true, "query-caching-min-ttl": float64(60)}
+	if !reflect.DeepEqual(result["legacy_settings"], want) {
+		t.Errorf("legacy settings = %v, want %v", result["legacy_settings"], want)
+	}
+}
+
+func TestSetCachePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		method    string
+		body      map[string]interface{}
+		wantErr   bool
+	}{
+		{"duration", map[string]interface{}{"model": "database", "model_id": 7, "strategy": "duration", "duration_hours": 6},
+			"PUT", map[string]interface{}{"model": "database", "model_id": float64(7), "strategy": map[string]interface{}{"type": "duration", "duration": float64(6), "unit": "hours"}}, false},
+		{"ttl defaults", map[string]interface{}{"model": "root", "model_id": 3, "strategy": "ttl"},
+			"PUT", map[string]interface{}{"model": "root", "model_id": float64(0), "strategy": map[string]interface{}{"type": "ttl", "multiplier": float64(10), "min_duration_ms": float64(1000)}}, false},
+		{"inherit", map[string]interface{}{"model": "question", "model_id": 5, "strategy": "inherit"},
+			"DELETE", map[string]interface{}{"model": "question", "model_id": []interface{}{float64(5)}}, false},
+		{"duration without hours", map[string]interface{}{"model": "database", "model_id": 7, "strategy": "duration"}, "", nil, true},
+		{"schedule without cron", map[string]interface{}{"model": "dashboard", "model_id": 2, "strategy": "schedule"}, "", nil, true},
+		{"database without ID", map[string]interface{}{"model": "database", "strategy": "nocache"}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMetabase(t, map[string]interface{}{"/api/cache": map[string]interface{}{}})
+
+			preview := callTool(t, context.Background(), handleSetCachePolicy, client, tt.arguments)
+			if preview.IsError != tt.wantErr {
+				t.Fatalf("preview = %s, want error %v", resultText(preview), tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(fake.requests) != 0 {
+				t.Errorf("preview sent %v", fake.requests)
+			}
+
+			tt.arguments["confirm"] = true
+			callTool(t, context.Background(), handleSetCachePolicy, client, tt.arguments)
+			sent := fake.sent(tt.method)
+			if len(sent) != 1 || !reflect.DeepEqual(sent[0].Body, tt.body) {
+				t.Errorf("sent %v, want %s %v", fake.requests, tt.method, tt.body)
+			}
+		})
+	}
+}
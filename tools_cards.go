@@ -0,0 +1,1228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultCardLimit is the number of cards list-cards returns unless asked otherwise
+const defaultCardLimit = 100
+
+// chartRoles maps the visualization settings naming the columns a chart
+// shows to their role
+var chartRoles = map[string]string{
+	"graph.dimensions":   "dimensions",
+	"graph.metrics":      "metrics",
+	"pie.dimension":      "dimensions",
+	"pie.metric":         "metrics",
+	"funnel.dimension":   "dimensions",
+	"funnel.metric":      "metrics",
+	"map.dimension":      "dimensions",
+	"map.metric":         "metrics",
+	"scalar.field":       "metrics",
+	"table.pivot_column": "dimensions",
+	"table.cell_column":  "metrics",
+}
+
+// defaultRevisionLimit is the number of revisions card-revisions returns unless asked otherwise
+const defaultRevisionLimit = 20
+
+// cardDisplays are the visualizations a card can be saved with
+var cardDisplays = []string{"table", "scalar", "bar", "row", "line", "area", "combo", "pie", "funnel", "map", "pivot"}
+
+// registerCardTools adds the tools discovering, running and saving questions
+func registerCardTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"list-cards",
+		mcp.WithDescription("List saved questions, models and metrics in Metabase, filtered by collection, creator or name. Use it to discover governed questions before writing SQL from scratch"),
+		mcp.WithString(
+			"name",
+			mcp.Description("Only include cards whose name contains this text"),
+		),
+		mcp.WithNumber(
+			"collection_id",
+			mcp.Description("Only include cards in this collection; 0 for the root collection"),
+		),
+		mcp.WithString(
+			"creator",
+			mcp.Description("Only include cards created by this user, given by user ID, email or a part of their name"),
+		),
+		mcp.WithString(
+			"type",
+			mcp.Enum("question", "model", "metric"),
+			mcp.Description("Only include cards of this type"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Only include cards querying this database"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description(fmt.Sprintf("Maximum number of cards to return (default %d)", defaultCardLimit)),
+		),
+	), handleListCards)
+
+	r.add(mcp.NewTool(
+		"search-cards",
+		mcp.WithDescription("Search saved questions, models and metrics by keyword in their name, description and SQL, e.g. to find out whether a churn query already exists before writing one"),
+		mcp.WithString(
+			"keyword",
+			mcp.Required(),
+			mcp.Description("Words to look for; every word must occur in the name, description or SQL of a card"),
+		),
+		mcp.WithString(
+			"type",
+			mcp.Enum("question", "model", "metric"),
+			mcp.Description("Only include cards of this type"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Only include cards querying this database"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description(fmt.Sprintf("Maximum number of cards to return (default %d)", defaultCardLimit)),
+		),
+	), handleSearchCards)
+
+	r.add(mcp.NewTool(
+		"run-card",
+		mcp.WithDescription("Run a saved question by ID and return its result, formatted like metabase-tool results. Prefer running a governed question found with list-cards over recreating its SQL. Filter it through the parameters it declares, such as date or category filters"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to run"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Values for the card's parameters, keyed by slug, name or ID. Dates are given as 2024-01-31, ranges as 2024-01-01~2024-01-31 and relative dates as past30days; list several values for multi-select filters. parameter-values lists the values a parameter accepts"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleRunCard)
+
+	r.add(mcp.NewTool(
+		"get-card-definition",
+		mcp.WithDescription("Get the definition of a saved question: its SQL or MBQL query, parameters and result columns. Use it to explain what a question computes or as the starting point to modify it with update-card"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card"),
+		),
+	), handleGetCardDefinition)
+
+	r.add(mcp.NewTool(
+		"get-card-visualization",
+		mcp.WithDescription("Get how a saved question is visualized: its chart type, the columns on its axes, axis settings and per-column formatting. Use it to describe a chart or to suggest visualization changes applied with update-card"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card"),
+		),
+	), handleGetCardVisualization)
+
+	r.addWrite(mcp.NewTool(
+		"create-card",
+		mcp.WithDescription("Save a SQL query as a new question in Metabase, so a successful analysis can be found and reused by people. Give it a name and description saying what it answers"),
+		mcp.WithString(
+			"name",
+			mcp.Required(),
+			mcp.Description("Name of the question"),
+		),
+		mcp.WithString(
+			"query",
+			mcp.Required(),
+			mcp.Description("SQL query of the question; {{variables}} become its filters"),
+		),
+		mcp.WithString(
+			"description",
+			mcp.Description("What the question answers and how to read it"),
+		),
+		mcp.WithNumber(
+			"collection_id",
+			mcp.Description("Collection to save the question in (default: root collection)"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database the query runs against; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database the query runs against, as for metabase-tool; an alternative to database_id"),
+		),
+		mcp.WithString(
+			"display",
+			mcp.Enum(cardDisplays...),
+			mcp.Description("Visualization of the question (default table)"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Types and default values of the query's {{variables}}, given as for metabase-tool"),
+		),
+	), r.handleCreateCard)
+
+	r.addWrite(mcp.NewTool(
+		"update-card",
+		mcp.WithDescription("Update a saved question: its SQL query, name, description, display or visualization settings. Without confirm the changes, with a diff of the old and new SQL, are only previewed"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to update"),
+		),
+		mcp.WithString(
+			"query",
+			mcp.Description("New SQL query of the question; only SQL questions can be given one"),
+		),
+		mcp.WithString(
+			"name",
+			mcp.Description("New name of the question"),
+		),
+		mcp.WithString(
+			"description",
+			mcp.Description("New description of the question"),
+		),
+		mcp.WithString(
+			"display",
+			mcp.Enum(cardDisplays...),
+			mcp.Description("New visualization of the question"),
+		),
+		mcp.WithObject(
+			"visualization_settings",
+			mcp.Description("Visualization settings to change, merged into the card's settings; a null value removes a setting"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Types and default values of the new query's {{variables}}, given as for metabase-tool; variables left out keep their current filter"),
+		),
+		withConfirm(),
+	), r.handleUpdateCard)
+
+	r.addWrite(mcp.NewTool(
+		"duplicate-card",
+		mcp.WithDescription("Copy a saved question, optionally into another collection or, for SQL questions, pointing at another database, as the starting point for a variant of an analysis. Change the copy's query afterwards with update-card"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to copy"),
+		),
+		mcp.WithString(
+			"name",
+			mcp.Description("Name of the copy (default: the card's name followed by (copy))"),
+		),
+		mcp.WithNumber(
+			"collection_id",
+			mcp.Description("Collection to save the copy in; 0 for the root collection (default: the card's collection)"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database the copy queries (default: the card's database); only SQL questions can be pointed at another database"),
+		),
+	), r.handleDuplicateCard)
+
+	r.addWrite(mcp.NewTool(
+		"move-card",
+		mcp.WithDescription("Move a saved question into another collection, given by name, path such as Finance/Reports, or ID"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to move"),
+		),
+		mcp.WithString(
+			"collection",
+			mcp.Required(),
+			mcp.Description("Collection to move the card into: its name, its path such as Finance/Reports, its ID, or root"),
+		),
+	), r.handleMoveCard)
+
+	r.add(mcp.NewTool(
+		"card-revisions",
+		mcp.WithDescription("List the revision history of a saved question: who changed what and when, with a diff of the SQL when the query changed. Use it to answer what changed in a question, and revert-card to roll back a bad edit"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card"),
+		),
+		mcp.WithNumber(
+			"since_days",
+			mcp.Description("Only include revisions made within this many days (default: all revisions)"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description(fmt.Sprintf("Maximum number of revisions to return, most recent first (default %d)", defaultRevisionLimit)),
+		),
+	), handleCardRevisions)
+
+	r.addWrite(mcp.NewTool(
+		"revert-card",
+		mcp.WithDescription("Revert a saved question to one of its revisions listed by card-revisions. Without confirm the revert, with a diff of the current and restored SQL, is only previewed. The revert is itself recorded as a revision, so it can be undone"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to revert"),
+		),
+		mcp.WithNumber(
+			"revision_id",
+			mcp.Required(),
+			mcp.Description("ID of the revision to restore the card to"),
+		),
+		withConfirm(),
+	), r.handleRevertCard)
+
+	r.addWrite(mcp.NewTool(
+		"archive-card",
+		mcp.WithDescription("Move a saved question to the trash, e.g. when it is stale or duplicated. Nothing is deleted: unarchive-card restores it"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to archive"),
+		),
+	), r.archiveCardHandler(true))
+
+	r.addWrite(mcp.NewTool(
+		"unarchive-card",
+		mcp.WithDescription("Restore an archived saved question to its collection"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to restore"),
+		),
+	), r.archiveCardHandler(false))
+}
+
+func handleListCards(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name := strings.ToLower(request.GetString("name", ""))
+	creator := strings.ToLower(request.GetString("creator", ""))
+	cardType := request.GetString("type", "")
+	databaseID := request.GetInt("database_id", 0)
+	_, byCollection := request.GetArguments()["collection_id"]
+	collectionID := request.GetInt("collection_id", 0)
+	limit := request.GetInt("limit", defaultCardLimit)
+	if limit <= 0 {
+		limit = defaultCardLimit
+	}
+
+	cards, err := listCards(ctx, client)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list cards: %v", err)), nil
+	}
+
+	rows := make([][]interface{}, 0)
+	matches := 0
+	for _, card := range cards {
+		if card.Archived || checkDatabaseAccess(ctx, card.DatabaseID) != nil {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(card.Name), name) {
+			continue
+		}
+		if byCollection && collectionID == 0 && card.CollectionID != nil {
+			continue
+		}
+		if byCollection && collectionID != 0 && (card.CollectionID == nil || *card.CollectionID != collectionID) {
+			continue
+		}
+		if cardType != "" && card.Type != cardType {
+			continue
+		}
+		if databaseID != 0 && card.DatabaseID != databaseID {
+			continue
+		}
+		if creator != "" && !card.createdBy(creator) {
+			continue
+		}
+		matches++
+		if len(rows) == limit {
+			continue
+		}
+		var description, creatorName interface{}
+		if card.Description != nil && *card.Description != "" {
+			description = *card.Description
+		}
+		if card.Creator != nil {
+			creatorName = card.Creator.CommonName
+		}
+		rows = append(rows, []interface{}{card.ID, card.Name, description, card.Type, card.QueryType, card.DatabaseID, card.CollectionID, creatorName})
+	}
+
+	result := map[string]interface{}{
+		"matches": matches,
+		"columns": []string{"id", "name", "description", "type", "query_type", "database_id", "collection_id", "creator"},
+		"rows":    rows,
+	}
+	if matches > len(rows) {
+		result["truncated"] = true
+	}
+	return jsonResult(result)
+}
+
+// maxSnippetLength is the length beyond which search-cards cuts SQL lines
+const maxSnippetLength = 160
+
+// cardMatch is a card found by search-cards
+type cardMatch struct {
+	rank    int
+	card    Card
+	matched string
+	snippet interface{}
+}
+
+func handleSearchCards(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	keyword, err := request.RequireString("keyword")
+	words := strings.Fields(strings.ToLower(keyword))
+	if err != nil || len(words) == 0 {
+		return mcp.NewToolResultError("keyword is required and must be a string"), nil
+	}
+	cardType := request.GetString("type", "")
+	databaseID := request.GetInt("database_id", 0)
+	limit := request.GetInt("limit", defaultCardLimit)
+	if limit <= 0 {
+		limit = defaultCardLimit
+	}
+
+	cards, err := listCards(ctx, client)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list cards: %v", err)), nil
+	}
+
+	matches := make([]cardMatch, 0)
+	for _, card := range cards {
+		if card.Archived || checkDatabaseAccess(ctx, card.DatabaseID) != nil {
+			continue
+		}
+		if (cardType != "" && card.Type != cardType) || (databaseID != 0 && card.DatabaseID != databaseID) {
+			continue
+		}
+		if match, ok := matchCard(words, card); ok {
+			matches = append(matches, match)
+		}
+	}
+	// Name matches come before description and SQL matches, verified cards first
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].card.Verified() && !matches[j].card.Verified()
+	})
+
+	rows := make([][]interface{}, 0, min(len(matches), limit))
+	for _, match := range matches[:min(len(matches), limit)] {
+		card := match.card
+		rows = append(rows, []interface{}{card.ID, card.Name, card.Type, card.DatabaseID, card.CollectionID, card.Verified(), match.matched, match.snippet})
+	}
+	result := map[string]interface{}{
+		"keyword": keyword,
+		"matches": len(matches),
+		"columns": []string{"id", "name", "type", "database_id", "collection_id", "verified", "matched", "snippet"},
+		"rows":    rows,
+	}
+	if len(matches) > limit {
+		result["truncated"] = true
+	}
+	if len(matches) == 0 {
+		result["message"] = "No card matched; try a shorter keyword or a synonym, or search-schema to find the tables to query"
+	}
+	return jsonResult(result)
+}
+
+// matchCard reports whether every word occurs in the name, description or
+// SQL of a card, where the best match was found and the first line of the
+// query holding the first word, if any
+func matchCard(words []string, card Card) (cardMatch, bool) {
+	var description string
+	if card.Description != nil {
+		description = *card.Description
+	}
+	native, _ := nativeQueryOf(card.DatasetQuery)
+	candidates := []struct {
+		matched string
+		value   string
+	}{{"name", card.Name}, {"description", description}, {"sql", native.Query}}
+
+	all := strings.ToLower(card.Name + "\n" + description + "\n" + native.Query)
+	for _, word := range words {
+		if !strings.Contains(all, word) {
+			return cardMatch{}, false
+		}
+	}
+	match := cardMatch{rank: len(candidates), card: card, matched: "name, description or sql"}
+	for rank, candidate := range candidates {
+		value := strings.ToLower(candidate.value)
+		found := true
+		for _, word := range words {
+			found = found && strings.Contains(value, word)
+		}
+		if found {
+			match.rank, match.matched = rank, candidate.matched
+			break
+		}
+	}
+	if match.rank > 0 {
+		for _, line := range strings.Split(native.Query, "\n") {
+			at := strings.Index(strings.ToLower(line), words[0])
+			if at < 0 {
+				continue
+			}
+			// Long lines are cut around the word
+			if start := at - maxSnippetLength/2; len(line) > maxSnippetLength && start > 0 {
+				line = "..." + line[start:]
+			}
+			if len(line) > maxSnippetLength {
+				line = line[:maxSnippetLength] + "..."
+			}
+			match.snippet = strings.TrimSpace(strings.ToValidUTF8(line, ""))
+			break
+		}
+	}
+	return match, true
+}
+
+func (r *toolRegistry) handleRunCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	if err := checkCardQueryAccess(ctx, client, card); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	values, _ := request.GetArguments()["parameters"].(map[string]interface{})
+	entries, err := cardParameterEntries(card.Parameters, values)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	body := map[string]interface{}{"parameters": entries}
+	outcome, err := r.executeAt(ctx, client, fmt.Sprintf("/api/card/%d/query", cardID), body, card.DatabaseID, fmt.Sprintf("card %d: %s", card.ID, card.Name))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !outcome.Parsed {
+		return outcome.rawResult()
+	}
+
+	cfg := r.currentConfig()
+	binaryNotes := handleBinaryColumns(&outcome.Response.Data, cfg.BinaryColumns)
+	jsonNotes, err := handleJSONColumns(&outcome.Response.Data, parseJSONColumnOptions(request.GetArguments(), cfg.JSONColumns))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result := outcome.result()
+	delete(result, "query_sent")
+	result["card"] = map[string]interface{}{"id": card.ID, "name": card.Name, "verified": card.Verified()}
+	if len(binaryNotes) > 0 {
+		result["binary_columns"] = binaryNotes
+	}
+	if len(jsonNotes) > 0 {
+		result["json_columns"] = jsonNotes
+	}
+	if len(values) > 0 {
+		result["parameters"] = values
+	}
+	return r.budget.apply(ctx, result)
+}
+
+func handleGetCardDefinition(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	definition := map[string]interface{}{
+		"id":            card.ID,
+		"name":          card.Name,
+		"description":   card.Description,
+		"type":          card.Type,
+		"display":       card.Display,
+		"database_id":   card.DatabaseID,
+		"collection_id": card.CollectionID,
+		"archived":      card.Archived,
+		"verified":      card.Verified(),
+		"query_type":    card.QueryType,
+	}
+	if native, ok := nativeQueryOf(card.DatasetQuery); ok {
+		definition["sql"] = native.Query
+		if len(native.TemplateTags) > 0 {
+			definition["template_tags"] = native.TemplateTags
+		}
+	} else {
+		var tableID int
+		if card.TableID != nil {
+			tableID = *card.TableID
+		}
+		source := make(map[string]interface{})
+		tables := &definitionTables{client: client, tables: make(map[int]*TableMetadata)}
+		if !tables.describe(ctx, source, card.DatabaseID, tableID, queryDefinition(card.DatasetQuery)) {
+			return mcp.NewToolResultError(fmt.Sprintf("access denied: card %d reads a table outside the allowed schemas", cardID)), nil
+		}
+		for _, key := range []string{"table_id", "table", "fields"} {
+			if value, ok := source[key]; ok {
+				definition[key] = value
+			}
+		}
+		definition["mbql"] = queryDefinition(card.DatasetQuery)
+	}
+
+	parameters := make([]map[string]interface{}, 0, len(card.Parameters))
+	for _, parameter := range card.Parameters {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     parameter.Name,
+			"slug":     parameter.Slug,
+			"type":     parameter.Type,
+			"required": parameter.Required,
+			"default":  parameter.Default,
+			"target":   parameter.Target,
+		})
+	}
+	definition["parameters"] = parameters
+
+	columns := make([]map[string]interface{}, 0, len(card.ResultMetadata))
+	for _, column := range card.ResultMetadata {
+		var semanticType interface{}
+		if column.SemanticType != nil {
+			semanticType = strings.TrimPrefix(*column.SemanticType, "type/")
+		}
+		columns = append(columns, map[string]interface{}{
+			"name":          column.Name,
+			"display_name":  column.DisplayName,
+			"type":          strings.TrimPrefix(column.BaseType, "type/"),
+			"semantic_type": semanticType,
+			"description":   column.Description,
+		})
+	}
+	definition["result_columns"] = columns
+	return jsonResult(definition)
+}
+
+func handleGetCardVisualization(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	columns := make(map[string]interface{})
+	axes := make(map[string]interface{})
+	formatting := make(map[string]interface{})
+	other := make(map[string]interface{})
+	for key, value := range card.VisualizationSettings {
+		switch {
+		case chartRoles[key] != "":
+			role := chartRoles[key]
+			names, _ := columns[role].([]interface{})
+			if list, ok := value.([]interface{}); ok {
+				names = append(names, list...)
+			} else if value != nil {
+				names = append(names, value)
+			}
+			columns[role] = names
+		case strings.HasPrefix(key, "graph.x_axis.") || strings.HasPrefix(key, "graph.y_axis."):
+			axes[key] = value
+		case key == "column_settings":
+			settings, _ := value.(map[string]interface{})
+			for ref, columnSettings := range settings {
+				formatting[columnSettingsName(ref, card.ResultMetadata)] = columnSettings
+			}
+		default:
+			other[key] = value
+		}
+	}
+
+	result := map[string]interface{}{
+		"card_id": card.ID,
+		"name":    card.Name,
+		"display": card.Display,
+	}
+	for key, value := range map[string]map[string]interface{}{"columns": columns, "axes": axes, "column_formatting": formatting, "settings": other} {
+		if len(value) > 0 {
+			result[key] = value
+		}
+	}
+	if len(columns) == 0 && card.Display != "" && card.Display != "table" {
+		result["note"] = "The card does not name the columns it shows; Metabase chooses them from the result columns"
+	}
+	return jsonResult(result)
+}
+
+// columnSettingsName names the column a column_settings key refers to. Keys
+// are JSON references such as ["name","total"] or ["ref",["field",12,null]];
+// field IDs are resolved through the card's result columns.
+func columnSettingsName(key string, columns []ResultColumn) string {
+	var ref []interface{}
+	if json.Unmarshal([]byte(key), &ref) != nil || len(ref) < 2 {
+		return key
+	}
+	if name, ok := ref[1].(string); ok {
+		return name
+	}
+	field, ok := ref[1].([]interface{})
+	if !ok || len(field) < 2 {
+		return key
+	}
+	switch id := field[1].(type) {
+	case string:
+		return id
+	case float64:
+		for _, column := range columns {
+			if column.ID != nil && *column.ID == int(id) {
+				return column.Name
+			}
+		}
+	}
+	return key
+}
+
+func (r *toolRegistry) handleCreateCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil || strings.TrimSpace(name) == "" {
+		return mcp.NewToolResultError("name is required and must be a string"), nil
+	}
+	query, err := request.RequireString("query")
+	if err != nil || query == "" {
+		return mcp.NewToolResultError("query is required and must be a string"), nil
+	}
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	args, _ := request.GetArguments()["parameters"].(map[string]interface{})
+	datasetQuery, err := r.cardQuery(ctx, client, databaseID, query, args, nil)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	body := map[string]interface{}{
+		"name":                   name,
+		"type":                   "question",
+		"display":                request.GetString("display", "table"),
+		"visualization_settings": map[string]interface{}{},
+		"dataset_query":          datasetQuery,
+	}
+	if description := request.GetString("description", ""); description != "" {
+		body["description"] = description
+	}
+	if collectionID := request.GetInt("collection_id", 0); collectionID != 0 {
+		body["collection_id"] = collectionID
+	}
+
+	var card Card
+	if err := client.Post(ctx, "/api/card", body, &card); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to create card: %v", err)), nil
+	}
+	return jsonResult(map[string]interface{}{
+		"id":            card.ID,
+		"name":          card.Name,
+		"database_id":   card.DatabaseID,
+		"collection_id": card.CollectionID,
+		"display":       card.Display,
+	})
+}
+
+func (r *toolRegistry) handleUpdateCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	arguments := request.GetArguments()
+
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	body := make(map[string]interface{})
+	changes := make(map[string]interface{})
+	if name, ok := arguments["name"].(string); ok && name != card.Name {
+		if strings.TrimSpace(name) == "" {
+			return mcp.NewToolResultError("name must not be empty"), nil
+		}
+		body["name"] = name
+		changes["name"] = map[string]interface{}{"from": card.Name, "to": name}
+	}
+	var currentDescription string
+	if card.Description != nil {
+		currentDescription = *card.Description
+	}
+	if description, ok := arguments["description"].(string); ok && description != currentDescription {
+		body["description"] = description
+		changes["description"] = map[string]interface{}{"from": card.Description, "to": description}
+	}
+	if display, ok := arguments["display"].(string); ok && display != card.Display {
+		body["display"] = display
+		changes["display"] = map[string]interface{}{"from": card.Display, "to": display}
+	}
+	if settings, ok := arguments["visualization_settings"].(map[string]interface{}); ok && len(settings) > 0 {
+		merged := make(map[string]interface{}, len(card.VisualizationSettings)+len(settings))
+		for key, value := range card.VisualizationSettings {
+			merged[key] = value
+		}
+		for key, value := range settings {
+			if value == nil {
+				delete(merged, key)
+			} else {
+				merged[key] = value
+			}
+		}
+		body["visualization_settings"] = merged
+		changes["visualization_settings"] = map[string]interface{}{"from": card.VisualizationSettings, "to": merged}
+	}
+
+	if query, ok := arguments["query"].(string); ok && query != "" {
+		current, native := nativeQueryOf(card.DatasetQuery)
+		if !native {
+			return mcp.NewToolResultError(fmt.Sprintf("card %d is not a SQL question; only the query of SQL questions can be replaced", cardID)), nil
+		}
+		args, _ := arguments["parameters"].(map[string]interface{})
+		datasetQuery, err := r.cardQuery(ctx, client, card.DatabaseID, query, args, current.TemplateTags)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if datasetQuery.Native.Query != current.Query || len(args) > 0 {
+			body["dataset_query"] = datasetQuery
+			changes["query"] = map[string]interface{}{
+				"from": current.Query,
+				"to":   datasetQuery.Native.Query,
+				"diff": lineDiff(current.Query, datasetQuery.Native.Query),
+			}
+		}
+	}
+	if len(body) == 0 {
+		return mcp.NewToolResultError("nothing to update: give a query, name, description, display or visualization_settings differing from the card's"), nil
+	}
+
+	action := fmt.Sprintf("update card %d (%s)", card.ID, card.Name)
+	if !confirmed(request) {
+		return previewResult(action, changes)
+	}
+
+	var updated Card
+	if err := client.Put(ctx, fmt.Sprintf("/api/card/%d", cardID), body, &updated); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update card %d: %v", cardID, err)), nil
+	}
+	return jsonResult(map[string]interface{}{
+		"applied": true,
+		"action":  action,
+		"card_id": updated.ID,
+		"name":    updated.Name,
+		"changes": changes,
+	})
+}
+
+// cardQuery builds the dataset query saved in a card from SQL, applying the
+// checks metabase-tool applies before running it. Every {{variable}} gets a
+// template tag: the given parameters set its type and default value, and
+// variables without one keep the tag in existing, if any.
+func (r *toolRegistry) cardQuery(ctx context.Context, client *MetabaseClient, databaseID int, query string, args map[string]interface{}, existing map[string]interface{}) (MetabaseQuery, error) {
+	if statements := splitStatements(query); len(statements) > 1 {
+		return MetabaseQuery{}, fmt.Errorf("a question holds a single statement, but the query holds %d", len(statements))
+	}
+	if profile := profileFromContext(ctx); profile.Guardrails.ReadOnly && !isSelectQuery(query) {
+		r.stats.recordPolicy(ctx, "read_only")
+		return MetabaseQuery{}, fmt.Errorf("profile %s is read-only: only SELECT queries are allowed", profile.Name)
+	}
+
+	// The saved question must not depend on the session's virtual views
+	query, _ = r.views.expand(sessionID(ctx), query)
+	if err := checkQueryAccess(ctx, databaseID, query); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return MetabaseQuery{}, err
+	}
+
+	params := parseTemplateParameters(args)
+	tags, _, _, err := buildTemplateTags(ctx, client, databaseID, query, params)
+	if err != nil {
+		return MetabaseQuery{}, err
+	}
+	for name := range tags {
+		if param, ok := params[name]; ok {
+			if param.Value != nil {
+				tags[name].(map[string]interface{})["default"] = param.Value
+			}
+		} else if tag, ok := existing[name]; ok {
+			tags[name] = tag
+		}
+	}
+	datasetQuery := newNativeQuery(databaseID, query)
+	datasetQuery.Native.TemplateTags = tags
+	return datasetQuery, nil
+}
+
+// lineDiff compares two texts line by line, marking removed lines with "-",
+// added lines with "+" and unchanged lines with a space
+func lineDiff(from, to string) string {
+	a, b := strings.Split(from, "\n"), strings.Split(to, "\n")
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || common[i][j+1] > common[i+1][j]):
+			diff.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			diff.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return diff.String()
+}
+
+func (r *toolRegistry) handleDuplicateCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	// Settings and parameters are copied as returned, keeping fields Card leaves out
+	var raw json.RawMessage
+	if err := client.Get(ctx, fmt.Sprintf("/api/card/%d", cardID), &raw); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	var card Card
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &card); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to decode card %d: %v", cardID, err)), nil
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to decode card %d: %v", cardID, err)), nil
+	}
+	if err := checkCardQueryAccess(ctx, client, card); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var datasetQuery map[string]interface{}
+	if err := json.Unmarshal(card.DatasetQuery, &datasetQuery); err != nil || datasetQuery == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("card %d has no query to copy", cardID)), nil
+	}
+	databaseID := request.GetInt("database_id", card.DatabaseID)
+	if databaseID != card.DatabaseID {
+		native, ok := nativeQueryOf(card.DatasetQuery)
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("card %d is not a SQL question; only SQL questions can be pointed at another database", cardID)), nil
+		}
+		// Field filters and query-builder sources refer to IDs of the card's database
+		for name, tag := range native.TemplateTags {
+			if tag, ok := tag.(map[string]interface{}); ok && (tag["type"] == "dimension" || tag["type"] == "card") {
+				return mcp.NewToolResultError(fmt.Sprintf("the {{%s}} variable of card %d refers to database %d and cannot be pointed at another database", name, cardID, card.DatabaseID)), nil
+			}
+		}
+		if err := checkQueryAccess(ctx, databaseID, native.Query); err != nil {
+			r.stats.recordPolicy(ctx, policyName(err))
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		datasetQuery["database"] = databaseID
+	}
+
+	name := request.GetString("name", "")
+	if strings.TrimSpace(name) == "" {
+		name = card.Name + " (copy)"
+	}
+	body := map[string]interface{}{
+		"name":                   name,
+		"description":            card.Description,
+		"display":                card.Display,
+		"dataset_query":          datasetQuery,
+		"visualization_settings": map[string]interface{}{},
+		"collection_id":          card.CollectionID,
+	}
+	for _, field := range []string{"visualization_settings", "parameters", "parameter_mappings", "type"} {
+		if value, ok := fields[field]; ok && string(value) != "null" {
+			body[field] = value
+		}
+	}
+	if _, ok := request.GetArguments()["collection_id"]; ok {
+		body["collection_id"] = nil
+		if collectionID := request.GetInt("collection_id", 0); collectionID != 0 {
+			body["collection_id"] = collectionID
+		}
+	}
+
+	var copied Card
+	if err := client.Post(ctx, "/api/card", body, &copied); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to copy card %d: %v", cardID, err)), nil
+	}
+	return jsonResult(map[string]interface{}{
+		"id":            copied.ID,
+		"name":          copied.Name,
+		"copied_from":   card.ID,
+		"database_id":   copied.DatabaseID,
+		"collection_id": copied.CollectionID,
+	})
+}
+
+func (r *toolRegistry) handleMoveCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	collection, err := request.RequireString("collection")
+	if err != nil || strings.TrimSpace(collection) == "" {
+		return mcp.NewToolResultError("collection is required and must be a string"), nil
+	}
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	collectionID, path, err := resolveCollection(ctx, client, collection)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if (collectionID == nil && card.CollectionID == nil) || (collectionID != nil && card.CollectionID != nil && *collectionID == *card.CollectionID) {
+		return mcp.NewToolResultError(fmt.Sprintf("card %d (%s) is already in %s", card.ID, card.Name, path)), nil
+	}
+
+	var moved Card
+	if err := client.Put(ctx, fmt.Sprintf("/api/card/%d", cardID), map[string]interface{}{"collection_id": collectionID}, &moved); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to move card %d: %v", cardID, err)), nil
+	}
+	return jsonResult(map[string]interface{}{
+		"id":                 moved.ID,
+		"name":               moved.Name,
+		"from_collection_id": card.CollectionID,
+		"collection_id":      moved.CollectionID,
+		"collection":         path,
+	})
+}
+
+func handleCardRevisions(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	sinceDays := request.GetInt("since_days", 0)
+	limit := request.GetInt("limit", defaultRevisionLimit)
+	if limit <= 0 {
+		limit = defaultRevisionLimit
+	}
+	if err := checkCardAccess(ctx, client, cardID); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var revisions []Revision
+	if err := client.Get(ctx, fmt.Sprintf("/api/revision?entity=card&id=%d", cardID), &revisions); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch revisions of card %d: %v", cardID, err)), nil
+	}
+
+	now := time.Now()
+	listed := make([]map[string]interface{}, 0)
+	for _, revision := range revisions {
+		if sinceDays > 0 {
+			at, err := time.Parse(time.RFC3339, revision.Timestamp)
+			if err == nil && now.Sub(at) > time.Duration(sinceDays)*24*time.Hour {
+				continue
+			}
+		}
+		if len(listed) == limit {
+			break
+		}
+		entry := map[string]interface{}{
+			"id":           revision.ID,
+			"timestamp":    revision.Timestamp,
+			"description":  revision.Description,
+			"is_creation":  revision.IsCreation,
+			"is_reversion": revision.IsReversion,
+		}
+		if revision.User != nil {
+			entry["user"] = revision.User.CommonName
+		}
+		if revision.Message != nil && *revision.Message != "" {
+			entry["message"] = *revision.Message
+		}
+		if revision.Diff != nil {
+			changed := make(map[string]bool)
+			for field := range revision.Diff.Before {
+				changed[field] = true
+			}
+			for field := range revision.Diff.After {
+				changed[field] = true
+			}
+			fields := make([]string, 0, len(changed))
+			for field := range changed {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			entry["changed"] = fields
+
+			before, beforeNative := nativeQueryOf(revision.Diff.Before["dataset_query"])
+			after, afterNative := nativeQueryOf(revision.Diff.After["dataset_query"])
+			if beforeNative && afterNative && before.Query != after.Query {
+				entry["sql_diff"] = lineDiff(before.Query, after.Query)
+			}
+		}
+		listed = append(listed, entry)
+	}
+
+	return jsonResult(map[string]interface{}{
+		"card_id":   cardID,
+		"count":     len(listed),
+		"revisions": listed,
+	})
+}
+
+func (r *toolRegistry) handleRevertCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	revisionID, err := request.RequireInt("revision_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var revisions []Revision
+	if err := client.Get(ctx, fmt.Sprintf("/api/revision?entity=card&id=%d", cardID), &revisions); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch revisions of card %d: %v", cardID, err)), nil
+	}
+	index := -1
+	for i, revision := range revisions {
+		if revision.ID == revisionID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("revision %d is not a revision of card %d; list them with card-revisions", revisionID, cardID)), nil
+	}
+
+	action := fmt.Sprintf("revert card %d (%s) to revision %d", card.ID, card.Name, revisionID)
+	if !confirmed(request) {
+		revision := revisions[index]
+		changes := map[string]interface{}{
+			"revision_id": revision.ID,
+			"timestamp":   revision.Timestamp,
+			"description": revision.Description,
+		}
+		if revision.User != nil {
+			changes["user"] = revision.User.CommonName
+		}
+		// The SQL as of the revision is the one the closest newer revision
+		// changing the query started from; revisions are listed newest first
+		if current, ok := nativeQueryOf(card.DatasetQuery); ok {
+			for i := index - 1; i >= 0; i-- {
+				if revisions[i].Diff == nil {
+					continue
+				}
+				if restored, ok := nativeQueryOf(revisions[i].Diff.Before["dataset_query"]); ok {
+					if restored.Query != current.Query {
+						changes["sql_diff"] = lineDiff(current.Query, restored.Query)
+					}
+					break
+				}
+			}
+		}
+		return previewResult(action, changes)
+	}
+
+	body := map[string]interface{}{"entity": "card", "id": cardID, "revision_id": revisionID}
+	if err := client.Post(ctx, "/api/revision/revert", body, nil); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to revert card %d to revision %d: %v", cardID, revisionID, err)), nil
+	}
+	result := map[string]interface{}{"applied": true, "action": action, "card_id": cardID, "reverted_to": revisionID}
+	if card, err := getCard(ctx, client, cardID); err == nil {
+		result["name"] = card.Name
+		if native, ok := nativeQueryOf(card.DatasetQuery); ok {
+			result["sql"] = native.Query
+		}
+	}
+	return jsonResult(result)
+}
+
+// archiveCardHandler returns the handler archiving or restoring a card
+func (r *toolRegistry) archiveCardHandler(archived bool) toolHandler {
+	return func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cardID, err := request.RequireInt("card_id")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		card, err := getCard(ctx, client, cardID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+		}
+		if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+			r.stats.recordPolicy(ctx, policyName(err))
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if card.Archived == archived {
+			state := "not archived"
+			if archived {
+				state = "already archived"
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("card %d (%s) is %s", card.ID, card.Name, state)), nil
+		}
+
+		var updated Card
+		if err := client.Put(ctx, fmt.Sprintf("/api/card/%d", cardID), map[string]interface{}{"archived": archived}, &updated); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to update card %d: %v", cardID, err)), nil
+		}
+		return jsonResult(map[string]interface{}{
+			"id":            updated.ID,
+			"name":          updated.Name,
+			"archived":      updated.Archived,
+			"collection_id": updated.CollectionID,
+		})
+	}
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"unchanged", "SELECT 1", "SELECT 1", "  SELECT 1\n"},
+		{"replaced line", "SELECT a\nFROM t", "SELECT b\nFROM t", "- SELECT a\n+ SELECT b\n  FROM t\n"},
+		{"added line", "SELECT a\nFROM t", "SELECT a\nFROM t\nLIMIT 10", "  SELECT a\n  FROM t\n+ LIMIT 10\n"},
+		{"removed line", "SELECT a\nFROM t\nWHERE x = 1", "SELECT a\nFROM t", "  SELECT a\n  FROM t\n- WHERE x = 1\n"},
+		{"inserted in the middle", "SELECT a\nFROM t", "SELECT a\n, b\nFROM t", "  SELECT a\n+ , b\n  FROM t\n"},
+		{"from empty", "", "SELECT 1", "- \n+ SELECT 1\n"},
+		{"completely different", "a\nb", "c\nd", "- a\n- b\n+ c\n+ d\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineDiff(tt.from, tt.to); got != tt.want {
+				t.Errorf("lineDiff(%q, %q) =\n%s\nwant\n%s", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// cardResponses are the answers of a fake Metabase holding SQL question 5 of database 1
+func cardResponses() map[string]interface{} {
+	return map[string]interface{}{
+		"GET /api/card/5": map[string]interface{}{
+			"id":          5,
+			"name":        "Orders",
+			"database_id": 1,
+			"display":     "table",
+			"dataset_query": map[string]interface{}{
+				"type":     "native",
+				"database": 1,
+				"native":   map[string]interface{}{"query": "SELECT id\nFROM finance.orders"},
+			},
+		},
+		"PUT /api/card/5": map[string]interface{}{"id": 5, "name": "Orders"},
+	}
+}
+
+// newCardTestClient returns a fake Metabase holding SQL question 5 of database 1
+func newCardTestClient(t *testing.T) (*MetabaseClient, *fakeMetabase) {
+	return newFakeMetabase(t, cardResponses())
+}
+
+// newCardRegistry returns a registry serving the card and collection tools
+// from a fake Metabase answering with responses
+func newCardRegistry(t *testing.T, guardrails Guardrails, responses map[string]interface{}) (*toolRegistry, *fakeMetabase, *bytes.Buffer) {
+	var audit bytes.Buffer
+	r := newTestRegistry(guardrails, &audit)
+	r.views = newViewStore()
+	client, fake := newFakeMetabase(t, responses)
+	r.config.Profiles["default"].client = client
+	registerCardTools(r)
+	registerCollectionTools(r)
+	return r, fake, &audit
+}
+
+func TestCreateCard(t *testing.T) {
+	responses := map[string]interface{}{
+		"POST /api/card": map[string]interface{}{"id": 7, "name": "Revenue", "database_id": 1},
+	}
+	arguments := map[string]interface{}{"name": "Revenue", "query": "SELECT sum(total) FROM finance.orders"}
+
+	r, fake, audit := newCardRegistry(t, Guardrails{}, responses)
+	response := callServerTool(t, r, "create-card", arguments)
+	posts := fake.sent("POST")
+	if len(posts) != 1 {
+		t.Fatalf("create-card sent %d cards, want 1: %s", len(posts), response)
+	}
+	datasetQuery, _ := posts[0].Body["dataset_query"].(map[string]interface{})
+	native, _ := datasetQuery["native"].(map[string]interface{})
+	if posts[0].Body["name"] != "Revenue" || datasetQuery["database"] != float64(1) || native["query"] != arguments["query"] {
+		t.Errorf("created card = %v", posts[0].Body)
+	}
+	if !strings.Contains(audit.String(), `"outcome":"applied"`) {
+		t.Errorf("audit log = %q, want the creation", audit.String())
+	}
+
+	r, fake, audit = newCardRegistry(t, Guardrails{ReadOnly: true}, responses)
+	response = callServerTool(t, r, "create-card", arguments)
+	if !strings.Contains(response, "is read-only") || len(fake.sent("POST")) != 0 {
+		t.Errorf("create-card on a read-only profile = %s", response)
+	}
+	if !strings.Contains(audit.String(), `"outcome":"error"`) {
+		t.Errorf("audit log = %q, want the refusal", audit.String())
+	}
+}
+
+func TestUpdateCardPreview(t *testing.T) {
+	client, fake := newCardTestClient(t)
+	r := &toolRegistry{views: newViewStore(), stats: newSessionStatsStore()}
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+
+	result := decodeResult(t, callTool(t, ctx, r.handleUpdateCard, client, map[string]interface{}{
+		"card_id": 5,
+		"query":   "SELECT id, total\nFROM finance.orders",
+	}))
+	if result["applied"] != false {
+		t.Errorf("applied = %v, want false", result["applied"])
+	}
+	changes, _ := result["changes"].(map[string]interface{})
+	query, _ := changes["query"].(map[string]interface{})
+	if want := "- SELECT id\n+ SELECT id, total\n  FROM finance.orders\n"; query["diff"] != want {
+		t.Errorf("diff = %q, want %q", query["diff"], want)
+	}
+	if puts := fake.sent("PUT"); len(puts) != 0 {
+		t.Errorf("preview sent %d updates", len(puts))
+	}
+
+	callTool(t, ctx, r.handleUpdateCard, client, map[string]interface{}{
+		"card_id": 5,
+		"query":   "SELECT id, total\nFROM finance.orders",
+		"confirm": true,
+	})
+	puts := fake.sent("PUT")
+	if len(puts) != 1 {
+		t.Fatalf("confirmed update sent %d updates, want 1", len(puts))
+	}
+	datasetQuery, _ := puts[0].Body["dataset_query"].(map[string]interface{})
+	native, _ := datasetQuery["native"].(map[string]interface{})
+	if native["query"] != "SELECT id, total\nFROM finance.orders" {
+		t.Errorf("saved query = %v", native["query"])
+	}
+}
+
+func TestUpdateCardRefusals(t *testing.T) {
+	client, fake := newCardTestClient(t)
+	r := &toolRegistry{views: newViewStore(), stats: newSessionStatsStore()}
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		args map[string]interface{}
+		want string
+	}{
+		{"no changes", ctx, map[string]interface{}{"name": "Orders"}, "nothing to update"},
+		{"several statements", ctx, map[string]interface{}{"query": "SELECT 1; SELECT 2"}, "single statement"},
+		{"other database", withClientAccess(ctx, &ClientAccess{Name: "sales", Databases: []int{2}}),
+			map[string]interface{}{"name": "Renamed"}, "may not query database 1"},
+		{"query into other schema", withClientAccess(ctx, &ClientAccess{Name: "finance", Schemas: []string{"finance"}}),
+			map[string]interface{}{"query": "SELECT * FROM hr.salaries"}, `may not read schema "hr"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args["card_id"] = 5
+			tt.args["confirm"] = true
+			result := callTool(t, tt.ctx, r.handleUpdateCard, client, tt.args)
+			if !result.IsError {
+				t.Fatalf("result is not an error")
+			}
+			if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, tt.want) {
+				t.Errorf("error = %q, want it to mention %q", text, tt.want)
+			}
+		})
+	}
+	if puts := fake.sent("PUT"); len(puts) != 0 {
+		t.Errorf("refused updates sent %d requests", len(puts))
+	}
+}
+
+func TestArchiveCard(t *testing.T) {
+	responses := cardResponses()
+	responses["PUT /api/card/5"] = map[string]interface{}{"id": 5, "name": "Orders", "archived": true}
+
+	tests := []struct {
+		name       string
+		tool       string
+		guardrails Guardrails
+		want       string
+		archived   interface{}
+	}{
+		{"archive", "archive-card", Guardrails{}, `\"archived\": true`, true},
+		{"restore a card in use", "unarchive-card", Guardrails{}, "is not archived", nil},
+		{"read-only profile", "archive-card", Guardrails{ReadOnly: true}, "is read-only", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, fake, audit := newCardRegistry(t, tt.guardrails, responses)
+			response := callServerTool(t, r, tt.tool, map[string]interface{}{"card_id": 5})
+			if !strings.Contains(response, tt.want) {
+				t.Errorf("%s = %s, want %s", tt.tool, response, tt.want)
+			}
+			puts := fake.sent("PUT")
+			if tt.archived == nil {
+				if len(puts) != 0 {
+					t.Errorf("%s sent %d updates", tt.tool, len(puts))
+				}
+			} else if len(puts) != 1 || puts[0].Body["archived"] != tt.archived {
+				t.Errorf("%s sent %v, want archived %v", tt.tool, puts, tt.archived)
+			}
+			if !strings.Contains(audit.String(), `"tool":"`+tt.tool+`"`) {
+				t.Errorf("audit log = %q, want the %s call", audit.String(), tt.tool)
+			}
+		})
+	}
+}
+
+func TestRevertCard(t *testing.T) {
+	responses := cardResponses()
+	// Revisions are listed newest first; revision 12 changed the query
+	responses["GET /api/revision"] = []interface{}{
+		map[string]interface{}{
+			"id": 12,
+			"diff": map[string]interface{}{
+				"before": map[string]interface{}{"dataset_query": map[string]interface{}{"type": "native", "native": map[string]interface{}{"query": "SELECT *\nFROM finance.orders"}}},
+				"after":  map[string]interface{}{"dataset_query": map[string]interface{}{"type": "native", "native": map[string]interface{}{"query": "SELECT id\nFROM finance.orders"}}},
+			},
+		},
+		map[string]interface{}{"id": 11, "is_creation": true},
+	}
+	responses["POST /api/revision/revert"] = map[string]interface{}{}
+
+	tests := []struct {
+		name       string
+		guardrails Guardrails
+		arguments  map[string]interface{}
+		want       string
+		outcome    string
+		reverted   bool
+	}{
+		{"other card's revision", Guardrails{}, map[string]interface{}{"revision_id": 99}, "is not a revision of card 5", "error", false},
+		{"preview", Guardrails{}, map[string]interface{}{"revision_id": 11}, `- SELECT id\\n+ SELECT *\\n  FROM finance.orders`, "previewed", false},
+		{"confirmed", Guardrails{}, map[string]interface{}{"revision_id": 11, "confirm": true}, `\"reverted_to\": 11`, "applied", true},
+		{"read-only profile", Guardrails{ReadOnly: true}, map[string]interface{}{"revision_id": 11, "confirm": true}, "is read-only", "error", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, fake, audit := newCardRegistry(t, tt.guardrails, responses)
+			tt.arguments["card_id"] = 5
+			response := callServerTool(t, r, "revert-card", tt.arguments)
+			if !strings.Contains(response, tt.want) {
+				t.Errorf("revert-card = %s, want %s", response, tt.want)
+			}
+			posts := fake.sent("POST")
+			if tt.reverted != (len(posts) == 1) {
+				t.Errorf("revert-card sent %d reverts, want reverted %v", len(posts), tt.reverted)
+			}
+			if tt.reverted && (posts[0].Body["entity"] != "card" || posts[0].Body["id"] != float64(5) || posts[0].Body["revision_id"] != float64(11)) {
+				t.Errorf("revert = %v", posts[0].Body)
+			}
+			if !strings.Contains(audit.String(), `"outcome":"`+tt.outcome+`"`) {
+				t.Errorf("audit log = %q, want outcome %s", audit.String(), tt.outcome)
+			}
+		})
+	}
+}
+
+func TestDuplicateCard(t *testing.T) {
+	responses := cardResponses()
+	responses["GET /api/card/5"].(map[string]interface{})["visualization_settings"] = map[string]interface{}{"table.pivot": true}
+	responses["POST /api/card"] = map[string]interface{}{"id": 6, "name": "Orders (copy)"}
+
+	filtered := cardResponses()
+	filtered["GET /api/card/5"].(map[string]interface{})["dataset_query"] = map[string]interface{}{
+		"type":     "native",
+		"database": 1,
+		"native": map[string]interface{}{
+			"query":         "SELECT id FROM finance.orders WHERE {{created}}",
+			"template-tags": map[string]interface{}{"created": map[string]interface{}{"type": "dimension", "dimension": []interface{}{"field", 101, nil}}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		guardrails Guardrails
+		responses  map[string]interface{}
+		arguments  map[string]interface{}
+		want       string
+		database   interface{}
+	}{
+		{"copy", Guardrails{}, responses, map[string]interface{}{}, `\"copied_from\": 5`, float64(1)},
+		{"other database", Guardrails{}, responses, map[string]interface{}{"database_id": 2}, `\"copied_from\": 5`, float64(2)},
+		{"field filter to other database", Guardrails{}, filtered, map[string]interface{}{"database_id": 2}, "cannot be pointed at another database", nil},
+		{"read-only profile", Guardrails{ReadOnly: true}, responses, map[string]interface{}{}, "is read-only", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, fake, _ := newCardRegistry(t, tt.guardrails, tt.responses)
+			tt.arguments["card_id"] = 5
+			response := callServerTool(t, r, "duplicate-card", tt.arguments)
+			if !strings.Contains(response, tt.want) {
+				t.Errorf("duplicate-card = %s, want %s", response, tt.want)
+			}
+			posts := fake.sent("POST")
+			if tt.database == nil {
+				if len(posts) != 0 {
+					t.Errorf("duplicate-card sent %d cards", len(posts))
+				}
+				return
+			}
+			if len(posts) != 1 {
+				t.Fatalf("duplicate-card sent %d cards, want 1", len(posts))
+			}
+			datasetQuery, _ := posts[0].Body["dataset_query"].(map[string]interface{})
+			settings, _ := posts[0].Body["visualization_settings"].(map[string]interface{})
+			if posts[0].Body["name"] != "Orders (copy)" || datasetQuery["database"] != tt.database || settings["table.pivot"] != true {
+				t.Errorf("copy = %v", posts[0].Body)
+			}
+		})
+	}
+}
+
+func TestMoveCard(t *testing.T) {
+	responses := cardResponses()
+	responses["GET /api/collection"] = []interface{}{
+		map[string]interface{}{"id": "root", "name": "Our analytics"},
+		map[string]interface{}{"id": 3, "name": "Finance", "location": "/"},
+		map[string]interface{}{"id": 4, "name": "Reports", "location": "/3/"},
+		map[string]interface{}{"id": 7, "name": "Reports", "location": "/"},
+	}
+
+	tests := []struct {
+		name       string
+		guardrails Guardrails
+		collection string
+		want       string
+		moved      interface{}
+	}{
+		{"by path", Guardrails{}, "Finance/Reports", `\"collection\": \"Finance/Reports\"`, float64(4)},
+		{"by ID", Guardrails{}, "7", `\"collection\": \"Reports\"`, float64(7)},
+		{"ambiguous name", Guardrails{}, "Reports", "is ambiguous", nil},
+		{"same collection", Guardrails{}, "root", "is already in", nil},
+		{"read-only profile", Guardrails{ReadOnly: true}, "Finance/Reports", "is read-only", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, fake, _ := newCardRegistry(t, tt.guardrails, responses)
+			response := callServerTool(t, r, "move-card", map[string]interface{}{"card_id": 5, "collection": tt.collection})
+			if !strings.Contains(response, tt.want) {
+				t.Errorf("move-card = %s, want %s", response, tt.want)
+			}
+			puts := fake.sent("PUT")
+			if tt.moved == nil {
+				if len(puts) != 0 {
+					t.Errorf("move-card sent %d updates", len(puts))
+				}
+			} else if len(puts) != 1 || puts[0].Body["collection_id"] != tt.moved {
+				t.Errorf("move-card sent %v, want collection %v", puts, tt.moved)
+			}
+		})
+	}
+}
+
+// listedCards are the cards of a fake Metabase listing saved questions
+func listedCards() []interface{} {
+	ada := map[string]interface{}{"id": 7, "common_name": "Ada Lovelace", "email": "ada@example.com"}
+	grace := map[string]interface{}{"id": 8, "common_name": "Grace Hopper", "email": "grace@example.com"}
+	return []interface{}{
+		map[string]interface{}{"id": 1, "name": "Monthly revenue", "type": "question", "query_type": "native", "database_id": 1, "collection_id": 3, "creator_id": 7, "creator": ada},
+		map[string]interface{}{"id": 2, "name": "Revenue model", "description": "Orders joined to payments", "type": "model", "query_type": "query", "database_id": 1, "creator_id": 8, "creator": grace},
+		map[string]interface{}{"id": 3, "name": "Active users", "type": "metric", "query_type": "query", "database_id": 2, "collection_id": 3, "creator_id": 7, "creator": ada},
+		map[string]interface{}{"id": 4, "name": "Old revenue", "type": "question", "database_id": 1, "archived": true},
+	}
+}
+
+func TestListCards(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/card": listedCards()})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"all", context.Background(), nil, "[1 2 3]"},
+		{"name", context.Background(), map[string]interface{}{"name": "REVENUE"}, "[1 2]"},
+		{"root collection", context.Background(), map[string]interface{}{"collection_id": 0}, "[2]"},
+		{"collection", context.Background(), map[string]interface{}{"collection_id": 3}, "[1 3]"},
+		{"creator name", context.Background(), map[string]interface{}{"creator": "lovelace"}, "[1 3]"},
+		{"creator email", context.Background(), map[string]interface{}{"creator": "Grace@Example.com"}, "[2]"},
+		{"creator ID", context.Background(), map[string]interface{}{"creator": "7"}, "[1 3]"},
+		{"type", context.Background(), map[string]interface{}{"type": "metric"}, "[3]"},
+		{"database", context.Background(), map[string]interface{}{"database_id": 1}, "[1 2]"},
+		{"denied database", withProfile(context.Background(), &Profile{Name: "default", DeniedDatabases: []int{2}}), nil, "[1 2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeResult(t, callTool(t, tt.ctx, handleListCards, client, tt.arguments))
+			var ids []interface{}
+			for _, row := range result["rows"].([]interface{}) {
+				ids = append(ids, row.([]interface{})[0])
+			}
+			if got := fmt.Sprint(ids); got != tt.want {
+				t.Errorf("cards = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	result := decodeResult(t, callTool(t, context.Background(), handleListCards, client, map[string]interface{}{"limit": 1}))
+	if result["matches"] != 3.0 || result["truncated"] != true || len(result["rows"].([]interface{})) != 1 {
+		t.Errorf("result = %v, want 1 of 3 cards", result)
+	}
+}
+
+func TestRunCard(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, nil)
+	for key, response := range cardResponses() {
+		fake.responses[key] = response
+	}
+	fake.responses["POST /api/card/5/query"] = datasetResponse(2)
+
+	result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleRunCard, client, map[string]interface{}{"card_id": 5}))
+	if card, _ := result["card"].(map[string]interface{}); card["name"] != "Orders" || card["verified"] != false {
+		t.Errorf("card = %v, want question 5", result["card"])
+	}
+	if result["row_count"] != 2.0 || result["query_sent"] != nil {
+		t.Errorf("result = %v, want the card's 2 rows", result)
+	}
+	if sent := fake.sent("POST"); len(sent) != 1 || sent[0].Path != "/api/card/5/query" {
+		t.Errorf("sent %v, want the card query", sent)
+	}
+
+	// Cards reading tables outside the client's schemas are refused
+	ctx := withClientAccess(queryContext(Guardrails{}), &ClientAccess{Name: "hr", Schemas: []string{"hr"}})
+	refused := callTool(t, ctx, r.handleRunCard, client, map[string]interface{}{"card_id": 5})
+	if !refused.IsError || !strings.Contains(resultText(refused), "client hr may not") {
+		t.Errorf("refused card = %s, want an access error", resultText(refused))
+	}
+	missing := callTool(t, queryContext(Guardrails{}), r.handleRunCard, client, map[string]interface{}{"card_id": 9})
+	if !missing.IsError || !strings.Contains(resultText(missing), "failed to fetch card 9") {
+		t.Errorf("missing card = %s, want an error", resultText(missing))
+	}
+	if sent := fake.sent("POST"); len(sent) != 1 {
+		t.Errorf("refused cards sent %d queries", len(sent)-1)
+	}
+}
+
+func TestRunCardParameters(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, nil)
+	fake.responses["GET /api/card/5"] = map[string]interface{}{
+		"id": 5, "name": "Orders", "database_id": 1,
+		"dataset_query": map[string]interface{}{"type": "native", "database": 1, "native": map[string]interface{}{
+			"query": "SELECT id FROM finance.orders WHERE status = {{status}} AND {{created}} AND customer_id = {{customer}}",
+		}},
+		"parameters": []interface{}{
+			map[string]interface{}{"id": "p1", "name": "Status", "slug": "status", "type": "string/=", "target": []interface{}{"variable", []interface{}{"template-tag", "status"}}},
+			map[string]interface{}{"id": "p2", "name": "Created", "slug": "created", "type": "date/range", "required": true},
+			map[string]interface{}{"id": "p3", "name": "Customer", "slug": "customer", "type": "number/=", "required": true, "default": 1},
+		},
+	}
+	fake.responses["POST /api/card/5/query"] = datasetResponse(1)
+	ctx := queryContext(Guardrails{})
+
+	// Values are keyed by slug, name or ID
+	result := decodeResult(t, callTool(t, ctx, r.handleRunCard, client, map[string]interface{}{
+		"card_id":    5,
+		"parameters": map[string]interface{}{"Status": []interface{}{"paid", "shipped"}, "p2": "2024-01-01~2024-01-31"},
+	}))
+	if result["parameters"] == nil {
+		t.Errorf("result = %v, want the parameter values echoed", result)
+	}
+	sent := fake.sent("POST")
+	if len(sent) != 1 {
+		t.Fatalf("sent %d queries, want 1", len(sent))
+	}
+	entries := make(map[string]string)
+	for _, entry := range sent[0].Body["parameters"].([]interface{}) {
+		entry := entry.(map[string]interface{})
+		entries[entry["id"].(string)] = fmt.Sprintf("%v %v %v", entry["type"], entry["target"], entry["value"])
+	}
+	want := map[string]string{
+		"p1": "string/= [variable [template-tag status]] [paid shipped]",
+		"p2": "date/range <nil> 2024-01-01~2024-01-31",
+	}
+	if fmt.Sprint(entries) != fmt.Sprint(want) {
+		t.Errorf("parameters = %v, want %v", entries, want)
+	}
+
+	tests := []struct {
+		name       string
+		parameters map[string]interface{}
+		want       string
+	}{
+		{"unknown", map[string]interface{}{"created": "2024-01-01~2024-01-31", "region": "EU"}, `unknown parameter "region"; the card declares: created (date/range), customer (number/=), status (string/=)`},
+		{"missing required", map[string]interface{}{"status": "paid"}, `parameter "created" is required`},
+		{"bad range", map[string]interface{}{"created": "January"}, `parameter "created" takes a range such as 2024-01-01~2024-01-31, got January`},
+		{"bad number", map[string]interface{}{"created": "2024-01-01~2024-01-31", "customer": "seven"}, `parameter "customer" takes numbers, got seven`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, ctx, r.handleRunCard, client, map[string]interface{}{"card_id": 5, "parameters": tt.parameters})
+			if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+				t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+			}
+		})
+	}
+	if sent := fake.sent("POST"); len(sent) != 1 {
+		t.Errorf("rejected parameters sent %d queries", len(sent)-1)
+	}
+}
+
+func TestGetCardDefinition(t *testing.T) {
+	responses := definitionResponses()
+	responses["/api/card/5"] = map[string]interface{}{
+		"id": 5, "name": "Orders by status", "type": "question", "display": "bar", "database_id": 1, "query_type": "native",
+		"dataset_query": map[string]interface{}{"type": "native", "database": 1, "native": map[string]interface{}{
+			"query":         "SELECT status, count(*) FROM finance.orders WHERE {{created}} GROUP BY status",
+			"template-tags": map[string]interface{}{"created": map[string]interface{}{"name": "created", "type": "dimension"}},
+		}},
+		"parameters":      []interface{}{map[string]interface{}{"id": "p1", "name": "Created", "slug": "created", "type": "date/all-options"}},
+		"result_metadata": []interface{}{map[string]interface{}{"name": "status", "display_name": "Status", "base_type": "type/Text", "semantic_type": "type/Category"}},
+	}
+	responses["/api/card/6"] = map[string]interface{}{
+		"id": 6, "name": "Paid orders", "type": "question", "database_id": 1, "table_id": 3, "query_type": "query",
+		"dataset_query": map[string]interface{}{"type": "query", "database": 1, "query": map[string]interface{}{
+			"source-table": 3,
+			"filter":       []interface{}{"=", []interface{}{"field", 12, nil}, "paid"},
+		}},
+	}
+	responses["/api/card/7"] = map[string]interface{}{
+		"id": 7, "name": "Headcount", "database_id": 2, "table_id": 4, "query_type": "query",
+		"dataset_query": map[string]interface{}{"type": "query", "database": 2, "query": map[string]interface{}{"source-table": 4}},
+	}
+	client := newTestClient(t, responses)
+
+	native := decodeResult(t, callTool(t, context.Background(), handleGetCardDefinition, client, map[string]interface{}{"card_id": 5}))
+	if !strings.HasPrefix(native["sql"].(string), "SELECT status") || native["template_tags"] == nil || native["mbql"] != nil {
+		t.Errorf("definition = %v, want the SQL and template tags", native)
+	}
+	if got := fmt.Sprint(native["parameters"], native["result_columns"]); got != "[map[default:<nil> name:Created required:false slug:created target:<nil> type:date/all-options]] [map[description:<nil> display_name:Status name:status semantic_type:Category type:Text]]" {
+		t.Errorf("parameters and columns = %s", got)
+	}
+
+	structured := decodeResult(t, callTool(t, context.Background(), handleGetCardDefinition, client, map[string]interface{}{"card_id": 6}))
+	if structured["table"] != "finance.orders" || fmt.Sprint(structured["fields"]) != "map[12:status]" || structured["mbql"] == nil || structured["sql"] != nil {
+		t.Errorf("definition = %v, want the MBQL with its table and columns", structured)
+	}
+
+	// Cards reading tables outside the client's schemas are refused
+	refused := callTool(t, financeContext(), handleGetCardDefinition, client, map[string]interface{}{"card_id": 7})
+	if !refused.IsError || !strings.Contains(resultText(refused), "card 7 reads a table outside the allowed schemas") {
+		t.Errorf("refused card = %s, want an access error", resultText(refused))
+	}
+}
+
+func TestGetCardVisualization(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{
+		"/api/card/5": map[string]interface{}{
+			"id": 5, "name": "Revenue by month", "display": "line", "database_id": 1,
+			"visualization_settings": map[string]interface{}{
+				"graph.dimensions":        []interface{}{"created_at"},
+				"graph.metrics":           []interface{}{"count", "total"},
+				"graph.y_axis.title_text": "Revenue",
+				"graph.show_values":       true,
+				"column_settings": map[string]interface{}{
+					`["ref",["field",12,null]]`: map[string]interface{}{"currency": "EUR"},
+					`["name","count"]`:          map[string]interface{}{"suffix": " orders"},
+				},
+			},
+			"result_metadata": []interface{}{map[string]interface{}{"id": 12, "name": "total"}},
+		},
+		"/api/card/6": map[string]interface{}{"id": 6, "name": "Orders", "display": "bar", "database_id": 2},
+	})
+
+	result := decodeResult(t, callTool(t, context.Background(), handleGetCardVisualization, client, map[string]interface{}{"card_id": 5}))
+	want := map[string]string{
+		"columns":           "map[dimensions:[created_at] metrics:[count total]]",
+		"axes":              "map[graph.y_axis.title_text:Revenue]",
+		"column_formatting": "map[count:map[suffix: orders] total:map[currency:EUR]]",
+		"settings":          "map[graph.show_values:true]",
+		"note":              "<nil>",
+	}
+	for key, want := range want {
+		if got := fmt.Sprint(result[key]); got != want {
+			t.Errorf("%s = %s, want %s", key, got, want)
+		}
+	}
+
+	// Charts without named columns are noted; cards of denied databases are refused
+	bar := decodeResult(t, callTool(t, context.Background(), handleGetCardVisualization, client, map[string]interface{}{"card_id": 6}))
+	if bar["display"] != "bar" || bar["note"] == nil || bar["columns"] != nil {
+		t.Errorf("result = %v, want a note on the chosen columns", bar)
+	}
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DeniedDatabases: []int{2}})
+	if refused := callTool(t, ctx, handleGetCardVisualization, client, map[string]interface{}{"card_id": 6}); !refused.IsError {
+		t.Errorf("card of a denied database = %s, want an error", resultText(refused))
+	}
+}
+
+func TestSearchCards(t *testing.T) {
+	native := func(query string) map[string]interface{} {
+		return map[string]interface{}{"type": "native", "database": 1, "native": map[string]interface{}{"query": query}}
+	}
+	client := newTestClient(t, map[string]interface{}{"/api/card": []interface{}{
+		map[string]interface{}{"id": 1, "name": "Churn by month", "type": "question", "database_id": 1},
+		map[string]interface{}{"id": 2, "name": "Retention", "description": "Monthly churn of customers", "type": "question", "database_id": 1},
+		map[string]interface{}{"id": 3, "name": "Cancellations", "type": "question", "database_id": 1,
+			"dataset_query": native("SELECT customer_id\nFROM subscriptions\nWHERE status = 'churned'")},
+		map[string]interface{}{"id": 4, "name": "Churn rate", "type": "metric", "database_id": 1,
+			"moderation_reviews": []interface{}{map[string]interface{}{"most_recent": true, "status": "verified"}}},
+		map[string]interface{}{"id": 5, "name": "Old churn", "type": "question", "database_id": 1, "archived": true},
+		map[string]interface{}{"id": 6, "name": "Churned accounts", "type": "model", "database_id": 2},
+	}})
+
+	// Name matches rank first, verified cards first among them
+	result := decodeResult(t, callTool(t, context.Background(), handleSearchCards, client, map[string]interface{}{"keyword": "Churn"}))
+	var got []string
+	for _, row := range result["rows"].([]interface{}) {
+		row := row.([]interface{})
+		got = append(got, fmt.Sprintf("%v %v %v", row[0], row[6], row[7]))
+	}
+	want := []string{
+		"4 name <nil>",
+		"1 name <nil>",
+		"6 name <nil>",
+		"2 description <nil>",
+		"3 sql WHERE status = 'churned'",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("matches = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"every word", map[string]interface{}{"keyword": "churn customers"}, "[2]"},
+		{"words across fields", map[string]interface{}{"keyword": "cancellations subscriptions"}, "[3]"},
+		{"type", map[string]interface{}{"keyword": "churn", "type": "model"}, "[6]"},
+		{"database", map[string]interface{}{"keyword": "churn", "database_id": 2}, "[6]"},
+		{"limit", map[string]interface{}{"keyword": "churn", "limit": 2}, "[4 1]"},
+		{"no match", map[string]interface{}{"keyword": "refunds"}, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeResult(t, callTool(t, context.Background(), handleSearchCards, client, tt.arguments))
+			ids := make([]interface{}, 0)
+			for _, row := range result["rows"].([]interface{}) {
+				ids = append(ids, row.([]interface{})[0])
+			}
+			if got := fmt.Sprint(ids); got != tt.want {
+				t.Errorf("cards = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	result = decodeResult(t, callTool(t, context.Background(), handleSearchCards, client, map[string]interface{}{"keyword": "churn", "limit": 2}))
+	if result["matches"] != 5.0 || result["truncated"] != true {
+		t.Errorf("result = %v, want 2 of 5 matches", result)
+	}
+	result = decodeResult(t, callTool(t, context.Background(), handleSearchCards, client, map[string]interface{}{"keyword": "refunds"}))
+	if result["matches"] != 0.0 || result["message"] == nil {
+		t.Errorf("result = %v, want no matches with a hint", result)
+	}
+}
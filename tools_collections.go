@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// pinnedItem is a card or dashboard as far as pinning is concerned
+type pinnedItem struct {
+	ID                 int    `json:"id"`
+	Name               string `json:"name"`
+	CollectionID       *int   `json:"collection_id"`
+	CollectionPosition *int   `json:"collection_position"`
+}
+
+// registerCollectionTools adds the tools curating collections
+func registerCollectionTools(r *toolRegistry) {
+	r.addWrite(mcp.NewTool(
+		"pin-item",
+		mcp.WithDescription("Pin a saved question or dashboard in its collection, so it shows at the top, e.g. to pin the weekly KPIs dashboard. Give the item by ID or name"),
+		mcp.WithString(
+			"item_type",
+			mcp.Required(),
+			mcp.Enum("card", "dashboard"),
+			mcp.Description("Whether the item is a card or a dashboard"),
+		),
+		mcp.WithNumber(
+			"item_id",
+			mcp.Description("ID of the item"),
+		),
+		mcp.WithString(
+			"name",
+			mcp.Description("Name of the item, an alternative to item_id"),
+		),
+		mcp.WithNumber(
+			"position",
+			mcp.Description("Position among the pinned items of the collection, from 1 (default 1, the first); items pinned after it shift down"),
+		),
+	), r.pinHandler(true))
+
+	r.addWrite(mcp.NewTool(
+		"unpin-item",
+		mcp.WithDescription("Unpin a saved question or dashboard from the top of its collection. Give the item by ID or name"),
+		mcp.WithString(
+			"item_type",
+			mcp.Required(),
+			mcp.Enum("card", "dashboard"),
+			mcp.Description("Whether the item is a card or a dashboard"),
+		),
+		mcp.WithNumber(
+			"item_id",
+			mcp.Description("ID of the item"),
+		),
+		mcp.WithString(
+			"name",
+			mcp.Description("Name of the item, an alternative to item_id"),
+		),
+	), r.pinHandler(false))
+}
+
+// pinHandler returns the handler pinning or unpinning an item
+func (r *toolRegistry) pinHandler(pin bool) toolHandler {
+	return func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		itemType := request.GetString("item_type", "")
+		if itemType != "card" && itemType != "dashboard" {
+			return mcp.NewToolResultError("item_type is required and must be card or dashboard"), nil
+		}
+		itemID := request.GetInt("item_id", 0)
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if itemID == 0 && name == "" {
+			return mcp.NewToolResultError("give the item's item_id or name"), nil
+		}
+		position := request.GetInt("position", 1)
+		if position < 1 {
+			return mcp.NewToolResultError("position must be 1 or more"), nil
+		}
+
+		if itemID == 0 {
+			found, err := findItemByName(ctx, client, itemType, name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			itemID = found
+		}
+		item, err := getPinnedItem(ctx, client, itemType, itemID)
+		if err != nil {
+			if errors.Is(err, errAccessDenied) {
+				r.stats.recordPolicy(ctx, policyName(err))
+			}
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if !pin && item.CollectionPosition == nil {
+			return mcp.NewToolResultError(fmt.Sprintf("%s %d (%s) is not pinned", itemType, item.ID, item.Name)), nil
+		}
+		if pin && item.CollectionPosition != nil && *item.CollectionPosition == position {
+			return mcp.NewToolResultError(fmt.Sprintf("%s %d (%s) is already pinned at position %d", itemType, item.ID, item.Name, position)), nil
+		}
+
+		var update interface{}
+		if pin {
+			update = position
+		}
+		var updated pinnedItem
+		if err := client.Put(ctx, fmt.Sprintf("/api/%s/%d", itemType, itemID), map[string]interface{}{"collection_position": update}, &updated); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to update %s %d: %v", itemType, itemID, err)), nil
+		}
+		return jsonResult(map[string]interface{}{
+			"item_type":     itemType,
+			"id":            item.ID,
+			"name":          item.Name,
+			"collection_id": item.CollectionID,
+			"pinned":        pin,
+			"position":      updated.CollectionPosition,
+		})
+	}
+}
+
+// getPinnedItem fetches a card or dashboard, refusing cards on databases the
+// caller may not query and dashboards showing such cards
+func getPinnedItem(ctx context.Context, client *MetabaseClient, itemType string, itemID int) (pinnedItem, error) {
+	if itemType == "card" {
+		card, err := getCard(ctx, client, itemID)
+		if err != nil {
+			return pinnedItem{}, fmt.Errorf("failed to fetch card %d: %v", itemID, err)
+		}
+		if err := checkDatabaseAccess(ctx, card.DatabaseID); err != nil {
+			return pinnedItem{}, err
+		}
+		return pinnedItem{ID: card.ID, Name: card.Name, CollectionID: card.CollectionID, CollectionPosition: card.CollectionPosition}, nil
+	}
+
+	dashboard, err := getDashboard(ctx, client, itemID)
+	if err != nil {
+		return pinnedItem{}, fmt.Errorf("failed to fetch dashboard %d: %v", itemID, err)
+	}
+	for _, dashcard := range dashboard.Cards() {
+		if dashcard.CardID == nil {
+			continue
+		}
+		if err := checkDatabaseAccess(ctx, dashcard.Card.DatabaseID); err != nil {
+			return pinnedItem{}, err
+		}
+	}
+	return pinnedItem{ID: dashboard.ID, Name: dashboard.Name, CollectionID: dashboard.CollectionID, CollectionPosition: dashboard.CollectionPosition}, nil
+}
+
+// findItemByName returns the ID of the unarchived card or dashboard with the
+// given name, ignoring case
+func findItemByName(ctx context.Context, client *MetabaseClient, itemType, name string) (int, error) {
+	var items []struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Archived bool   `json:"archived"`
+	}
+	path := "/api/card?f=all"
+	if itemType == "dashboard" {
+		path = "/api/dashboard"
+	}
+	if err := client.Get(ctx, path, &items); err != nil {
+		return 0, fmt.Errorf("failed to list %ss: %v", itemType, err)
+	}
+	var found []int
+	for _, item := range items {
+		if !item.Archived && strings.EqualFold(item.Name, name) {
+			found = append(found, item.ID)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, fmt.Errorf("no %s is named %q", itemType, name)
+	case 1:
+		return found[0], nil
+	}
+	ids := make([]string, len(found))
+	for i, id := range found {
+		ids[i] = fmt.Sprint(id)
+	}
+	return 0, fmt.Errorf("%d %ss are named %q; give the item_id of one of %s", len(found), itemType, name, strings.Join(ids, ", "))
+}
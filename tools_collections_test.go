@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPinItem(t *testing.T) {
+	responses := cardResponses()
+	responses["GET /api/card"] = []interface{}{
+		map[string]interface{}{"id": 5, "name": "Orders"},
+		map[string]interface{}{"id": 8, "name": "Orders", "archived": true},
+	}
+	pinned := cardResponses()
+	pinned["GET /api/card/5"].(map[string]interface{})["collection_position"] = 2
+
+	tests := []struct {
+		name       string
+		guardrails Guardrails
+		responses  map[string]interface{}
+		tool       string
+		arguments  map[string]interface{}
+		want       string
+		position   interface{}
+	}{
+		{"pin by name", Guardrails{}, responses, "pin-item", map[string]interface{}{"name": "orders"}, `\"pinned\": true`, float64(1)},
+		{"pin at a position", Guardrails{}, pinned, "pin-item", map[string]interface{}{"item_id": 5, "position": 3}, `\"pinned\": true`, float64(3)},
+		{"already pinned there", Guardrails{}, pinned, "pin-item", map[string]interface{}{"item_id": 5, "position": 2}, "already pinned at position 2", nil},
+		{"unpin", Guardrails{}, pinned, "unpin-item", map[string]interface{}{"item_id": 5}, `\"pinned\": false`, "unpinned"},
+		{"unpin an unpinned card", Guardrails{}, responses, "unpin-item", map[string]interface{}{"item_id": 5}, "is not pinned", nil},
+		{"read-only profile", Guardrails{ReadOnly: true}, responses, "pin-item", map[string]interface{}{"item_id": 5}, "is read-only", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, fake, audit := newCardRegistry(t, tt.guardrails, tt.responses)
+			tt.arguments["item_type"] = "card"
+			response := callServerTool(t, r, tt.tool, tt.arguments)
+			if !strings.Contains(response, tt.want) {
+				t.Errorf("%s = %s, want %s", tt.tool, response, tt.want)
+			}
+			puts := fake.sent("PUT")
+			switch {
+			case tt.position == nil:
+				if len(puts) != 0 {
+					t.Errorf("%s sent %d updates", tt.tool, len(puts))
+				}
+			case len(puts) != 1:
+				t.Errorf("%s sent %d updates, want 1", tt.tool, len(puts))
+			case tt.position == "unpinned":
+				if position, ok := puts[0].Body["collection_position"]; !ok || position != nil {
+					t.Errorf("unpin sent %v, want a null position", puts[0].Body)
+				}
+			case puts[0].Body["collection_position"] != tt.position:
+				t.Errorf("pin sent %v, want position %v", puts[0].Body, tt.position)
+			}
+			if !strings.Contains(audit.String(), `"tool":"`+tt.tool+`"`) {
+				t.Errorf("audit log = %q, want the %s call", audit.String(), tt.tool)
+			}
+		})
+	}
+}
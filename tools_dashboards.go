@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits of one run-dashboard call
+const (
+	defaultDashboardConcurrency = 4
+	maxDashboardConcurrency     = 8
+	defaultDashboardRows        = 200
+)
+
+// registerDashboardTools adds the tools describing and running dashboards
+func registerDashboardTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"get-dashboard",
+		mcp.WithDescription("Describe a dashboard: its tabs, the cards on each tab in layout order with their SQL or MBQL query, text cards, and its filters with the cards they apply to. Use it to explain what a dashboard shows; run-card or combined-card-data fetch the data of a card"),
+		mcp.WithNumber(
+			"dashboard_id",
+			mcp.Required(),
+			mcp.Description("ID of the dashboard"),
+		),
+	), handleGetDashboard)
+
+	r.add(mcp.NewTool(
+		"run-dashboard",
+		mcp.WithDescription("Run every card of a dashboard and return their results together, each labeled with the card's title: a snapshot of the dashboard as data. Apply the dashboard's filters through parameters"),
+		mcp.WithNumber(
+			"dashboard_id",
+			mcp.Required(),
+			mcp.Description("ID of the dashboard"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Values for the dashboard's filters, keyed by slug, name or ID, as for run-card; each card receives the filters mapped to it"),
+		),
+		mcp.WithString(
+			"tab",
+			mcp.Description("Only run the cards of this tab, given by name or ID"),
+		),
+		mcp.WithNumber(
+			"concurrency",
+			mcp.Description(fmt.Sprintf("How many cards may run at once, up to %d (default %d)", maxDashboardConcurrency, defaultDashboardConcurrency)),
+		),
+		mcp.WithNumber(
+			"max_rows",
+			mcp.Description(fmt.Sprintf("Return at most this many rows per card (default %d)", defaultDashboardRows)),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleRunDashboard)
+}
+
+func handleGetDashboard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dashboardID, err := request.RequireInt("dashboard_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	dashboard, err := getDashboard(ctx, client, dashboardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch dashboard: %v", err)), nil
+	}
+
+	// Cards are listed in reading order: top to bottom, then left to right
+	dashcards := append([]Dashcard(nil), dashboard.Cards()...)
+	sort.SliceStable(dashcards, func(i, j int) bool {
+		if dashcards[i].Row != dashcards[j].Row {
+			return dashcards[i].Row < dashcards[j].Row
+		}
+		return dashcards[i].Col < dashcards[j].Col
+	})
+
+	filters := make([]map[string]interface{}, 0, len(dashboard.Parameters))
+	filterIndex := make(map[string]map[string]interface{}, len(dashboard.Parameters))
+	for _, parameter := range dashboard.Parameters {
+		filter := map[string]interface{}{
+			"id":       parameter.ID,
+			"name":     parameter.Name,
+			"slug":     parameter.Slug,
+			"type":     parameter.Type,
+			"default":  parameter.Default,
+			"required": parameter.Required,
+			"applies":  make([]map[string]interface{}, 0),
+		}
+		if len(parameter.FilteringParameters) > 0 {
+			filter["linked_to"] = parameter.FilteringParameters
+		}
+		filters = append(filters, filter)
+		filterIndex[parameter.ID] = filter
+	}
+
+	all := make([]map[string]interface{}, 0, len(dashcards))
+	byTab := make(map[int][]map[string]interface{})
+	for _, dashcard := range dashcards {
+		entry := describeDashcard(ctx, dashcard)
+		var slugs []string
+		for _, mapping := range dashcard.ParameterMappings {
+			id, _ := mapping["parameter_id"].(string)
+			filter, ok := filterIndex[id]
+			if !ok {
+				continue
+			}
+			slugs = append(slugs, filter["slug"].(string))
+			filter["applies"] = append(filter["applies"].([]map[string]interface{}), map[string]interface{}{
+				"dashcard_id": dashcard.ID,
+				"card_id":     mapping["card_id"],
+				"target":      mapping["target"],
+			})
+		}
+		if len(slugs) > 0 {
+			entry["filters"] = slugs
+		}
+		var tabID int
+		if dashcard.DashboardTabID != nil {
+			tabID = *dashcard.DashboardTabID
+		}
+		byTab[tabID] = append(byTab[tabID], entry)
+		all = append(all, entry)
+	}
+
+	result := map[string]interface{}{
+		"id":            dashboard.ID,
+		"name":          dashboard.Name,
+		"description":   dashboard.Description,
+		"collection_id": dashboard.CollectionID,
+		"filters":       filters,
+	}
+	if dashboard.Archived {
+		result["archived"] = true
+	}
+	if len(dashboard.Tabs) == 0 {
+		result["cards"] = all
+		return jsonResult(result)
+	}
+
+	tabs := append([]DashboardTab(nil), dashboard.Tabs...)
+	sort.SliceStable(tabs, func(i, j int) bool { return tabs[i].Position < tabs[j].Position })
+	described := make([]map[string]interface{}, 0, len(tabs))
+	for _, tab := range tabs {
+		cards := byTab[tab.ID]
+		if cards == nil {
+			cards = make([]map[string]interface{}, 0)
+		}
+		described = append(described, map[string]interface{}{
+			"id":    tab.ID,
+			"name":  tab.Name,
+			"cards": cards,
+		})
+	}
+	result["tabs"] = described
+	return jsonResult(result)
+}
+
+// describeDashcard describes a card placed on a dashboard with its query,
+// or the content of a text or heading card. Queries on databases the caller
+// may not query are left out.
+func describeDashcard(ctx context.Context, dashcard Dashcard) map[string]interface{} {
+	entry := map[string]interface{}{
+		"dashcard_id": dashcard.ID,
+		"position": map[string]int{
+			"row":    dashcard.Row,
+			"col":    dashcard.Col,
+			"width":  dashcard.SizeX,
+			"height": dashcard.SizeY,
+		},
+	}
+	if dashcard.CardID == nil {
+		// Text, heading and link cards are virtual cards without a query
+		kind := "text"
+		if virtual, ok := dashcard.VisualizationSettings["virtual_card"].(map[string]interface{}); ok {
+			if display, ok := virtual["display"].(string); ok && display != "" {
+				kind = display
+			}
+		}
+		entry["kind"] = kind
+		if text, ok := dashcard.VisualizationSettings["text"].(string); ok {
+			entry["text"] = text
+		}
+		return entry
+	}
+
+	card := dashcard.Card
+	entry["kind"] = "card"
+	entry["card_id"] = *dashcard.CardID
+	entry["name"] = card.Name
+	if title, ok := dashcard.VisualizationSettings["card.title"].(string); ok && title != "" && title != card.Name {
+		entry["title"] = title
+	}
+	entry["display"] = card.Display
+	if card.Description != nil && *card.Description != "" {
+		entry["description"] = *card.Description
+	}
+	if checkDatabaseAccess(ctx, card.DatabaseID) != nil {
+		entry["query"] = "not shown: the card queries a database outside the allowed scope"
+		return entry
+	}
+	entry["database_id"] = card.DatabaseID
+	if native, ok := nativeQueryOf(card.DatasetQuery); ok {
+		entry["sql"] = native.Query
+	} else if definition := queryDefinition(card.DatasetQuery); definition != nil {
+		entry["mbql"] = definition
+	}
+	if len(dashcard.Series) > 0 {
+		series := make([]map[string]interface{}, 0, len(dashcard.Series))
+		for _, combined := range dashcard.Series {
+			series = append(series, map[string]interface{}{"card_id": combined.ID, "name": combined.Name})
+		}
+		entry["series"] = series
+	}
+	return entry
+}
+
+func (r *toolRegistry) handleRunDashboard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dashboardID, err := request.RequireInt("dashboard_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	concurrency := max(1, min(request.GetInt("concurrency", defaultDashboardConcurrency), maxDashboardConcurrency))
+	maxRows := request.GetInt("max_rows", defaultDashboardRows)
+	if maxRows <= 0 {
+		maxRows = defaultDashboardRows
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	dashboard, err := getDashboard(ctx, client, dashboardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch dashboard: %v", err)), nil
+	}
+	values, _ := request.GetArguments()["parameters"].(map[string]interface{})
+	for key := range values {
+		if _, ok := findParameter(dashboard.Parameters, key); !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("unknown filter %q; the dashboard declares: %s", key, parameterNames(dashboard.Parameters))), nil
+		}
+	}
+	entries, err := cardParameterEntries(dashboard.Parameters, values)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	tabNames := make(map[int]string, len(dashboard.Tabs))
+	tabPositions := make(map[int]int, len(dashboard.Tabs))
+	selectedTab := 0
+	if tab := request.GetString("tab", ""); tab != "" {
+		for _, t := range dashboard.Tabs {
+			if strings.EqualFold(t.Name, tab) || strconv.Itoa(t.ID) == tab {
+				selectedTab = t.ID
+			}
+		}
+		if selectedTab == 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("dashboard %d has no tab %q", dashboardID, tab)), nil
+		}
+	}
+	for _, t := range dashboard.Tabs {
+		tabNames[t.ID], tabPositions[t.ID] = t.Name, t.Position
+	}
+
+	// Cards run in reading order, tab by tab; text and heading cards have nothing to run
+	dashcards := make([]Dashcard, 0)
+	for _, dashcard := range dashboard.Cards() {
+		if dashcard.CardID == nil {
+			continue
+		}
+		if selectedTab != 0 && (dashcard.DashboardTabID == nil || *dashcard.DashboardTabID != selectedTab) {
+			continue
+		}
+		dashcards = append(dashcards, dashcard)
+	}
+	tabPosition := func(dashcard Dashcard) int {
+		if dashcard.DashboardTabID == nil {
+			return 0
+		}
+		return tabPositions[*dashcard.DashboardTabID]
+	}
+	sort.SliceStable(dashcards, func(i, j int) bool {
+		if a, b := tabPosition(dashcards[i]), tabPosition(dashcards[j]); a != b {
+			return a < b
+		}
+		if dashcards[i].Row != dashcards[j].Row {
+			return dashcards[i].Row < dashcards[j].Row
+		}
+		return dashcards[i].Col < dashcards[j].Col
+	})
+	if len(dashcards) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("dashboard %d has no cards to run", dashboardID)), nil
+	}
+
+	results := make([]map[string]interface{}, len(dashcards))
+	labels := make(map[string]int)
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	startedAt := time.Now()
+	for i, dashcard := range dashcards {
+		label := dashcard.Card.Name
+		if title, ok := dashcard.VisualizationSettings["card.title"].(string); ok && title != "" {
+			label = title
+		}
+		if labels[label]++; labels[label] > 1 {
+			label = fmt.Sprintf("%s (%d)", label, labels[label])
+		}
+		entry := map[string]interface{}{
+			"label":       label,
+			"dashcard_id": dashcard.ID,
+			"card_id":     *dashcard.CardID,
+		}
+		if dashcard.DashboardTabID != nil {
+			entry["tab"] = tabNames[*dashcard.DashboardTabID]
+		}
+		results[i] = entry
+
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			<-slots
+			entry["status"] = "skipped"
+			continue
+		}
+		wg.Add(1)
+		go func(entry map[string]interface{}, dashcard Dashcard) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			started := time.Now()
+			resp, err := runDashcard(ctx, client, dashboardID, dashcard.ID, *dashcard.CardID, dashcardParameters(entries, dashcard))
+			entry["duration_ms"] = time.Since(started).Milliseconds()
+			switch {
+			case err != nil:
+				entry["status"], entry["error"] = "error", err.Error()
+			case resp.Status == "failed":
+				entry["status"], entry["error"] = "error", "Metabase reported the query as failed"
+			default:
+				entry["status"] = "ok"
+				columns := make([]string, 0, len(resp.Data.Cols))
+				for _, col := range resp.Data.Cols {
+					columns = append(columns, col.Name)
+				}
+				rows := resp.Data.Rows
+				if len(rows) > maxRows {
+					rows = rows[:maxRows]
+					entry["truncated"] = true
+				}
+				entry["columns"], entry["rows"], entry["row_count"] = columns, rows, len(resp.Data.Rows)
+			}
+		}(entry, dashcard)
+	}
+	wg.Wait()
+
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result["status"].(string)]++
+	}
+	result := map[string]interface{}{
+		"dashboard_id": dashboard.ID,
+		"name":         dashboard.Name,
+		"cards":        results,
+		"succeeded":    counts["ok"],
+		"failed":       counts["error"],
+		"skipped":      counts["skipped"],
+		"concurrency":  concurrency,
+		"duration_ms":  time.Since(startedAt).Milliseconds(),
+	}
+	if len(values) > 0 {
+		result["parameters"] = values
+	}
+	return r.budget.apply(ctx, result)
+}
+
+// dashcardParameters targets the dashboard filter values at one card, through
+// the card's parameter mappings. Filters not mapped to the card are left out.
+func dashcardParameters(entries []interface{}, dashcard Dashcard) []interface{} {
+	parameters := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		value := entry.(map[string]interface{})
+		for _, mapping := range dashcard.ParameterMappings {
+			if mapping["parameter_id"] != value["id"] {
+				continue
+			}
+			if cardID, ok := mapping["card_id"].(float64); ok && int(cardID) != *dashcard.CardID {
+				continue
+			}
+			parameters = append(parameters, map[string]interface{}{
+				"id":     value["id"],
+				"type":   value["type"],
+				"value":  value["value"],
+				"target": mapping["target"],
+			})
+			break
+		}
+	}
+	return parameters
+}
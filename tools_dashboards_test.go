@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// salesDashboard is dashboard 1 with a status filter and two tabs: an
+// overview holding a SQL and an MBQL card, and details holding a heading and
+// a card on database 2
+func salesDashboard() map[string]interface{} {
+	return map[string]interface{}{
+		"id": 1, "name": "Sales",
+		"parameters": []interface{}{
+			map[string]interface{}{"id": "p1", "name": "Status", "slug": "status", "type": "string/="},
+			map[string]interface{}{"id": "p2", "name": "Region", "slug": "region", "type": "string/="},
+		},
+		"tabs": []interface{}{
+			map[string]interface{}{"id": 21, "name": "Details", "position": 1},
+			map[string]interface{}{"id": 20, "name": "Overview", "position": 0},
+		},
+		"dashcards": []interface{}{
+			map[string]interface{}{
+				"id": 101, "card_id": 5, "dashboard_tab_id": 20, "row": 0, "col": 6, "size_x": 6, "size_y": 4,
+				"card": map[string]interface{}{"id": 5, "name": "Revenue", "display": "line", "database_id": 1,
+					"dataset_query": map[string]interface{}{"type": "native", "database": 1, "native": map[string]interface{}{"query": "SELECT sum(total) FROM orders WHERE {{status}}"}}},
+				"parameter_mappings": []interface{}{map[string]interface{}{"parameter_id": "p1", "card_id": 5, "target": []interface{}{"dimension", []interface{}{"template-tag", "status"}}}},
+			},
+			map[string]interface{}{
+				"id": 102, "card_id": 6, "dashboard_tab_id": 20, "row": 0, "col": 0, "size_x": 6, "size_y": 4,
+				"card": map[string]interface{}{"id": 6, "name": "Orders", "display": "table", "database_id": 1,
+					"dataset_query": map[string]interface{}{"type": "query", "database": 1, "query": map[string]interface{}{"source-table": 3}}},
+				"visualization_settings": map[string]interface{}{"card.title": "Orders list"},
+				"parameter_mappings":     []interface{}{map[string]interface{}{"parameter_id": "p1", "card_id": 6, "target": []interface{}{"dimension", []interface{}{"field", 12, nil}}}},
+			},
+			map[string]interface{}{
+				"id": 103, "dashboard_tab_id": 21, "row": 0, "col": 0, "size_x": 12, "size_y": 1,
+				"visualization_settings": map[string]interface{}{"text": "Staffing", "virtual_card": map[string]interface{}{"display": "heading"}},
+			},
+			map[string]interface{}{
+				"id": 104, "card_id": 7, "dashboard_tab_id": 21, "row": 1, "col": 0, "size_x": 12, "size_y": 4,
+				"card": map[string]interface{}{"id": 7, "name": "Headcount", "display": "scalar", "database_id": 2},
+			},
+		},
+	}
+}
+
+// dashcardSummary describes a dashcard entry by ID, kind and name or text
+func dashcardSummary(entry interface{}) string {
+	card := entry.(map[string]interface{})
+	name := card["name"]
+	if title, ok := card["title"]; ok {
+		name = title
+	}
+	if text, ok := card["text"]; ok {
+		name = text
+	}
+	return fmt.Sprintf("%v %v %v", card["dashcard_id"], card["kind"], name)
+}
+
+func TestGetDashboard(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/dashboard/1": salesDashboard()})
+
+	result := decodeResult(t, callTool(t, context.Background(), handleGetDashboard, client, map[string]interface{}{"dashboard_id": 1}))
+	var tabs []string
+	for _, tab := range result["tabs"].([]interface{}) {
+		tab := tab.(map[string]interface{})
+		var cards []string
+		for _, card := range tab["cards"].([]interface{}) {
+			cards = append(cards, dashcardSummary(card))
+		}
+		tabs = append(tabs, fmt.Sprintf("%s: %s", tab["name"], strings.Join(cards, ", ")))
+	}
+	want := []string{
+		"Overview: 102 card Orders list, 101 card Revenue",
+		"Details: 103 heading Staffing, 104 card Headcount",
+	}
+	if strings.Join(tabs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("tabs = %q, want %q", tabs, want)
+	}
+
+	overview := result["tabs"].([]interface{})[0].(map[string]interface{})["cards"].([]interface{})
+	orders, revenue := overview[0].(map[string]interface{}), overview[1].(map[string]interface{})
+	if orders["mbql"] == nil || fmt.Sprint(orders["filters"]) != "[status]" || fmt.Sprint(orders["position"]) != "map[col:0 height:4 row:0 width:6]" {
+		t.Errorf("orders card = %v, want its MBQL, filters and position", orders)
+	}
+	if !strings.HasPrefix(fmt.Sprint(revenue["sql"]), "SELECT sum(total)") {
+		t.Errorf("revenue card = %v, want its SQL", revenue)
+	}
+	filters := result["filters"].([]interface{})
+	var applies []interface{}
+	for _, applied := range filters[0].(map[string]interface{})["applies"].([]interface{}) {
+		applies = append(applies, applied.(map[string]interface{})["dashcard_id"])
+	}
+	if fmt.Sprint(applies) != "[102 101]" || len(filters[1].(map[string]interface{})["applies"].([]interface{})) != 0 {
+		t.Errorf("filters = %v, want status applied to both overview cards", filters)
+	}
+
+	// Queries on databases outside the profile's policy are not shown
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DeniedDatabases: []int{2}})
+	result = decodeResult(t, callTool(t, ctx, handleGetDashboard, client, map[string]interface{}{"dashboard_id": 1}))
+	details := result["tabs"].([]interface{})[1].(map[string]interface{})["cards"].([]interface{})
+	if headcount := details[1].(map[string]interface{}); headcount["database_id"] != nil || !strings.HasPrefix(fmt.Sprint(headcount["query"]), "not shown") {
+		t.Errorf("headcount card = %v, want its query hidden", headcount)
+	}
+}
+
+func TestGetDashboardWithoutTabs(t *testing.T) {
+	dashboard := salesDashboard()
+	dashboard["ordered_cards"] = dashboard["dashcards"]
+	delete(dashboard, "dashcards")
+	delete(dashboard, "tabs")
+	client := newTestClient(t, map[string]interface{}{"/api/dashboard/1": dashboard})
+
+	// Dashboards of Metabase versions before tabs list their cards in reading order
+	result := decodeResult(t, callTool(t, context.Background(), handleGetDashboard, client, map[string]interface{}{"dashboard_id": 1}))
+	var cards []string
+	for _, card := range result["cards"].([]interface{}) {
+		cards = append(cards, dashcardSummary(card))
+	}
+	if got := strings.Join(cards, ", "); got != "102 card Orders list, 103 heading Staffing, 101 card Revenue, 104 card Headcount" {
+		t.Errorf("cards = %s", got)
+	}
+}
+
+func TestRunDashboard(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, nil)
+	fake.responses["/api/dashboard/1"] = salesDashboard()
+	fake.responses["/api/dashboard/1/dashcard/101/card/5/query"] = datasetResponse(1)
+	fake.responses["/api/dashboard/1/dashcard/102/card/6/query"] = datasetResponse(3)
+	fake.responses["/api/dashboard/1/dashcard/104/card/7/query"] = map[string]interface{}{"status": "failed", "error": "Table not found"}
+	ctx := queryContext(Guardrails{})
+
+	// Cards run tab by tab in reading order, labeled with their titles
+	result := decodeResult(t, callTool(t, ctx, r.handleRunDashboard, client, map[string]interface{}{
+		"dashboard_id": 1,
+		"parameters":   map[string]interface{}{"status": "paid"},
+		"max_rows":     2,
+	}))
+	var got []string
+	for _, card := range result["cards"].([]interface{}) {
+		card := card.(map[string]interface{})
+		got = append(got, fmt.Sprintf("%s/%s %s rows=%v truncated=%v", card["tab"], card["label"], card["status"], card["row_count"], card["truncated"]))
+	}
+	want := []string{
+		"Overview/Orders list ok rows=3 truncated=true",
+		"Overview/Revenue ok rows=1 truncated=<nil>",
+		"Details/Headcount error rows=<nil> truncated=<nil>",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("cards = %q, want %q", got, want)
+	}
+	if result["succeeded"] != 2.0 || result["failed"] != 1.0 {
+		t.Errorf("result = %v, want 2 cards succeeded and 1 failed", result)
+	}
+
+	// Each card receives the filters mapped to it, at its own target
+	parameters := make(map[string]string)
+	for _, request := range fake.sent("POST") {
+		parameters[request.Path] = fmt.Sprint(request.Body["parameters"])
+	}
+	wantParameters := map[string]string{
+		"/api/dashboard/1/dashcard/101/card/5/query": "[map[id:p1 target:[dimension [template-tag status]] type:string/= value:paid]]",
+		"/api/dashboard/1/dashcard/102/card/6/query": "[map[id:p1 target:[dimension [field 12 <nil>]] type:string/= value:paid]]",
+		"/api/dashboard/1/dashcard/104/card/7/query": "[]",
+	}
+	if fmt.Sprint(parameters) != fmt.Sprint(wantParameters) {
+		t.Errorf("parameters = %v, want %v", parameters, wantParameters)
+	}
+
+	result = decodeResult(t, callTool(t, ctx, r.handleRunDashboard, client, map[string]interface{}{"dashboard_id": 1, "tab": "details"}))
+	if cards := result["cards"].([]interface{}); len(cards) != 1 || cards[0].(map[string]interface{})["label"] != "Headcount" {
+		t.Errorf("cards = %v, want only the details tab", cards)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"unknown tab", map[string]interface{}{"tab": "Forecast"}, `dashboard 1 has no tab "Forecast"`},
+		{"unknown filter", map[string]interface{}{"parameters": map[string]interface{}{"color": "red"}}, `unknown filter "color"; the dashboard declares: region (string/=), status (string/=)`},
+		{"missing dashboard", map[string]interface{}{"dashboard_id": 9}, "failed to fetch dashboard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.arguments["dashboard_id"]; !ok {
+				tt.arguments["dashboard_id"] = 1
+			}
+			result := callTool(t, ctx, r.handleRunDashboard, client, tt.arguments)
+			if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+				t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MetabaseDatabase represents a database connection registered in Metabase
+type MetabaseDatabase struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Engine    string `json:"engine"`
+	IsSample  bool   `json:"is_sample"`
+	CacheTTL  *int   `json:"cache_ttl"`
+	CreatedAt string `json:"created_at"`
+}
+
+// listDatabases returns the databases the Metabase user can see
+func listDatabases(ctx context.Context, client *MetabaseClient) ([]MetabaseDatabase, error) {
+	body, err := client.Do(ctx, http.MethodGet, "/api/database", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newer Metabase versions wrap the list in a data field
+	var databases []MetabaseDatabase
+	if json.Unmarshal(body, &databases) != nil {
+		var wrapped struct {
+			Data []MetabaseDatabase `json:"data"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return nil, fmt.Errorf("failed to parse database list: %w", err)
+		}
+		databases = wrapped.Data
+	}
+	return databases, nil
+}
+
+// registerDatabaseTools adds the database connection administration tools
+func registerDatabaseTools(r *toolRegistry) {
+	r.addAdminWrite(mcp.NewTool(
+		"create-database",
+		mcp.WithDescription("Register a new database connection in Metabase and trigger its initial schema sync. The password is read from a secret reference, never passed in plain text"),
+		mcp.WithString(
+			"name",
+			mcp.Required(),
+			mcp.Description("Display name of the database in Metabase"),
+		),
+		mcp.WithString(
+			"engine",
+			mcp.Required(),
+			mcp.Description("Metabase driver name, e.g. postgres, mysql, redshift, snowflake, bigquery-cloud-sdk"),
+		),
+		mcp.WithString(
+			"host",
+			mcp.Description("Database host"),
+		),
+		mcp.WithNumber(
+			"port",
+			mcp.Description("Database port"),
+		),
+		mcp.WithString(
+			"dbname",
+			mcp.Description("Database (catalog) name to connect to"),
+		),
+		mcp.WithString(
+			"user",
+			mcp.Description("User to connect as"),
+		),
+		mcp.WithString(
+			"password_secret",
+			mcp.Description("Secret reference for the password: env:VARIABLE_NAME or file:/path/to/secret"),
+		),
+		mcp.WithBoolean(
+			"ssl",
+			mcp.Description("Connect using SSL"),
+		),
+		mcp.WithObject(
+			"details",
+			mcp.Description("Additional engine-specific connection details merged into the connection settings"),
+		),
+	), handleCreateDatabase)
+
+	r.addAdminWrite(mcp.NewTool(
+		"set-database-cache-ttl",
+		mcp.WithDescription("Set how long Metabase caches question results for a database. Metabase has no table-level caching; use this per database. Previews the change unless confirm is true"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Required(),
+			mcp.Description("Database to configure"),
+		),
+		mcp.WithNumber(
+			"cache_ttl_hours",
+			mcp.Required(),
+			mcp.Description("Cache lifetime in hours, or 0 to fall back to the instance default"),
+		),
+		withConfirm(),
+	), handleSetDatabaseCacheTTL)
+
+	r.addAdminWrite(mcp.NewTool(
+		"sync-database",
+		mcp.WithDescription("Ask Metabase to re-sync a database's schema, so newly created tables and columns show up, and/or rescan the values of its fields used by filters and field-values. Both run in the background in Metabase"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Required(),
+			mcp.Description("Database to sync"),
+		),
+		mcp.WithString(
+			"scope",
+			mcp.Enum("schema", "values", "all"),
+			mcp.Description("schema (default) to sync tables and columns, values to rescan field values, all for both"),
+		),
+	), handleSyncDatabase)
+}
+
+func handleCreateDatabase(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	engine, err := request.RequireString("engine")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	details := make(map[string]interface{})
+	if extra, ok := request.GetArguments()["details"].(map[string]interface{}); ok {
+		for key, value := range extra {
+			details[key] = value
+		}
+	}
+	for _, key := range []string{"host", "dbname", "user"} {
+		if value := request.GetString(key, ""); value != "" {
+			details[key] = value
+		}
+	}
+	if port := request.GetInt("port", 0); port != 0 {
+		details["port"] = port
+	}
+	if _, ok := request.GetArguments()["ssl"]; ok {
+		details["ssl"] = request.GetBool("ssl", false)
+	}
+	if ref := request.GetString("password_secret", ""); ref != "" {
+		password, err := resolveSecret(ref)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to resolve password: %v", err)), nil
+		}
+		details["password"] = password
+	}
+
+	var database MetabaseDatabase
+	body := map[string]interface{}{
+		"name":         name,
+		"engine":       engine,
+		"details":      details,
+		"is_full_sync": true,
+	}
+	if err := client.Post(ctx, "/api/database", body, &database); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to create database: %v", err)), nil
+	}
+
+	syncStatus := "started"
+	if err := client.Post(ctx, fmt.Sprintf("/api/database/%d/sync_schema", database.ID), nil, nil); err != nil {
+		syncStatus = fmt.Sprintf("failed to start: %v", err)
+	}
+
+	return jsonResult(map[string]interface{}{
+		"database_id": database.ID,
+		"name":        database.Name,
+		"engine":      database.Engine,
+		"sync":        syncStatus,
+	})
+}
+
+func handleSyncDatabase(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID, err := request.RequireInt("database_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var endpoints []string
+	switch scope := request.GetString("scope", "schema"); scope {
+	case "schema":
+		endpoints = []string{"sync_schema"}
+	case "values":
+		endpoints = []string{"rescan_values"}
+	case "all":
+		endpoints = []string{"sync_schema", "rescan_values"}
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("unknown scope %q, expected schema, values or all", scope)), nil
+	}
+
+	var database MetabaseDatabase
+	if err := client.Get(ctx, fmt.Sprintf("/api/database/%d", databaseID), &database); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database: %v", err)), nil
+	}
+	started := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if err := client.Post(ctx, fmt.Sprintf("/api/database/%d/%s", databaseID, endpoint), nil, nil); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to start %s: %v", endpoint, err)), nil
+		}
+		started = append(started, endpoint)
+	}
+
+	return jsonResult(map[string]interface{}{
+		"database_id": database.ID,
+		"name":        database.Name,
+		"started":     started,
+		"message":     "Metabase runs the sync in the background; large databases can take minutes. Call list-tables afterwards to see the result",
+	})
+}
+
+func handleSetDatabaseCacheTTL(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID, err := request.RequireInt("database_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	hours, err := request.RequireInt("cache_ttl_hours")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var database MetabaseDatabase
+	if err := client.Get(ctx, fmt.Sprintf("/api/database/%d", databaseID), &database); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database: %v", err)), nil
+	}
+
+	var cacheTTL interface{}
+	if hours > 0 {
+		cacheTTL = hours
+	}
+
+	action := fmt.Sprintf("set cache TTL of database %d (%s)", database.ID, database.Name)
+	changes := map[string]interface{}{
+		"cache_ttl_hours": map[string]interface{}{"from": database.CacheTTL, "to": cacheTTL},
+	}
+	if !confirmed(request) {
+		return previewResult(action, changes)
+	}
+
+	if err := client.Put(ctx, fmt.Sprintf("/api/database/%d", databaseID), map[string]interface{}{"cache_ttl": cacheTTL}, nil); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update database: %v", err)), nil
+	}
+
+	return jsonResult(map[string]interface{}{
+		"applied": true,
+		"action":  action,
+		"changes": changes,
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// newDatabaseRegistry returns a registry serving the database tools from a fake Metabase
+func newDatabaseRegistry(t *testing.T) (*toolRegistry, *fakeMetabase, *bytes.Buffer) {
+	var audit bytes.Buffer
+	r := newTestRegistry(Guardrails{}, &audit)
+	client, fake := newFakeMetabase(t, map[string]interface{}{
+		"GET /api/database/7":                map[string]interface{}{"id": 7, "name": "Warehouse", "engine": "postgres", "cache_ttl": nil},
+		"POST /api/database":                 map[string]interface{}{"id": 7, "name": "Warehouse", "engine": "postgres"},
+		"POST /api/database/7/sync_schema":   map[string]interface{}{},
+		"POST /api/database/7/rescan_values": map[string]interface{}{},
+		"PUT /api/database/7":                map[string]interface{}{"id": 7},
+	})
+	r.config.Profiles["default"].client = client
+	registerDatabaseTools(r)
+	return r, fake, &audit
+}
+
+func TestCreateDatabase(t *testing.T) {
+	t.Setenv("TEST_WAREHOUSE_PASSWORD", "s3cret")
+	r, fake, audit := newDatabaseRegistry(t)
+
+	response := callServerTool(t, r, "create-database", map[string]interface{}{
+		"name":            "Warehouse",
+		"engine":          "postgres",
+		"host":            "db.internal",
+		"port":            5432,
+		"ssl":             false,
+		"password_secret": "env:TEST_WAREHOUSE_PASSWORD",
+		"details":         map[string]interface{}{"schema-filters-type": "all"},
+	})
+	if !strings.Contains(response, `\"sync\": \"started\"`) {
+		t.Errorf("create-database = %s", response)
+	}
+	posts := fake.sent("POST")
+	if len(posts) != 2 || posts[1].Path != "/api/database/7/sync_schema" {
+		t.Fatalf("sent %v, want the database and its sync", posts)
+	}
+	details, _ := posts[0].Body["details"].(map[string]interface{})
+	if details["password"] != "s3cret" || details["host"] != "db.internal" || details["port"] != float64(5432) || details["ssl"] != false || details["schema-filters-type"] != "all" {
+		t.Errorf("details = %v", details)
+	}
+	if strings.Contains(audit.String(), "s3cret") || !strings.Contains(audit.String(), `"password_secret":"[redacted]"`) {
+		t.Errorf("audit log = %q", audit.String())
+	}
+
+	response = callServerTool(t, r, "create-database", map[string]interface{}{"name": "Other", "engine": "postgres", "password_secret": "env:TEST_WAREHOUSE_UNSET"})
+	if !strings.Contains(response, "failed to resolve password") || len(fake.sent("POST")) != 2 {
+		t.Errorf("create-database with an unset secret = %s", response)
+	}
+}
+
+func TestSetDatabaseCacheTTL(t *testing.T) {
+	r, fake, audit := newDatabaseRegistry(t)
+
+	response := callServerTool(t, r, "set-database-cache-ttl", map[string]interface{}{"database_id": 7, "cache_ttl_hours": 24})
+	if !strings.Contains(response, `\"applied\": false`) || len(fake.sent("PUT")) != 0 {
+		t.Errorf("preview = %s", response)
+	}
+	if !strings.Contains(audit.String(), `"outcome":"previewed"`) {
+		t.Errorf("audit log = %q, want the preview", audit.String())
+	}
+
+	for _, hours := range []int{24, 0} {
+		callServerTool(t, r, "set-database-cache-ttl", map[string]interface{}{"database_id": 7, "cache_ttl_hours": hours, "confirm": true})
+	}
+	puts := fake.sent("PUT")
+	if len(puts) != 2 || puts[0].Body["cache_ttl"] != float64(24) {
+		t.Fatalf("sent %v, want two updates", puts)
+	}
+	// Zero falls back to the instance default
+	if ttl, ok := puts[1].Body["cache_ttl"]; !ok || ttl != nil {
+		t.Errorf("cache_ttl = %v, want null", puts[1].Body)
+	}
+}
+
+func TestSyncDatabase(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  []string
+	}{
+		{"", []string{"/api/database/7/sync_schema"}},
+		{"values", []string{"/api/database/7/rescan_values"}},
+		{"all", []string{"/api/database/7/sync_schema", "/api/database/7/rescan_values"}},
+		{"tables", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			r, fake, _ := newDatabaseRegistry(t)
+			arguments := map[string]interface{}{"database_id": 7}
+			if tt.scope != "" {
+				arguments["scope"] = tt.scope
+			}
+			response := callServerTool(t, r, "sync-database", arguments)
+
+			var sent []string
+			for _, request := range fake.sent("POST") {
+				sent = append(sent, request.Path)
+			}
+			if strings.Join(sent, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("sent %v, want %v", sent, tt.want)
+			}
+			if tt.want == nil && !strings.Contains(response, `unknown scope \"tables\"`) {
+				t.Errorf("sync-database = %s, want an unknown scope error", response)
+			}
+			if tt.want != nil && !strings.Contains(response, `\"name\": \"Warehouse\"`) {
+				t.Errorf("sync-database = %s, want the database named", response)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// explainPrefixes maps Metabase database engines to the statement prefix
+// returning a query plan without running the query. Engines missing here,
+// such as BigQuery, SQL Server or Oracle, have no plan statement that
+// returns rows through the dataset API.
+var explainPrefixes = map[string]string{
+	"athena":      "EXPLAIN",
+	"clickhouse":  "EXPLAIN",
+	"databricks":  "EXPLAIN",
+	"druid-jdbc":  "EXPLAIN PLAN FOR",
+	"duckdb":      "EXPLAIN",
+	"h2":          "EXPLAIN",
+	"mariadb":     "EXPLAIN",
+	"mysql":       "EXPLAIN",
+	"postgres":    "EXPLAIN",
+	"presto-jdbc": "EXPLAIN",
+	"redshift":    "EXPLAIN",
+	"snowflake":   "EXPLAIN",
+	"sparksql":    "EXPLAIN",
+	"sqlite":      "EXPLAIN QUERY PLAN",
+	"starburst":   "EXPLAIN",
+	"trino":       "EXPLAIN",
+	"vertica":     "EXPLAIN",
+}
+
+// registerExplainTools adds the tool returning query plans
+func registerExplainTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"explain-query",
+		mcp.WithDescription("Return the database's execution plan for a native query without running it, using the EXPLAIN syntax of the database engine. Use it to sanity-check the cost of a heavy query, e.g. full table scans or huge joins, before running it with metabase-tool"),
+		mcp.WithString(
+			"query",
+			mcp.Required(),
+			mcp.Description("The query to explain"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database the query targets; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database the query targets, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Values for {{variable}} template tags, keyed by name, as for metabase-tool"),
+		),
+		withTimeoutArgument(),
+	), r.handleExplainQuery)
+}
+
+func (r *toolRegistry) handleExplainQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil || strings.TrimSpace(query) == "" {
+		return mcp.NewToolResultError("query is required and must be a string"), nil
+	}
+	if statements := splitStatements(query); len(statements) > 1 {
+		return mcp.NewToolResultError(fmt.Sprintf("explain-query takes a single statement, but the query holds %d", len(statements))), nil
+	}
+	ctx = withCallTimeout(ctx, request)
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	engine, err := databaseEngine(ctx, client, databaseID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	prefix, ok := explainPrefixes[engine]
+	if !ok {
+		supported := make([]string, 0, len(explainPrefixes))
+		for name := range explainPrefixes {
+			supported = append(supported, name)
+		}
+		sort.Strings(supported)
+		return mcp.NewToolResultError(fmt.Sprintf("explain-query does not support the %s engine of database %d; supported engines: %s", engine, databaseID, strings.Join(supported, ", "))), nil
+	}
+
+	query, appliedViews := r.views.expand(sessionID(ctx), strings.TrimRight(strings.TrimSpace(query), ";"))
+	metabaseQuery := newNativeQuery(databaseID, prefix+" "+query)
+	if args, ok := request.GetArguments()["parameters"].(map[string]interface{}); ok && len(args) > 0 {
+		tags, values, _, err := buildTemplateTags(ctx, client, databaseID, query, parseTemplateParameters(args))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		metabaseQuery.Native.TemplateTags = tags
+		metabaseQuery.Parameters = values
+	}
+
+	outcome, err := r.executeNative(ctx, client, metabaseQuery)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !outcome.Parsed {
+		return outcome.rawResult()
+	}
+	if outcome.Response.Status == "failed" {
+		return mcp.NewToolResultError(fmt.Sprintf("the database could not explain the query; check it with validate-query. Statement sent: %s", metabaseQuery.Native.Query)), nil
+	}
+
+	result := map[string]interface{}{
+		"database_id": databaseID,
+		"engine":      engine,
+		"query_sent":  metabaseQuery.Native.Query,
+	}
+	if len(appliedViews) > 0 {
+		result["views_applied"] = appliedViews
+	}
+	// Most engines return the plan as one text line per row
+	if plan, ok := planLines(outcome.Response.Data.Rows); ok {
+		result["plan"] = plan
+	} else {
+		result["columns"] = outcome.Response.Data.Cols
+		result["rows"] = outcome.Response.Data.Rows
+	}
+	return r.budget.apply(ctx, result)
+}
+
+// databaseEngine looks up the engine of a database in Metabase
+func databaseEngine(ctx context.Context, client *MetabaseClient, databaseID int) (string, error) {
+	databases, err := listDatabases(ctx, client)
+	if err != nil {
+		return "", fmt.Errorf("failed to list databases: %w", err)
+	}
+	for _, database := range databases {
+		if database.ID == databaseID {
+			return database.Engine, nil
+		}
+	}
+	return "", fmt.Errorf("database %d not found", databaseID)
+}
+
+// planLines returns the rows of a single text column as lines
+func planLines(rows [][]interface{}) ([]string, bool) {
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if len(row) != 1 {
+			return nil, false
+		}
+		line, ok := row[0].(string)
+		if !ok {
+			return nil, false
+		}
+		lines = append(lines, line)
+	}
+	return lines, len(lines) > 0
+}
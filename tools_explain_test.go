@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainQuery(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, func(request fakeRequest) interface{} {
+		plan := datasetResponse(0)
+		plan["data"] = map[string]interface{}{
+			"cols": []interface{}{map[string]interface{}{"name": "QUERY PLAN"}},
+			"rows": [][]interface{}{{"Seq Scan on orders  (cost=0.00..35.50 rows=2550 width=8)"}, {"  Filter: (total > 100)"}},
+		}
+		return plan
+	})
+	fake.responses["/api/database"] = []map[string]interface{}{
+		{"id": 1, "name": "Sample", "engine": "postgres"},
+		{"id": 2, "name": "Warehouse", "engine": "bigquery-cloud-sdk"},
+	}
+	ctx := queryContext(Guardrails{})
+
+	result := decodeResult(t, callTool(t, ctx, r.handleExplainQuery, client, map[string]interface{}{"query": "SELECT id FROM orders WHERE total > 100;"}))
+	if result["engine"] != "postgres" || result["query_sent"] != "EXPLAIN SELECT id FROM orders WHERE total > 100" {
+		t.Errorf("engine %v, sent %v, want an EXPLAIN for postgres", result["engine"], result["query_sent"])
+	}
+	if plan, _ := result["plan"].([]interface{}); len(plan) != 2 || plan[1] != "  Filter: (total > 100)" {
+		t.Errorf("plan = %v, want the plan's lines", result["plan"])
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"unsupported engine", map[string]interface{}{"query": "SELECT 1", "database_id": 2}, "does not support the bigquery-cloud-sdk engine of database 2"},
+		{"several statements", map[string]interface{}{"query": "SELECT 1; SELECT 2"}, "takes a single statement, but the query holds 2"},
+		{"unknown database", map[string]interface{}{"query": "SELECT 1", "database_id": 9}, "database 9 not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, ctx, r.handleExplainQuery, client, tt.arguments)
+			if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+				t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+			}
+		})
+	}
+}
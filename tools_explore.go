@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits of the row counts run by table-row-counts
+const (
+	defaultRowCountCap = 1000000
+	maxCountedTables   = 20
+)
+
+// Limits of the rows returned by sample-table
+const (
+	defaultSampleRows = 10
+	maxSampleRows     = 100
+)
+
+// maxStatsColumns is the number of columns column-stats summarizes in one call
+const maxStatsColumns = 20
+
+// randomSampleSyntax maps Metabase database engines to the function ordering
+// rows randomly and the character quoting identifiers. Random samples of
+// tables on other engines are refused.
+var randomSampleSyntax = map[string]struct {
+	random string
+	quote  string
+}{
+	"athena":             {"RANDOM()", `"`},
+	"bigquery-cloud-sdk": {"RAND()", "`"},
+	"clickhouse":         {"rand()", `"`},
+	"databricks":         {"RAND()", "`"},
+	"duckdb":             {"RANDOM()", `"`},
+	"h2":                 {"RAND()", `"`},
+	"mariadb":            {"RAND()", "`"},
+	"mysql":              {"RAND()", "`"},
+	"postgres":           {"RANDOM()", `"`},
+	"presto-jdbc":        {"RANDOM()", `"`},
+	"redshift":           {"RANDOM()", `"`},
+	"snowflake":          {"RANDOM()", `"`},
+	"sparksql":           {"RAND()", "`"},
+	"sqlite":             {"RANDOM()", `"`},
+	"starburst":          {"RANDOM()", `"`},
+	"trino":              {"RANDOM()", `"`},
+	"vertica":            {"RANDOM()", `"`},
+}
+
+// registerExploreTools adds the tools exploring the contents of tables
+func registerExploreTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"table-row-counts",
+		mcp.WithDescription("Report how many rows tables hold, from the estimates Metabase keeps, optionally counting the rows of tables without one. Counts stop at a cap, so they stay cheap on huge tables. Use it to decide whether a full scan is reasonable before running a query"),
+		mcp.WithArray(
+			"tables",
+			mcp.Description("Tables to report, as name, schema.name or table ID; defaults to every table in the database"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithString(
+			"count",
+			mcp.Enum("never", "missing", "always"),
+			mcp.Description(fmt.Sprintf("When to count rows with a capped COUNT(*): never (default), for tables Metabase has no estimate for, or always. At most %d tables are counted per call", maxCountedTables)),
+		),
+		mcp.WithNumber(
+			"cap",
+			mcp.Description(fmt.Sprintf("Stop counting at this many rows (default %d)", defaultRowCountCap)),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database holding the tables; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database holding the tables, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleTableRowCounts)
+
+	r.add(mcp.NewTool(
+		"sample-table",
+		mcp.WithDescription(fmt.Sprintf("Show what a table looks like: fetch its first rows, or a random sample, without writing SQL. At most %d rows are returned. A random sample orders the whole table randomly, which scans it, so prefer the first rows on large tables", maxSampleRows)),
+		mcp.WithString(
+			"table",
+			mcp.Required(),
+			mcp.Description("Table to sample, as name, schema.name or table ID"),
+		),
+		mcp.WithNumber(
+			"rows",
+			mcp.Description(fmt.Sprintf("Number of rows to return (default %d, at most %d)", defaultSampleRows, maxSampleRows)),
+		),
+		mcp.WithString(
+			"mode",
+			mcp.Enum("first", "random"),
+			mcp.Description("Return the first rows as the database yields them (default), or a random sample"),
+		),
+		mcp.WithArray(
+			"fields",
+			mcp.Description("Columns to return; defaults to all columns"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database holding the table; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database holding the table, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleSampleTable)
+
+	r.add(mcp.NewTool(
+		"column-stats",
+		mcp.WithDescription("Compute exploratory statistics for columns of a table in one query: row count, distinct count and share of nulls, plus min and max for numeric and date columns and the average for numeric ones. Metabase writes the SQL for the database's engine. The query reads the whole table; profile-table gives sampled estimates without running a query"),
+		mcp.WithString(
+			"table",
+			mcp.Required(),
+			mcp.Description("Table holding the columns, as name, schema.name or table ID"),
+		),
+		mcp.WithArray(
+			"columns",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Columns to summarize, at most %d", maxStatsColumns)),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database holding the table; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database holding the table, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleColumnStats)
+}
+
+func (r *toolRegistry) handleTableRowCounts(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	mode := request.GetString("count", "never")
+	if mode != "never" && mode != "missing" && mode != "always" {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown count %q, expected never, missing or always", mode)), nil
+	}
+	limit := request.GetInt("cap", defaultRowCountCap)
+	if limit <= 0 {
+		limit = defaultRowCountCap
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var metadata DatabaseMetadata
+	cachedAt, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), &metadata)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+
+	tables := make([]TableMetadata, 0)
+	for _, name := range request.GetStringSlice("tables", nil) {
+		table, ok := findTable(metadata, name)
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", name, databaseID)), nil
+		}
+		if err := checkTableAccess(ctx, databaseID, table.Schema); err != nil {
+			r.stats.recordPolicy(ctx, policyName(err))
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		tables = append(tables, table)
+	}
+	if len(tables) == 0 {
+		for _, table := range metadata.Tables {
+			if checkTableAccess(ctx, databaseID, table.Schema) == nil {
+				tables = append(tables, table)
+			}
+		}
+	}
+
+	rows := make([][]interface{}, 0, len(tables))
+	counted, skipped := 0, 0
+	for _, table := range tables {
+		estimate := table.rowEstimate()
+		var rowCount, capped, countErr interface{}
+		if mode == "always" || (mode == "missing" && estimate == nil) {
+			if counted == maxCountedTables {
+				skipped++
+			} else {
+				counted++
+				n, err := r.countRows(ctx, client, databaseID, table, limit)
+				switch {
+				case err != nil:
+					countErr = err.Error()
+				case n > int64(limit):
+					rowCount, capped = int64(limit), true
+				default:
+					rowCount, capped = n, false
+				}
+			}
+		}
+		rows = append(rows, []interface{}{table.qualifiedName(), estimate, rowCount, capped, countErr})
+	}
+
+	result := map[string]interface{}{
+		"database_id": databaseID,
+		"columns":     []string{"table", "estimated_rows", "counted_rows", "capped", "error"},
+		"rows":        rows,
+	}
+	if counted > 0 {
+		result["cap"] = limit
+	}
+	if skipped > 0 {
+		result["message"] = fmt.Sprintf("%d tables were not counted because at most %d are counted per call; ask again for the remaining tables", skipped, maxCountedTables)
+	}
+	if cachedAt != nil {
+		result["offline"] = offlineNotice(*cachedAt)
+	}
+	return jsonResult(result)
+}
+
+// countRows counts the rows of a table, stopping after limit+1 rows. The
+// count runs as MBQL, so Metabase writes it in the database's dialect.
+func (r *toolRegistry) countRows(ctx context.Context, client *MetabaseClient, databaseID int, table TableMetadata, limit int) (int64, error) {
+	query := StructuredQuery{
+		Type:     "query",
+		Database: databaseID,
+		Query: map[string]interface{}{
+			"source-query": map[string]interface{}{"source-table": table.ID, "limit": limit + 1},
+			"aggregation":  []interface{}{[]interface{}{"count"}},
+		},
+		Parameters: []interface{}{},
+	}
+	text, _ := json.Marshal(query.Query)
+	outcome, err := r.executeQuery(ctx, client, query, databaseID, string(text))
+	if err != nil {
+		return 0, err
+	}
+	if !outcome.Parsed || outcome.Response.Status == "failed" {
+		return 0, fmt.Errorf("Metabase could not count the rows of %s: %s", table.qualifiedName(), outcome.failure())
+	}
+	if len(outcome.Response.Data.Rows) != 1 || len(outcome.Response.Data.Rows[0]) != 1 {
+		return 0, fmt.Errorf("unexpected count result for %s", table.qualifiedName())
+	}
+	n, ok := outcome.Response.Data.Rows[0][0].(float64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected count result for %s", table.qualifiedName())
+	}
+	return int64(n), nil
+}
+
+func (r *toolRegistry) handleSampleTable(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tableName, err := request.RequireString("table")
+	if err != nil || tableName == "" {
+		return mcp.NewToolResultError("table is required and must be a string"), nil
+	}
+	mode := request.GetString("mode", "first")
+	if mode != "first" && mode != "random" {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown mode %q, expected first or random", mode)), nil
+	}
+	n := request.GetInt("rows", defaultSampleRows)
+	if n <= 0 {
+		n = defaultSampleRows
+	}
+	n = min(n, maxSampleRows)
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var metadata DatabaseMetadata
+	if _, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), &metadata); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+	table, ok := findTable(metadata, tableName)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", tableName, databaseID)), nil
+	}
+	if err := checkTableAccess(ctx, databaseID, table.Schema); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var outcome queryOutcome
+	if mode == "first" {
+		// Metabase compiles the query with the LIMIT syntax of the engine
+		query, err := buildStructuredQuery(databaseID, table, QuerySpec{Fields: request.GetStringSlice("fields", nil), Limit: n})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		text, _ := json.Marshal(query.Query)
+		outcome, err = r.executeQuery(ctx, client, query, databaseID, string(text))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else {
+		syntax, ok := randomSampleSyntax[metadata.Engine]
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("random samples are not supported on the %s engine of database %d; use mode first", metadata.Engine, databaseID)), nil
+		}
+		quote := func(name string) string {
+			return syntax.quote + strings.ReplaceAll(name, syntax.quote, syntax.quote+syntax.quote) + syntax.quote
+		}
+		columns := "*"
+		if names := request.GetStringSlice("fields", nil); len(names) > 0 {
+			quoted := make([]string, 0, len(names))
+			for _, name := range names {
+				field, ok := tableField(table, name)
+				if !ok {
+					return mcp.NewToolResultError(fmt.Sprintf("column %q not found in table %s", name, table.qualifiedName())), nil
+				}
+				quoted = append(quoted, quote(field.Name))
+			}
+			columns = strings.Join(quoted, ", ")
+		}
+		from := quote(table.Name)
+		if table.Schema != "" {
+			from = quote(table.Schema) + "." + from
+		}
+		outcome, err = r.executeNative(ctx, client, newNativeQuery(databaseID, fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT %d", columns, from, syntax.random, n)))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	if !outcome.Parsed {
+		return outcome.rawResult()
+	}
+	if outcome.Response.Status == "failed" {
+		return mcp.NewToolResultError(fmt.Sprintf("sampling %s failed: %s", table.qualifiedName(), outcome.failure())), nil
+	}
+
+	result := outcome.result()
+	result["table"] = table.qualifiedName()
+	result["mode"] = mode
+	return r.budget.apply(ctx, result)
+}
+
+// tableField looks up a column of a table by name, ignoring case
+func tableField(table TableMetadata, name string) (Field, bool) {
+	for _, field := range table.Fields {
+		if strings.EqualFold(field.Name, strings.TrimSpace(name)) {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+func (r *toolRegistry) handleColumnStats(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tableName, err := request.RequireString("table")
+	if err != nil || tableName == "" {
+		return mcp.NewToolResultError("table is required and must be a string"), nil
+	}
+	names := request.GetStringSlice("columns", nil)
+	switch {
+	case len(names) == 0:
+		return mcp.NewToolResultError("columns is required and must list at least one column"), nil
+	case len(names) > maxStatsColumns:
+		return mcp.NewToolResultError(fmt.Sprintf("at most %d columns can be summarized at once, got %d", maxStatsColumns, len(names))), nil
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var metadata DatabaseMetadata
+	if _, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), &metadata); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+	table, ok := findTable(metadata, tableName)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", tableName, databaseID)), nil
+	}
+	if err := checkTableAccess(ctx, databaseID, table.Schema); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// One query computes every statistic; positions maps each column's
+	// statistics to the aggregation computing it
+	type columnStats struct {
+		field     Field
+		positions map[string]int
+	}
+	aggregations := []interface{}{[]interface{}{"count"}}
+	columns := make([]columnStats, 0, len(names))
+	for _, name := range names {
+		field, ok := tableField(table, name)
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("column %q not found in table %s", name, table.qualifiedName())), nil
+		}
+		ref := []interface{}{"field", field.ID, nil}
+		stats := []string{"distinct", "null_share"}
+		switch templateTypeForBaseType(field.BaseType) {
+		case "number":
+			stats = append(stats, "min", "max", "avg")
+		case "date":
+			stats = append(stats, "min", "max")
+		}
+		column := columnStats{field: field, positions: make(map[string]int, len(stats))}
+		for _, stat := range stats {
+			column.positions[stat] = len(aggregations)
+			if stat == "null_share" {
+				aggregations = append(aggregations, []interface{}{"share", []interface{}{"is-null", ref}})
+			} else {
+				aggregations = append(aggregations, []interface{}{stat, ref})
+			}
+		}
+		columns = append(columns, column)
+	}
+
+	query := StructuredQuery{
+		Type:       "query",
+		Database:   databaseID,
+		Query:      map[string]interface{}{"source-table": table.ID, "aggregation": aggregations},
+		Parameters: []interface{}{},
+	}
+	text, _ := json.Marshal(query.Query)
+	outcome, err := r.executeQuery(ctx, client, query, databaseID, string(text))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !outcome.Parsed {
+		return outcome.rawResult()
+	}
+	if outcome.Response.Status == "failed" {
+		return mcp.NewToolResultError(fmt.Sprintf("computing statistics for %s failed: %s", table.qualifiedName(), outcome.failure())), nil
+	}
+	if len(outcome.Response.Data.Rows) != 1 || len(outcome.Response.Data.Rows[0]) != len(aggregations) {
+		return mcp.NewToolResultError(fmt.Sprintf("unexpected statistics result for %s", table.qualifiedName())), nil
+	}
+	values := outcome.Response.Data.Rows[0]
+
+	rows := make([][]interface{}, 0, len(columns))
+	for _, column := range columns {
+		stat := func(name string) interface{} {
+			if i, ok := column.positions[name]; ok {
+				return values[i]
+			}
+			return nil
+		}
+		var nullPercent interface{}
+		if share, ok := stat("null_share").(float64); ok {
+			nullPercent = math.Round(share*1000) / 10
+		}
+		rows = append(rows, []interface{}{
+			column.field.Name,
+			strings.TrimPrefix(column.field.BaseType, "type/"),
+			stat("distinct"),
+			nullPercent,
+			stat("min"),
+			stat("max"),
+			stat("avg"),
+		})
+	}
+	return jsonResult(map[string]interface{}{
+		"table":        table.qualifiedName(),
+		"row_count":    values[0],
+		"columns":      []string{"name", "type", "distinct", "null_pct", "min", "max", "avg"},
+		"rows":         rows,
+		"running_time": outcome.Response.RunningTime,
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// exploreMetadata describes a postgres database with one table Metabase has
+// a row estimate for and two without
+func exploreMetadata() map[string]interface{} {
+	return map[string]interface{}{
+		"id": 1, "name": "warehouse", "engine": "postgres",
+		"tables": []interface{}{
+			map[string]interface{}{"id": 10, "schema": "public", "name": "orders", "estimated_row_count": 1200, "fields": []interface{}{
+				map[string]interface{}{"id": 100, "name": "id", "base_type": "type/Integer"},
+				map[string]interface{}{"id": 101, "name": "created_at", "base_type": "type/DateTime"},
+				map[string]interface{}{"id": 102, "name": "status", "base_type": "type/Text"},
+			}},
+			map[string]interface{}{"id": 11, "schema": "public", "name": "customers"},
+			map[string]interface{}{"id": 12, "schema": "public", "name": "events"},
+		},
+	}
+}
+
+func TestTableRowCounts(t *testing.T) {
+	// customers holds 50 rows; events holds more than any cap
+	r, client, fake := newQueryRegistry(t, outputLimits{}, func(request fakeRequest) interface{} {
+		query, _ := request.Body["query"].(map[string]interface{})
+		source, _ := query["source-query"].(map[string]interface{})
+		n := 50.0
+		if source["source-table"] == 12.0 {
+			n = source["limit"].(float64)
+		}
+		return map[string]interface{}{"status": "completed", "data": map[string]interface{}{
+			"cols": []interface{}{map[string]interface{}{"name": "count"}},
+			"rows": [][]interface{}{{n}},
+		}}
+	})
+	fake.responses["/api/database/1/metadata"] = exploreMetadata()
+	ctx := queryContext(Guardrails{})
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      []string
+		counted   int
+	}{
+		{"estimates only", nil, []string{
+			"public.orders 1200 <nil> <nil>",
+			"public.customers <nil> <nil> <nil>",
+			"public.events <nil> <nil> <nil>",
+		}, 0},
+		{"count missing", map[string]interface{}{"count": "missing", "cap": 100}, []string{
+			"public.orders 1200 <nil> <nil>",
+			"public.customers <nil> 50 false",
+			"public.events <nil> 100 true",
+		}, 2},
+		{"named tables", map[string]interface{}{"tables": []interface{}{"customers"}, "count": "always"}, []string{
+			"public.customers <nil> 50 false",
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(fake.sent("POST"))
+			result := decodeResult(t, callTool(t, ctx, r.handleTableRowCounts, client, tt.arguments))
+			var got []string
+			for _, row := range result["rows"].([]interface{}) {
+				row := row.([]interface{})
+				got = append(got, fmt.Sprintf("%v %v %v %v", row[0], row[1], row[2], row[3]))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+			if counted := len(fake.sent("POST")) - before; counted != tt.counted {
+				t.Errorf("ran %d counts, want %d", counted, tt.counted)
+			}
+		})
+	}
+
+	for want, arguments := range map[string]map[string]interface{}{
+		`unknown count "sometimes"`:  {"count": "sometimes"},
+		`table "invoices" not found`: {"tables": []interface{}{"invoices"}},
+	} {
+		result := callTool(t, ctx, r.handleTableRowCounts, client, arguments)
+		if !result.IsError || !strings.Contains(resultText(result), want) {
+			t.Errorf("result = %s, want an error containing %q", resultText(result), want)
+		}
+	}
+}
+
+func TestSampleTable(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} { return datasetResponse(2) })
+	fake.responses["/api/database/1/metadata"] = exploreMetadata()
+	ctx := queryContext(Guardrails{})
+
+	// The first rows run as MBQL, so Metabase writes the LIMIT
+	result := decodeResult(t, callTool(t, ctx, r.handleSampleTable, client, map[string]interface{}{"table": "orders", "rows": 5, "fields": []interface{}{"status"}}))
+	if result["table"] != "public.orders" || result["mode"] != "first" || result["row_count"] != 2.0 {
+		t.Errorf("result = %v, want the first rows of public.orders", result)
+	}
+	sent := fake.sent("POST")
+	query, _ := sent[len(sent)-1].Body["query"].(map[string]interface{})
+	if query["source-table"] != 10.0 || query["limit"] != 5.0 || fmt.Sprint(query["fields"]) != "[[field 102 <nil>]]" {
+		t.Errorf("query = %v, want 5 rows of the status column", query)
+	}
+
+	// Random samples are written in the engine's dialect, capped at the maximum
+	tests := []struct {
+		arguments map[string]interface{}
+		want      string
+	}{
+		{map[string]interface{}{"rows": 500}, `SELECT * FROM "public"."orders" ORDER BY RANDOM() LIMIT 100`},
+		{map[string]interface{}{"fields": []interface{}{"ID", "status"}}, `SELECT "id", "status" FROM "public"."orders" ORDER BY RANDOM() LIMIT 10`},
+	}
+	for _, tt := range tests {
+		tt.arguments["table"] = "orders"
+		tt.arguments["mode"] = "random"
+		decodeResult(t, callTool(t, ctx, r.handleSampleTable, client, tt.arguments))
+		sent := fake.sent("POST")
+		if got := sentSQL(sent[len(sent)-1]); got != tt.want {
+			t.Errorf("sent %q, want %q", got, tt.want)
+		}
+	}
+
+	refusals := []struct {
+		arguments map[string]interface{}
+		want      string
+	}{
+		{map[string]interface{}{"table": "orders", "mode": "last"}, `unknown mode "last"`},
+		{map[string]interface{}{"table": "invoices"}, `table "invoices" not found`},
+		{map[string]interface{}{"table": "orders", "mode": "random", "fields": []interface{}{"total"}}, `column "total" not found in table public.orders`},
+	}
+	for _, tt := range refusals {
+		result := callTool(t, ctx, r.handleSampleTable, client, tt.arguments)
+		if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+			t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+		}
+	}
+
+	metadata := exploreMetadata()
+	metadata["engine"] = "mongo"
+	fake.responses["/api/database/1/metadata"] = metadata
+	refused := callTool(t, ctx, r.handleSampleTable, client, map[string]interface{}{"table": "orders", "mode": "random"})
+	if !refused.IsError || !strings.Contains(resultText(refused), "not supported on the mongo engine") {
+		t.Errorf("random sample on mongo = %s, want an error", resultText(refused))
+	}
+}
+
+func TestColumnStats(t *testing.T) {
+	r, client, fake := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} {
+		return map[string]interface{}{"status": "completed", "data": map[string]interface{}{
+			"rows": [][]interface{}{{
+				1200,
+				1200, 0, 1, 1200, 600.5,
+				900, 0.25, "2024-01-01", "2024-12-31",
+				4, 0.0123,
+			}},
+		}}
+	})
+	fake.responses["/api/database/1/metadata"] = exploreMetadata()
+	ctx := queryContext(Guardrails{})
+
+	result := decodeResult(t, callTool(t, ctx, r.handleColumnStats, client, map[string]interface{}{
+		"table":   "public.orders",
+		"columns": []interface{}{"id", "created_at", "status"},
+	}))
+	var got []string
+	for _, row := range result["rows"].([]interface{}) {
+		got = append(got, fmt.Sprint(row))
+	}
+	want := []string{
+		"[id Integer 1200 0 1 1200 600.5]",
+		"[created_at DateTime 900 25 2024-01-01 2024-12-31 <nil>]",
+		"[status Text 4 1.2 <nil> <nil> <nil>]",
+	}
+	if result["row_count"] != 1200.0 || strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("row_count %v, rows %q, want %q", result["row_count"], got, want)
+	}
+
+	// Every statistic is computed by one query
+	sent := fake.sent("POST")
+	if len(sent) != 1 {
+		t.Fatalf("sent %d queries, want 1", len(sent))
+	}
+	query, _ := sent[0].Body["query"].(map[string]interface{})
+	aggregations, _ := query["aggregation"].([]interface{})
+	if query["source-table"] != 10.0 || len(aggregations) != 12 || fmt.Sprint(aggregations[2]) != "[share [is-null [field 100 <nil>]]]" {
+		t.Errorf("query = %v, want 12 aggregations over public.orders", query)
+	}
+
+	tooMany := make([]interface{}, maxStatsColumns+1)
+	for i := range tooMany {
+		tooMany[i] = "id"
+	}
+	refusals := []struct {
+		arguments map[string]interface{}
+		want      string
+	}{
+		{map[string]interface{}{"table": "orders"}, "columns is required"},
+		{map[string]interface{}{"table": "orders", "columns": tooMany}, fmt.Sprintf("at most %d columns", maxStatsColumns)},
+		{map[string]interface{}{"table": "orders", "columns": []interface{}{"total"}}, `column "total" not found in table public.orders`},
+	}
+	for _, tt := range refusals {
+		result := callTool(t, ctx, r.handleColumnStats, client, tt.arguments)
+		if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+			t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+		}
+	}
+}
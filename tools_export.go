@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// exportMIMETypes are the export formats Metabase offers and their MIME types
+var exportMIMETypes = map[string]string{
+	"csv":  "text/csv",
+	"json": "application/json",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// unsafeFileNamePattern matches characters not kept in export file names
+var unsafeFileNamePattern = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// registerExportTools adds the tools exporting query and card results to files
+func registerExportTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"export-query",
+		mcp.WithDescription("Run a native query through Metabase's export endpoint and save the full result as an xlsx, csv or json file, returning its path and a resource URI. Use it to hand results to people rather than to read them"),
+		mcp.WithString(
+			"query",
+			mcp.Required(),
+			mcp.Description("The query to export"),
+		),
+		mcp.WithString(
+			"export_format",
+			mcp.Enum("xlsx", "csv", "json"),
+			mcp.Description("File format (default xlsx)"),
+		),
+		mcp.WithString(
+			"file_name",
+			mcp.Description("Base name of the file, without extension (default export)"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to run the query against; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database to run the query against, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Values for {{variable}} template tags, keyed by name, as for metabase-tool"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleExportQuery)
+
+	r.add(mcp.NewTool(
+		"export-card",
+		mcp.WithDescription("Run a saved question through Metabase's export endpoint and save its full result as a csv, xlsx or json file, returning its path and a resource URI. Use it to export a question's result in bulk rather than to read it"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to export"),
+		),
+		mcp.WithString(
+			"export_format",
+			mcp.Enum("csv", "xlsx", "json"),
+			mcp.Description("File format (default csv)"),
+		),
+		mcp.WithString(
+			"file_name",
+			mcp.Description("Base name of the file, without extension (default card-<id>)"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Values for the card's parameters, keyed by slug, name or ID, as for run-card"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleExportCard)
+}
+
+func (r *toolRegistry) handleExportQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil || query == "" {
+		return mcp.NewToolResultError("query is required and must be a string"), nil
+	}
+	if statements := splitStatements(query); len(statements) > 1 {
+		return mcp.NewToolResultError(fmt.Sprintf("export-query takes a single statement, but the query holds %d", len(statements))), nil
+	}
+	format := request.GetString("export_format", "xlsx")
+	if _, ok := exportMIMETypes[format]; !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown export_format %q, expected xlsx, csv or json", format)), nil
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+	profile := profileFromContext(ctx)
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if profile.Guardrails.ReadOnly && !isSelectQuery(query) {
+		r.stats.recordPolicy(ctx, "read_only")
+		return mcp.NewToolResultError(fmt.Sprintf("profile %s is read-only: only SELECT queries are allowed", profile.Name)), nil
+	}
+
+	query, _ = r.views.expand(sessionID(ctx), query)
+	metabaseQuery := newNativeQuery(databaseID, query)
+	if args, ok := request.GetArguments()["parameters"].(map[string]interface{}); ok && len(args) > 0 {
+		tags, values, _, err := buildTemplateTags(ctx, client, databaseID, query, parseTemplateParameters(args))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		metabaseQuery.Native.TemplateTags = tags
+		metabaseQuery.Parameters = values
+	}
+
+	result, err := r.saveExport(ctx, request.GetString("file_name", ""), "export", format, func(w io.Writer) (int64, error) {
+		return client.Export(ctx, format, metabaseQuery, w)
+	})
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result["database_id"] = databaseID
+	return jsonResult(result)
+}
+
+func (r *toolRegistry) handleExportCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	format := request.GetString("export_format", "csv")
+	if _, ok := exportMIMETypes[format]; !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown export_format %q, expected csv, xlsx or json", format)), nil
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	card, err := getCard(ctx, client, cardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card %d: %v", cardID, err)), nil
+	}
+	if err := checkCardQueryAccess(ctx, client, card); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	values, _ := request.GetArguments()["parameters"].(map[string]interface{})
+	entries, err := cardParameterEntries(card.Parameters, values)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result, err := r.saveExport(ctx, request.GetString("file_name", ""), fmt.Sprintf("card-%d", card.ID), format, func(w io.Writer) (int64, error) {
+		return client.ExportCard(ctx, card.ID, format, entries, w)
+	})
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result["card"] = map[string]interface{}{"id": card.ID, "name": card.Name, "verified": card.Verified()}
+	if len(values) > 0 {
+		result["parameters"] = values
+	}
+	return jsonResult(result)
+}
+
+// saveExport streams an export written by write to a file of the export
+// directory, named after name or else fallback, and serves the file as
+// resources readable by the caller. It returns the file's path, size and
+// resource URIs.
+func (r *toolRegistry) saveExport(ctx context.Context, name, fallback, format string, write func(io.Writer) (int64, error)) (map[string]interface{}, error) {
+	dir := r.currentConfig().ExportDir
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	name = strings.Trim(unsafeFileNamePattern.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		name = fallback
+	}
+	startedAt := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.%s", name, startedAt.UTC().Format("20060102T150405.000"), format))
+
+	// The export is streamed to a partial file, renamed once complete
+	partial := path + ".part"
+	file, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %w", err)
+	}
+	size, err := write(file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write export: %w", closeErr)
+	}
+	if err == nil {
+		err = os.Rename(partial, path)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("export failed: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"path":        path,
+		"format":      format,
+		"bytes":       size,
+		"duration_ms": time.Since(startedAt).Milliseconds(),
+	}
+	if uris := r.exports.putFile(ctx, path, exportMIMETypes[format], format != "xlsx", size); len(uris) == 1 {
+		result["resource_uri"] = uris[0]
+	} else {
+		result["resource_uris"] = uris
+		result["message"] = fmt.Sprintf("The export is larger than one resource read and is served in %d parts; read them in order and join them", len(uris))
+	}
+	return result, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestExportQuery(t *testing.T) {
+	var mu sync.Mutex
+	var exported []string
+	metabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		var query MetabaseQuery
+		json.Unmarshal([]byte(r.PostForm.Get("query")), &query)
+		mu.Lock()
+		exported = append(exported, r.URL.Path+" "+query.Native.Query)
+		mu.Unlock()
+		if strings.Contains(query.Native.Query, "broken") {
+			http.Error(w, "Table not found", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("id,name\n1,Ada\n"))
+	}))
+	defer metabase.Close()
+
+	r, _, _ := newQueryRegistry(t, outputLimits{}, nil)
+	r.config.ExportDir = t.TempDir()
+	r.exports = newResultStore(server.NewMCPServer("test", "1.0", server.WithResourceCapabilities(false, false)), 10)
+	client := NewMetabaseClient(metabase.URL, 1)
+	ctx := queryContext(Guardrails{})
+
+	result := decodeResult(t, callTool(t, ctx, r.handleExportQuery, client, map[string]interface{}{
+		"query":         "SELECT id, name FROM customers",
+		"export_format": "csv",
+		"file_name":     "../Q1 revenue",
+	}))
+	path, _ := result["path"].(string)
+	if filepath.Dir(path) != r.config.ExportDir || !strings.HasPrefix(filepath.Base(path), "Q1_revenue-") || !strings.HasSuffix(path, ".csv") {
+		t.Errorf("path = %s, want a csv file named after Q1_revenue in the export directory", path)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "id,name\n1,Ada\n" {
+		t.Errorf("export file = %q, %v, want the exported rows", content, err)
+	}
+	if result["bytes"] != 14.0 || result["resource_uri"] == nil {
+		t.Errorf("result = %v, want the size and a resource URI", result)
+	}
+	mu.Lock()
+	if len(exported) != 1 || exported[0] != "/api/dataset/csv SELECT id, name FROM customers" {
+		t.Errorf("exported %v, want the query sent to the csv endpoint", exported)
+	}
+	mu.Unlock()
+
+	// Failed exports leave no file behind
+	failed := callTool(t, ctx, r.handleExportQuery, client, map[string]interface{}{"query": "SELECT * FROM broken"})
+	if !failed.IsError || !strings.Contains(resultText(failed), "export failed") {
+		t.Errorf("failed export = %s, want an error", resultText(failed))
+	}
+	if files, _ := os.ReadDir(r.config.ExportDir); len(files) != 1 {
+		t.Errorf("export directory holds %d files, want only the first export", len(files))
+	}
+
+	for query, want := range map[string]string{
+		"SELECT 1; SELECT 2": "takes a single statement",
+		"SELECT 1":           `unknown export_format "pdf"`,
+	} {
+		refused := callTool(t, ctx, r.handleExportQuery, client, map[string]interface{}{"query": query, "export_format": "pdf"})
+		if !refused.IsError || !strings.Contains(resultText(refused), want) {
+			t.Errorf("export of %q = %s, want an error containing %q", query, resultText(refused), want)
+		}
+	}
+}
+
+func TestExportCard(t *testing.T) {
+	var mu sync.Mutex
+	var exported []string
+	metabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id": 5, "name": "Orders", "database_id": 1,
+				"dataset_query": map[string]interface{}{"type": "native", "database": 1, "native": map[string]interface{}{"query": "SELECT id FROM finance.orders WHERE status = {{status}}"}},
+				"parameters":    []interface{}{map[string]interface{}{"id": "p1", "slug": "status", "type": "string/="}},
+			})
+			return
+		}
+		r.ParseForm()
+		mu.Lock()
+		exported = append(exported, r.URL.Path+" "+r.PostForm.Get("parameters"))
+		mu.Unlock()
+		w.Write([]byte("id\n1\n"))
+	}))
+	defer metabase.Close()
+
+	r, _, _ := newQueryRegistry(t, outputLimits{}, nil)
+	r.config.ExportDir = t.TempDir()
+	r.exports = newResultStore(server.NewMCPServer("test", "1.0", server.WithResourceCapabilities(false, false)), 10)
+	client := NewMetabaseClient(metabase.URL, 1)
+	ctx := queryContext(Guardrails{})
+
+	result := decodeResult(t, callTool(t, ctx, r.handleExportCard, client, map[string]interface{}{
+		"card_id":    5,
+		"parameters": map[string]interface{}{"status": "paid"},
+	}))
+	path, _ := result["path"].(string)
+	if !strings.HasPrefix(filepath.Base(path), "card-5-") || !strings.HasSuffix(path, ".csv") {
+		t.Errorf("path = %s, want a csv file named after the card", path)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "id\n1\n" {
+		t.Errorf("export file = %q, %v, want the card's rows", content, err)
+	}
+	if card, _ := result["card"].(map[string]interface{}); card["name"] != "Orders" || result["parameters"] == nil {
+		t.Errorf("result = %v, want the card and its parameter values", result)
+	}
+	mu.Lock()
+	if len(exported) != 1 || exported[0] != `/api/card/5/query/csv [{"id":"p1","target":null,"type":"string/=","value":"paid"}]` {
+		t.Errorf("exported %v, want the card's csv export with its parameters", exported)
+	}
+	mu.Unlock()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"unknown format", ctx, map[string]interface{}{"card_id": 5, "export_format": "pdf"}, `unknown export_format "pdf"`},
+		{"unknown parameter", ctx, map[string]interface{}{"card_id": 5, "parameters": map[string]interface{}{"region": "EU"}}, `unknown parameter "region"`},
+		{"outside the client's schemas", withClientAccess(ctx, &ClientAccess{Name: "hr", Schemas: []string{"hr"}}), map[string]interface{}{"card_id": 5}, "client hr may not"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, tt.ctx, r.handleExportCard, client, tt.arguments)
+			if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+				t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+			}
+		})
+	}
+	if files, _ := os.ReadDir(r.config.ExportDir); len(files) != 1 {
+		t.Errorf("export directory holds %d files, want only the first export", len(files))
+	}
+}
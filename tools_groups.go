@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// GroupMember represents a user's membership in a permission group
+type GroupMember struct {
+	MembershipID int    `json:"membership_id"`
+	UserID       int    `json:"user_id"`
+	Email        string `json:"email"`
+	CommonName   string `json:"common_name"`
+}
+
+// GroupDetails represents a permission group with its members
+type GroupDetails struct {
+	ID      int           `json:"id"`
+	Name    string        `json:"name"`
+	Members []GroupMember `json:"members"`
+}
+
+// registerGroupTools adds the group membership administration tools
+func registerGroupTools(r *toolRegistry) {
+	r.addAdmin(mcp.NewTool(
+		"list-group-members",
+		mcp.WithDescription("List permission groups, or the members of one group"),
+		mcp.WithString(
+			"group",
+			mcp.Description("Group ID or name; omit to list all groups"),
+		),
+	), handleListGroupMembers)
+
+	r.addAdminWrite(mcp.NewTool(
+		"add-group-member",
+		mcp.WithDescription("Add a user to a permission group. Previews the change unless confirm is true"),
+		mcp.WithString(
+			"group",
+			mcp.Required(),
+			mcp.Description("Group ID or name, e.g. Finance"),
+		),
+		mcp.WithString(
+			"user",
+			mcp.Required(),
+			mcp.Description("User ID, email or full name"),
+		),
+		withConfirm(),
+	), handleAddGroupMember)
+
+	r.addAdminWrite(mcp.NewTool(
+		"remove-group-member",
+		mcp.WithDescription("Remove a user from a permission group. Previews the change unless confirm is true"),
+		mcp.WithString(
+			"group",
+			mcp.Required(),
+			mcp.Description("Group ID or name"),
+		),
+		mcp.WithString(
+			"user",
+			mcp.Required(),
+			mcp.Description("User ID, email or full name"),
+		),
+		withConfirm(),
+	), handleRemoveGroupMember)
+}
+
+func handleListGroupMembers(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	groupRef := request.GetString("group", "")
+	if groupRef == "" {
+		var groups []PermissionGroup
+		if err := client.Get(ctx, "/api/permissions/group", &groups); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch permission groups: %v", err)), nil
+		}
+		return jsonResult(groups)
+	}
+
+	group, err := resolveGroup(ctx, client, groupRef)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonResult(group)
+}
+
+func handleAddGroupMember(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	group, user, err := resolveMembershipArguments(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	for _, member := range group.Members {
+		if member.UserID == user.ID {
+			return jsonResult(map[string]interface{}{
+				"applied": false,
+				"message": fmt.Sprintf("%s is already a member of %s", user.Email, group.Name),
+			})
+		}
+	}
+
+	action := fmt.Sprintf("add %s to group %s", user.Email, group.Name)
+	if !confirmed(request) {
+		return previewResult(action, map[string]interface{}{"group_id": group.ID, "user_id": user.ID})
+	}
+
+	body := map[string]interface{}{"group_id": group.ID, "user_id": user.ID}
+	if err := client.Post(ctx, "/api/permissions/membership", body, nil); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to add group member: %v", err)), nil
+	}
+	return jsonResult(map[string]interface{}{"applied": true, "action": action})
+}
+
+func handleRemoveGroupMember(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	group, user, err := resolveMembershipArguments(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	membershipID := 0
+	for _, member := range group.Members {
+		if member.UserID == user.ID {
+			membershipID = member.MembershipID
+		}
+	}
+	if membershipID == 0 {
+		return jsonResult(map[string]interface{}{
+			"applied": false,
+			"message": fmt.Sprintf("%s is not a member of %s", user.Email, group.Name),
+		})
+	}
+
+	action := fmt.Sprintf("remove %s from group %s", user.Email, group.Name)
+	if !confirmed(request) {
+		return previewResult(action, map[string]interface{}{"group_id": group.ID, "user_id": user.ID, "membership_id": membershipID})
+	}
+
+	if err := client.Delete(ctx, fmt.Sprintf("/api/permissions/membership/%d", membershipID)); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to remove group member: %v", err)), nil
+	}
+	return jsonResult(map[string]interface{}{"applied": true, "action": action})
+}
+
+// resolveMembershipArguments resolves the group and user arguments of a membership change
+func resolveMembershipArguments(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (GroupDetails, MetabaseUser, error) {
+	groupRef, err := request.RequireString("group")
+	if err != nil {
+		return GroupDetails{}, MetabaseUser{}, err
+	}
+	userRef, err := request.RequireString("user")
+	if err != nil {
+		return GroupDetails{}, MetabaseUser{}, err
+	}
+
+	group, err := resolveGroup(ctx, client, groupRef)
+	if err != nil {
+		return GroupDetails{}, MetabaseUser{}, err
+	}
+	user, err := resolveUser(ctx, client, userRef)
+	if err != nil {
+		return GroupDetails{}, MetabaseUser{}, err
+	}
+	return group, user, nil
+}
+
+// resolveGroup finds a permission group by ID or case-insensitive name and loads its members
+func resolveGroup(ctx context.Context, client *MetabaseClient, ref string) (GroupDetails, error) {
+	var group GroupDetails
+	groupID, err := strconv.Atoi(ref)
+	if err != nil {
+		var groups []PermissionGroup
+		if err := client.Get(ctx, "/api/permissions/group", &groups); err != nil {
+			return group, fmt.Errorf("failed to fetch permission groups: %v", err)
+		}
+		for _, g := range groups {
+			if strings.EqualFold(g.Name, ref) {
+				groupID = g.ID
+			}
+		}
+		if groupID == 0 {
+			return group, fmt.Errorf("no permission group named %q", ref)
+		}
+	}
+
+	if err := client.Get(ctx, fmt.Sprintf("/api/permissions/group/%d", groupID), &group); err != nil {
+		return group, fmt.Errorf("failed to fetch permission group: %v", err)
+	}
+	return group, nil
+}
+
+// resolveUser finds exactly one user by ID, email or full name
+func resolveUser(ctx context.Context, client *MetabaseClient, ref string) (MetabaseUser, error) {
+	users, err := fetchUsers(ctx, client, "/api/user")
+	if err != nil {
+		return MetabaseUser{}, fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	var matches []MetabaseUser
+	for _, user := range users {
+		if strconv.Itoa(user.ID) == ref || strings.EqualFold(user.Email, ref) || strings.EqualFold(user.CommonName, ref) {
+			matches = append(matches, user)
+		}
+	}
+	// Fall back to a partial name match, e.g. a first name
+	if len(matches) == 0 {
+		for _, user := range users {
+			if strings.Contains(strings.ToLower(user.CommonName), strings.ToLower(ref)) {
+				matches = append(matches, user)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return MetabaseUser{}, fmt.Errorf("no user matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		emails := make([]string, 0, len(matches))
+		for _, user := range matches {
+			emails = append(emails, user.Email)
+		}
+		return MetabaseUser{}, fmt.Errorf("%q matches several users (%s); use an email or ID", ref, strings.Join(emails, ", "))
+	}
+}
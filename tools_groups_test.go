@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// groupResponses are the answers of a fake Metabase with a Finance group holding Ana
+func groupResponses() map[string]interface{} {
+	return map[string]interface{}{
+		"/api/permissions/group": []interface{}{
+			map[string]interface{}{"id": 1, "name": "All Users"},
+			map[string]interface{}{"id": 2, "name": "Finance"},
+		},
+		"/api/permissions/group/2": map[string]interface{}{"id": 2, "name": "Finance", "members": []interface{}{
+			map[string]interface{}{"membership_id": 40, "user_id": 1, "email": "ana@example.com"},
+		}},
+		"/api/user": map[string]interface{}{"data": []interface{}{
+			map[string]interface{}{"id": 1, "email": "ana@example.com", "common_name": "Ana Silva"},
+			map[string]interface{}{"id": 2, "email": "bo@example.com", "common_name": "Bo Chen"},
+			map[string]interface{}{"id": 3, "email": "bob@example.com", "common_name": "Bob Stone"},
+		}},
+		"POST /api/permissions/membership":      map[string]interface{}{},
+		"DELETE /api/permissions/membership/40": map[string]interface{}{},
+	}
+}
+
+func TestResolveUser(t *testing.T) {
+	client := newTestClient(t, groupResponses())
+	tests := []struct {
+		ref     string
+		want    int
+		wantErr string
+	}{
+		{"2", 2, ""},
+		{"ANA@example.com", 1, ""},
+		{"bo chen", 2, ""},
+		{"Silva", 1, ""},
+		{"Bo", 0, "bo@example.com, bob@example.com"},
+		{"carol", 0, "no user matches"},
+	}
+	for _, tt := range tests {
+		user, err := resolveUser(context.Background(), client, tt.ref)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveUser(%q) = %v, %v, want error %q", tt.ref, user.Email, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || user.ID != tt.want {
+			t.Errorf("resolveUser(%q) = %d, %v, want %d", tt.ref, user.ID, err, tt.want)
+		}
+	}
+}
+
+func TestGroupMembershipTools(t *testing.T) {
+	var audit bytes.Buffer
+	r := newTestRegistry(Guardrails{}, &audit)
+	client, fake := newFakeMetabase(t, groupResponses())
+	r.config.Profiles["default"].client = client
+	registerGroupTools(r)
+
+	calls := []struct {
+		tool      string
+		arguments map[string]interface{}
+		want      string
+		outcome   string
+	}{
+		{"add-group-member", map[string]interface{}{"group": "finance", "user": "bo@example.com"}, `\"applied\": false`, "previewed"},
+		{"add-group-member", map[string]interface{}{"group": "finance", "user": "bo@example.com", "confirm": true}, `\"applied\": true`, "applied"},
+		{"add-group-member", map[string]interface{}{"group": "2", "user": "Ana Silva", "confirm": true}, "already a member", "applied"},
+		{"remove-group-member", map[string]interface{}{"group": "Finance", "user": "ana@example.com", "confirm": true}, `\"applied\": true`, "applied"},
+		{"remove-group-member", map[string]interface{}{"group": "Sales", "user": "ana@example.com", "confirm": true}, "no permission group named", "error"},
+	}
+	for _, call := range calls {
+		audit.Reset()
+		if response := callServerTool(t, r, call.tool, call.arguments); !strings.Contains(response, call.want) {
+			t.Errorf("%s %v = %s, want %s", call.tool, call.arguments, response, call.want)
+		}
+		if !strings.Contains(audit.String(), `"outcome":"`+call.outcome+`"`) {
+			t.Errorf("%s %v: audit log = %q, want outcome %s", call.tool, call.arguments, audit.String(), call.outcome)
+		}
+	}
+
+	posts := fake.sent("POST")
+	if len(posts) != 1 || posts[0].Body["group_id"] != float64(2) || posts[0].Body["user_id"] != float64(2) {
+		t.Errorf("added %v, want Bo to Finance once", posts)
+	}
+	if deletes := fake.sent("DELETE"); len(deletes) != 1 || deletes[0].Path != "/api/permissions/membership/40" {
+		t.Errorf("removed %v, want Ana's membership", deletes)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerHealthTools adds the server health tools
+func registerHealthTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"server-health",
+		mcp.WithDescription("Report the health of each configured Metabase connection: circuit breaker state, whether read-only requests are currently served by the failover host, query queue usage, and whether cached metadata is being served while a reconnect check is pending. With a profile argument only that profile is reported"),
+		mcp.WithBoolean(
+			"check",
+			mcp.Description("Also call the Metabase health endpoint of each host (default true)"),
+		),
+	), r.handleServerHealth)
+}
+
+func (r *toolRegistry) handleServerHealth(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	check := request.GetBool("check", true)
+	cfg := r.currentConfig()
+
+	names := r.profileNames()
+	if name := request.GetString("profile", ""); name != "" {
+		names = []string{name}
+	}
+
+	profiles := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		profile := cfg.Profiles[name]
+		status := map[string]interface{}{
+			"name":        name,
+			"host":        profile.client.host,
+			"auth":        profile.client.authProvider().Name(),
+			"active_host": profile.client.activeHost(),
+			"failed_over": profile.client.activeHost() != profile.client.host,
+			"offline":     profile.client.offline(),
+			"circuit":     profile.client.breaker.status(),
+			"queue":       profile.client.queue.stats(),
+		}
+		if profile.client.flights != nil {
+			status["coalescing"] = profile.client.flights.stats()
+		}
+		if profile.client.failoverHost != "" {
+			status["failover_host"] = profile.client.failoverHost
+		}
+		if check {
+			status["primary_health"] = hostHealth(ctx, profile.client, profile.client.host)
+			if profile.client.failoverHost != "" {
+				status["failover_health"] = hostHealth(ctx, profile.client, profile.client.failoverHost)
+			}
+		}
+		profiles = append(profiles, status)
+	}
+
+	health := map[string]interface{}{
+		"profiles":    profiles,
+		"audit_sinks": r.audit.sinkStats(),
+	}
+	if r.faults != nil {
+		health["fault_injection"] = r.faults.stats()
+	}
+	if cfg.InsecureSkipVerify {
+		health["tls_verification"] = "disabled"
+	}
+	return jsonResult(health)
+}
+
+// hostHealth calls the Metabase health endpoint of host directly, bypassing
+// the circuit breaker so an open circuit does not hide a recovered host
+func hostHealth(ctx context.Context, client *MetabaseClient, host string) string {
+	if _, err := client.sendTo(ctx, host, http.MethodGet, "/api/health", "", nil); err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
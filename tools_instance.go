@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SessionProperties represents the subset of /api/session/properties used by the server
+type SessionProperties struct {
+	Version       VersionInfo     `json:"version"`
+	TokenFeatures map[string]bool `json:"token-features"`
+}
+
+// VersionInfo represents the Metabase version reported by the instance
+type VersionInfo struct {
+	Tag  string `json:"tag"`
+	Date string `json:"date"`
+	Hash string `json:"hash"`
+}
+
+// premiumFeatureDescriptions explains what commonly asked-about premium features unlock
+var premiumFeatureDescriptions = map[string]string{
+	"sandboxes":                  "Data sandboxing (row/column level security per group)",
+	"official_collections":       "Official collections and verified content",
+	"content_verification":       "Verifying questions and models",
+	"cache_granularity_controls": "Per-database, per-dashboard and per-question cache policies",
+	"advanced_permissions":       "Advanced permissions (download, data model and settings access)",
+	"audit_app":                  "Usage analytics and audit logs",
+	"sso_google":                 "Google sign-in for groups mapping",
+	"sso_jwt":                    "JWT single sign-on",
+	"sso_saml":                   "SAML single sign-on",
+	"sso_ldap":                   "Advanced LDAP configuration",
+	"scim":                       "SCIM user provisioning",
+	"embedding":                  "Interactive embedding",
+	"whitelabel":                 "White labeling",
+	"serialization":              "Serialization (export/import of content)",
+	"upload_management":          "Managing uploaded tables",
+}
+
+// registerInstanceTools adds tools describing the Metabase instance itself
+func registerInstanceTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"instance-features",
+		mcp.WithDescription("Report the Metabase version, edition and which premium features (sandboxing, official collections, caching granularity, SSO types) are enabled, to explain why some requests are not possible on this deployment"),
+	), handleInstanceFeatures)
+}
+
+func handleInstanceFeatures(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var props SessionProperties
+	if err := client.Get(ctx, "/api/session/properties", &props); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch session properties: %v", err)), nil
+	}
+
+	// Enterprise builds are tagged v1.x, open source builds v0.x
+	edition := "open source"
+	if strings.HasPrefix(props.Version.Tag, "v1.") {
+		edition = "enterprise"
+	}
+
+	enabled := make([]string, 0)
+	disabled := make([]string, 0)
+	for feature, on := range props.TokenFeatures {
+		if on {
+			enabled = append(enabled, feature)
+		} else {
+			disabled = append(disabled, feature)
+		}
+	}
+	sort.Strings(enabled)
+	sort.Strings(disabled)
+
+	explained := make(map[string]interface{})
+	for feature, description := range premiumFeatureDescriptions {
+		on, known := props.TokenFeatures[feature]
+		if !known {
+			continue
+		}
+		explained[feature] = map[string]interface{}{
+			"enabled":     on,
+			"description": description,
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"version":           props.Version.Tag,
+		"edition":           edition,
+		"enabled_features":  enabled,
+		"disabled_features": disabled,
+		"feature_details":   explained,
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestInstanceFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		edition  string
+		features map[string]interface{}
+		enabled  []interface{}
+		disabled []interface{}
+	}{
+		{"open source", "v0.50.3", "open source", map[string]interface{}{"sandboxes": false}, []interface{}{}, []interface{}{"sandboxes"}},
+		{"enterprise", "v1.50.3", "enterprise", map[string]interface{}{"sso_saml": true, "audit_app": true, "hosting": false},
+			[]interface{}{"audit_app", "sso_saml"}, []interface{}{"hosting"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, map[string]interface{}{
+				"/api/session/properties": map[string]interface{}{
+					"version":        map[string]interface{}{"tag": tt.tag},
+					"token-features": tt.features,
+				},
+			})
+			result := decodeResult(t, callTool(t, context.Background(), handleInstanceFeatures, client, nil))
+			if result["version"] != tt.tag || result["edition"] != tt.edition {
+				t.Errorf("version %v, edition %v, want %s, %s", result["version"], result["edition"], tt.tag, tt.edition)
+			}
+			if !reflect.DeepEqual(result["enabled_features"], tt.enabled) || !reflect.DeepEqual(result["disabled_features"], tt.disabled) {
+				t.Errorf("enabled %v, disabled %v, want %v, %v", result["enabled_features"], result["disabled_features"], tt.enabled, tt.disabled)
+			}
+			// Only known features are explained
+			details, _ := result["feature_details"].(map[string]interface{})
+			if _, ok := details["hosting"]; ok {
+				t.Errorf("feature details = %v, want known features only", details)
+			}
+			for feature, on := range tt.features {
+				if detail, ok := details[feature].(map[string]interface{}); ok && detail["enabled"] != on {
+					t.Errorf("%s detail = %v, want enabled %v", feature, detail, on)
+				}
+			}
+		})
+	}
+}
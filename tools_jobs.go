@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerJobTools adds the tools running queries in the background
+func registerJobTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"start-query",
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Start a native query in the background and return a job ID at once. Use it for queries that may outlast the client's request timeout, then poll query-status and collect the result with fetch-result. Takes the same arguments as metabase-tool"),
+		}, nativeQueryArguments()...)...,
+	), r.handleStartQuery)
+
+	r.add(mcp.NewTool(
+		"query-status",
+		mcp.WithDescription("Report whether a query started with start-query is running, completed, failed or cancelled, and how long it has taken"),
+		mcp.WithString(
+			"job_id",
+			mcp.Required(),
+			mcp.Description("Job ID returned by start-query"),
+		),
+		mcp.WithBoolean(
+			"cancel",
+			mcp.Description("Cancel the query if it is still running"),
+		),
+	), r.handleQueryStatus)
+
+	r.add(mcp.NewTool(
+		"fetch-result",
+		mcp.WithDescription("Return the result of a query started with start-query once it has finished, in the same form as metabase-tool"),
+		mcp.WithString(
+			"job_id",
+			mcp.Required(),
+			mcp.Description("Job ID returned by start-query"),
+		),
+	), r.handleFetchResult)
+}
+
+func (r *toolRegistry) handleStartQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query := request.GetString("query", "")
+	if query == "" && request.GetString("cursor", "") == "" {
+		return mcp.NewToolResultError("query is required and must be a string"), nil
+	}
+
+	job := r.jobs.start(ctx, sessionID(ctx), query, func(ctx context.Context) (*mcp.CallToolResult, error) {
+		return r.handleNativeQuery(ctx, client, request)
+	})
+	status := job.status()
+	status["message"] = "Poll query-status with this job_id, then call fetch-result once the state is completed or failed"
+	return jsonResult(status)
+}
+
+func (r *toolRegistry) handleQueryStatus(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return mcp.NewToolResultError("job_id is required"), nil
+	}
+
+	lookup := r.jobs.get
+	if request.GetBool("cancel", false) {
+		lookup = r.jobs.cancelJob
+	}
+	job, ok := lookup(sessionID(ctx), id)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown job %q; jobs are kept for the session that started them", id)), nil
+	}
+	return jsonResult(job.status())
+}
+
+func (r *toolRegistry) handleFetchResult(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return mcp.NewToolResultError("job_id is required"), nil
+	}
+
+	job, ok := r.jobs.get(sessionID(ctx), id)
+	switch {
+	case !ok:
+		return mcp.NewToolResultError(fmt.Sprintf("unknown job %q; jobs are kept for the session that started them", id)), nil
+	case job.State == jobRunning:
+		return mcp.NewToolResultError(fmt.Sprintf("job %s is still running after %s; call fetch-result again later", id, time.Since(job.StartedAt).Round(time.Second))), nil
+	case job.State == jobCancelled:
+		return mcp.NewToolResultError(fmt.Sprintf("job %s was cancelled", id)), nil
+	}
+	return job.Result, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerLintTools adds the SQL lint tool
+func registerLintTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"lint-query",
+		mcp.WithDescription("Check a SQL query for common warehouse anti-patterns (functions on filtered columns, implicit cross joins, unbounded DISTINCT, non-sargable date filters, ...) without running it. Returns findings with severities and suggested rewrites"),
+		mcp.WithString(
+			"query",
+			mcp.Required(),
+			mcp.Description("The SQL query to check"),
+		),
+	), handleLintQuery)
+}
+
+func handleLintQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	findings := lintQuery(query)
+	return jsonResult(map[string]interface{}{
+		"findings": findings,
+		"summary":  lintSummary(findings),
+	})
+}
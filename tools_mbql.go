@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerStructuredQueryTools adds the MBQL query tool
+func registerStructuredQueryTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"structured-query",
+		mcp.WithDescription("Run an analytical query without writing SQL: pick a table, then filter, aggregate, group, sort and limit it by column name. Metabase compiles the query to the database's SQL dialect. Use list-tables to find tables and columns"),
+		mcp.WithString(
+			"table",
+			mcp.Required(),
+			mcp.Description("Table to query, as name, schema.name or table ID"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database holding the table; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database holding the table, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		mcp.WithArray(
+			"filters",
+			mcp.Description("Conditions rows must all meet"),
+			mcp.Items(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"field":    map[string]interface{}{"type": "string", "description": "Column name"},
+					"operator": map[string]interface{}{"type": "string", "enum": []string{"=", "!=", "<", "<=", ">", ">=", "between", "contains", "does-not-contain", "starts-with", "ends-with", "is-null", "not-null", "time-interval"}, "description": "Comparison (default =); = and != accept a list of values, between a list of two, time-interval a relative amount such as -30 with a unit"},
+					"value":    map[string]interface{}{"description": "Value, or list of values, to compare with"},
+					"unit":     map[string]interface{}{"type": "string", "description": "Unit of a time-interval filter: minute, hour, day, week, month, quarter or year"},
+				},
+				"required": []string{"field"},
+			}),
+		),
+		mcp.WithArray(
+			"aggregations",
+			mcp.Description("Aggregates to compute, per breakout group when breakouts are given"),
+			mcp.Items(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"function": map[string]interface{}{"type": "string", "enum": []string{"count", "sum", "avg", "min", "max", "distinct", "median", "stddev"}},
+					"field":    map[string]interface{}{"type": "string", "description": "Column to aggregate; not used by count"},
+				},
+				"required": []string{"function"},
+			}),
+		),
+		mcp.WithArray(
+			"breakouts",
+			mcp.Description("Columns to group by; date columns may name a unit, e.g. created_at:month"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithArray(
+			"order_by",
+			mcp.Description("Sort order, by column or by the index of an aggregation"),
+			mcp.Items(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"field":       map[string]interface{}{"type": "string", "description": "Column to sort by"},
+					"aggregation": map[string]interface{}{"type": "number", "description": "Index of the aggregation to sort by, starting at 0"},
+					"direction":   map[string]interface{}{"type": "string", "enum": []string{"asc", "desc"}},
+				},
+			}),
+		),
+		mcp.WithArray(
+			"fields",
+			mcp.Description("Columns to return when not aggregating; defaults to all columns"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description("Maximum number of rows to return"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleStructuredQuery)
+}
+
+func (r *toolRegistry) handleStructuredQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tableName, err := request.RequireString("table")
+	if err != nil || tableName == "" {
+		return mcp.NewToolResultError("table is required and must be a string"), nil
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// The arguments share the layout of QuerySpec
+	var spec QuerySpec
+	encoded, err := json.Marshal(request.GetArguments())
+	if err == nil {
+		err = json.Unmarshal(encoded, &spec)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid structured query: %v", err)), nil
+	}
+
+	var metadata DatabaseMetadata
+	if _, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), &metadata); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+	table, ok := findTable(metadata, tableName)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", tableName, databaseID)), nil
+	}
+	if err := checkTableAccess(ctx, databaseID, table.Schema); err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	query, err := buildStructuredQuery(databaseID, table, spec)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	text, _ := json.Marshal(query.Query)
+	outcome, err := r.executeQuery(ctx, client, query, databaseID, string(text))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !outcome.Parsed {
+		return outcome.rawResult()
+	}
+
+	result := outcome.result()
+	result["table"] = table.qualifiedName()
+	return r.budget.apply(ctx, result)
+}
+
+// findTable looks up a table by ID, name or schema-qualified name
+func findTable(metadata DatabaseMetadata, name string) (TableMetadata, bool) {
+	id, err := strconv.Atoi(name)
+	name = strings.ToLower(name)
+	for _, table := range metadata.Tables {
+		if (err == nil && table.ID == id) || strings.ToLower(table.Name) == name || table.qualifiedName() == name {
+			return table, true
+		}
+	}
+	return TableMetadata{}, false
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Field represents a column as described by the Metabase field API
+type Field struct {
+	ID             int     `json:"id"`
+	Name           string  `json:"name"`
+	DisplayName    string  `json:"display_name"`
+	Description    *string `json:"description"`
+	TableID        int     `json:"table_id"`
+	BaseType       string  `json:"base_type"`
+	EffectiveType  string  `json:"effective_type"`
+	SemanticType   *string `json:"semantic_type"`
+	VisibilityType string  `json:"visibility_type"`
+	FKTargetID     *int    `json:"fk_target_field_id"`
+}
+
+// registerMetadataTools adds the data model curation tools
+func registerMetadataTools(r *toolRegistry) {
+	r.addAdminWrite(mcp.NewTool(
+		"update-field-metadata",
+		mcp.WithDescription("Set a field's description, semantic type or visibility in the Metabase data model, e.g. describe a column or mark an email column as sensitive. Previews the change unless confirm is true"),
+		mcp.WithNumber(
+			"field_id",
+			mcp.Required(),
+			mcp.Description("ID of the field to update"),
+		),
+		mcp.WithString(
+			"description",
+			mcp.Description("New description for the field"),
+		),
+		mcp.WithString(
+			"semantic_type",
+			mcp.Description("Semantic type such as Email, PK, FK or Category, with or without the type/ prefix, or \"none\" to clear it"),
+		),
+		mcp.WithString(
+			"visibility_type",
+			mcp.Enum("normal", "details-only", "hidden", "sensitive", "retired"),
+			mcp.Description("Where the field is shown; sensitive hides it everywhere, including query results"),
+		),
+		withConfirm(),
+	), handleUpdateFieldMetadata)
+
+	r.addAdminWrite(mcp.NewTool(
+		"update-table-metadata",
+		mcp.WithDescription("Hide or unhide a table and set its description or entity type in the Metabase data model. Previews the change unless confirm is true"),
+		mcp.WithNumber(
+			"table_id",
+			mcp.Required(),
+			mcp.Description("ID of the table to update"),
+		),
+		mcp.WithString(
+			"visibility",
+			mcp.Enum("visible", "hidden", "technical", "cruft"),
+			mcp.Description("visible to show the table, or hidden/technical/cruft to hide it from browsing and the query builder"),
+		),
+		mcp.WithString(
+			"description",
+			mcp.Description("New description for the table"),
+		),
+		mcp.WithString(
+			"entity_type",
+			mcp.Description("What the table's rows are, the table counterpart of a semantic type: e.g. UserTable, TransactionTable, ProductTable, EventTable or GenericTable, with or without the entity/ prefix"),
+		),
+		withConfirm(),
+	), handleUpdateTableMetadata)
+}
+
+func handleUpdateFieldMetadata(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	fieldID, err := request.RequireInt("field_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var field Field
+	if err := client.Get(ctx, fmt.Sprintf("/api/field/%d", fieldID), &field); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch field: %v", err)), nil
+	}
+
+	update := make(map[string]interface{})
+	changes := make(map[string]interface{})
+	arguments := request.GetArguments()
+	if _, ok := arguments["description"]; ok {
+		description := request.GetString("description", "")
+		update["description"] = description
+		changes["description"] = map[string]interface{}{"from": field.Description, "to": description}
+	}
+	if _, ok := arguments["semantic_type"]; ok {
+		var semanticType interface{} = request.GetString("semantic_type", "")
+		switch semanticType {
+		case "none", "":
+			semanticType = nil
+		default:
+			semanticType = "type/" + strings.TrimPrefix(semanticType.(string), "type/")
+		}
+		update["semantic_type"] = semanticType
+		changes["semantic_type"] = map[string]interface{}{"from": field.SemanticType, "to": semanticType}
+	}
+	if _, ok := arguments["visibility_type"]; ok {
+		visibility := request.GetString("visibility_type", "")
+		update["visibility_type"] = visibility
+		changes["visibility_type"] = map[string]interface{}{"from": field.VisibilityType, "to": visibility}
+	}
+	if len(update) == 0 {
+		return mcp.NewToolResultError("nothing to update: provide description, semantic_type or visibility_type"), nil
+	}
+
+	action := fmt.Sprintf("update field %d (%s)", field.ID, field.Name)
+	if !confirmed(request) {
+		return previewResult(action, changes)
+	}
+
+	var updated Field
+	if err := client.Put(ctx, fmt.Sprintf("/api/field/%d", fieldID), update, &updated); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update field: %v", err)), nil
+	}
+
+	return jsonResult(map[string]interface{}{
+		"applied": true,
+		"action":  action,
+		"field":   updated,
+	})
+}
+
+func handleUpdateTableMetadata(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tableID, err := request.RequireInt("table_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var table struct {
+		MetabaseTable
+		EntityType *string `json:"entity_type"`
+	}
+	if err := client.Get(ctx, fmt.Sprintf("/api/table/%d", tableID), &table); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch table: %v", err)), nil
+	}
+
+	update := make(map[string]interface{})
+	changes := make(map[string]interface{})
+	arguments := request.GetArguments()
+	if _, ok := arguments["visibility"]; ok {
+		// Metabase represents visible tables with a null visibility type
+		var visibility interface{} = request.GetString("visibility", "visible")
+		if visibility == "visible" {
+			visibility = nil
+		}
+		update["visibility_type"] = visibility
+		changes["visibility_type"] = map[string]interface{}{"from": table.Visibility, "to": visibility}
+	}
+	if _, ok := arguments["description"]; ok {
+		description := request.GetString("description", "")
+		update["description"] = description
+		changes["description"] = map[string]interface{}{"from": table.Description, "to": description}
+	}
+	if entityType := request.GetString("entity_type", ""); entityType != "" {
+		entityType = "entity/" + strings.TrimPrefix(entityType, "entity/")
+		update["entity_type"] = entityType
+		changes["entity_type"] = map[string]interface{}{"from": table.EntityType, "to": entityType}
+	}
+	if len(update) == 0 {
+		return mcp.NewToolResultError("nothing to update: provide visibility, description or entity_type"), nil
+	}
+
+	action := fmt.Sprintf("update table %d (%s)", table.ID, table.Name)
+	if !confirmed(request) {
+		return previewResult(action, changes)
+	}
+
+	if err := client.Put(ctx, fmt.Sprintf("/api/table/%d", tableID), update, nil); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update table: %v", err)), nil
+	}
+
+	return jsonResult(map[string]interface{}{
+		"applied": true,
+		"action":  action,
+		"changes": changes,
+	})
+}
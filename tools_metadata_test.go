@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpdateFieldMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		update    map[string]interface{}
+		wantErr   bool
+	}{
+		{"preview", map[string]interface{}{"description": "Order total in USD"}, nil, false},
+		{"describe", map[string]interface{}{"description": "Order total in USD", "confirm": true},
+			map[string]interface{}{"description": "Order total in USD"}, false},
+		{"semantic type", map[string]interface{}{"semantic_type": "type/Currency", "visibility_type": "details-only", "confirm": true},
+			map[string]interface{}{"semantic_type": "type/Currency", "visibility_type": "details-only"}, false},
+		{"unprefixed semantic type", map[string]interface{}{"semantic_type": "Email", "confirm": true},
+			map[string]interface{}{"semantic_type": "type/Email"}, false},
+		{"clear semantic type", map[string]interface{}{"semantic_type": "none", "confirm": true},
+			map[string]interface{}{"semantic_type": nil}, false},
+		{"nothing to update", map[string]interface{}{"confirm": true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMetabase(t, map[string]interface{}{
+				"GET /api/field/100": map[string]interface{}{"id": 100, "name": "total", "semantic_type": "type/Number"},
+				"PUT /api/field/100": map[string]interface{}{"id": 100, "name": "total"},
+			})
+			tt.arguments["field_id"] = 100
+			result := callTool(t, context.Background(), handleUpdateFieldMetadata, client, tt.arguments)
+			if result.IsError != tt.wantErr {
+				t.Fatalf("result = %s, want error %v", resultText(result), tt.wantErr)
+			}
+			puts := fake.sent("PUT")
+			if tt.update == nil {
+				if len(puts) != 0 {
+					t.Errorf("sent %v, want no update", puts)
+				}
+				if !tt.wantErr && decodeResult(t, result)["applied"] != false {
+					t.Errorf("result = %s, want a preview", resultText(result))
+				}
+				return
+			}
+			if len(puts) != 1 || len(puts[0].Body) != len(tt.update) {
+				t.Fatalf("sent %v, want %v", puts, tt.update)
+			}
+			for key, want := range tt.update {
+				if got, ok := puts[0].Body[key]; !ok || got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateTableMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		update    map[string]interface{}
+	}{
+		{"preview", map[string]interface{}{"visibility": "hidden"}, nil},
+		{"hide", map[string]interface{}{"visibility": "hidden", "confirm": true}, map[string]interface{}{"visibility_type": "hidden"}},
+		// Metabase marks visible tables with a null visibility type
+		{"show", map[string]interface{}{"visibility": "visible", "description": "", "confirm": true},
+			map[string]interface{}{"visibility_type": nil, "description": ""}},
+		{"entity type", map[string]interface{}{"entity_type": "TransactionTable", "confirm": true},
+			map[string]interface{}{"entity_type": "entity/TransactionTable"}},
+		{"prefixed entity type", map[string]interface{}{"entity_type": "entity/UserTable", "confirm": true},
+			map[string]interface{}{"entity_type": "entity/UserTable"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMetabase(t, map[string]interface{}{
+				"GET /api/table/10": map[string]interface{}{"id": 10, "name": "orders", "visibility_type": "technical"},
+				"PUT /api/table/10": map[string]interface{}{"id": 10},
+			})
+			tt.arguments["table_id"] = 10
+			result := decodeResult(t, callTool(t, context.Background(), handleUpdateTableMetadata, client, tt.arguments))
+			puts := fake.sent("PUT")
+			if tt.update == nil {
+				if len(puts) != 0 || result["applied"] != false {
+					t.Errorf("preview = %v, sent %v", result, puts)
+				}
+				return
+			}
+			if len(puts) != 1 || len(puts[0].Body) != len(tt.update) {
+				t.Fatalf("sent %v, want %v", puts, tt.update)
+			}
+			for key, want := range tt.update {
+				if got, ok := puts[0].Body[key]; !ok || got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
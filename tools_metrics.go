@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// LegacyMetric represents a metric defined in the table data model, as
+// returned by /api/legacy-metric, or /api/metric before Metabase 50
+type LegacyMetric struct {
+	ID          int                    `json:"id"`
+	Name        string                 `json:"name"`
+	Description *string                `json:"description"`
+	TableID     int                    `json:"table_id"`
+	Archived    bool                   `json:"archived"`
+	Definition  map[string]interface{} `json:"definition"`
+}
+
+// Segment represents a named filter defined on a table in the data model, as
+// returned by /api/segment
+type Segment struct {
+	ID          int                    `json:"id"`
+	Name        string                 `json:"name"`
+	Description *string                `json:"description"`
+	TableID     int                    `json:"table_id"`
+	Archived    bool                   `json:"archived"`
+	Definition  map[string]interface{} `json:"definition"`
+}
+
+// registerMetricTools adds the tools listing governed definitions
+func registerMetricTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"list-metrics",
+		mcp.WithDescription("List the metrics defined in Metabase with their formula (aggregation and filter) and the table they are computed from. Reuse a governed metric instead of reinventing a definition such as active users: apply its aggregation and filter to its table, e.g. with structured-query"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Only include metrics computed from this database"),
+		),
+		mcp.WithString(
+			"search",
+			mcp.Description("Only include metrics whose name or description contains this text"),
+		),
+	), handleListMetrics)
+
+	r.add(mcp.NewTool(
+		"list-segments",
+		mcp.WithDescription("List the segments defined in Metabase: named filters on a table, such as paying customers, with their filter and table. Apply a governed segment instead of re-deriving its filter: use its filter with structured-query, or reference it in MBQL"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Only include segments on tables of this database"),
+		),
+		mcp.WithString(
+			"table",
+			mcp.Description("Only include segments on this table, as name, schema.name or table ID"),
+		),
+		mcp.WithString(
+			"search",
+			mcp.Description("Only include segments whose name or description contains this text"),
+		),
+	), handleListSegments)
+}
+
+func handleListMetrics(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID := request.GetInt("database_id", 0)
+	search := strings.ToLower(request.GetString("search", ""))
+
+	cards, err := listCards(ctx, client)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list cards: %v", err)), nil
+	}
+
+	// Legacy metrics live at /api/legacy-metric since Metabase 50, at
+	// /api/metric before, and are gone from recent versions
+	var legacy []LegacyMetric
+	for _, path := range []string{"/api/legacy-metric", "/api/metric"} {
+		err = client.Get(ctx, path, &legacy)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list legacy metrics: %v", err)), nil
+		}
+		break
+	}
+
+	tables := &definitionTables{client: client, tables: make(map[int]*TableMetadata)}
+
+	metrics := make([]map[string]interface{}, 0)
+	for _, card := range cards {
+		if card.Type != "metric" || card.Archived || !matchesSearch(search, card.Name, card.Description) {
+			continue
+		}
+		if databaseID != 0 && card.DatabaseID != databaseID {
+			continue
+		}
+		metric := map[string]interface{}{
+			"id":          card.ID,
+			"kind":        "metric",
+			"name":        card.Name,
+			"description": card.Description,
+			"database_id": card.DatabaseID,
+			"verified":    card.Verified(),
+		}
+		var tableID int
+		if card.TableID != nil {
+			tableID = *card.TableID
+		}
+		if tables.describe(ctx, metric, card.DatabaseID, tableID, queryDefinition(card.DatasetQuery)) {
+			metrics = append(metrics, metric)
+		}
+	}
+	for _, legacyMetric := range legacy {
+		if legacyMetric.Archived || !matchesSearch(search, legacyMetric.Name, legacyMetric.Description) {
+			continue
+		}
+		metric := map[string]interface{}{
+			"id":          legacyMetric.ID,
+			"kind":        "legacy_metric",
+			"name":        legacyMetric.Name,
+			"description": legacyMetric.Description,
+		}
+		var metricDatabaseID int
+		if found := tables.get(ctx, legacyMetric.TableID); found != nil {
+			metricDatabaseID = found.DBID
+			metric["database_id"] = found.DBID
+		}
+		if databaseID != 0 && metricDatabaseID != databaseID {
+			continue
+		}
+		if tables.describe(ctx, metric, metricDatabaseID, legacyMetric.TableID, legacyMetric.Definition) {
+			metrics = append(metrics, metric)
+		}
+	}
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return strings.ToLower(metrics[i]["name"].(string)) < strings.ToLower(metrics[j]["name"].(string))
+	})
+
+	return jsonResult(map[string]interface{}{
+		"count":   len(metrics),
+		"metrics": metrics,
+		"usage":   "Apply a metric's aggregation and filter to its table; in MBQL a metric is also referenced as [\"metric\", id]",
+	})
+}
+
+func handleListSegments(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID := request.GetInt("database_id", 0)
+	tableName := strings.ToLower(request.GetString("table", ""))
+	search := request.GetString("search", "")
+
+	var segments []Segment
+	if err := client.Get(ctx, "/api/segment", &segments); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list segments: %v", err)), nil
+	}
+
+	tables := &definitionTables{client: client, tables: make(map[int]*TableMetadata)}
+	listed := make([]map[string]interface{}, 0)
+	for _, segment := range segments {
+		if segment.Archived || !matchesSearch(search, segment.Name, segment.Description) {
+			continue
+		}
+		table := tables.get(ctx, segment.TableID)
+		if (databaseID != 0 || tableName != "") && table == nil {
+			continue
+		}
+		if databaseID != 0 && table.DBID != databaseID {
+			continue
+		}
+		if tableName != "" && strconv.Itoa(table.ID) != tableName && strings.ToLower(table.Name) != tableName && table.qualifiedName() != tableName {
+			continue
+		}
+		entry := map[string]interface{}{
+			"id":          segment.ID,
+			"name":        segment.Name,
+			"description": segment.Description,
+		}
+		var segmentDatabaseID int
+		if table != nil {
+			segmentDatabaseID = table.DBID
+			entry["database_id"] = table.DBID
+		}
+		if tables.describe(ctx, entry, segmentDatabaseID, segment.TableID, segment.Definition) {
+			listed = append(listed, entry)
+		}
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		return strings.ToLower(listed[i]["name"].(string)) < strings.ToLower(listed[j]["name"].(string))
+	})
+
+	return jsonResult(map[string]interface{}{
+		"count":    len(listed),
+		"segments": listed,
+		"usage":    "Add a segment's filter to queries on its table; in MBQL a segment is also referenced as the filter [\"segment\", id]",
+	})
+}
+
+// definitionTables looks up the tables governed definitions are computed
+// from, fetching each table once
+type definitionTables struct {
+	client *MetabaseClient
+	tables map[int]*TableMetadata
+}
+
+// get returns a table with its fields, or nil when it cannot be fetched
+func (t *definitionTables) get(ctx context.Context, id int) *TableMetadata {
+	if cached, ok := t.tables[id]; ok {
+		return cached
+	}
+	var found TableMetadata
+	if _, err := t.client.GetMetadata(ctx, fmt.Sprintf("/api/table/%d/query_metadata", id), &found); err != nil {
+		t.tables[id] = nil
+		return nil
+	}
+	t.tables[id] = &found
+	return &found
+}
+
+// describe adds the table and the MBQL clauses of a definition to entry,
+// naming the columns the clauses refer to by ID. It reports false when the
+// calling client may not read the table.
+func (t *definitionTables) describe(ctx context.Context, entry map[string]interface{}, databaseID, tableID int, definition map[string]interface{}) bool {
+	if databaseID != 0 && checkDatabaseAccess(ctx, databaseID) != nil {
+		return false
+	}
+	if tableID != 0 {
+		entry["table_id"] = tableID
+		if found := t.get(ctx, tableID); found != nil {
+			if checkTableAccess(ctx, found.DBID, found.Schema) != nil {
+				return false
+			}
+			entry["table"] = found.qualifiedName()
+
+			columns := make(map[string]string)
+			for _, field := range found.Fields {
+				if referencesField(definition, field.ID) {
+					columns[strconv.Itoa(field.ID)] = field.Name
+				}
+			}
+			if len(columns) > 0 {
+				entry["fields"] = columns
+			}
+		}
+	}
+	for _, key := range []string{"aggregation", "filter", "breakout"} {
+		if value, ok := definition[key]; ok {
+			entry[key] = value
+		}
+	}
+	return true
+}
+
+// matchesSearch reports whether a name or description contains search, ignoring case
+func matchesSearch(search, name string, description *string) bool {
+	if search == "" {
+		return true
+	}
+	text := name
+	if description != nil {
+		text += "\n" + *description
+	}
+	return strings.Contains(strings.ToLower(text), strings.ToLower(search))
+}
+
+// queryDefinition returns the MBQL clauses of a card's dataset query, from
+// the legacy {"query": {...}} form or the first stage of the pMBQL form
+func queryDefinition(datasetQuery json.RawMessage) map[string]interface{} {
+	var query struct {
+		Query  map[string]interface{}   `json:"query"`
+		Stages []map[string]interface{} `json:"stages"`
+	}
+	if json.Unmarshal(datasetQuery, &query) != nil {
+		return nil
+	}
+	if query.Query != nil {
+		return query.Query
+	}
+	if len(query.Stages) > 0 {
+		return query.Stages[0]
+	}
+	return nil
+}
+
+// referencesField reports whether an MBQL clause holds a ["field", id, ...]
+// reference to the field, in the legacy or the pMBQL layout
+func referencesField(clause interface{}, fieldID int) bool {
+	switch v := clause.(type) {
+	case map[string]interface{}:
+		for _, value := range v {
+			if referencesField(value, fieldID) {
+				return true
+			}
+		}
+	case []interface{}:
+		if len(v) >= 2 && v[0] == "field" {
+			for _, arg := range v[1:] {
+				if id, ok := arg.(float64); ok && int(id) == fieldID {
+					return true
+				}
+			}
+		}
+		for _, value := range v {
+			if referencesField(value, fieldID) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// definitionResponses holds metrics and segments on finance.orders in
+// database 1 and on hr.employees in database 2
+func definitionResponses() map[string]interface{} {
+	return map[string]interface{}{
+		"/api/card": []interface{}{
+			map[string]interface{}{
+				"id": 5, "name": "Active customers", "type": "metric", "database_id": 1, "table_id": 3,
+				"dataset_query": map[string]interface{}{"database": 1, "type": "query", "query": map[string]interface{}{
+					"source-table": 3,
+					"aggregation":  []interface{}{[]interface{}{"distinct", []interface{}{"field", 11, nil}}},
+					"filter":       []interface{}{"=", []interface{}{"field", 12, nil}, "active"},
+				}},
+				"moderation_reviews": []interface{}{map[string]interface{}{"most_recent": true, "status": "verified"}},
+			},
+			map[string]interface{}{"id": 6, "name": "Orders by month", "type": "question", "database_id": 1, "table_id": 3},
+			map[string]interface{}{"id": 7, "name": "Old revenue", "type": "metric", "database_id": 1, "table_id": 3, "archived": true},
+			map[string]interface{}{"id": 8, "name": "Headcount", "type": "metric", "database_id": 2, "table_id": 4},
+		},
+		"/api/metric": []interface{}{
+			map[string]interface{}{"id": 1, "name": "Revenue", "description": "Sum of order totals", "table_id": 3, "definition": map[string]interface{}{
+				"aggregation": []interface{}{[]interface{}{"sum", []interface{}{"field", 13, nil}}},
+			}},
+		},
+		"/api/segment": []interface{}{
+			map[string]interface{}{"id": 1, "name": "Paying customers", "table_id": 3, "definition": map[string]interface{}{
+				"filter": []interface{}{">", []interface{}{"field", 13, nil}, 0},
+			}},
+			map[string]interface{}{"id": 2, "name": "Contractors", "description": "Staff on fixed-term contracts", "table_id": 4, "definition": map[string]interface{}{
+				"filter": []interface{}{"=", []interface{}{"field", 21, nil}, "contract"},
+			}},
+			map[string]interface{}{"id": 3, "name": "Refunded", "table_id": 3, "archived": true},
+		},
+		"/api/table/3/query_metadata": map[string]interface{}{"id": 3, "db_id": 1, "schema": "finance", "name": "orders", "fields": []interface{}{
+			map[string]interface{}{"id": 11, "name": "customer_id"},
+			map[string]interface{}{"id": 12, "name": "status"},
+			map[string]interface{}{"id": 13, "name": "total"},
+		}},
+		"/api/table/4/query_metadata": map[string]interface{}{"id": 4, "db_id": 2, "schema": "hr", "name": "employees", "fields": []interface{}{
+			map[string]interface{}{"id": 21, "name": "kind"},
+		}},
+	}
+}
+
+// definitionNames lists the names of the entries under key in a result
+func definitionNames(result map[string]interface{}, key string) []string {
+	var names []string
+	for _, entry := range result[key].([]interface{}) {
+		names = append(names, entry.(map[string]interface{})["name"].(string))
+	}
+	return names
+}
+
+func TestListMetrics(t *testing.T) {
+	client := newTestClient(t, definitionResponses())
+
+	// Legacy metrics are read from /api/metric when /api/legacy-metric is missing
+	result := decodeResult(t, callTool(t, queryContext(Guardrails{}), handleListMetrics, client, nil))
+	if got := strings.Join(definitionNames(result, "metrics"), ", "); got != "Active customers, Headcount, Revenue" {
+		t.Errorf("metrics = %s, want the live metric cards and the legacy metric", got)
+	}
+	active := result["metrics"].([]interface{})[0].(map[string]interface{})
+	if active["kind"] != "metric" || active["verified"] != true || active["table"] != "finance.orders" ||
+		fmt.Sprint(active["fields"]) != "map[11:customer_id 12:status]" || active["filter"] == nil {
+		t.Errorf("metric = %v, want its table, columns and formula", active)
+	}
+	revenue := result["metrics"].([]interface{})[2].(map[string]interface{})
+	if revenue["kind"] != "legacy_metric" || revenue["database_id"] != 1.0 || fmt.Sprint(revenue["fields"]) != "map[13:total]" {
+		t.Errorf("legacy metric = %v, want its database and columns", revenue)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"database", map[string]interface{}{"database_id": 2}, "Headcount"},
+		{"search", map[string]interface{}{"search": "ORDER TOTALS"}, "Revenue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeResult(t, callTool(t, queryContext(Guardrails{}), handleListMetrics, client, tt.arguments))
+			if got := strings.Join(definitionNames(result, "metrics"), ", "); got != tt.want {
+				t.Errorf("metrics = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Metrics on tables the client may not read are left out
+	result = decodeResult(t, callTool(t, financeContext(), handleListMetrics, client, nil))
+	if got := strings.Join(definitionNames(result, "metrics"), ", "); got != "Active customers, Revenue" {
+		t.Errorf("metrics = %s, want only those on the finance schema", got)
+	}
+}
+
+func TestListSegments(t *testing.T) {
+	client := newTestClient(t, definitionResponses())
+
+	result := decodeResult(t, callTool(t, queryContext(Guardrails{}), handleListSegments, client, nil))
+	if got := strings.Join(definitionNames(result, "segments"), ", "); got != "Contractors, Paying customers" {
+		t.Errorf("segments = %s, want the live segments", got)
+	}
+	paying := result["segments"].([]interface{})[1].(map[string]interface{})
+	if paying["table"] != "finance.orders" || paying["database_id"] != 1.0 || fmt.Sprint(paying["fields"]) != "map[13:total]" || paying["filter"] == nil {
+		t.Errorf("segment = %v, want its table, columns and filter", paying)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"database", map[string]interface{}{"database_id": 2}, "Contractors"},
+		{"table name", map[string]interface{}{"table": "Orders"}, "Paying customers"},
+		{"qualified table", map[string]interface{}{"table": "hr.employees"}, "Contractors"},
+		{"table ID", map[string]interface{}{"table": "3"}, "Paying customers"},
+		{"search", map[string]interface{}{"search": "fixed-term"}, "Contractors"},
+		{"no match", map[string]interface{}{"table": "invoices"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeResult(t, callTool(t, queryContext(Guardrails{}), handleListSegments, client, tt.arguments))
+			if got := strings.Join(definitionNames(result, "segments"), ", "); got != tt.want {
+				t.Errorf("segments = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	result = decodeResult(t, callTool(t, financeContext(), handleListSegments, client, nil))
+	if got := strings.Join(definitionNames(result, "segments"), ", "); got != "Paying customers" {
+		t.Errorf("segments = %s, want only those on the finance schema", got)
+	}
+}
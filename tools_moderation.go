@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerModerationTools adds the content verification tools
+func registerModerationTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"list-verified-cards",
+		mcp.WithDescription("List saved questions that have been verified by a Metabase moderator. Prefer verified questions when answering and mention that a result comes from verified content"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Only include cards querying this database"),
+		),
+	), handleListVerifiedCards)
+
+	r.addAdminWrite(mcp.NewTool(
+		"review-card",
+		mcp.WithDescription("Mark a saved question as verified, or clear its verification to flag it as no longer trustworthy"),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Required(),
+			mcp.Description("ID of the card to review"),
+		),
+		mcp.WithString(
+			"status",
+			mcp.Required(),
+			mcp.Enum("verified", "none"),
+			mcp.Description("\"verified\" to verify the card, \"none\" to remove verification"),
+		),
+		mcp.WithString(
+			"comment",
+			mcp.Description("Optional note explaining the review"),
+		),
+	), handleReviewCard)
+}
+
+func handleListVerifiedCards(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID := request.GetInt("database_id", 0)
+
+	cards, err := listCards(ctx, client)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list cards: %v", err)), nil
+	}
+
+	verified := make([]map[string]interface{}, 0)
+	for _, card := range cards {
+		if card.Archived || !card.Verified() {
+			continue
+		}
+		if databaseID != 0 && card.DatabaseID != databaseID {
+			continue
+		}
+		verified = append(verified, map[string]interface{}{
+			"id":            card.ID,
+			"name":          card.Name,
+			"description":   card.Description,
+			"database_id":   card.DatabaseID,
+			"collection_id": card.CollectionID,
+			"verified":      true,
+		})
+	}
+
+	return jsonResult(map[string]interface{}{
+		"count": len(verified),
+		"cards": verified,
+	})
+}
+
+func handleReviewCard(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cardID, err := request.RequireInt("card_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	status := request.GetString("status", "")
+	review := map[string]interface{}{
+		"moderated_item_id":   cardID,
+		"moderated_item_type": "card",
+	}
+	switch status {
+	case "verified":
+		review["status"] = "verified"
+	case "none":
+		review["status"] = nil
+	default:
+		return mcp.NewToolResultError("status must be \"verified\" or \"none\""), nil
+	}
+	if comment := request.GetString("comment", ""); comment != "" {
+		review["text"] = comment
+	}
+
+	var result map[string]interface{}
+	if err := client.Post(ctx, "/api/moderation-review", review, &result); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to review card: %v", err)), nil
+	}
+
+	return jsonResult(result)
+}
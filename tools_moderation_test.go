@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListVerifiedCards(t *testing.T) {
+	verified := map[string]interface{}{"status": "verified", "most_recent": true}
+	client := newTestClient(t, map[string]interface{}{
+		"/api/card": []interface{}{
+			map[string]interface{}{"id": 1, "name": "Revenue", "database_id": 1, "moderation_reviews": []interface{}{verified}},
+			map[string]interface{}{"id": 2, "name": "Churn", "database_id": 2, "moderation_reviews": []interface{}{verified}},
+			map[string]interface{}{"id": 3, "name": "Old revenue", "database_id": 1, "archived": true, "moderation_reviews": []interface{}{verified}},
+			// Verification was cleared by a later review
+			map[string]interface{}{"id": 4, "name": "Signups", "database_id": 1, "moderation_reviews": []interface{}{
+				map[string]interface{}{"status": nil, "most_recent": true},
+				map[string]interface{}{"status": "verified", "most_recent": false},
+			}},
+			map[string]interface{}{"id": 5, "name": "Draft", "database_id": 1},
+		},
+	})
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      []float64
+	}{
+		{"all databases", nil, []float64{1, 2}},
+		{"one database", map[string]interface{}{"database_id": 1}, []float64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeResult(t, callTool(t, context.Background(), handleListVerifiedCards, client, tt.arguments))
+			cards, _ := result["cards"].([]interface{})
+			if len(cards) != len(tt.want) {
+				t.Fatalf("cards = %v, want IDs %v", cards, tt.want)
+			}
+			for i, id := range tt.want {
+				if card := cards[i].(map[string]interface{}); card["id"] != id {
+					t.Errorf("card %d = %v, want ID %v", i, card, id)
+				}
+			}
+		})
+	}
+}
+
+func TestReviewCard(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		status    interface{}
+		text      interface{}
+	}{
+		{"verify", map[string]interface{}{"status": "verified", "comment": "Checked against finance"}, "verified", "Checked against finance"},
+		{"clear", map[string]interface{}{"status": "none"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMetabase(t, map[string]interface{}{
+				"POST /api/moderation-review": map[string]interface{}{"id": 9},
+			})
+			tt.arguments["card_id"] = 5
+			callTool(t, context.Background(), handleReviewCard, client, tt.arguments)
+			posts := fake.sent("POST")
+			if len(posts) != 1 {
+				t.Fatalf("sent %d reviews, want 1", len(posts))
+			}
+			review := posts[0].Body
+			if review["moderated_item_id"] != float64(5) || review["moderated_item_type"] != "card" || review["status"] != tt.status || review["text"] != tt.text {
+				t.Errorf("review = %v, want status %v and text %v", review, tt.status, tt.text)
+			}
+			if _, ok := review["status"]; !ok {
+				t.Errorf("review = %v, want an explicit status", review)
+			}
+		})
+	}
+}
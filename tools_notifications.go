@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// PulseChannelSpec represents a delivery channel type from /api/pulse/form_input
+type PulseChannelSpec struct {
+	Type             string              `json:"type"`
+	Name             string              `json:"name"`
+	Configured       bool                `json:"configured"`
+	AllowsRecipients bool                `json:"allows_recipients"`
+	Recipients       []string            `json:"recipients"`
+	Schedules        []string            `json:"schedules"`
+	Fields           []PulseChannelField `json:"fields"`
+}
+
+// PulseChannelField represents a configurable field of a delivery channel, such as a Slack channel
+type PulseChannelField struct {
+	Name        string        `json:"name"`
+	DisplayName string        `json:"displayName"`
+	Type        string        `json:"type"`
+	Required    bool          `json:"required"`
+	Options     []interface{} `json:"options"`
+}
+
+// NotificationChannel represents a channel configured via /api/channel, such as a webhook
+type NotificationChannel struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	Description *string `json:"description"`
+	Active      bool    `json:"active"`
+}
+
+// registerNotificationTools adds tools describing alert and subscription delivery targets
+func registerNotificationTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"list-notification-channels",
+		mcp.WithDescription("List the notification channels configured in Metabase (email, Slack channels, webhooks) that alerts and subscriptions can be delivered to"),
+	), handleListNotificationChannels)
+}
+
+func handleListNotificationChannels(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var formInput struct {
+		Channels map[string]PulseChannelSpec `json:"channels"`
+	}
+	if err := client.Get(ctx, "/api/pulse/form_input", &formInput); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch channel configuration: %v", err)), nil
+	}
+
+	channels := make(map[string]interface{})
+	for key, spec := range formInput.Channels {
+		channel := map[string]interface{}{
+			"name":       spec.Name,
+			"configured": spec.Configured,
+			"schedules":  spec.Schedules,
+		}
+		if spec.AllowsRecipients {
+			channel["recipient_types"] = spec.Recipients
+		}
+		for _, field := range spec.Fields {
+			if len(field.Options) > 0 {
+				channel[field.Name+"_options"] = field.Options
+			}
+		}
+		channels[key] = channel
+	}
+
+	// Webhook channels only exist on newer Metabase versions
+	var webhooks []NotificationChannel
+	if err := client.Get(ctx, "/api/channel", &webhooks); err != nil {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch webhook channels: %v", err)), nil
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"channels": channels,
+		"webhooks": webhooks,
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListNotificationChannels(t *testing.T) {
+	formInput := map[string]interface{}{
+		"channels": map[string]interface{}{
+			"email": map[string]interface{}{
+				"name": "Email", "configured": true, "allows_recipients": true,
+				"recipients": []string{"user", "email"}, "schedules": []string{"daily"},
+			},
+			"slack": map[string]interface{}{
+				"name": "Slack", "configured": true, "schedules": []string{"hourly"},
+				"fields": []interface{}{map[string]interface{}{"name": "channel", "options": []string{"#finance", "#ops"}}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		webhooks interface{}
+		want     int
+	}{
+		{"webhooks", []interface{}{map[string]interface{}{"id": 1, "name": "Pager", "type": "channel/http", "active": true}}, 1},
+		// Metabase versions without webhooks answer 404
+		{"no webhook API", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]interface{}{"/api/pulse/form_input": formInput}
+			if tt.webhooks != nil {
+				responses["/api/channel"] = tt.webhooks
+			}
+			client := newTestClient(t, responses)
+			result := decodeResult(t, callTool(t, context.Background(), handleListNotificationChannels, client, nil))
+
+			channels, _ := result["channels"].(map[string]interface{})
+			email, _ := channels["email"].(map[string]interface{})
+			slack, _ := channels["slack"].(map[string]interface{})
+			if email["recipient_types"] == nil || slack["recipient_types"] != nil {
+				t.Errorf("recipient types: email %v, slack %v, want them for email only", email, slack)
+			}
+			if options, _ := slack["channel_options"].([]interface{}); len(options) != 2 {
+				t.Errorf("slack = %v, want its channel options", slack)
+			}
+			if webhooks, _ := result["webhooks"].([]interface{}); len(webhooks) != tt.want {
+				t.Errorf("webhooks = %v, want %d", result["webhooks"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerParameterTools adds tools for discovering valid filter values
+func registerParameterTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"parameter-values",
+		mcp.WithDescription("List the valid values of a dashboard or card filter. For dashboards with linked filters, pass the current values of the other filters so the result is constrained exactly like the Metabase UI"),
+		mcp.WithNumber(
+			"dashboard_id",
+			mcp.Description("Dashboard declaring the filter (either dashboard_id or card_id is required)"),
+		),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Description("Card declaring the filter (either dashboard_id or card_id is required)"),
+		),
+		mcp.WithString(
+			"parameter",
+			mcp.Required(),
+			mcp.Description("Parameter ID, slug or name"),
+		),
+		mcp.WithString(
+			"search",
+			mcp.Description("Only return values matching this text"),
+		),
+		mcp.WithObject(
+			"filters",
+			mcp.Description("Current values of other filters, keyed by parameter ID, slug or name, used to constrain linked filters"),
+		),
+	), handleParameterValues)
+
+	r.add(mcp.NewTool(
+		"field-values",
+		mcp.WithDescription("List the distinct values of a column as Metabase knows them, or search them. Use it to find the exact spelling of category, status or country values before writing WHERE clauses, so queries don't come back empty"),
+		mcp.WithNumber(
+			"field_id",
+			mcp.Description("Field to look up, as listed by list-fields (either field_id or field is required)"),
+		),
+		mcp.WithString(
+			"field",
+			mcp.Description("Column to look up as table.column or schema.table.column (either field_id or field is required)"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database holding the column given by field; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"search",
+			mcp.Description("Only return values containing this text, searched by Metabase across all values rather than the cached list"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description(fmt.Sprintf("Maximum number of values to return (default %d)", defaultFieldValueLimit)),
+		),
+	), handleFieldValues)
+}
+
+func handleParameterValues(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dashboardID := request.GetInt("dashboard_id", 0)
+	cardID := request.GetInt("card_id", 0)
+	key, err := request.RequireString("parameter")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	search := request.GetString("search", "")
+	filters, _ := request.GetArguments()["filters"].(map[string]interface{})
+
+	var (
+		parameters []Parameter
+		target     Parameter
+		values     ParameterValues
+	)
+	switch {
+	case dashboardID != 0:
+		dashboard, err := getDashboard(ctx, client, dashboardID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch dashboard: %v", err)), nil
+		}
+		parameters = dashboard.Parameters
+		target, values, err = dashboardParameterValues(ctx, client, dashboardID, parameters, key, search, filters)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch parameter values: %v", err)), nil
+		}
+	case cardID != 0:
+		card, err := getCard(ctx, client, cardID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch card: %v", err)), nil
+		}
+		parameters = card.Parameters
+		target, values, err = cardParameterValues(ctx, client, cardID, parameters, key, search)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch parameter values: %v", err)), nil
+		}
+	default:
+		return mcp.NewToolResultError("either dashboard_id or card_id is required"), nil
+	}
+
+	linkedTo := make([]string, 0, len(target.FilteringParameters))
+	for _, id := range target.FilteringParameters {
+		if p, ok := findParameter(parameters, id); ok {
+			linkedTo = append(linkedTo, p.Slug)
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"parameter":       target.Slug,
+		"parameter_id":    target.ID,
+		"type":            target.Type,
+		"linked_to":       linkedTo,
+		"values":          flattenValues(values.Values),
+		"has_more_values": values.HasMoreValues,
+	})
+}
+
+// defaultFieldValueLimit is the number of values field-values returns unless asked otherwise
+const defaultFieldValueLimit = 100
+
+// fieldTable is the table a field belongs to, as hydrated by /api/field/:id
+type fieldTable struct {
+	Field
+	Table struct {
+		DBID   int    `json:"db_id"`
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	} `json:"table"`
+}
+
+func handleFieldValues(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var field fieldTable
+	switch {
+	case request.GetInt("field_id", 0) != 0:
+		if err := client.Get(ctx, fmt.Sprintf("/api/field/%d", request.GetInt("field_id", 0)), &field); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch field: %v", err)), nil
+		}
+	case request.GetString("field", "") != "":
+		name := request.GetString("field", "")
+		tableName, columnName, ok := cutLast(name, ".")
+		if !ok {
+			return mcp.NewToolResultError("field must be given as table.column or schema.table.column"), nil
+		}
+		metadata, _, err := databaseMetadata(ctx, client, request)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+		}
+		table, ok := findTable(metadata, tableName)
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", tableName, metadata.ID)), nil
+		}
+		found := false
+		for _, f := range table.Fields {
+			if strings.EqualFold(f.Name, columnName) {
+				field.Field, found = f, true
+				break
+			}
+		}
+		if !found {
+			return mcp.NewToolResultError(fmt.Sprintf("column %q not found in table %s; use describe-table to see its columns", columnName, table.qualifiedName())), nil
+		}
+		field.Table.DBID, field.Table.Name, field.Table.Schema = metadata.ID, table.Name, table.Schema
+	default:
+		return mcp.NewToolResultError("either field_id or field is required"), nil
+	}
+	if err := checkTableAccess(ctx, field.Table.DBID, field.Table.Schema); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	limit := request.GetInt("limit", defaultFieldValueLimit)
+	if limit <= 0 {
+		limit = defaultFieldValueLimit
+	}
+	search := request.GetString("search", "")
+
+	var values ParameterValues
+	if search != "" {
+		query := url.Values{"value": {search}, "limit": {fmt.Sprint(limit + 1)}}
+		if err := client.Get(ctx, fmt.Sprintf("/api/field/%d/search/%d?%s", field.ID, field.ID, query.Encode()), &values.Values); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to search field values: %v", err)), nil
+		}
+	} else if err := client.Get(ctx, fmt.Sprintf("/api/field/%d/values", field.ID), &values); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch field values: %v", err)), nil
+	}
+	if len(values.Values) > limit {
+		values.Values, values.HasMoreValues = values.Values[:limit], true
+	}
+
+	flattened := flattenValues(values.Values)
+
+	table := field.Table.Name
+	if field.Table.Schema != "" {
+		table = field.Table.Schema + "." + table
+	}
+	result := map[string]interface{}{
+		"field_id":        field.ID,
+		"table":           table,
+		"field":           field.Name,
+		"values":          flattened,
+		"has_more_values": values.HasMoreValues,
+	}
+	if len(flattened) == 0 && search == "" {
+		result["message"] = "Metabase keeps no value list for this field; pass search, or run a SELECT DISTINCT with metabase-tool"
+	}
+	return jsonResult(result)
+}
+
+// flattenValues turns the [value] or [value, display name] tuples Metabase
+// returns into plain values and value/label pairs
+func flattenValues(tuples [][]interface{}) []interface{} {
+	flattened := make([]interface{}, 0, len(tuples))
+	for _, tuple := range tuples {
+		switch len(tuple) {
+		case 0:
+		case 1:
+			flattened = append(flattened, tuple[0])
+		default:
+			flattened = append(flattened, map[string]interface{}{"value": tuple[0], "label": tuple[1]})
+		}
+	}
+	return flattened
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
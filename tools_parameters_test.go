@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParameterValues(t *testing.T) {
+	// The city filter is linked to the state filter only
+	parameters := []interface{}{
+		map[string]interface{}{"id": "a1", "slug": "state", "name": "State", "type": "string/="},
+		map[string]interface{}{"id": "b2", "slug": "city", "name": "City", "type": "string/=", "filteringParameters": []string{"a1"}},
+		map[string]interface{}{"id": "c3", "slug": "channel", "name": "Channel", "type": "string/="},
+	}
+	values := map[string]interface{}{"values": [][]interface{}{{"Austin"}, {"Dallas", "Dallas, TX"}}, "has_more_values": true}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		path      string
+		query     map[string][]string
+		wantErr   bool
+	}{
+		{"linked filter", map[string]interface{}{"dashboard_id": 3, "parameter": "city", "filters": map[string]interface{}{"state": []interface{}{"TX", "CA"}, "Channel": "web"}},
+			"/api/dashboard/3/params/b2/values", map[string][]string{"a1": {"TX", "CA"}}, false},
+		{"search", map[string]interface{}{"dashboard_id": 3, "parameter": "b2", "search": "Aus"},
+			"/api/dashboard/3/params/b2/search/Aus", map[string][]string{}, false},
+		{"card", map[string]interface{}{"card_id": 5, "parameter": "City"},
+			"/api/card/5/params/b2/values", map[string][]string{}, false},
+		{"unknown filter", map[string]interface{}{"dashboard_id": 3, "parameter": "city", "filters": map[string]interface{}{"region": "south"}}, "", nil, true},
+		{"unknown parameter", map[string]interface{}{"card_id": 5, "parameter": "zip"}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMetabase(t, map[string]interface{}{
+				"/api/dashboard/3":                      map[string]interface{}{"id": 3, "parameters": parameters},
+				"/api/card/5":                           map[string]interface{}{"id": 5, "parameters": parameters},
+				"/api/dashboard/3/params/b2/values":     values,
+				"/api/dashboard/3/params/b2/search/Aus": values,
+				"/api/card/5/params/b2/values":          values,
+			})
+			result := callTool(t, context.Background(), handleParameterValues, client, tt.arguments)
+			if tt.wantErr {
+				if !result.IsError {
+					t.Errorf("result = %s, want an error", resultText(result))
+				}
+				return
+			}
+			decoded := decodeResult(t, result)
+			want := []interface{}{"Austin", map[string]interface{}{"value": "Dallas", "label": "Dallas, TX"}}
+			if decoded["parameter"] != "city" || !reflect.DeepEqual(decoded["values"], want) || decoded["has_more_values"] != true {
+				t.Errorf("result = %v", decoded)
+			}
+			if tt.arguments["dashboard_id"] != nil && !reflect.DeepEqual(decoded["linked_to"], []interface{}{"state"}) {
+				t.Errorf("linked_to = %v, want [state]", decoded["linked_to"])
+			}
+
+			requests := fake.sent("GET")
+			last := requests[len(requests)-1]
+			if last.Path != tt.path || len(last.Query) != len(tt.query) {
+				t.Fatalf("requested %s?%s, want %s with %v", last.Path, last.Query.Encode(), tt.path, tt.query)
+			}
+			for key, want := range tt.query {
+				if !reflect.DeepEqual(last.Query[key], want) {
+					t.Errorf("query %s = %v, want %v", key, last.Query[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFieldValues(t *testing.T) {
+	client, fake := newFakeMetabase(t, map[string]interface{}{
+		"/api/database/1/metadata": ordersMetadata(),
+		"/api/field/12/values":     map[string]interface{}{"values": [][]interface{}{{"paid"}, {"refunded"}, {"shipped"}}, "has_more_values": false},
+		"/api/field/12/search/12":  [][]interface{}{{"refunded"}},
+		"/api/field/20":            map[string]interface{}{"id": 20, "name": "salary", "table": map[string]interface{}{"db_id": 1, "name": "salaries", "schema": "hr"}},
+	})
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		values    []interface{}
+		more      bool
+	}{
+		{"by name", map[string]interface{}{"field": "orders.status"}, []interface{}{"paid", "refunded", "shipped"}, false},
+		{"limit", map[string]interface{}{"field": "public.orders.STATUS", "limit": 2}, []interface{}{"paid", "refunded"}, true},
+		{"search", map[string]interface{}{"field": "orders.status", "search": "ref"}, []interface{}{"refunded"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeResult(t, callTool(t, ctx, handleFieldValues, client, tt.arguments))
+			if result["table"] != "public.orders" || result["field_id"] != 12.0 {
+				t.Errorf("result = %v, want public.orders.status", result)
+			}
+			if !reflect.DeepEqual(result["values"], tt.values) || result["has_more_values"] != tt.more {
+				t.Errorf("values = %v, more %v, want %v, %v", result["values"], result["has_more_values"], tt.values, tt.more)
+			}
+		})
+	}
+	requests := fake.sent("GET")
+	if search := requests[len(requests)-1]; search.Query.Get("value") != "ref" {
+		t.Errorf("search sent %v, want value=ref", search.Query)
+	}
+
+	for name, arguments := range map[string]map[string]interface{}{
+		"unknown column": {"field": "orders.total"},
+		"no table":       {"field": "status"},
+		"other schema":   {"field_id": 20},
+	} {
+		result := callTool(t, financeContext(), handleFieldValues, client, arguments)
+		if !result.IsError {
+			t.Errorf("%s: result = %s, want an error", name, resultText(result))
+		}
+	}
+}
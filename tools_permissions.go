@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// CollectionPermissionGraph represents the collection permission graph
+type CollectionPermissionGraph struct {
+	Revision int                          `json:"revision"`
+	Groups   map[string]map[string]string `json:"groups"`
+}
+
+// PermissionGroup represents a Metabase permission group
+type PermissionGroup struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	MemberCount int    `json:"member_count"`
+}
+
+// Collection represents a Metabase collection
+type Collection struct {
+	ID       interface{} `json:"id"`
+	Name     string      `json:"name"`
+	Location string      `json:"location"`
+	Archived bool        `json:"archived"`
+}
+
+// collectionAccessLabels maps graph values to the names used in the Metabase UI
+var collectionAccessLabels = map[string]string{
+	"write": "curate",
+	"read":  "view",
+	"none":  "no access",
+}
+
+// registerPermissionTools adds the permission administration tools
+func registerPermissionTools(r *toolRegistry) {
+	r.addAdmin(mcp.NewTool(
+		"get-collection-permissions",
+		mcp.WithDescription("Show which permission groups can view or curate which collections"),
+		mcp.WithNumber(
+			"group_id",
+			mcp.Description("Only show grants for this group"),
+		),
+		mcp.WithString(
+			"collection_id",
+			mcp.Description("Only show grants for this collection ID, or \"root\" for Our analytics"),
+		),
+	), handleGetCollectionPermissions)
+
+	r.addAdminWrite(mcp.NewTool(
+		"set-collection-permission",
+		mcp.WithDescription("Change a group's access to a collection. Shows a diff of the permission graph and only applies it when confirm is true"),
+		mcp.WithNumber(
+			"group_id",
+			mcp.Required(),
+			mcp.Description("Permission group to change"),
+		),
+		mcp.WithString(
+			"collection_id",
+			mcp.Required(),
+			mcp.Description("Collection ID, or \"root\" for Our analytics"),
+		),
+		mcp.WithString(
+			"access",
+			mcp.Required(),
+			mcp.Enum("write", "read", "none"),
+			mcp.Description("write (curate), read (view) or none"),
+		),
+		withConfirm(),
+	), handleSetCollectionPermission)
+}
+
+func handleGetCollectionPermissions(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	groupFilter := request.GetInt("group_id", 0)
+	collectionFilter := request.GetString("collection_id", "")
+
+	var graph CollectionPermissionGraph
+	if err := client.Get(ctx, "/api/collection/graph", &graph); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch collection permissions: %v", err)), nil
+	}
+	groupNames, collectionNames, err := permissionNames(ctx, client)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	grants := make([]map[string]interface{}, 0)
+	for groupID, collections := range graph.Groups {
+		if groupFilter != 0 && groupID != strconv.Itoa(groupFilter) {
+			continue
+		}
+		for collectionID, access := range collections {
+			if collectionFilter != "" && collectionID != collectionFilter {
+				continue
+			}
+			if access == "none" {
+				continue
+			}
+			grants = append(grants, map[string]interface{}{
+				"group_id":        groupID,
+				"group":           groupNames[groupID],
+				"collection_id":   collectionID,
+				"collection":      collectionNames[collectionID],
+				"access":          access,
+				"access_ui_label": collectionAccessLabels[access],
+			})
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"revision": graph.Revision,
+		"grants":   grants,
+	})
+}
+
+func handleSetCollectionPermission(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	groupID, err := request.RequireInt("group_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	collectionID, err := request.RequireString("collection_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	access, err := request.RequireString("access")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var graph CollectionPermissionGraph
+	if err := client.Get(ctx, "/api/collection/graph", &graph); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch collection permissions: %v", err)), nil
+	}
+	groupNames, collectionNames, err := permissionNames(ctx, client)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	groupKey := strconv.Itoa(groupID)
+	if _, ok := groupNames[groupKey]; !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("permission group %d does not exist", groupID)), nil
+	}
+	if _, ok := collectionNames[collectionID]; !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("collection %s does not exist", collectionID)), nil
+	}
+
+	current := "none"
+	if existing, ok := graph.Groups[groupKey][collectionID]; ok {
+		current = existing
+	}
+	diff := map[string]interface{}{
+		"group":      groupNames[groupKey],
+		"collection": collectionNames[collectionID],
+		"from":       current,
+		"to":         access,
+	}
+	if current == access {
+		return jsonResult(map[string]interface{}{
+			"applied": false,
+			"message": "permission already set, nothing to change",
+			"diff":    diff,
+		})
+	}
+
+	action := fmt.Sprintf("set %s access for group %s on collection %s", access, groupNames[groupKey], collectionNames[collectionID])
+	if !confirmed(request) {
+		return previewResult(action, diff)
+	}
+
+	// Only the changed group is sent; the revision guards against concurrent edits
+	update := CollectionPermissionGraph{
+		Revision: graph.Revision,
+		Groups: map[string]map[string]string{
+			groupKey: {collectionID: access},
+		},
+	}
+	if err := client.Put(ctx, "/api/collection/graph", update, nil); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to update collection permissions: %v", err)), nil
+	}
+
+	return jsonResult(map[string]interface{}{
+		"applied": true,
+		"action":  action,
+		"diff":    diff,
+	})
+}
+
+// permissionNames resolves group and collection IDs to names, keyed as in the permission graph
+func permissionNames(ctx context.Context, client *MetabaseClient) (map[string]string, map[string]string, error) {
+	var groups []PermissionGroup
+	if err := client.Get(ctx, "/api/permissions/group", &groups); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch permission groups: %v", err)
+	}
+	groupNames := make(map[string]string, len(groups))
+	for _, group := range groups {
+		groupNames[strconv.Itoa(group.ID)] = group.Name
+	}
+
+	var collections []Collection
+	if err := client.Get(ctx, "/api/collection", &collections); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch collections: %v", err)
+	}
+	collectionNames := map[string]string{"root": "Our analytics"}
+	for _, collection := range collections {
+		if id, ok := collection.ID.(float64); ok {
+			collectionNames[strconv.Itoa(int(id))] = collection.Name
+		}
+	}
+
+	return groupNames, collectionNames, nil
+}
+
+// rootCollectionName is the name the Metabase UI gives the root collection
+const rootCollectionName = "Our analytics"
+
+// resolveCollection finds a collection given by ID, name or path of names
+// such as Finance/Reports, ignoring case. "root" and the root collection's
+// name resolve to a nil ID. It returns the collection's ID and path.
+func resolveCollection(ctx context.Context, client *MetabaseClient, ref string) (*int, string, error) {
+	ref = strings.Trim(strings.TrimSpace(ref), "/")
+	if strings.EqualFold(ref, "root") || strings.EqualFold(ref, rootCollectionName) {
+		return nil, rootCollectionName, nil
+	}
+
+	var collections []Collection
+	if err := client.Get(ctx, "/api/collection", &collections); err != nil {
+		return nil, "", fmt.Errorf("failed to fetch collections: %v", err)
+	}
+	names := make(map[string]string, len(collections))
+	for _, collection := range collections {
+		if id, ok := collection.ID.(float64); ok {
+			names[strconv.Itoa(int(id))] = collection.Name
+		}
+	}
+
+	// Collections are matched on their ID, name or path below the root
+	wantedID, byID := strconv.Atoi(ref)
+	var found []int
+	var paths []string
+	for _, collection := range collections {
+		id, ok := collection.ID.(float64)
+		if !ok || collection.Archived {
+			continue
+		}
+		path := make([]string, 0)
+		for _, ancestor := range strings.Split(strings.Trim(collection.Location, "/"), "/") {
+			if name, ok := names[ancestor]; ok {
+				path = append(path, name)
+			}
+		}
+		path = append(path, collection.Name)
+		fullPath := strings.Join(path, "/")
+		if (byID == nil && int(id) == wantedID) || strings.EqualFold(collection.Name, ref) || strings.EqualFold(fullPath, ref) {
+			found = append(found, int(id))
+			paths = append(paths, fullPath)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, "", fmt.Errorf("unknown collection %q; give its ID, name or path such as Finance/Reports, or root", ref)
+	case 1:
+		return &found[0], paths[0], nil
+	}
+	candidates := make([]string, len(found))
+	for i := range found {
+		candidates[i] = fmt.Sprintf("%q (%d)", paths[i], found[i])
+	}
+	return nil, "", fmt.Errorf("collection name %q is ambiguous; give the ID or path of one of %s", ref, strings.Join(candidates, ", "))
+}
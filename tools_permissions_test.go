@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// permissionResponses are the answers of a fake Metabase with two groups and a Finance collection
+func permissionResponses() map[string]interface{} {
+	return map[string]interface{}{
+		"GET /api/collection/graph": map[string]interface{}{
+			"revision": 12,
+			"groups": map[string]interface{}{
+				"1": map[string]interface{}{"root": "read", "3": "none"},
+				"2": map[string]interface{}{"root": "write", "3": "write"},
+			},
+		},
+		"PUT /api/collection/graph": map[string]interface{}{},
+		"/api/permissions/group": []interface{}{
+			map[string]interface{}{"id": 1, "name": "All Users"},
+			map[string]interface{}{"id": 2, "name": "Finance"},
+		},
+		"/api/collection": []interface{}{
+			map[string]interface{}{"id": "root", "name": "Our analytics"},
+			map[string]interface{}{"id": 3, "name": "Finance"},
+		},
+	}
+}
+
+func TestGetCollectionPermissions(t *testing.T) {
+	client := newTestClient(t, permissionResponses())
+	result := decodeResult(t, callTool(t, context.Background(), handleGetCollectionPermissions, client, map[string]interface{}{"collection_id": "3"}))
+
+	// Grants of no access are left out
+	grants, _ := result["grants"].([]interface{})
+	want := []interface{}{map[string]interface{}{
+		"group_id": "2", "group": "Finance", "collection_id": "3", "collection": "Finance", "access": "write", "access_ui_label": "curate",
+	}}
+	if result["revision"] != float64(12) || !reflect.DeepEqual(grants, want) {
+		t.Errorf("result = %v, want grants %v", result, want)
+	}
+}
+
+func TestSetCollectionPermission(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		applied   bool
+		wantErr   bool
+	}{
+		{"grant", map[string]interface{}{"group_id": 1, "collection_id": "3", "access": "read"}, true, false},
+		{"unchanged", map[string]interface{}{"group_id": 2, "collection_id": "3", "access": "write"}, false, false},
+		{"unknown group", map[string]interface{}{"group_id": 9, "collection_id": "3", "access": "read"}, false, true},
+		{"unknown collection", map[string]interface{}{"group_id": 1, "collection_id": "8", "access": "read"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMetabase(t, permissionResponses())
+			if preview := callTool(t, context.Background(), handleSetCollectionPermission, client, tt.arguments); preview.IsError != tt.wantErr {
+				t.Fatalf("preview = %s, want error %v", resultText(preview), tt.wantErr)
+			}
+			tt.arguments["confirm"] = true
+			callTool(t, context.Background(), handleSetCollectionPermission, client, tt.arguments)
+
+			puts := fake.sent("PUT")
+			if !tt.applied {
+				if len(puts) != 0 {
+					t.Errorf("sent %v, want no update", puts)
+				}
+				return
+			}
+			// Only the changed grant is sent, with the revision it was read at
+			want := map[string]interface{}{"revision": float64(12), "groups": map[string]interface{}{"1": map[string]interface{}{"3": "read"}}}
+			if len(puts) != 1 || !reflect.DeepEqual(puts[0].Body, want) {
+				t.Errorf("sent %v, want one update %v", puts, want)
+			}
+		})
+	}
+}
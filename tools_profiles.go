@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerProfileTools adds the environment profile tools
+func registerProfileTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"list-profiles",
+		mcp.WithDescription("List the configured environment profiles (dev, staging, prod, ...) with their host, default database, database registry and guardrails. Pass a profile name as the profile argument of any tool to run it against that environment"),
+	), r.handleListProfiles)
+}
+
+func (r *toolRegistry) handleListProfiles(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cfg := r.currentConfig()
+	names := r.profileNames()
+	if name := request.GetString("profile", ""); name != "" {
+		names = []string{name}
+	}
+
+	profiles := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		profile := cfg.Profiles[name]
+		level := profile.GuardrailLevel
+		if level == "" {
+			level = "standard"
+		}
+		entry := map[string]interface{}{
+			"name":            name,
+			"default":         name == cfg.DefaultProfile,
+			"host":            profile.Host,
+			"database_id":     profile.DatabaseID,
+			"databases":       profile.Databases,
+			"guardrail_level": level,
+			"guardrails":      profile.Guardrails,
+		}
+		if len(profile.AllowedDatabases) > 0 {
+			entry["allowed_databases"] = profile.AllowedDatabases
+		}
+		if len(profile.DeniedDatabases) > 0 {
+			entry["denied_databases"] = profile.DeniedDatabases
+		}
+		profiles = append(profiles, entry)
+	}
+
+	return jsonResult(profiles)
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerQueryTools adds the native query tool
+func registerQueryTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"metabase-tool",
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Metabase mcp can access dashboards, execute queries"),
+		}, nativeQueryArguments()...)...,
+	), r.handleNativeQuery)
+}
+
+// nativeQueryArguments are the arguments of the tools running native queries
+func nativeQueryArguments() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString(
+			"query",
+			mcp.Description("The query to execute against the the db; required unless cursor is given"),
+		),
+		mcp.WithString(
+			"cursor",
+			mcp.Description("next_cursor of a paged result, to fetch its next page; replaces query, database_id, parameters, page and page_size"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to run the query against; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"database",
+			mcp.Description("Name of the database to run the query against, from the profile's database registry or as shown in Metabase; an alternative to database_id"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+		mcp.WithBoolean(
+			"adaptive_limit",
+			mcp.Description("When the result is too large for the output budget, re-run it with a smaller LIMIT and return that reduced view"),
+		),
+		mcp.WithObject(
+			"parameters",
+			mcp.Description("Values for {{variable}} template tags, keyed by name. A plain value has its type inferred from the column it is compared to (or from the value); use {\"value\": ..., \"type\": \"text|number|date|field\", \"field\": \"table.column\"} to be explicit. Variables used as a whole condition (WHERE {{x}}) become field filters"),
+		),
+		mcp.WithNumber(
+			"page_size",
+			mcp.Description("Return the result of a SELECT in pages of this many rows"),
+		),
+		mcp.WithNumber(
+			"page",
+			mcp.Description("Page to return when page_size is set, starting at 1 (default 1)"),
+		),
+		mcp.WithBoolean(
+			"count_total",
+			mcp.Description("With page_size, also run a COUNT(*) of the query when the total cannot be derived from the page, to report total_rows and page_count"),
+		),
+		mcp.WithNumber(
+			"max_rows",
+			mcp.Description("Return at most this many rows. Metabase stops reading there, and the response reports rows_dropped and whether the limit was reached; use page_size instead to read further"),
+		),
+		mcp.WithString(
+			"binary_columns",
+			mcp.Enum(binaryExclude, binaryTruncate, binaryBase64),
+			mcp.Description("How to return binary (BLOB/bytea) columns: exclude them (default), truncate each value to a hex preview with its size, or encode values as base64"),
+		),
+		mcp.WithString(
+			"json_columns",
+			mcp.Enum(jsonRaw, jsonPretty),
+			mcp.Description("How to return JSON columns: raw as Metabase returns them (usually escaped strings), or pretty as nested JSON"),
+		),
+		mcp.WithArray(
+			"json_flatten",
+			mcp.Items(map[string]interface{}{"type": "string"}),
+			mcp.Description("JSON columns to flatten into additional columns: \"column\" adds one column per top-level key, \"column:$.path\" adds one column for the JSONPath"),
+		),
+		mcp.WithObject(
+			"json_extract",
+			mcp.Description("Replace the values of JSON columns with the match of a JSONPath, keyed by column name, e.g. {\"payload\": \"$.items[*].sku\"}"),
+		),
+	}
+}
+
+// withPriorityArgument adds the priority argument used by query-running tools
+func withPriorityArgument() mcp.ToolOption {
+	return mcp.WithString(
+		"priority",
+		mcp.Enum("interactive", "batch"),
+		mcp.Description("interactive (default) for queries a user is waiting on, batch for background or bulk work that may wait behind them"),
+	)
+}
+
+// withTimeoutArgument adds the timeout_seconds argument used by query-running tools
+func withTimeoutArgument() mcp.ToolOption {
+	return mcp.WithNumber(
+		"timeout_seconds",
+		mcp.Description("How long each request to Metabase may take for this call, overriding the server's timeout; raise it for long analytical queries"),
+	)
+}
+
+// selectDatabase returns the database a call runs against: its database_id
+// argument, the database named by its database argument, or the profile's
+// database
+func selectDatabase(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (int, error) {
+	profile := profileFromContext(ctx)
+	name := request.GetString("database", "")
+	if request.GetInt("database_id", 0) != 0 || name == "" {
+		return requestedDatabase(ctx, request)
+	}
+
+	// Registry names take precedence over the names shown in Metabase
+	for registered, id := range profile.Databases {
+		if strings.EqualFold(registered, name) {
+			return id, checkDatabaseAccess(ctx, id)
+		}
+	}
+	databases, err := listDatabases(ctx, client)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up database %q: %w", name, err)
+	}
+	available := make([]string, 0, len(databases))
+	for _, database := range databases {
+		if strings.EqualFold(database.Name, name) {
+			return database.ID, checkDatabaseAccess(ctx, database.ID)
+		}
+		if checkDatabaseAccess(ctx, database.ID) == nil {
+			available = append(available, fmt.Sprintf("%q (%d)", database.Name, database.ID))
+		}
+	}
+	return 0, fmt.Errorf("unknown database %q; available databases: %s", name, strings.Join(available, ", "))
+}
+
+// requestedDatabase returns the call's database_id argument, or the profile's
+// database when it is not given. Either way the database must be within the
+// profile's database policy and the calling client's scope, so leaving the
+// argument out does not get around the check.
+func requestedDatabase(ctx context.Context, request mcp.CallToolRequest) (int, error) {
+	databaseID := request.GetInt("database_id", profileFromContext(ctx).DatabaseID)
+	return databaseID, checkDatabaseAccess(ctx, databaseID)
+}
+
+// withCallTimeout applies the call's timeout_seconds argument, if given, to ctx
+func withCallTimeout(ctx context.Context, request mcp.CallToolRequest) context.Context {
+	if seconds := request.GetFloat("timeout_seconds", 0); seconds > 0 {
+		return withRequestTimeout(ctx, time.Duration(seconds*float64(time.Second)))
+	}
+	return ctx
+}
+
+func (r *toolRegistry) handleNativeQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	// Continue a paged result where its cursor left off
+	if token := request.GetString("cursor", ""); token != "" {
+		cursor, err := decodePageCursor(token)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		cursor.apply(request.GetArguments())
+	}
+
+	// Extract query (required)
+	query, err := request.RequireString("query")
+	if err != nil || query == "" {
+		return mcp.NewToolResultError("query is required and must be a string"), nil
+	}
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+	profile := profileFromContext(ctx)
+	databaseID, err := selectDatabase(ctx, client, request)
+	if err != nil {
+		if errors.Is(err, errAccessDenied) {
+			r.stats.recordPolicy(ctx, policyName(err))
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if profile.Guardrails.ReadOnly && !isSelectQuery(query) {
+		r.stats.recordPolicy(ctx, "read_only")
+		return mcp.NewToolResultError(fmt.Sprintf("profile %s is read-only: only SELECT queries are allowed", profile.Name)), nil
+	}
+
+	// Metabase runs one statement per query: reject several, or run them in turn
+	if statements := splitStatements(query); len(statements) > 1 {
+		return r.handleMultiStatement(ctx, client, request, statements)
+	}
+
+	// Prepend the session's virtual views the query reads from
+	original := query
+	query, appliedViews := r.views.expand(sessionID(ctx), query)
+
+	pageSize := request.GetInt("page_size", 0)
+	page := request.GetInt("page", 1)
+	if pageSize > 0 && !isSelectQuery(query) {
+		return mcp.NewToolResultError("page_size is only supported for SELECT queries"), nil
+	}
+	if page < 1 {
+		page = 1
+	}
+	maxRows := request.GetInt("max_rows", 0)
+	if maxRows > 0 && pageSize > 0 {
+		return mcp.NewToolResultError("max_rows cannot be combined with page_size, which already bounds the rows returned"), nil
+	}
+
+	// Build template tags for {{variables}}, inferring types the agent left out
+	native := func(sql string) MetabaseQuery {
+		return newNativeQuery(databaseID, sql)
+	}
+	var tagInfo map[string]TemplateTagInfo
+	if args, ok := request.GetArguments()["parameters"].(map[string]interface{}); ok && len(args) > 0 {
+		tags, values, infos, err := buildTemplateTags(ctx, client, databaseID, query, parseTemplateParameters(args))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		tagInfo = infos
+		native = func(sql string) MetabaseQuery {
+			q := newNativeQuery(databaseID, sql)
+			q.Native.TemplateTags = tags
+			q.Parameters = values
+			return q
+		}
+	}
+
+	// Let Metabase's constraints middleware stop reading at max_rows
+	if maxRows > 0 {
+		build := native
+		native = func(sql string) MetabaseQuery {
+			q := build(sql)
+			q.Constraints = &QueryConstraints{MaxResults: maxRows, MaxResultsBareRows: maxRows}
+			return q
+		}
+	}
+
+	sent := query
+	if pageSize > 0 {
+		sent = pageQuery(query, page, pageSize)
+	}
+	outcome, err := r.executeNative(ctx, client, native(sent))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !outcome.Parsed {
+		return outcome.rawResult()
+	}
+	// Trim rows Metabase returned beyond max_rows anyway, e.g. from its cache
+	var rowLimit map[string]interface{}
+	if maxRows > 0 {
+		dropped := 0
+		if rows := outcome.Response.Data.Rows; len(rows) > maxRows {
+			dropped = len(rows) - maxRows
+			outcome.Response.Data.Rows = rows[:maxRows]
+			outcome.Response.RowCount = maxRows
+		}
+		rowLimit = map[string]interface{}{
+			"max_rows":      maxRows,
+			"rows_dropped":  dropped,
+			"limit_reached": len(outcome.Response.Data.Rows) == maxRows,
+		}
+	}
+	cfg := r.currentConfig()
+	binaryMode := request.GetString("binary_columns", cfg.BinaryColumns)
+	binaryNotes := handleBinaryColumns(&outcome.Response.Data, binaryMode)
+	jsonOptions := parseJSONColumnOptions(request.GetArguments(), cfg.JSONColumns)
+	jsonNotes, err := handleJSONColumns(&outcome.Response.Data, jsonOptions)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result := outcome.result()
+	if len(binaryNotes) > 0 {
+		result["binary_columns"] = binaryNotes
+	}
+	if len(jsonNotes) > 0 {
+		result["json_columns"] = jsonNotes
+	}
+	if len(appliedViews) > 0 {
+		result["views_applied"] = appliedViews
+	}
+	if rowLimit != nil {
+		result["max_rows"] = rowLimit
+	}
+	if len(tagInfo) > 0 {
+		result["parameter_types"] = tagInfo
+	}
+	if pageSize > 0 && outcome.Response.Status != "failed" {
+		info := r.pagination(ctx, client, native, query, page, pageSize, outcome.Response.RowCount, request.GetBool("count_total", false))
+		if info["has_more"] == true {
+			parameters, _ := request.GetArguments()["parameters"].(map[string]interface{})
+			next := pageCursor{Query: original, DatabaseID: databaseID, Parameters: parameters, Page: page + 1, PageSize: pageSize}
+			info["next_cursor"] = next.encode()
+		}
+		result["pagination"] = info
+	}
+	if profile.Guardrails.LintQueries {
+		if findings := lintQuery(query); len(findings) > 0 {
+			r.stats.recordPolicy(ctx, "lint_findings")
+			result["lint"] = findings
+		}
+	}
+
+	// Re-run oversized results with a smaller LIMIT instead of truncating blindly
+	if pageSize == 0 && request.GetBool("adaptive_limit", profile.Guardrails.AdaptiveLimit) {
+		if limit := r.budget.rowsWithinBudget(result); limit >= 0 && isSelectQuery(query) {
+			reduced, err := r.executeNative(ctx, client, native(limitQuery(query, limit)))
+			if err == nil && reduced.Parsed && reduced.Response.Status != "failed" {
+				r.stats.recordPolicy(ctx, "adaptive_limit")
+				binaryNotes = handleBinaryColumns(&reduced.Response.Data, binaryMode)
+				jsonNotes, _ = handleJSONColumns(&reduced.Response.Data, jsonOptions)
+				result = reduced.result()
+				if len(binaryNotes) > 0 {
+					result["binary_columns"] = binaryNotes
+				}
+				if len(jsonNotes) > 0 {
+					result["json_columns"] = jsonNotes
+				}
+				result["reduced_view"] = map[string]interface{}{
+					"limit":              limit,
+					"original_row_count": outcome.Response.RowCount,
+					"message":            fmt.Sprintf("The full result was too large; this is a re-executed view limited to the first %d rows", limit),
+				}
+			}
+		}
+	}
+
+	return r.budget.apply(ctx, result)
+}
+
+// handleMultiStatement answers a query holding several statements as
+// METABASE_MULTI_STATEMENT says: it is rejected, or its statements run one
+// after the other, stopping at the first that fails
+func (r *toolRegistry) handleMultiStatement(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest, statements []string) (*mcp.CallToolResult, error) {
+	if r.currentConfig().MultiStatement != multiStatementSplit {
+		r.stats.recordPolicy(ctx, "multi_statement")
+		return mcp.NewToolResultError(fmt.Sprintf("the query holds %d statements, but Metabase runs one statement per query; send them one at a time or with batch-query", len(statements))), nil
+	}
+	if request.GetInt("page_size", 0) > 0 {
+		return mcp.NewToolResultError("page_size is only supported for a single statement"), nil
+	}
+
+	shared := make(map[string]interface{})
+	for name, value := range request.GetArguments() {
+		switch name {
+		case "query", "cursor", "parameters", "page", "count_total":
+		default:
+			shared[name] = value
+		}
+	}
+	// Each statement gets the parameters its own template tags use
+	parameters, _ := request.GetArguments()["parameters"].(map[string]interface{})
+	batch := make([]batchStatement, len(statements))
+	for i, statement := range statements {
+		batch[i] = batchStatement{Label: fmt.Sprintf("statement_%d", i+1), Query: statement}
+		for _, match := range templateTagPattern.FindAllStringSubmatch(statement, -1) {
+			if value, ok := parameters[match[1]]; ok {
+				if batch[i].Parameters == nil {
+					batch[i].Parameters = make(map[string]interface{})
+				}
+				batch[i].Parameters[match[1]] = value
+			}
+		}
+	}
+	return r.runStatements(ctx, client, shared, batch, 1, true)
+}
+
+// pagination describes the returned page. The total row count is derived when
+// the page is the last one, and otherwise counted when countTotal is set.
+func (r *toolRegistry) pagination(ctx context.Context, client *MetabaseClient, native func(string) MetabaseQuery, query string, page, pageSize, rowsOnPage int, countTotal bool) map[string]interface{} {
+	info := map[string]interface{}{
+		"page":         page,
+		"page_size":    pageSize,
+		"rows_on_page": rowsOnPage,
+	}
+
+	total := -1
+	switch {
+	case rowsOnPage < pageSize && (rowsOnPage > 0 || page == 1):
+		total = (page-1)*pageSize + rowsOnPage
+		info["total_source"] = "derived"
+	case countTotal:
+		counted, err := r.executeNative(ctx, client, native(countQuery(query)))
+		if err == nil && counted.Parsed && len(counted.Response.Data.Rows) == 1 && len(counted.Response.Data.Rows[0]) == 1 {
+			if n, ok := counted.Response.Data.Rows[0][0].(float64); ok {
+				total = int(n)
+				info["total_source"] = "count"
+			}
+		}
+		if total < 0 {
+			info["total_error"] = "failed to count the rows of the query"
+		}
+	}
+
+	if total >= 0 {
+		info["total_rows"] = total
+		info["page_count"] = (total + pageSize - 1) / pageSize
+		info["has_more"] = page*pageSize < total
+	} else {
+		info["has_more"] = rowsOnPage == pageSize
+	}
+	return info
+}
+
+// pageCursor is the continuation token of a paged query result. It carries
+// the query itself, so any server instance can serve the next page.
+type pageCursor struct {
+	Query      string                 `json:"query"`
+	DatabaseID int                    `json:"database_id"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Page       int                    `json:"page"`
+	PageSize   int                    `json:"page_size"`
+}
+
+// encode renders the cursor as an opaque token
+func (c pageCursor) encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodePageCursor reads a token produced by encode
+func decodePageCursor(token string) (pageCursor, error) {
+	var cursor pageCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(decoded, &cursor)
+	}
+	if err != nil || cursor.Query == "" || cursor.Page < 1 || cursor.PageSize < 1 {
+		return pageCursor{}, errors.New("cursor is not a valid next_cursor of a paged result")
+	}
+	return cursor, nil
+}
+
+// apply replaces the query arguments of a call with those of the cursor
+func (c pageCursor) apply(args map[string]interface{}) {
+	args["query"] = c.Query
+	args["database_id"] = float64(c.DatabaseID)
+	args["page"] = float64(c.Page)
+	args["page_size"] = float64(c.PageSize)
+	delete(args, "database")
+	delete(args, "parameters")
+	if len(c.Parameters) > 0 {
+		args["parameters"] = c.Parameters
+	}
+}
+
+// newNativeQuery builds a native dataset query without parameters
+func newNativeQuery(databaseID int, query string) MetabaseQuery {
+	return MetabaseQuery{
+		Type:     "native",
+		Database: databaseID,
+		Native: NativeQuery{
+			Query:        query,
+			TemplateTags: make(map[string]interface{}),
+		},
+		Parameters: make([]interface{}, 0),
+	}
+}
+
+// queryOutcome holds the response to a query execution
+type queryOutcome struct {
+	Query      interface{}
+	Response   MetabaseResponse
+	Parsed     bool
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+// executeNative runs a native query against the dataset API and records it in
+// the query history
+func (r *toolRegistry) executeNative(ctx context.Context, client *MetabaseClient, metabaseQuery MetabaseQuery) (queryOutcome, error) {
+	return r.executeQuery(ctx, client, metabaseQuery, metabaseQuery.Database, metabaseQuery.Native.Query)
+}
+
+// executeQuery runs a native or structured query against the dataset API and
+// records it in the query history under text. Unparseable or unsuccessful
+// responses are returned with Parsed unset rather than as errors.
+func (r *toolRegistry) executeQuery(ctx context.Context, client *MetabaseClient, query interface{}, databaseID int, text string) (queryOutcome, error) {
+	return r.executeAt(ctx, client, "/api/dataset", query, databaseID, text)
+}
+
+// executeAt posts a query to a Metabase endpoint returning a dataset, such as
+// the dataset or card query API, as executeQuery does
+func (r *toolRegistry) executeAt(ctx context.Context, client *MetabaseClient, path string, query interface{}, databaseID int, text string) (queryOutcome, error) {
+	outcome := queryOutcome{Query: query, StatusCode: http.StatusOK, Status: "200 OK"}
+
+	// Make the request
+	startedAt := time.Now()
+	respBody, err := client.Query(ctx, path, query)
+	if err != nil {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			if errors.Is(err, errAccessDenied) {
+				r.stats.recordPolicy(ctx, policyName(err))
+			}
+			return outcome, err
+		}
+		outcome.StatusCode, outcome.Status, respBody = apiErr.StatusCode, apiErr.Status, []byte(apiErr.Body)
+	}
+	outcome.Body = respBody
+
+	// Try to parse the response into the MetabaseResponse struct
+	if err := json.Unmarshal(respBody, &outcome.Response); err != nil || outcome.StatusCode >= 300 {
+		return outcome, nil
+	}
+	outcome.Parsed = true
+	r.stats.recordQuery(ctx, outcome.Response)
+
+	entry := QueryHistoryEntry{
+		DatabaseID: databaseID,
+		Query:      text,
+		StartedAt:  startedAt,
+		Duration:   time.Since(startedAt),
+		RowCount:   outcome.Response.RowCount,
+		Status:     outcome.Response.Status,
+	}
+	if profile := profileFromContext(ctx); profile != nil {
+		entry.Profile = profile.Name
+	}
+	r.history.record(entry)
+	return outcome, nil
+}
+
+// result formats a parsed response for the tool output
+func (o queryOutcome) result() map[string]interface{} {
+	return map[string]interface{}{
+		"status":       o.Response.Status,
+		"row_count":    o.Response.RowCount,
+		"running_time": o.Response.RunningTime,
+		"database_id":  o.Response.DatabaseID,
+		"cached":       o.Response.Cached,
+		"rows":         o.Response.Data.Rows,
+		"columns":      o.Response.Data.Cols,
+		"query_sent":   o.Query,
+	}
+}
+
+// failure returns the error Metabase gave for a query it did not complete
+func (o queryOutcome) failure() string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(o.Body, &body) == nil && body.Error != "" {
+		return body.Error
+	}
+	if o.StatusCode >= 300 {
+		return o.Status
+	}
+	return "the query failed"
+}
+
+// rawResult returns the unparsed response, used when Metabase did not return a dataset
+func (o queryOutcome) rawResult() (*mcp.CallToolResult, error) {
+	return jsonResult(map[string]interface{}{
+		"status_code": o.StatusCode,
+		"status":      o.Status,
+		"body":        string(o.Body),
+		"query_sent":  o.Query,
+	})
+}
+
+// isSelectQuery reports whether query is a SELECT (optionally with CTEs) that
+// only reads data and can be wrapped in a subquery. Every statement must start
+// with SELECT or WITH, and none may write data outside string literals and
+// comments, as WITH x AS (...) DELETE ... or SELECT ... INTO would.
+func isSelectQuery(query string) bool {
+	for _, mysql := range []bool{false, true} {
+		tokens := tokenizeSQL(query, mysql)
+		if len(tokens) == 0 {
+			return false
+		}
+		start := true
+		for _, t := range tokens {
+			switch {
+			case t.is(";"):
+				start = true
+			case start && t.is("("):
+			case start:
+				if !t.is("select") && !t.is("with") {
+					return false
+				}
+				start = false
+			}
+		}
+		if sqlWriteKeyword(tokens) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// limitQuery wraps query in a subquery returning at most limit rows
+func limitQuery(query string, limit int) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(query), ";")
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) limited_result LIMIT %d", trimmed, limit)
+}
+
+// pageQuery wraps query in a subquery returning one page of rows
+func pageQuery(query string, page, pageSize int) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(query), ";")
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) paged_result LIMIT %d OFFSET %d", trimmed, pageSize, (page-1)*pageSize)
+}
+
+// countQuery wraps query in a subquery counting its rows
+func countQuery(query string) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(query), ";")
+	return fmt.Sprintf("SELECT COUNT(*) FROM (\n%s\n) counted_result", trimmed)
+}
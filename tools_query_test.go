@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestSelectDatabase(t *testing.T) {
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1, Databases: map[string]int{"sales": 2}})
+	ctx = withClientAccess(ctx, &ClientAccess{Name: "sales", Databases: []int{2}})
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      int
+		allowed   bool
+	}{
+		{"profile database", nil, 1, false},
+		{"database_id", map[string]interface{}{"database_id": 2}, 2, true},
+		{"other database_id", map[string]interface{}{"database_id": 3}, 3, false},
+		{"registry name", map[string]interface{}{"database": "sales"}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := newRequest(tt.arguments)
+			got, err := selectDatabase(ctx, nil, request)
+			if got != tt.want {
+				t.Errorf("selectDatabase() = %d, want %d", got, tt.want)
+			}
+			if tt.allowed && err != nil {
+				t.Errorf("selectDatabase() error = %v, want allowed", err)
+			}
+			if !tt.allowed && !errors.Is(err, errAccessDenied) {
+				t.Errorf("selectDatabase() error = %v, want access denied", err)
+			}
+		})
+	}
+}
+
+func TestSelectDatabaseByName(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{
+		"/api/database": map[string]interface{}{"data": []map[string]interface{}{
+			{"id": 1, "name": "Sample"},
+			{"id": 2, "name": "Sales Warehouse"},
+			{"id": 3, "name": "HR"},
+		}},
+	})
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1, DeniedDatabases: []int{3}})
+
+	// Names shown in Metabase match regardless of case
+	got, err := selectDatabase(ctx, client, newRequest(map[string]interface{}{"database": "sales warehouse"}))
+	if got != 2 || err != nil {
+		t.Errorf("selectDatabase(sales warehouse) = %d, %v, want 2", got, err)
+	}
+	if _, err := selectDatabase(ctx, client, newRequest(map[string]interface{}{"database": "HR"})); !errors.Is(err, errAccessDenied) {
+		t.Errorf("selectDatabase(HR) error = %v, want access denied", err)
+	}
+
+	// Unknown names list only the databases the call may use
+	_, err = selectDatabase(ctx, client, newRequest(map[string]interface{}{"database": "Finance"}))
+	want := `unknown database "Finance"; available databases: "Sample" (1), "Sales Warehouse" (2)`
+	if err == nil || err.Error() != want {
+		t.Errorf("selectDatabase(Finance) error = %v, want %s", err, want)
+	}
+}
+
+func TestIsSelectQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"select", "SELECT * FROM orders", true},
+		{"lowercase with leading whitespace", "\n  select 1", true},
+		{"cte", "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", true},
+		{"recursive cte", "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT * FROM n", true},
+		{"parenthesized union", "(SELECT 1) UNION (SELECT 2)", true},
+		{"leading comment", "-- weekly revenue\nSELECT 1", true},
+		{"keyword in string", "SELECT * FROM audit WHERE action = 'delete'", true},
+		{"keyword in comment", "SELECT 1 /* update later */", true},
+		{"quoted column", `SELECT "update" FROM changes`, true},
+		{"qualified column", "SELECT c.update FROM changes c", true},
+		{"trailing semicolon", "SELECT 1;", true},
+		{"several selects", "SELECT 1; SELECT 2", true},
+		{"delete", "DELETE FROM orders", false},
+		{"cte then delete", "WITH x AS (SELECT id FROM orders) DELETE FROM orders WHERE id IN (SELECT id FROM x)", false},
+		{"cte then update", "WITH x AS (SELECT 1) UPDATE orders SET total = 0", false},
+		{"cte then insert", "WITH x AS (SELECT 1) INSERT INTO archive SELECT * FROM x", false},
+		{"data-modifying cte", "WITH gone AS (DELETE FROM orders RETURNING *) SELECT * FROM gone", false},
+		{"select into", "SELECT * INTO backup FROM orders", false},
+		{"select for update", "SELECT * FROM orders FOR UPDATE", false},
+		{"select then drop", "SELECT 1; DROP TABLE orders", false},
+		{"keyword after mysql comment", "SELECT 1 # '\n; DELETE FROM orders", false},
+		{"explain", "EXPLAIN SELECT 1", false},
+		{"empty", "  ", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSelectQuery(tt.query); got != tt.want {
+				t.Errorf("isSelectQuery(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCallTimeout(t *testing.T) {
+	client := NewMetabaseClient("https://metabase.example.com", 1)
+	client.setTimeout(time.Minute)
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      time.Duration
+		perCall   bool
+	}{
+		{"server timeout", nil, time.Minute, false},
+		{"per call", map[string]interface{}{"timeout_seconds": 300}, 5 * time.Minute, true},
+		{"fraction of a second", map[string]interface{}{"timeout_seconds": 0.5}, 500 * time.Millisecond, true},
+		{"zero keeps the server timeout", map[string]interface{}{"timeout_seconds": 0}, time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := withCallTimeout(context.Background(), newRequest(tt.arguments))
+			got, perCall := client.requestTimeout(ctx)
+			if got != tt.want || perCall != tt.perCall {
+				t.Errorf("requestTimeout() = %v, %v, want %v, %v", got, perCall, tt.want, tt.perCall)
+			}
+		})
+	}
+}
+
+// datasetResponse is a completed dataset of n numbered rows
+func datasetResponse(n int) map[string]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = []interface{}{i + 1, fmt.Sprintf("customer %d", i+1)}
+	}
+	return map[string]interface{}{
+		"status":      "completed",
+		"row_count":   n,
+		"database_id": 1,
+		"data": map[string]interface{}{
+			"cols": []interface{}{map[string]interface{}{"name": "id"}, map[string]interface{}{"name": "name"}},
+			"rows": rows,
+		},
+	}
+}
+
+// sentSQL returns the SQL of a dataset query received by a fake Metabase
+func sentSQL(request fakeRequest) string {
+	native, _ := request.Body["native"].(map[string]interface{})
+	query, _ := native["query"].(string)
+	return query
+}
+
+// newQueryRegistry returns a registry running queries within limits against a
+// fake Metabase answering dataset queries with answer
+func newQueryRegistry(t *testing.T, limits outputLimits, answer func(request fakeRequest) interface{}) (*toolRegistry, *MetabaseClient, *fakeMetabase) {
+	client, fake := newFakeMetabase(t, map[string]interface{}{"POST /api/dataset": answer})
+	r := &toolRegistry{
+		config:  Config{DatabaseID: 1},
+		history: newQueryHistory(100),
+		budget:  &outputBudget{limits: limits},
+		views:   newViewStore(),
+		stats:   newSessionStatsStore(),
+	}
+	return r, client, fake
+}
+
+// queryContext is the context of a call served by a profile on database 1
+func queryContext(guardrails Guardrails) context.Context {
+	return withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1, Guardrails: guardrails})
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	limitPattern := regexp.MustCompile(`LIMIT (\d+)$`)
+	answer := func(request fakeRequest) interface{} {
+		if match := limitPattern.FindStringSubmatch(sentSQL(request)); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			return datasetResponse(n)
+		}
+		return datasetResponse(500)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		reduced   bool
+	}{
+		{"re-run with a limit", map[string]interface{}{"query": "SELECT id, name FROM customers", "adaptive_limit": true}, true},
+		{"truncate", map[string]interface{}{"query": "SELECT id, name FROM customers"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, client, fake := newQueryRegistry(t, outputLimits{Tokens: 1000}, answer)
+			result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, tt.arguments))
+
+			posts := fake.sent("POST")
+			reduced, _ := result["reduced_view"].(map[string]interface{})
+			if !tt.reduced {
+				if len(posts) != 1 || reduced != nil || result["truncated"] != true {
+					t.Errorf("ran %d queries, result %v, want one truncated result", len(posts), result)
+				}
+				return
+			}
+			if len(posts) != 2 || reduced == nil {
+				t.Fatalf("ran %d queries, result %v, want a reduced view", len(posts), result)
+			}
+			want := fmt.Sprintf("SELECT * FROM (\nSELECT id, name FROM customers\n) limited_result LIMIT %v", reduced["limit"])
+			if sentSQL(posts[1]) != want {
+				t.Errorf("re-ran %q, want %q", sentSQL(posts[1]), want)
+			}
+			if rows, _ := result["rows"].([]interface{}); float64(len(rows)) != reduced["limit"] || reduced["original_row_count"] != float64(500) {
+				t.Errorf("%d rows, reduced view %v", len(rows), reduced)
+			}
+			if result["truncated"] == true {
+				t.Errorf("reduced view was truncated as well")
+			}
+		})
+	}
+}
+
+// pagedAnswer answers paged queries over total rows, and counts of them
+func pagedAnswer(total int) func(request fakeRequest) interface{} {
+	pagePattern := regexp.MustCompile(`LIMIT (\d+) OFFSET (\d+)$`)
+	return func(request fakeRequest) interface{} {
+		sql := sentSQL(request)
+		if strings.HasPrefix(sql, "SELECT COUNT(*) FROM (") {
+			counted := datasetResponse(1)
+			counted["data"].(map[string]interface{})["rows"] = [][]interface{}{{total}}
+			return counted
+		}
+		match := pagePattern.FindStringSubmatch(sql)
+		if match == nil {
+			return datasetResponse(total)
+		}
+		limit, _ := strconv.Atoi(match[1])
+		offset, _ := strconv.Atoi(match[2])
+		n := total - offset
+		if n > limit {
+			n = limit
+		}
+		if n < 0 {
+			n = 0
+		}
+		return datasetResponse(n)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	const total = 23
+	answer := pagedAnswer(total)
+
+	tests := []struct {
+		name       string
+		arguments  map[string]interface{}
+		want       map[string]interface{}
+		countQuery bool
+	}{
+		{
+			"first page",
+			map[string]interface{}{"page_size": 10},
+			map[string]interface{}{"page": 1.0, "rows_on_page": 10.0, "has_more": true},
+			false,
+		},
+		{
+			"last page derives the total",
+			map[string]interface{}{"page_size": 10, "page": 3},
+			map[string]interface{}{"rows_on_page": 3.0, "total_rows": 23.0, "page_count": 3.0, "total_source": "derived", "has_more": false},
+			false,
+		},
+		{
+			"single page derives the total",
+			map[string]interface{}{"page_size": 50},
+			map[string]interface{}{"rows_on_page": 23.0, "total_rows": 23.0, "page_count": 1.0, "has_more": false},
+			false,
+		},
+		{
+			"past the end",
+			map[string]interface{}{"page_size": 10, "page": 4},
+			map[string]interface{}{"rows_on_page": 0.0, "has_more": false},
+			false,
+		},
+		{
+			"count the total",
+			map[string]interface{}{"page_size": 10, "page": 2, "count_total": true},
+			map[string]interface{}{"rows_on_page": 10.0, "total_rows": 23.0, "page_count": 3.0, "total_source": "count", "has_more": true},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, client, fake := newQueryRegistry(t, outputLimits{}, answer)
+			tt.arguments["query"] = "SELECT id, name FROM customers;"
+			result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, tt.arguments))
+
+			info, _ := result["pagination"].(map[string]interface{})
+			for key, want := range tt.want {
+				if info[key] != want {
+					t.Errorf("pagination[%q] = %v, want %v (%v)", key, info[key], want, info)
+				}
+			}
+			if _, ok := tt.want["total_rows"]; !ok && (info["total_rows"] != nil || info["page_count"] != nil) {
+				t.Errorf("pagination = %v, want no total", info)
+			}
+
+			posts := fake.sent("POST")
+			page, _ := tt.arguments["page"].(int)
+			if page == 0 {
+				page = 1
+			}
+			wantSQL := pageQuery("SELECT id, name FROM customers", page, tt.arguments["page_size"].(int))
+			if sentSQL(posts[0]) != wantSQL {
+				t.Errorf("sent %q, want %q", sentSQL(posts[0]), wantSQL)
+			}
+			if counted := len(posts) == 2 && strings.HasPrefix(sentSQL(posts[1]), "SELECT COUNT(*)"); counted != tt.countQuery || len(posts) > 2 {
+				t.Errorf("sent %d queries, want a count query: %v", len(posts), tt.countQuery)
+			}
+		})
+	}
+}
+
+func TestPaginationRefusals(t *testing.T) {
+	r, client, _ := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} { return datasetResponse(1) })
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"not a select", map[string]interface{}{"query": "SHOW TABLES", "page_size": 10}, "page_size is only supported for SELECT queries"},
+		{"with max_rows", map[string]interface{}{"query": "SELECT 1", "page_size": 10, "max_rows": 5}, "max_rows cannot be combined with page_size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, tt.arguments)
+			if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+				t.Errorf("result = %v, want an error containing %q", resultText(result), tt.want)
+			}
+		})
+	}
+}
+
+func TestPageCursor(t *testing.T) {
+	r, client, _ := newQueryRegistry(t, outputLimits{}, pagedAnswer(23))
+	ctx := queryContext(Guardrails{})
+
+	// Following next_cursor walks every page with the original query
+	arguments := map[string]interface{}{"query": "SELECT id, name FROM customers", "page_size": 10}
+	var pages []float64
+	for len(pages) < 5 {
+		result := decodeResult(t, callTool(t, ctx, r.handleNativeQuery, client, arguments))
+		info, _ := result["pagination"].(map[string]interface{})
+		pages = append(pages, info["rows_on_page"].(float64))
+		cursor, ok := info["next_cursor"].(string)
+		if !ok {
+			break
+		}
+		arguments = map[string]interface{}{"cursor": cursor}
+	}
+	if fmt.Sprint(pages) != "[10 10 3]" {
+		t.Errorf("rows on each page = %v, want [10 10 3]", pages)
+	}
+
+	// A cursor is still checked against the caller's databases
+	cursor := pageCursor{Query: "SELECT 1", DatabaseID: 2, Page: 2, PageSize: 10}.encode()
+	denied := callTool(t, withClientAccess(ctx, &ClientAccess{Name: "sales", Databases: []int{1}}), r.handleNativeQuery, client, map[string]interface{}{"cursor": cursor})
+	if !denied.IsError || !strings.Contains(resultText(denied), "access denied") {
+		t.Errorf("cursor for another database = %s, want access denied", resultText(denied))
+	}
+
+	invalid := callTool(t, ctx, r.handleNativeQuery, client, map[string]interface{}{"cursor": "not-a-cursor"})
+	if !invalid.IsError || !strings.Contains(resultText(invalid), "not a valid next_cursor") {
+		t.Errorf("invalid cursor = %s, want an error", resultText(invalid))
+	}
+}
+
+func TestMaxRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		returned int
+		maxRows  int
+		want     map[string]interface{}
+	}{
+		{"rows beyond the limit are dropped", 10, 3, map[string]interface{}{"max_rows": 3.0, "rows_dropped": 7.0, "limit_reached": true}},
+		{"within the limit", 2, 5, map[string]interface{}{"max_rows": 5.0, "rows_dropped": 0.0, "limit_reached": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, client, fake := newQueryRegistry(t, outputLimits{}, func(fakeRequest) interface{} { return datasetResponse(tt.returned) })
+			result := decodeResult(t, callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, map[string]interface{}{
+				"query":    "SELECT id, name FROM customers",
+				"max_rows": tt.maxRows,
+			}))
+
+			limit, _ := result["max_rows"].(map[string]interface{})
+			for key, want := range tt.want {
+				if limit[key] != want {
+					t.Errorf("max_rows[%q] = %v, want %v", key, limit[key], want)
+				}
+			}
+			if rows, _ := result["rows"].([]interface{}); len(rows) != min(tt.returned, tt.maxRows) {
+				t.Errorf("rows = %d, want %d", len(rows), min(tt.returned, tt.maxRows))
+			}
+
+			// Metabase is asked to stop reading at the limit
+			constraints, _ := fake.sent("POST")[0].Body["constraints"].(map[string]interface{})
+			if constraints["max-results"] != float64(tt.maxRows) || constraints["max-results-bare-rows"] != float64(tt.maxRows) {
+				t.Errorf("constraints = %v, want %d rows", constraints, tt.maxRows)
+			}
+		})
+	}
+}
+
+func TestCallTimeoutArgument(t *testing.T) {
+	release := make(chan struct{})
+	metabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer metabase.Close()
+	defer close(release)
+
+	r, _, _ := newQueryRegistry(t, outputLimits{}, nil)
+	client := NewMetabaseClient(metabase.URL, 1)
+	result := callTool(t, queryContext(Guardrails{}), r.handleNativeQuery, client, map[string]interface{}{
+		"query":           "SELECT pg_sleep(60)",
+		"timeout_seconds": 0.05,
+	})
+	if !result.IsError || !strings.Contains(resultText(result), "request timed out after 50ms; pass a larger timeout_seconds") {
+		t.Errorf("result = %s, want the call's timeout reported", resultText(result))
+	}
+
+	// The argument is offered in the query tool's schema
+	r = newTestRegistry(Guardrails{}, &bytes.Buffer{})
+	registerQueryTools(r)
+	encoded, err := json.Marshal(r.server.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed struct {
+		Result struct {
+			Tools []mcp.Tool `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(encoded, &listed); err != nil {
+		t.Fatal(err)
+	}
+	var arguments map[string]interface{}
+	for _, tool := range listed.Result.Tools {
+		if tool.Name == "metabase-tool" {
+			arguments = tool.InputSchema.Properties
+		}
+	}
+	if _, ok := arguments["timeout_seconds"]; !ok {
+		t.Errorf("metabase-tool arguments = %v, want timeout_seconds", arguments)
+	}
+}
@@ -0,0 +1,819 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DatabaseMetadata represents a database with its tables and fields as
+// returned by /api/database/:id/metadata
+type DatabaseMetadata struct {
+	ID     int             `json:"id"`
+	Name   string          `json:"name"`
+	Engine string          `json:"engine"`
+	Tables []TableMetadata `json:"tables"`
+}
+
+// TableMetadata represents a table together with its fields
+type TableMetadata struct {
+	MetabaseTable
+	Fields []Field `json:"fields"`
+}
+
+// qualifiedName returns the table name prefixed with its schema, lowercased
+func (t TableMetadata) qualifiedName() string {
+	if t.Schema == "" {
+		return strings.ToLower(t.Name)
+	}
+	return strings.ToLower(t.Schema + "." + t.Name)
+}
+
+// registerSchemaTools adds the schema browsing, validation and history tools.
+// They keep working from the metadata cache while Metabase is unreachable.
+func registerSchemaTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"list-tables",
+		mcp.WithDescription("Browse the tables of a database with their schema, description and estimated row count, or the fields of one table. Use it to orient yourself before writing SQL. Works offline from cached metadata when Metabase is unreachable; cached responses are labelled"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to browse; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"schema",
+			mcp.Description("Only list tables in this schema"),
+		),
+		mcp.WithString(
+			"table",
+			mcp.Description("Show the fields of this table (name or schema.name)"),
+		),
+	), handleListTables)
+
+	r.add(mcp.NewTool(
+		"describe-table",
+		mcp.WithDescription("Describe one table compactly for writing SQL: each column with its type, semantic type (e.g. PK, FK, Email, Category), description and the column a foreign key references. Works offline from cached metadata"),
+		mcp.WithString(
+			"table",
+			mcp.Required(),
+			mcp.Description("Table to describe, as name, schema.name or table ID"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database holding the table; defaults to the profile's database"),
+		),
+	), handleDescribeTable)
+
+	r.add(mcp.NewTool(
+		"profile-table",
+		mcp.WithDescription("Profile a table's columns from the fingerprints Metabase computes during sync: distinct count, share of nulls, min/max/average for numbers, date range for temporal columns and average length for text. Runs no query against the database; use it to judge cardinality, null handling and value ranges before writing SQL"),
+		mcp.WithString(
+			"table",
+			mcp.Required(),
+			mcp.Description("Table to profile, as name, schema.name or table ID"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database holding the table; defaults to the profile's database"),
+		),
+	), handleProfileTable)
+
+	r.add(mcp.NewTool(
+		"list-relationships",
+		mcp.WithDescription("List the foreign keys of a database from Metabase metadata, or only those linking one table to its direct neighbors, with the join condition for each. Use it to write correct JOINs without trial queries. Works offline from cached metadata"),
+		mcp.WithString(
+			"table",
+			mcp.Description("Only list the foreign keys from or to this table, as name, schema.name or table ID"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to inspect; defaults to the profile's database"),
+		),
+	), handleListRelationships)
+
+	r.add(mcp.NewTool(
+		"list-fields",
+		mcp.WithDescription("Search the columns of every table in a database by name, table or description, and by Metabase semantic type such as Email, State, Category or FK. Use it to find where a concept lives before writing SQL. Works offline from cached metadata"),
+		mcp.WithString(
+			"search",
+			mcp.Description("Only list fields whose name, display name, table or description contains this text"),
+		),
+		mcp.WithString(
+			"semantic_type",
+			mcp.Description("Only list fields of this semantic type, e.g. Email, State, Category, PK or FK"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to search; defaults to the profile's database"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description(fmt.Sprintf("Maximum number of fields to return (default %d)", defaultFieldLimit)),
+		),
+	), handleListFields)
+
+	r.add(mcp.NewTool(
+		"search-schema",
+		mcp.WithDescription("Find where a concept lives: search the names, display names and descriptions of every table and column in a database for a keyword such as revenue or churn, best matches first. Works offline from cached metadata"),
+		mcp.WithString(
+			"keyword",
+			mcp.Required(),
+			mcp.Description("Text to look for, case-insensitively; several words must all match"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to search; defaults to the profile's database"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description(fmt.Sprintf("Maximum number of matches to return (default %d)", defaultSchemaSearchLimit)),
+		),
+	), handleSearchSchema)
+
+	r.add(mcp.NewTool(
+		"validate-query",
+		mcp.WithDescription("Check a SQL query without running it: every referenced table must exist in the database metadata or be a virtual view of the session, and lint findings are included. Works offline from cached metadata"),
+		mcp.WithString(
+			"query",
+			mcp.Required(),
+			mcp.Description("The SQL query to validate"),
+		),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database the query targets; defaults to the profile's database"),
+		),
+	), r.handleValidateQuery)
+
+	r.add(mcp.NewTool(
+		"schema-drift",
+		mcp.WithDescription("Compare the current schema of a database with an earlier snapshot: new and dropped tables and columns, and column type changes. Use it to explain queries that broke after a migration"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Database to check; defaults to the profile's database"),
+		),
+		mcp.WithString(
+			"since",
+			mcp.Description("Compare against the latest snapshot taken at or before this RFC 3339 time; defaults to the latest snapshot"),
+		),
+	), r.handleSchemaDrift)
+
+	r.add(mcp.NewTool(
+		"query-history",
+		mcp.WithDescription("List the most recent queries executed through this server with their status, duration and row count"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Only include queries against this database"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description("Number of queries to return (default 20)"),
+		),
+	), r.handleQueryHistory)
+}
+
+// databaseMetadata fetches the metadata of the requested database, falling
+// back to the cache while Metabase is unreachable
+func databaseMetadata(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (DatabaseMetadata, map[string]interface{}, error) {
+	var metadata DatabaseMetadata
+	databaseID, err := requestedDatabase(ctx, request)
+	if err != nil {
+		return metadata, nil, err
+	}
+	cachedAt, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), &metadata)
+	if err != nil {
+		return metadata, nil, err
+	}
+	if cachedAt != nil {
+		return metadata, offlineNotice(*cachedAt), nil
+	}
+	return metadata, nil, nil
+}
+
+func handleListTables(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	metadata, offline, err := databaseMetadata(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+
+	schema := strings.ToLower(request.GetString("schema", ""))
+	tableName := strings.ToLower(request.GetString("table", ""))
+
+	result := map[string]interface{}{
+		"database_id": metadata.ID,
+		"database":    metadata.Name,
+		"engine":      metadata.Engine,
+	}
+	if offline != nil {
+		result["offline"] = offline
+	}
+
+	if tableName != "" {
+		for _, table := range metadata.Tables {
+			if strings.ToLower(table.Name) == tableName || table.qualifiedName() == tableName {
+				if checkTableAccess(ctx, metadata.ID, table.Schema) != nil {
+					continue
+				}
+				result["table"] = table
+				return jsonResult(result)
+			}
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d", tableName, metadata.ID)), nil
+	}
+
+	tables := make([]map[string]interface{}, 0, len(metadata.Tables))
+	for _, table := range metadata.Tables {
+		if schema != "" && strings.ToLower(table.Schema) != schema {
+			continue
+		}
+		if checkTableAccess(ctx, metadata.ID, table.Schema) != nil {
+			continue
+		}
+		tables = append(tables, map[string]interface{}{
+			"id":             table.ID,
+			"schema":         table.Schema,
+			"name":           table.Name,
+			"description":    table.Description,
+			"estimated_rows": table.rowEstimate(),
+			"fields":         len(table.Fields),
+		})
+	}
+	result["tables"] = tables
+	return jsonResult(result)
+}
+
+func handleDescribeTable(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tableName, err := request.RequireString("table")
+	if err != nil || tableName == "" {
+		return mcp.NewToolResultError("table is required and must be a string"), nil
+	}
+	metadata, offline, err := databaseMetadata(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+	table, ok := findTable(metadata, tableName)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", tableName, metadata.ID)), nil
+	}
+	if err := checkTableAccess(ctx, metadata.ID, table.Schema); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Foreign keys name the column they reference, unless it is in a schema
+	// the client may not read
+	targets := make(map[int]string)
+	for _, other := range metadata.Tables {
+		if checkTableAccess(ctx, metadata.ID, other.Schema) != nil {
+			continue
+		}
+		for _, field := range other.Fields {
+			targets[field.ID] = other.qualifiedName() + "." + strings.ToLower(field.Name)
+		}
+	}
+
+	rows := make([][]interface{}, 0, len(table.Fields))
+	for _, field := range table.Fields {
+		if field.VisibilityType == "retired" {
+			continue
+		}
+		var semanticType, description, references interface{}
+		if field.SemanticType != nil {
+			semanticType = strings.TrimPrefix(*field.SemanticType, "type/")
+		}
+		if field.Description != nil && *field.Description != "" {
+			description = *field.Description
+		}
+		if field.FKTargetID != nil {
+			if target, ok := targets[*field.FKTargetID]; ok {
+				references = target
+			}
+		}
+		rows = append(rows, []interface{}{field.Name, strings.TrimPrefix(field.BaseType, "type/"), semanticType, description, references})
+	}
+
+	result := map[string]interface{}{
+		"table":          table.qualifiedName(),
+		"table_id":       table.ID,
+		"description":    table.Description,
+		"estimated_rows": table.rowEstimate(),
+		"columns":        []string{"name", "type", "semantic_type", "description", "references"},
+		"rows":           rows,
+	}
+	if offline != nil {
+		result["offline"] = offline
+	}
+	return jsonResult(result)
+}
+
+// profiledField is a field with the fingerprint Metabase computed while syncing it
+type profiledField struct {
+	Field
+	Fingerprint *Fingerprint `json:"fingerprint"`
+}
+
+// profiledTable is a table as returned by /api/table/:id/query_metadata
+type profiledTable struct {
+	MetabaseTable
+	Fields []profiledField `json:"fields"`
+}
+
+func handleProfileTable(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tableName, err := request.RequireString("table")
+	if err != nil || tableName == "" {
+		return mcp.NewToolResultError("table is required and must be a string"), nil
+	}
+	metadata, _, err := databaseMetadata(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+	found, ok := findTable(metadata, tableName)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", tableName, metadata.ID)), nil
+	}
+	if err := checkTableAccess(ctx, metadata.ID, found.Schema); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var table profiledTable
+	cachedAt, err := client.GetMetadata(ctx, fmt.Sprintf("/api/table/%d/query_metadata", found.ID), &table)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch table metadata: %v", err)), nil
+	}
+
+	rows := make([][]interface{}, 0, len(table.Fields))
+	unprofiled := make([]string, 0)
+	for _, field := range table.Fields {
+		if field.VisibilityType == "retired" {
+			continue
+		}
+		if field.Fingerprint == nil {
+			unprofiled = append(unprofiled, field.Name)
+			continue
+		}
+		var semanticType interface{}
+		if field.SemanticType != nil {
+			semanticType = strings.TrimPrefix(*field.SemanticType, "type/")
+		}
+		var min, max, avg, averageLength interface{}
+		for kind, stats := range field.Fingerprint.Type {
+			switch kind {
+			case "type/Number":
+				min, max, avg = roundStat(stats.Min), roundStat(stats.Max), roundStat(stats.Avg)
+			case "type/DateTime":
+				if stats.Earliest != nil {
+					min = *stats.Earliest
+				}
+				if stats.Latest != nil {
+					max = *stats.Latest
+				}
+			case "type/Text":
+				averageLength = roundStat(&stats.AverageLength)
+			}
+		}
+		rows = append(rows, []interface{}{
+			field.Name,
+			strings.TrimPrefix(field.BaseType, "type/"),
+			semanticType,
+			field.Fingerprint.Global.DistinctCount,
+			math.Round(field.Fingerprint.Global.NilPercent*1000) / 10,
+			min,
+			max,
+			avg,
+			averageLength,
+		})
+	}
+
+	result := map[string]interface{}{
+		"table":          found.qualifiedName(),
+		"table_id":       found.ID,
+		"estimated_rows": table.rowEstimate(),
+		"columns":        []string{"name", "type", "semantic_type", "distinct", "null_pct", "min", "max", "avg", "avg_length"},
+		"rows":           rows,
+		"note":           "Fingerprints are computed by Metabase from a sample of up to 10,000 rows during sync, so distinct counts and ranges are estimates",
+	}
+	if len(unprofiled) > 0 {
+		result["not_profiled"] = unprofiled
+	}
+	if cachedAt != nil {
+		result["offline"] = offlineNotice(*cachedAt)
+	}
+	return jsonResult(result)
+}
+
+// roundStat rounds a fingerprint statistic to two decimals
+func roundStat(value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return math.Round(*value*100) / 100
+}
+
+// relationshipEnd is a column at one end of a foreign key
+type relationshipEnd struct {
+	table  TableMetadata
+	column string
+}
+
+func handleListRelationships(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	metadata, offline, err := databaseMetadata(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+	var selected *TableMetadata
+	if tableName := request.GetString("table", ""); tableName != "" {
+		table, ok := findTable(metadata, tableName)
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("table %q not found in database %d; use list-tables to see the available tables", tableName, metadata.ID)), nil
+		}
+		if err := checkTableAccess(ctx, metadata.ID, table.Schema); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		selected = &table
+	}
+
+	ends := make(map[int]relationshipEnd)
+	for _, table := range metadata.Tables {
+		for _, field := range table.Fields {
+			ends[field.ID] = relationshipEnd{table, field.Name}
+		}
+	}
+
+	rows := make([][]interface{}, 0)
+	neighbors := make([]string, 0)
+	seen := make(map[int]bool)
+	for _, table := range metadata.Tables {
+		for _, field := range table.Fields {
+			if field.FKTargetID == nil || field.VisibilityType == "retired" {
+				continue
+			}
+			target, ok := ends[*field.FKTargetID]
+			if !ok {
+				continue
+			}
+			// Keys leading into schemas the client may not read are left out
+			if checkTableAccess(ctx, metadata.ID, table.Schema) != nil || checkTableAccess(ctx, metadata.ID, target.table.Schema) != nil {
+				continue
+			}
+			if selected != nil {
+				neighbor := table
+				switch selected.ID {
+				case table.ID:
+					neighbor = target.table
+				case target.table.ID:
+				default:
+					continue
+				}
+				if !seen[neighbor.ID] {
+					seen[neighbor.ID] = true
+					neighbors = append(neighbors, neighbor.qualifiedName())
+				}
+			}
+			from := table.qualifiedName() + "." + strings.ToLower(field.Name)
+			to := target.table.qualifiedName() + "." + strings.ToLower(target.column)
+			rows = append(rows, []interface{}{table.qualifiedName(), field.Name, target.table.qualifiedName(), target.column, from + " = " + to})
+		}
+	}
+
+	result := map[string]interface{}{
+		"database_id":   metadata.ID,
+		"relationships": len(rows),
+		"columns":       []string{"from_table", "from_column", "to_table", "to_column", "join"},
+		"rows":          rows,
+	}
+	if selected != nil {
+		result["table"] = selected.qualifiedName()
+		result["neighbors"] = neighbors
+	}
+	if len(rows) == 0 {
+		result["message"] = "Metabase knows no foreign keys here; they are read from the database during sync or set as FK semantic types in the data model"
+	}
+	if offline != nil {
+		result["offline"] = offline
+	}
+	return jsonResult(result)
+}
+
+// defaultSchemaSearchLimit is the number of matches search-schema returns unless asked otherwise
+const defaultSchemaSearchLimit = 50
+
+// schemaMatch is a table or column found by search-schema
+type schemaMatch struct {
+	rank        int
+	kind        string
+	location    string
+	matched     string
+	description interface{}
+}
+
+func handleSearchSchema(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	keyword, err := request.RequireString("keyword")
+	words := strings.Fields(strings.ToLower(keyword))
+	if err != nil || len(words) == 0 {
+		return mcp.NewToolResultError("keyword is required and must be a string"), nil
+	}
+	metadata, offline, err := databaseMetadata(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+	limit := request.GetInt("limit", defaultSchemaSearchLimit)
+	if limit <= 0 {
+		limit = defaultSchemaSearchLimit
+	}
+
+	matches := make([]schemaMatch, 0)
+	for _, table := range metadata.Tables {
+		if checkTableAccess(ctx, metadata.ID, table.Schema) != nil {
+			continue
+		}
+		if match, ok := matchSchemaItem(words, table.Name, table.DisplayName, table.Description); ok {
+			match.kind, match.location = "table", table.qualifiedName()
+			matches = append(matches, match)
+		}
+		for _, field := range table.Fields {
+			if field.VisibilityType == "retired" {
+				continue
+			}
+			if match, ok := matchSchemaItem(words, field.Name, field.DisplayName, field.Description); ok {
+				match.kind, match.location = "column", table.qualifiedName()+"."+strings.ToLower(field.Name)
+				matches = append(matches, match)
+			}
+		}
+	}
+	// Name matches come before display name and description matches, and
+	// tables before their columns
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].kind == "table" && matches[j].kind == "column"
+	})
+
+	rows := make([][]interface{}, 0, min(len(matches), limit))
+	for _, match := range matches[:min(len(matches), limit)] {
+		rows = append(rows, []interface{}{match.kind, match.location, match.matched, match.description})
+	}
+	result := map[string]interface{}{
+		"database_id": metadata.ID,
+		"keyword":     keyword,
+		"matches":     len(matches),
+		"columns":     []string{"kind", "location", "matched", "description"},
+		"rows":        rows,
+	}
+	if len(matches) > limit {
+		result["truncated"] = true
+	}
+	if len(matches) == 0 {
+		result["message"] = "Nothing matched; try a shorter keyword or a synonym, or field-values to find a value stored in a column"
+	}
+	if offline != nil {
+		result["offline"] = offline
+	}
+	return jsonResult(result)
+}
+
+// matchSchemaItem reports whether every word occurs in the name, display name
+// or description of a table or column, and where the best match was found
+func matchSchemaItem(words []string, name, displayName string, description *string) (schemaMatch, bool) {
+	var text string
+	if description != nil {
+		text = *description
+	}
+	candidates := []struct {
+		matched string
+		value   string
+	}{{"name", name}, {"display_name", displayName}, {"description", text}}
+
+	all := strings.ToLower(name + "\n" + displayName + "\n" + text)
+	for _, word := range words {
+		if !strings.Contains(all, word) {
+			return schemaMatch{}, false
+		}
+	}
+	match := schemaMatch{rank: len(candidates), matched: "name, display_name or description"}
+	if text != "" {
+		match.description = text
+	}
+	for rank, candidate := range candidates {
+		value := strings.ToLower(candidate.value)
+		found := true
+		for _, word := range words {
+			found = found && strings.Contains(value, word)
+		}
+		if found {
+			match.rank, match.matched = rank, candidate.matched
+			break
+		}
+	}
+	return match, true
+}
+
+// defaultFieldLimit is the number of fields list-fields returns unless asked otherwise
+const defaultFieldLimit = 200
+
+// DatabaseField is a field as listed by /api/database/:id/fields
+type DatabaseField struct {
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	DisplayName  string  `json:"display_name"`
+	BaseType     string  `json:"base_type"`
+	SemanticType *string `json:"semantic_type"`
+	TableName    string  `json:"table_name"`
+	Schema       string  `json:"schema"`
+}
+
+func handleListFields(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID, err := requestedDatabase(ctx, request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var fields []DatabaseField
+	cachedAt, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/fields", databaseID), &fields)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch fields: %v", err)), nil
+	}
+
+	// The field list carries no descriptions; they come from the database metadata
+	descriptions := make(map[int]string)
+	if metadata, _, err := databaseMetadata(ctx, client, request); err == nil {
+		for _, table := range metadata.Tables {
+			for _, field := range table.Fields {
+				if field.Description != nil && *field.Description != "" {
+					descriptions[field.ID] = *field.Description
+				}
+			}
+		}
+	}
+
+	search := strings.ToLower(request.GetString("search", ""))
+	semanticType := strings.ToLower(strings.TrimPrefix(request.GetString("semantic_type", ""), "type/"))
+	limit := request.GetInt("limit", defaultFieldLimit)
+	if limit <= 0 {
+		limit = defaultFieldLimit
+	}
+
+	rows := make([][]interface{}, 0)
+	matches := 0
+	for _, field := range fields {
+		if checkTableAccess(ctx, databaseID, field.Schema) != nil {
+			continue
+		}
+		var fieldSemanticType interface{}
+		if field.SemanticType != nil {
+			fieldSemanticType = strings.TrimPrefix(*field.SemanticType, "type/")
+		}
+		if semanticType != "" && (fieldSemanticType == nil || strings.ToLower(fieldSemanticType.(string)) != semanticType) {
+			continue
+		}
+		table := field.TableName
+		if field.Schema != "" {
+			table = field.Schema + "." + field.TableName
+		}
+		description := descriptions[field.ID]
+		if search != "" && !strings.Contains(strings.ToLower(strings.Join([]string{field.Name, field.DisplayName, table, description}, "\n")), search) {
+			continue
+		}
+		matches++
+		if len(rows) == limit {
+			continue
+		}
+		var fieldDescription interface{}
+		if description != "" {
+			fieldDescription = description
+		}
+		rows = append(rows, []interface{}{field.ID, table, field.Name, strings.TrimPrefix(field.BaseType, "type/"), fieldSemanticType, fieldDescription})
+	}
+
+	result := map[string]interface{}{
+		"database_id": databaseID,
+		"matches":     matches,
+		"columns":     []string{"id", "table", "name", "type", "semantic_type", "description"},
+		"rows":        rows,
+	}
+	if matches > len(rows) {
+		result["truncated"] = true
+	}
+	if cachedAt != nil {
+		result["offline"] = offlineNotice(*cachedAt)
+	}
+	return jsonResult(result)
+}
+
+func (r *toolRegistry) handleValidateQuery(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	metadata, offline, err := databaseMetadata(ctx, client, request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch database metadata: %v", err)), nil
+	}
+
+	// Tables in schemas the client may not read are reported as unknown
+	known := make(map[string]bool, len(metadata.Tables)*2)
+	for _, table := range metadata.Tables {
+		if checkTableAccess(ctx, metadata.ID, table.Schema) != nil {
+			continue
+		}
+		known[strings.ToLower(table.Name)] = true
+		known[table.qualifiedName()] = true
+	}
+	for _, view := range r.views.list(sessionID(ctx)) {
+		known[strings.ToLower(view.Name)] = true
+	}
+	ctes := cteNames(query)
+	unknown := make([]string, 0)
+	for _, table := range referencedTables(query) {
+		if !known[table] && !ctes[table] {
+			unknown = append(unknown, table)
+		}
+	}
+
+	accessErr := checkQueryAccess(ctx, metadata.ID, query)
+
+	findings := lintQuery(query)
+	result := map[string]interface{}{
+		"valid":          len(unknown) == 0 && accessErr == nil,
+		"unknown_tables": unknown,
+		"findings":       findings,
+		"summary":        lintSummary(findings),
+	}
+	if accessErr != nil {
+		result["access_denied"] = accessErr.Error()
+	}
+	if offline != nil {
+		result["offline"] = offline
+	}
+	return jsonResult(result)
+}
+
+func (r *toolRegistry) handleSchemaDrift(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	profile := profileFromContext(ctx)
+	databaseID, err := requestedDatabase(ctx, request)
+	if err != nil {
+		r.stats.recordPolicy(ctx, policyName(err))
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var since time.Time
+	if value := request.GetString("since", ""); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return mcp.NewToolResultError("since must be an RFC 3339 time such as 2024-05-01T00:00:00Z"), nil
+		}
+		since = parsed
+	}
+
+	baseline, current, diff, err := checkSchemaDrift(ctx, r.snapshots, profile, databaseID, since)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to check schema drift: %v", err)), nil
+	}
+
+	result := map[string]interface{}{
+		"database_id": databaseID,
+		"current_at":  current.TakenAt,
+		"tables":      len(current.Tables),
+		"snapshots":   len(r.snapshots.list(profile.Name, databaseID)),
+	}
+	if baseline == nil {
+		result["message"] = "No earlier snapshot to compare with; the current schema has been stored as the baseline"
+		return jsonResult(result)
+	}
+	result["baseline_at"] = baseline.TakenAt
+	result["changed"] = !diff.Empty()
+	result["changes"] = diff
+	return jsonResult(result)
+}
+
+func (r *toolRegistry) handleQueryHistory(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID := request.GetInt("database_id", 0)
+	limit := request.GetInt("limit", 20)
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var profileName string
+	if profile := profileFromContext(ctx); profile != nil {
+		profileName = profile.Name
+	}
+	entries := r.history.snapshot()
+	recent := make([]QueryHistoryEntry, 0, limit)
+	for i := len(entries) - 1; i >= 0 && len(recent) < limit; i-- {
+		if entries[i].Profile != profileName || (databaseID != 0 && entries[i].DatabaseID != databaseID) {
+			continue
+		}
+		// Queries on databases or schemas the caller may not query are left out
+		if checkQueryAccess(ctx, entries[i].DatabaseID, entries[i].Query) != nil {
+			continue
+		}
+		recent = append(recent, entries[i])
+	}
+
+	return jsonResult(map[string]interface{}{
+		"count":   len(recent),
+		"queries": recent,
+	})
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testMetadata is a database with a table in the finance schema referencing
+// a table in the hr schema
+var testMetadata = map[string]interface{}{
+	"id": 1, "name": "warehouse", "engine": "postgres",
+	"tables": []interface{}{
+		map[string]interface{}{"id": 10, "db_id": 1, "schema": "finance", "name": "orders", "fields": []interface{}{
+			map[string]interface{}{"id": 100, "name": "id", "base_type": "type/Integer"},
+			map[string]interface{}{"id": 101, "name": "employee_id", "base_type": "type/Integer", "fk_target_field_id": 200},
+		}},
+		map[string]interface{}{"id": 20, "db_id": 1, "schema": "hr", "name": "salaries", "fields": []interface{}{
+			map[string]interface{}{"id": 200, "name": "employee_id", "base_type": "type/Integer"},
+		}},
+	},
+}
+
+// financeContext returns a call context for a client restricted to the finance schema
+func financeContext() context.Context {
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+	return withClientAccess(ctx, &ClientAccess{Name: "finance", Schemas: []string{"finance"}})
+}
+
+func TestSchemaToolsHideOtherSchemas(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": testMetadata})
+	r := &toolRegistry{views: newViewStore()}
+	ctx := financeContext()
+
+	t.Run("list-tables", func(t *testing.T) {
+		tables := decodeResult(t, callTool(t, ctx, handleListTables, client, nil))["tables"].([]interface{})
+		if len(tables) != 1 || tables[0].(map[string]interface{})["name"] != "orders" {
+			t.Errorf("tables = %v, want only finance.orders", tables)
+		}
+		if result := callTool(t, ctx, handleListTables, client, map[string]interface{}{"table": "hr.salaries"}); !result.IsError {
+			t.Errorf("fields of hr.salaries listed: %s", resultText(result))
+		}
+	})
+
+	t.Run("describe-table", func(t *testing.T) {
+		if result := callTool(t, ctx, handleDescribeTable, client, map[string]interface{}{"table": "hr.salaries"}); !result.IsError {
+			t.Errorf("hr.salaries described: %s", resultText(result))
+		}
+		result := callTool(t, ctx, handleDescribeTable, client, map[string]interface{}{"table": "finance.orders"})
+		if text := resultText(result); result.IsError || strings.Contains(text, "salaries") {
+			t.Errorf("finance.orders = %s, want columns without the foreign key into hr.salaries", text)
+		}
+	})
+
+	t.Run("validate-query", func(t *testing.T) {
+		result := decodeResult(t, callTool(t, ctx, r.handleValidateQuery, client, map[string]interface{}{"query": "SELECT * FROM hr.salaries"}))
+		if result["valid"] != false || result["access_denied"] == nil {
+			t.Errorf("query on hr.salaries = %v, want invalid with access_denied", result)
+		}
+		if unknown := result["unknown_tables"].([]interface{}); len(unknown) != 1 || unknown[0] != "hr.salaries" {
+			t.Errorf("unknown_tables = %v, want hr.salaries", unknown)
+		}
+		result = decodeResult(t, callTool(t, ctx, r.handleValidateQuery, client, map[string]interface{}{"query": "SELECT * FROM finance.orders"}))
+		if result["valid"] != true {
+			t.Errorf("query on finance.orders = %v, want valid", result)
+		}
+	})
+}
+
+func TestDefaultDatabaseIsChecked(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{
+		"/api/database/1/metadata": testMetadata,
+		"/api/database/1/fields":   []interface{}{},
+	})
+	r := &toolRegistry{views: newViewStore(), stats: newSessionStatsStore()}
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+	ctx = withClientAccess(ctx, &ClientAccess{Name: "other", Databases: []int{2}})
+
+	handlers := map[string]toolHandler{
+		"list-tables":        handleListTables,
+		"describe-table":     handleDescribeTable,
+		"list-fields":        handleListFields,
+		"validate-query":     r.handleValidateQuery,
+		"search-schema":      handleSearchSchema,
+		"profile-table":      handleProfileTable,
+		"schema-drift":       r.handleSchemaDrift,
+		"list-relationships": handleListRelationships,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			result := callTool(t, ctx, handler, client, map[string]interface{}{"table": "finance.orders", "query": "SELECT 1", "keyword": "orders"})
+			if !result.IsError || !strings.Contains(resultText(result), "access denied") {
+				t.Errorf("default database 1 = %s, want access denied", resultText(result))
+			}
+		})
+	}
+}
+
+func TestQueryHistoryScope(t *testing.T) {
+	history := newQueryHistory(10)
+	history.record(QueryHistoryEntry{Profile: "default", DatabaseID: 1, Query: "SELECT * FROM finance.orders"})
+	history.record(QueryHistoryEntry{Profile: "default", DatabaseID: 1, Query: "SELECT * FROM hr.salaries"})
+	history.record(QueryHistoryEntry{Profile: "default", DatabaseID: 2, Query: "SELECT * FROM finance.orders"})
+	history.record(QueryHistoryEntry{Profile: "staging", DatabaseID: 1, Query: "SELECT * FROM finance.customers"})
+	r := &toolRegistry{history: history}
+
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+	ctx = withClientAccess(ctx, &ClientAccess{Name: "finance", Databases: []int{1}, Schemas: []string{"finance"}})
+	queries := decodeResult(t, callTool(t, ctx, r.handleQueryHistory, nil, nil))["queries"].([]interface{})
+	if len(queries) != 1 || queries[0].(map[string]interface{})["query"] != "SELECT * FROM finance.orders" {
+		t.Errorf("queries = %v, want only the finance.orders query on database 1 of the default profile", queries)
+	}
+}
+
+func TestListTablesRowEstimates(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": map[string]interface{}{
+		"id": 1, "name": "warehouse", "engine": "postgres",
+		"tables": []interface{}{
+			map[string]interface{}{"id": 10, "schema": "public", "name": "orders", "estimated_row_count": 1200, "rows": 900},
+			map[string]interface{}{"id": 11, "schema": "public", "name": "customers", "rows": 300},
+			map[string]interface{}{"id": 12, "schema": "public", "name": "events"},
+		},
+	}})
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+
+	// The estimate Metabase keeps current wins over the count from the last sync
+	tables := decodeResult(t, callTool(t, ctx, handleListTables, client, nil))["tables"].([]interface{})
+	want := map[string]interface{}{"orders": 1200.0, "customers": 300.0, "events": nil}
+	for _, table := range tables {
+		table := table.(map[string]interface{})
+		if table["estimated_rows"] != want[table["name"].(string)] {
+			t.Errorf("%s: estimated_rows = %v, want %v", table["name"], table["estimated_rows"], want[table["name"].(string)])
+		}
+	}
+	if len(tables) != len(want) {
+		t.Errorf("tables = %v, want %d tables", tables, len(want))
+	}
+}
+
+func TestDescribeTable(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": map[string]interface{}{
+		"id": 1, "name": "warehouse", "engine": "postgres",
+		"tables": []interface{}{
+			map[string]interface{}{"id": 10, "schema": "finance", "name": "Orders", "estimated_row_count": 1200, "fields": []interface{}{
+				map[string]interface{}{"id": 100, "name": "id", "base_type": "type/Integer", "semantic_type": "type/PK"},
+				map[string]interface{}{"id": 101, "name": "employee_id", "base_type": "type/Integer", "semantic_type": "type/FK", "fk_target_field_id": 200, "description": "Who took the order"},
+				map[string]interface{}{"id": 102, "name": "legacy_code", "base_type": "type/Text", "visibility_type": "retired"},
+			}},
+			map[string]interface{}{"id": 20, "schema": "hr", "name": "employees", "fields": []interface{}{
+				map[string]interface{}{"id": 200, "name": "ID", "base_type": "type/Integer"},
+			}},
+		},
+	}})
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+
+	result := decodeResult(t, callTool(t, ctx, handleDescribeTable, client, map[string]interface{}{"table": "finance.orders"}))
+	if result["table"] != "finance.orders" || result["table_id"] != 10.0 || result["estimated_rows"] != 1200.0 {
+		t.Errorf("result = %v, want finance.orders with its row estimate", result)
+	}
+	want := `[["id","Integer","PK",null,null],["employee_id","Integer","FK","Who took the order","hr.employees.id"]]`
+	if rows, _ := json.Marshal(result["rows"]); string(rows) != want {
+		t.Errorf("rows = %s, want %s", rows, want)
+	}
+
+	missing := callTool(t, ctx, handleDescribeTable, client, map[string]interface{}{"table": "invoices"})
+	if !missing.IsError || !strings.Contains(resultText(missing), `table "invoices" not found in database 1`) {
+		t.Errorf("unknown table = %s, want an error", resultText(missing))
+	}
+}
+
+func TestListFields(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{
+		"/api/database/1/fields": []interface{}{
+			map[string]interface{}{"id": 100, "name": "id", "base_type": "type/Integer", "semantic_type": "type/PK", "table_name": "orders", "schema": "finance"},
+			map[string]interface{}{"id": 101, "name": "customer_email", "base_type": "type/Text", "semantic_type": "type/Email", "table_name": "orders", "schema": "finance"},
+			map[string]interface{}{"id": 102, "name": "placed_at", "base_type": "type/DateTime", "table_name": "orders", "schema": "finance"},
+			map[string]interface{}{"id": 200, "name": "email", "base_type": "type/Text", "semantic_type": "type/Email", "table_name": "salaries", "schema": "hr"},
+		},
+		"/api/database/1/metadata": map[string]interface{}{"id": 1, "tables": []interface{}{
+			map[string]interface{}{"id": 10, "schema": "finance", "name": "orders", "fields": []interface{}{
+				map[string]interface{}{"id": 102, "name": "placed_at", "description": "When checkout completed"},
+			}},
+		}},
+	})
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		ids       string
+		truncated bool
+	}{
+		{"all", nil, "[100 101 102]", false},
+		{"semantic type without prefix", map[string]interface{}{"semantic_type": "email"}, "[101]", false},
+		{"semantic type with prefix", map[string]interface{}{"semantic_type": "type/Email"}, "[101]", false},
+		{"search descriptions", map[string]interface{}{"search": "checkout"}, "[102]", false},
+		{"limit", map[string]interface{}{"limit": 2}, "[100 101]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The hr schema is hidden from the finance client
+			result := decodeResult(t, callTool(t, financeContext(), handleListFields, client, tt.arguments))
+			var ids []interface{}
+			for _, row := range result["rows"].([]interface{}) {
+				ids = append(ids, row.([]interface{})[0])
+			}
+			if fmt.Sprint(ids) != tt.ids || (result["truncated"] == true) != tt.truncated {
+				t.Errorf("fields = %v, truncated %v, want %s, truncated %v", ids, result["truncated"], tt.ids, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestProfileTable(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{
+		"/api/database/1/metadata": ordersMetadata(),
+		"/api/table/3/query_metadata": map[string]interface{}{"id": 3, "name": "orders", "schema": "public", "rows": 5000, "fields": []interface{}{
+			map[string]interface{}{"id": 10, "name": "id", "base_type": "type/Integer", "semantic_type": "type/PK", "fingerprint": map[string]interface{}{
+				"global": map[string]interface{}{"distinct-count": 5000, "nil%": 0},
+				"type":   map[string]interface{}{"type/Number": map[string]interface{}{"min": 1, "max": 5000, "avg": 2500.456}},
+			}},
+			map[string]interface{}{"id": 11, "name": "created_at", "base_type": "type/DateTime", "fingerprint": map[string]interface{}{
+				"global": map[string]interface{}{"distinct-count": 4200, "nil%": 0.0123},
+				"type":   map[string]interface{}{"type/DateTime": map[string]interface{}{"earliest": "2023-01-01T00:00:00Z", "latest": "2024-06-30T00:00:00Z"}},
+			}},
+			map[string]interface{}{"id": 12, "name": "status", "base_type": "type/Text", "fingerprint": map[string]interface{}{
+				"global": map[string]interface{}{"distinct-count": 4, "nil%": 0.5},
+				"type":   map[string]interface{}{"type/Text": map[string]interface{}{"average-length": 6.666}},
+			}},
+			map[string]interface{}{"id": 13, "name": "notes", "base_type": "type/Text"},
+		}},
+	})
+	ctx := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+
+	result := decodeResult(t, callTool(t, ctx, handleProfileTable, client, map[string]interface{}{"table": "orders"}))
+	want := `[["id","Integer","PK",5000,0,1,5000,2500.46,null],` +
+		`["created_at","DateTime",null,4200,1.2,"2023-01-01T00:00:00Z","2024-06-30T00:00:00Z",null,null],` +
+		`["status","Text",null,4,50,null,null,null,6.67]]`
+	if rows, _ := json.Marshal(result["rows"]); string(rows) != want {
+		t.Errorf("rows = %s, want %s", rows, want)
+	}
+	if fmt.Sprint(result["not_profiled"]) != "[notes]" || result["estimated_rows"] != 5000.0 {
+		t.Errorf("not_profiled %v, estimated_rows %v, want [notes] and 5000", result["not_profiled"], result["estimated_rows"])
+	}
+}
+
+func TestListRelationships(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": map[string]interface{}{
+		"id": 1, "name": "warehouse",
+		"tables": []interface{}{
+			map[string]interface{}{"id": 10, "schema": "finance", "name": "orders", "fields": []interface{}{
+				map[string]interface{}{"id": 100, "name": "id"},
+				map[string]interface{}{"id": 101, "name": "customer_id", "fk_target_field_id": 200},
+				map[string]interface{}{"id": 102, "name": "approver_id", "fk_target_field_id": 300},
+			}},
+			map[string]interface{}{"id": 20, "schema": "finance", "name": "customers", "fields": []interface{}{
+				map[string]interface{}{"id": 200, "name": "id"},
+			}},
+			map[string]interface{}{"id": 30, "schema": "hr", "name": "employees", "fields": []interface{}{
+				map[string]interface{}{"id": 300, "name": "id"},
+			}},
+			map[string]interface{}{"id": 40, "schema": "finance", "name": "order_items", "fields": []interface{}{
+				map[string]interface{}{"id": 400, "name": "order_id", "fk_target_field_id": 100},
+				map[string]interface{}{"id": 401, "name": "old_order_id", "fk_target_field_id": 100, "visibility_type": "retired"},
+			}},
+		},
+	}})
+	unrestricted := withProfile(context.Background(), &Profile{Name: "default", DatabaseID: 1})
+
+	joins := func(result map[string]interface{}) []string {
+		var joins []string
+		for _, row := range result["rows"].([]interface{}) {
+			joins = append(joins, row.([]interface{})[4].(string))
+		}
+		return joins
+	}
+
+	result := decodeResult(t, callTool(t, unrestricted, handleListRelationships, client, nil))
+	want := []string{
+		"finance.orders.customer_id = finance.customers.id",
+		"finance.orders.approver_id = hr.employees.id",
+		"finance.order_items.order_id = finance.orders.id",
+	}
+	if got := joins(result); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("joins = %q, want %q", got, want)
+	}
+
+	// A table's relationships lead to its neighbors either way; keys into
+	// schemas the client may not read are left out
+	result = decodeResult(t, callTool(t, financeContext(), handleListRelationships, client, map[string]interface{}{"table": "finance.orders"}))
+	if got := joins(result); len(got) != 2 || strings.Contains(strings.Join(got, " "), "hr.") {
+		t.Errorf("joins of finance.orders = %q, want two within finance", got)
+	}
+	if fmt.Sprint(result["neighbors"]) != "[finance.customers finance.order_items]" {
+		t.Errorf("neighbors = %v, want customers and order_items", result["neighbors"])
+	}
+}
+
+func TestSearchSchema(t *testing.T) {
+	client := newTestClient(t, map[string]interface{}{"/api/database/1/metadata": map[string]interface{}{
+		"id": 1, "name": "warehouse",
+		"tables": []interface{}{
+			map[string]interface{}{"id": 10, "schema": "finance", "name": "orders", "description": "Customer orders", "fields": []interface{}{
+				map[string]interface{}{"id": 100, "name": "customer_email", "display_name": "Customer Email"},
+				map[string]interface{}{"id": 101, "name": "contact", "display_name": "Email Address"},
+				map[string]interface{}{"id": 102, "name": "notes", "description": "Free text; may hold an email"},
+				map[string]interface{}{"id": 103, "name": "old_email", "visibility_type": "retired"},
+			}},
+			map[string]interface{}{"id": 20, "schema": "finance", "name": "email_campaigns"},
+			map[string]interface{}{"id": 30, "schema": "hr", "name": "employees", "fields": []interface{}{
+				map[string]interface{}{"id": 300, "name": "work_email"},
+			}},
+		},
+	}})
+
+	// Name matches rank first, tables before columns, then display names and descriptions
+	result := decodeResult(t, callTool(t, financeContext(), handleSearchSchema, client, map[string]interface{}{"keyword": "EMAIL"}))
+	var got []string
+	for _, row := range result["rows"].([]interface{}) {
+		row := row.([]interface{})
+		got = append(got, fmt.Sprintf("%s %s (%s)", row[0], row[1], row[2]))
+	}
+	want := []string{
+		"table finance.email_campaigns (name)",
+		"column finance.orders.customer_email (name)",
+		"column finance.orders.contact (display_name)",
+		"column finance.orders.notes (description)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("matches = %q, want %q", got, want)
+	}
+
+	// Every word must match, and the limit truncates
+	result = decodeResult(t, callTool(t, financeContext(), handleSearchSchema, client, map[string]interface{}{"keyword": "customer email"}))
+	if result["matches"] != 1.0 {
+		t.Errorf("result = %v, want only customer_email", result)
+	}
+	result = decodeResult(t, callTool(t, financeContext(), handleSearchSchema, client, map[string]interface{}{"keyword": "email", "limit": 2}))
+	if result["matches"] != 4.0 || result["truncated"] != true || len(result["rows"].([]interface{})) != 2 {
+		t.Errorf("result = %v, want 2 of 4 matches", result)
+	}
+	result = decodeResult(t, callTool(t, financeContext(), handleSearchSchema, client, map[string]interface{}{"keyword": "invoice"}))
+	if result["matches"] != 0.0 || result["message"] == nil {
+		t.Errorf("result = %v, want no matches with a hint", result)
+	}
+}
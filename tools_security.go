@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// LoginHistoryEntry represents a single login recorded by Metabase
+type LoginHistoryEntry struct {
+	Timestamp         string `json:"timestamp"`
+	DeviceID          string `json:"device_id"`
+	DeviceDescription string `json:"device_description"`
+	IPAddress         string `json:"ip_address"`
+	Location          string `json:"location"`
+	Timezone          string `json:"timezone"`
+	Active            bool   `json:"active"`
+}
+
+// MetabaseUser represents a user returned by the user API
+type MetabaseUser struct {
+	ID          int     `json:"id"`
+	Email       string  `json:"email"`
+	CommonName  string  `json:"common_name"`
+	IsActive    bool    `json:"is_active"`
+	IsSuperuser bool    `json:"is_superuser"`
+	LastLogin   *string `json:"last_login"`
+	FirstLogin  *string `json:"first_login"`
+	DateJoined  string  `json:"date_joined"`
+	SSOSource   *string `json:"sso_source"`
+}
+
+// registerSecurityTools adds the login history and audit tools
+func registerSecurityTools(r *toolRegistry) {
+	r.addAdmin(mcp.NewTool(
+		"login-history",
+		mcp.WithDescription("Show a user's login activity: first and last login from the admin user API and, for the authenticated Metabase account, its recent logins with first-seen devices and locations flagged"),
+		mcp.WithString(
+			"user",
+			mcp.Description("User to report on, by ID, email or name (default: the authenticated account)"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description("Maximum number of logins to return (default 50)"),
+		),
+	), handleLoginHistory)
+
+	r.addAdmin(mcp.NewTool(
+		"user-login-audit",
+		mcp.WithDescription("Audit last-login activity across all Metabase users to spot dormant, recently active, or privileged accounts"),
+		mcp.WithNumber(
+			"since_days",
+			mcp.Description("Only include users who logged in within this many days (default: all users)"),
+		),
+		mcp.WithBoolean(
+			"include_deactivated",
+			mcp.Description("Include deactivated users in the audit"),
+		),
+	), handleUserLoginAudit)
+}
+
+func handleLoginHistory(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	limit := request.GetInt("limit", 50)
+
+	var current MetabaseUser
+	if err := client.Get(ctx, "/api/user/current", &current); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch the authenticated user: %v", err)), nil
+	}
+	userID := current.ID
+	if ref := request.GetString("user", ""); ref != "" {
+		user, err := resolveUser(ctx, client, ref)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		userID = user.ID
+	}
+
+	// Per-user login times come from the admin user API
+	var user MetabaseUser
+	if err := client.Get(ctx, fmt.Sprintf("/api/user/%d", userID), &user); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch user %d: %v", userID, err)), nil
+	}
+	result := map[string]interface{}{
+		"user_id":     user.ID,
+		"email":       user.Email,
+		"name":        user.CommonName,
+		"is_active":   user.IsActive,
+		"date_joined": user.DateJoined,
+		"first_login": user.FirstLogin,
+		"last_login":  user.LastLogin,
+	}
+	if user.SSOSource != nil {
+		result["sso_source"] = *user.SSOSource
+	}
+
+	// Metabase only lists the devices and locations of the caller's own logins
+	if userID != current.ID {
+		result["message"] = "Metabase only exposes device and location history for the authenticated account; first_login and last_login are the login activity recorded for this user"
+		return jsonResult(result)
+	}
+
+	var history []LoginHistoryEntry
+	if err := client.Get(ctx, "/api/login-history/current", &history); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch login history: %v", err)), nil
+	}
+
+	// Walk from oldest to newest so the first sighting of a device or location is flagged
+	sort.Slice(history, func(i, j int) bool { return history[i].Timestamp < history[j].Timestamp })
+	seenDevices := make(map[string]bool)
+	seenLocations := make(map[string]bool)
+	logins := make([]map[string]interface{}, 0, len(history))
+	for _, entry := range history {
+		logins = append(logins, map[string]interface{}{
+			"timestamp":    entry.Timestamp,
+			"device":       entry.DeviceDescription,
+			"ip_address":   entry.IPAddress,
+			"location":     entry.Location,
+			"active":       entry.Active,
+			"new_device":   len(seenDevices) > 0 && !seenDevices[entry.DeviceID],
+			"new_location": len(seenLocations) > 0 && !seenLocations[entry.Location],
+		})
+		seenDevices[entry.DeviceID] = true
+		seenLocations[entry.Location] = true
+	}
+
+	// Most recent logins first
+	for i, j := 0, len(logins)-1; i < j; i, j = i+1, j-1 {
+		logins[i], logins[j] = logins[j], logins[i]
+	}
+	if limit > 0 && len(logins) > limit {
+		logins = logins[:limit]
+	}
+
+	result["total_logins"] = len(history)
+	result["distinct_devices"] = len(seenDevices)
+	result["distinct_locations"] = len(seenLocations)
+	result["logins"] = logins
+	return jsonResult(result)
+}
+
+func handleUserLoginAudit(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sinceDays := request.GetInt("since_days", 0)
+	path := "/api/user"
+	if request.GetBool("include_deactivated", false) {
+		path += "?include_deactivated=true"
+	}
+
+	users, err := fetchUsers(ctx, client, path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch users: %v", err)), nil
+	}
+
+	now := time.Now()
+	var neverLoggedIn, dormant []string
+	active := make([]map[string]interface{}, 0, len(users))
+	unparsed := make([]map[string]interface{}, 0)
+	for _, user := range users {
+		if user.LastLogin == nil {
+			neverLoggedIn = append(neverLoggedIn, user.Email)
+			continue
+		}
+
+		lastLogin, err := time.Parse(time.RFC3339, *user.LastLogin)
+		if err != nil {
+			unparsed = append(unparsed, map[string]interface{}{
+				"id":         user.ID,
+				"email":      user.Email,
+				"last_login": *user.LastLogin,
+				"error":      err.Error(),
+			})
+			continue
+		}
+		daysAgo := int(now.Sub(lastLogin).Hours() / 24)
+		if daysAgo > 90 {
+			dormant = append(dormant, user.Email)
+		}
+		if sinceDays > 0 && daysAgo > sinceDays {
+			continue
+		}
+
+		active = append(active, map[string]interface{}{
+			"id":             user.ID,
+			"email":          user.Email,
+			"name":           user.CommonName,
+			"is_superuser":   user.IsSuperuser,
+			"is_active":      user.IsActive,
+			"last_login":     *user.LastLogin,
+			"days_since_use": daysAgo,
+		})
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i]["last_login"].(string) > active[j]["last_login"].(string)
+	})
+
+	result := map[string]interface{}{
+		"total_users":     len(users),
+		"users":           active,
+		"never_logged_in": neverLoggedIn,
+		"dormant_90_days": dormant,
+	}
+	// Users whose last login could not be read are reported rather than dropped
+	if len(unparsed) > 0 {
+		result["unparsed_last_login"] = unparsed
+	}
+	return jsonResult(result)
+}
+
+// fetchUsers lists users, accepting both the paginated and legacy array responses
+func fetchUsers(ctx context.Context, client *MetabaseClient, path string) ([]MetabaseUser, error) {
+	var raw json.RawMessage
+	if err := client.Get(ctx, path, &raw); err != nil {
+		return nil, err
+	}
+
+	var paged struct {
+		Data []MetabaseUser `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &paged); err == nil {
+		return paged.Data, nil
+	}
+
+	var users []MetabaseUser
+	if err := json.Unmarshal(raw, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLoginHistory(t *testing.T) {
+	lastLogin := "2026-10-01T09:00:00Z"
+	client, fake := newFakeMetabase(t, map[string]interface{}{
+		"/api/user/current": map[string]interface{}{"id": 1, "email": "ana@example.com"},
+		"/api/user":         map[string]interface{}{"data": []interface{}{map[string]interface{}{"id": 1, "email": "ana@example.com", "common_name": "Ana Silva"}, map[string]interface{}{"id": 2, "email": "bo@example.com", "common_name": "Bo Chen"}}},
+		"/api/user/1":       map[string]interface{}{"id": 1, "email": "ana@example.com", "last_login": lastLogin},
+		"/api/user/2":       map[string]interface{}{"id": 2, "email": "bo@example.com", "last_login": lastLogin},
+		"/api/login-history/current": []interface{}{
+			map[string]interface{}{"timestamp": "2026-10-01T09:00:00Z", "device_id": "laptop", "location": "Lisbon"},
+			map[string]interface{}{"timestamp": "2026-09-01T09:00:00Z", "device_id": "laptop", "location": "Lisbon"},
+			map[string]interface{}{"timestamp": "2026-09-15T09:00:00Z", "device_id": "phone", "location": "Lisbon"},
+			map[string]interface{}{"timestamp": "2026-09-20T09:00:00Z", "device_id": "laptop", "location": "Porto"},
+		},
+	})
+
+	result := decodeResult(t, callTool(t, context.Background(), handleLoginHistory, client, nil))
+	logins, _ := result["logins"].([]interface{})
+	if len(logins) != 4 || result["distinct_devices"] != float64(2) || result["distinct_locations"] != float64(2) {
+		t.Fatalf("own login history = %v", result)
+	}
+	// Newest first, with first sightings flagged
+	want := []struct {
+		timestamp              string
+		newDevice, newLocation bool
+	}{
+		{"2026-10-01T09:00:00Z", false, false},
+		{"2026-09-20T09:00:00Z", false, true},
+		{"2026-09-15T09:00:00Z", true, false},
+		{"2026-09-01T09:00:00Z", false, false},
+	}
+	for i, w := range want {
+		login := logins[i].(map[string]interface{})
+		if login["timestamp"] != w.timestamp || login["new_device"] != w.newDevice || login["new_location"] != w.newLocation {
+			t.Errorf("login %d = %v, want %+v", i, login, w)
+		}
+	}
+
+	result = decodeResult(t, callTool(t, context.Background(), handleLoginHistory, client, map[string]interface{}{"user": "bo"}))
+	if result["user_id"] != float64(2) || result["last_login"] != lastLogin || result["logins"] != nil || result["message"] == nil {
+		t.Errorf("other user's login history = %v", result)
+	}
+	histories := 0
+	for _, request := range fake.sent("GET") {
+		if request.Path == "/api/login-history/current" {
+			histories++
+		}
+	}
+	if histories != 1 {
+		t.Errorf("fetched the login history %d times, want it for the authenticated account only", histories)
+	}
+}
+
+func TestUserLoginAudit(t *testing.T) {
+	recent := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	old := time.Now().Add(-200 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	client := newTestClient(t, map[string]interface{}{
+		"/api/user": []interface{}{
+			map[string]interface{}{"id": 1, "email": "recent@example.com", "last_login": recent},
+			map[string]interface{}{"id": 2, "email": "dormant@example.com", "last_login": old},
+			map[string]interface{}{"id": 3, "email": "never@example.com"},
+			map[string]interface{}{"id": 4, "email": "odd@example.com", "last_login": "last Tuesday"},
+		},
+	})
+
+	result := decodeResult(t, callTool(t, context.Background(), handleUserLoginAudit, client, map[string]interface{}{"since_days": 30}))
+	var got struct {
+		TotalUsers        int                      `json:"total_users"`
+		Users             []map[string]interface{} `json:"users"`
+		NeverLoggedIn     []string                 `json:"never_logged_in"`
+		Dormant           []string                 `json:"dormant_90_days"`
+		UnparsedLastLogin []map[string]interface{} `json:"unparsed_last_login"`
+	}
+	encoded, _ := json.Marshal(result)
+	if err := json.Unmarshal(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TotalUsers != 4 || len(got.Users) != 1 || got.Users[0]["email"] != "recent@example.com" {
+		t.Errorf("users = %v, want only the recent login within 30 days", got.Users)
+	}
+	if len(got.NeverLoggedIn) != 1 || got.NeverLoggedIn[0] != "never@example.com" {
+		t.Errorf("never logged in = %v", got.NeverLoggedIn)
+	}
+	if len(got.Dormant) != 1 || got.Dormant[0] != "dormant@example.com" {
+		t.Errorf("dormant = %v", got.Dormant)
+	}
+	if len(got.UnparsedLastLogin) != 1 || got.UnparsedLastLogin[0]["last_login"] != "last Tuesday" {
+		t.Errorf("unparsed last logins = %v, want the unreadable one reported", got.UnparsedLastLogin)
+	}
+}
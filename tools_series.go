@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// seriesResult holds the data of one series of a combined card
+type seriesResult struct {
+	CardID  int             `json:"card_id"`
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// registerSeriesTools adds tools for retrieving combined card data
+func registerSeriesTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"combined-card-data",
+		mcp.WithDescription("Fetch the data of a dashboard card together with every series combined into it, merged into one labeled result, so answers match the chart shown on the dashboard"),
+		mcp.WithNumber(
+			"dashboard_id",
+			mcp.Required(),
+			mcp.Description("Dashboard containing the card"),
+		),
+		mcp.WithNumber(
+			"dashcard_id",
+			mcp.Description("ID of the card's placement on the dashboard"),
+		),
+		mcp.WithNumber(
+			"card_id",
+			mcp.Description("Card ID, used to locate the dashcard when dashcard_id is not given"),
+		),
+		withPriorityArgument(),
+		withTimeoutArgument(),
+	), r.handleCombinedCardData)
+}
+
+func (r *toolRegistry) handleCombinedCardData(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dashboardID, err := request.RequireInt("dashboard_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	dashcardID := request.GetInt("dashcard_id", 0)
+	cardID := request.GetInt("card_id", 0)
+	if dashcardID == 0 && cardID == 0 {
+		return mcp.NewToolResultError("either dashcard_id or card_id is required"), nil
+	}
+
+	ctx = withPriority(ctx, parsePriority(request.GetString("priority", "")))
+	ctx = withCallTimeout(ctx, request)
+
+	dashboard, err := getDashboard(ctx, client, dashboardID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to fetch dashboard: %v", err)), nil
+	}
+
+	var dashcard *Dashcard
+	for _, dc := range dashboard.Cards() {
+		if dc.ID == dashcardID || (dashcardID == 0 && dc.CardID != nil && *dc.CardID == cardID) {
+			dc := dc
+			dashcard = &dc
+			break
+		}
+	}
+	if dashcard == nil || dashcard.CardID == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("card not found on dashboard %d", dashboardID)), nil
+	}
+
+	// The primary card runs in the dashboard context; series cards are run on their own
+	series := make([]seriesResult, 0, len(dashcard.Series)+1)
+	primary, err := runDashcard(ctx, client, dashboardID, dashcard.ID, *dashcard.CardID, nil)
+	series = append(series, newSeriesResult(*dashcard.CardID, dashcard.Card.Name, primary, err))
+	for _, card := range dashcard.Series {
+		resp, err := runDashcard(ctx, client, dashboardID, dashcard.ID, card.ID, nil)
+		series = append(series, newSeriesResult(card.ID, card.Name, resp, err))
+	}
+
+	result := map[string]interface{}{
+		"dashboard_id": dashboardID,
+		"dashcard_id":  dashcard.ID,
+		"series":       series,
+	}
+	if columns, rows, ok := mergeSeries(series); ok {
+		result["merged"] = map[string]interface{}{
+			"columns": columns,
+			"rows":    rows,
+		}
+	}
+
+	return r.budget.apply(ctx, result)
+}
+
+// newSeriesResult converts a card query response into a series result
+func newSeriesResult(cardID int, name string, resp MetabaseResponse, err error) seriesResult {
+	result := seriesResult{CardID: cardID, Name: name}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, col := range resp.Data.Cols {
+		result.Columns = append(result.Columns, col.Name)
+	}
+	result.Rows = resp.Data.Rows
+	return result
+}
+
+// mergeSeries stacks series sharing the same column layout into one table with
+// a leading series column. It reports false when the layouts differ.
+func mergeSeries(series []seriesResult) ([]string, [][]interface{}, bool) {
+	if len(series) < 2 {
+		return nil, nil, false
+	}
+	width := len(series[0].Columns)
+	for _, s := range series {
+		if s.Error != "" || len(s.Columns) != width {
+			return nil, nil, false
+		}
+	}
+
+	columns := append([]string{"series"}, series[0].Columns...)
+	rows := make([][]interface{}, 0)
+	for _, s := range series {
+		for _, row := range s.Rows {
+			rows = append(rows, append([]interface{}{s.Name}, row...))
+		}
+	}
+	return columns, rows, true
+}
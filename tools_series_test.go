@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMergeSeries(t *testing.T) {
+	web := seriesResult{Name: "Web", Columns: []string{"month", "orders"}, Rows: [][]interface{}{{"2026-01", 10}}}
+	store := seriesResult{Name: "Store", Columns: []string{"month", "orders"}, Rows: [][]interface{}{{"2026-01", 4}, {"2026-02", 6}}}
+
+	columns, rows, ok := mergeSeries([]seriesResult{web, store})
+	wantRows := [][]interface{}{{"Web", "2026-01", 10}, {"Store", "2026-01", 4}, {"Store", "2026-02", 6}}
+	if !ok || !reflect.DeepEqual(columns, []string{"series", "month", "orders"}) || !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("mergeSeries = %v, %v, %v", columns, rows, ok)
+	}
+
+	tests := []struct {
+		name   string
+		series []seriesResult
+	}{
+		{"single series", []seriesResult{web}},
+		{"different layouts", []seriesResult{web, {Name: "Goal", Columns: []string{"month"}}}},
+		{"failed series", []seriesResult{web, {Name: "Store", Error: "query failed"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := mergeSeries(tt.series); ok {
+				t.Errorf("mergeSeries merged %v", tt.series)
+			}
+		})
+	}
+}
+
+func TestCombinedCardData(t *testing.T) {
+	result := func(orders int) map[string]interface{} {
+		return map[string]interface{}{"data": map[string]interface{}{
+			"cols": []interface{}{map[string]interface{}{"name": "month"}, map[string]interface{}{"name": "orders"}},
+			"rows": [][]interface{}{{"2026-01", orders}},
+		}}
+	}
+	client, fake := newFakeMetabase(t, map[string]interface{}{
+		// Dashboards of Metabase before 0.47 list their cards as ordered_cards
+		"/api/dashboard/3": map[string]interface{}{"id": 3, "ordered_cards": []interface{}{
+			map[string]interface{}{"id": 29, "card_id": 4, "card": map[string]interface{}{"id": 4, "name": "Signups"}},
+			map[string]interface{}{"id": 30, "card_id": 5, "card": map[string]interface{}{"id": 5, "name": "Web"},
+				"series": []interface{}{map[string]interface{}{"id": 6, "name": "Store"}}},
+		}},
+		"POST /api/dashboard/3/dashcard/30/card/5/query": result(10),
+		"POST /api/dashboard/3/dashcard/30/card/6/query": result(4),
+	})
+	r := &toolRegistry{}
+
+	decoded := decodeResult(t, callTool(t, context.Background(), r.handleCombinedCardData, client, map[string]interface{}{"dashboard_id": 3, "card_id": 5}))
+	if decoded["dashcard_id"] != float64(30) {
+		t.Errorf("dashcard_id = %v, want 30", decoded["dashcard_id"])
+	}
+	merged, _ := decoded["merged"].(map[string]interface{})
+	want := []interface{}{[]interface{}{"Web", "2026-01", float64(10)}, []interface{}{"Store", "2026-01", float64(4)}}
+	if !reflect.DeepEqual(merged["rows"], want) {
+		t.Errorf("merged rows = %v, want %v", merged["rows"], want)
+	}
+	if posts := fake.sent("POST"); len(posts) != 2 {
+		t.Errorf("ran %d cards, want the card and its series", len(posts))
+	}
+
+	if result := callTool(t, context.Background(), r.handleCombinedCardData, client, map[string]interface{}{"dashboard_id": 3, "card_id": 9}); !result.IsError {
+		t.Errorf("card missing from the dashboard = %s, want an error", resultText(result))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerStatsTools adds the session execution statistics tool
+func registerStatsTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"session-stats",
+		mcp.WithDescription("Report what this session has run so far: queries executed, total warehouse time, rows returned, Metabase cache hit rate and the guardrail and access policies that were triggered. Use it to answer \"how much have we scanned?\""),
+		mcp.WithString(
+			"scope",
+			mcp.Enum("session", "all"),
+			mcp.Description("session (default) for the calling session, all for every active session (admin HTTP clients only)"),
+		),
+	), r.handleSessionStats)
+}
+
+func (r *toolRegistry) handleSessionStats(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if request.GetString("scope", "session") != "all" {
+		return jsonResult(statsSummary(r.stats.get(ctx)))
+	}
+
+	if access := clientAccessFromContext(ctx); access != nil && !access.Admin {
+		r.stats.recordPolicy(ctx, "access_denied")
+		return mcp.NewToolResultError("access denied: only admin clients may view the statistics of other sessions"), nil
+	}
+
+	sessions := r.stats.all()
+	total := SessionStats{PoliciesTriggered: make(map[string]int)}
+	summaries := make([]map[string]interface{}, 0, len(sessions))
+	for _, stats := range sessions {
+		summaries = append(summaries, statsSummary(stats))
+		total.Queries += stats.Queries
+		total.FailedQueries += stats.FailedQueries
+		total.CachedQueries += stats.CachedQueries
+		total.WarehouseTimeMS += stats.WarehouseTimeMS
+		total.RowsReturned += stats.RowsReturned
+		for policy, count := range stats.PoliciesTriggered {
+			total.PoliciesTriggered[policy] += count
+		}
+	}
+	totals := statsSummary(total)
+	delete(totals, "started_at")
+
+	return jsonResult(map[string]interface{}{
+		"sessions": summaries,
+		"total":    totals,
+	})
+}
+
+// statsSummary formats session statistics together with the derived cache hit rate
+func statsSummary(stats SessionStats) map[string]interface{} {
+	summary := map[string]interface{}{
+		"started_at":         stats.StartedAt,
+		"queries":            stats.Queries,
+		"failed_queries":     stats.FailedQueries,
+		"cached_queries":     stats.CachedQueries,
+		"cache_hit_rate":     stats.CacheHitRate(),
+		"warehouse_time_ms":  stats.WarehouseTimeMS,
+		"rows_returned":      stats.RowsReturned,
+		"policies_triggered": stats.PoliciesTriggered,
+	}
+	if stats.Session != "" {
+		summary["session"] = stats.Session
+	}
+	return summary
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// newTestRegistry returns a registry serving a single profile with the given
+// guardrails, writing audit records to audit
+func newTestRegistry(guardrails Guardrails, audit *bytes.Buffer) *toolRegistry {
+	profile := &Profile{Name: "default", DatabaseID: 1, Guardrails: guardrails}
+	return &toolRegistry{
+		server: server.NewMCPServer("test", "1.0", server.WithToolCapabilities(false)),
+		config: Config{
+			AdminToolsEnabled: true,
+			DefaultProfile:    "default",
+			Profiles:          map[string]*Profile{"default": profile},
+		},
+		audit: &auditLogger{w: audit},
+		stats: newSessionStatsStore(),
+	}
+}
+
+// callServerTool calls a registered tool through the MCP server, returning the
+// JSON-RPC response
+func callServerTool(t *testing.T, r *toolRegistry, name string, arguments map[string]interface{}) string {
+	t.Helper()
+	message, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]interface{}{"name": name, "arguments": arguments},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := json.Marshal(r.server.HandleMessage(context.Background(), message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(response)
+}
+
+func TestWriteToolsOnReadOnlyProfiles(t *testing.T) {
+	register := map[string]func(r *toolRegistry, tool mcp.Tool, handler toolHandler){
+		"addWrite":      (*toolRegistry).addWrite,
+		"addAdminWrite": (*toolRegistry).addAdminWrite,
+	}
+	for name, add := range register {
+		for _, readOnly := range []bool{false, true} {
+			var audit bytes.Buffer
+			r := newTestRegistry(Guardrails{ReadOnly: readOnly}, &audit)
+			called := false
+			add(r, mcp.NewTool("change-something"), func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				called = true
+				return mcp.NewToolResultText("changed"), nil
+			})
+
+			response := callServerTool(t, r, "change-something", nil)
+			if called == readOnly {
+				t.Errorf("%s, read-only %v: handler called = %v, response %s", name, readOnly, called, response)
+			}
+			if readOnly && !strings.Contains(response, "is read-only") {
+				t.Errorf("%s: response = %s, want read-only refusal", name, response)
+			}
+			want := `"outcome":"applied"`
+			if readOnly {
+				want = `"outcome":"error"`
+			}
+			if !strings.Contains(audit.String(), want) {
+				t.Errorf("%s, read-only %v: audit log = %q, want %s", name, readOnly, audit.String(), want)
+			}
+		}
+	}
+}
+
+func TestAuditedPreviews(t *testing.T) {
+	var audit bytes.Buffer
+	r := newTestRegistry(Guardrails{}, &audit)
+	r.addWrite(mcp.NewTool("change-something", withConfirm()), func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !confirmed(request) {
+			return previewResult("change something", nil)
+		}
+		return mcp.NewToolResultText("changed"), nil
+	})
+
+	callServerTool(t, r, "change-something", nil)
+	callServerTool(t, r, "change-something", map[string]interface{}{"confirm": true})
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"outcome":"previewed"`) || !strings.Contains(lines[1], `"outcome":"applied"`) {
+		t.Errorf("audit log = %q, want a previewed then an applied record", audit.String())
+	}
+}
+
+func TestProfileArgument(t *testing.T) {
+	r := newTestRegistry(Guardrails{}, nil)
+	r.config.Profiles["default"].client = newTestClient(t, map[string]interface{}{"/api/user/current": map[string]interface{}{"email": "dev@example.com"}})
+	r.config.Profiles["staging"] = &Profile{Name: "staging", DatabaseID: 2, client: newTestClient(t, map[string]interface{}{"/api/user/current": map[string]interface{}{"email": "staging@example.com"}})}
+	r.add(mcp.NewTool("current-user"), func(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var user map[string]interface{}
+		if err := client.Get(ctx, "/api/user/current", &user); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return jsonResult(user)
+	})
+
+	tools, err := json.Marshal(r.server.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(tools), `"profile":{"description":"Named environment profile`) || !strings.Contains(string(tools), `"enum":["default","staging"]`) {
+		t.Errorf("tools/list = %s, want a profile argument listing both profiles", tools)
+	}
+
+	tests := []struct {
+		arguments map[string]interface{}
+		want      string
+	}{
+		{nil, `dev@example.com`},
+		{map[string]interface{}{"profile": "staging"}, `staging@example.com`},
+		{map[string]interface{}{"profile": "prod"}, `unknown profile \"prod\"`},
+	}
+	for _, tt := range tests {
+		if response := callServerTool(t, r, "current-user", tt.arguments); !strings.Contains(response, tt.want) {
+			t.Errorf("profile %v: response = %s, want %s", tt.arguments["profile"], response, tt.want)
+		}
+	}
+
+	// A single profile needs no argument
+	single := newTestRegistry(Guardrails{}, nil)
+	single.add(mcp.NewTool("current-user"), nil)
+	tools, _ = json.Marshal(single.server.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)))
+	if strings.Contains(string(tools), `"profile"`) {
+		t.Errorf("tools/list = %s, want no profile argument", tools)
+	}
+}
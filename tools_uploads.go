@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerUploadTools adds the CSV upload tool
+func registerUploadTools(r *toolRegistry) {
+	r.addAdminWrite(mcp.NewTool(
+		"upload-csv",
+		mcp.WithDescription("Upload CSV data into the uploads-enabled database as a new table and model, making it queryable in Metabase. Provide either the CSV content itself or the path of a file in the server's upload directory"),
+		mcp.WithString(
+			"file_path",
+			mcp.Description("Path of a CSV file in the server's upload directory (METABASE_UPLOAD_DIR), relative to it"),
+		),
+		mcp.WithString(
+			"csv_content",
+			mcp.Description("CSV text to upload, including the header row"),
+		),
+		mcp.WithString(
+			"file_name",
+			mcp.Description("File name used to name the table when uploading csv_content (default upload.csv)"),
+		),
+		mcp.WithNumber(
+			"collection_id",
+			mcp.Description("Collection to save the created model in (default: root collection)"),
+		),
+	), r.handleUploadCSV)
+}
+
+func (r *toolRegistry) handleUploadCSV(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath := request.GetString("file_path", "")
+	content := request.GetString("csv_content", "")
+	fileName := request.GetString("file_name", "upload.csv")
+
+	var file io.Reader
+	switch {
+	case filePath != "":
+		path, err := uploadPath(r.currentConfig().UploadDir, filePath)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to open CSV file: %v", err)), nil
+		}
+		defer f.Close()
+		file = f
+		fileName = filepath.Base(path)
+	case content != "":
+		file = strings.NewReader(content)
+	default:
+		return mcp.NewToolResultError("either file_path or csv_content is required"), nil
+	}
+
+	fields := map[string]string{"collection_id": "root"}
+	if collectionID := request.GetInt("collection_id", 0); collectionID != 0 {
+		fields["collection_id"] = strconv.Itoa(collectionID)
+	}
+
+	// Newer Metabase versions moved uploads to /api/upload/csv
+	var modelID int
+	err := client.PostMultipart(ctx, "/api/upload/csv", fields, "file", fileName, file, &modelID)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		if seeker, ok := file.(io.Seeker); ok {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to rewind CSV: %v", err)), nil
+			}
+		}
+		err = client.PostMultipart(ctx, "/api/card/from-csv", fields, "file", fileName, file, &modelID)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to upload CSV: %v", err)), nil
+	}
+
+	model, err := getCard(ctx, client, modelID)
+	if err != nil {
+		return jsonResult(map[string]interface{}{"model_id": modelID})
+	}
+
+	return jsonResult(map[string]interface{}{
+		"model_id":      model.ID,
+		"model_name":    model.Name,
+		"database_id":   model.DatabaseID,
+		"table_id":      model.TableID,
+		"collection_id": model.CollectionID,
+	})
+}
+
+// uploadPath resolves a file_path argument inside the upload directory,
+// refusing paths that would leave it
+func uploadPath(dir, name string) (string, error) {
+	if dir == "" {
+		return "", errors.New("file_path is disabled: set METABASE_UPLOAD_DIR to allow uploading files from the server, or pass csv_content")
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("upload directory is not available: %w", err)
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("upload directory is not available: %w", err)
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	// Resolve links so a symlink inside the directory cannot point out of it
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file_path %s is outside the upload directory", name)
+	}
+	return path, nil
+}
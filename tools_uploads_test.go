@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadPath(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	for _, name := range []string{filepath.Join(dir, "orders.csv"), filepath.Join(outside, "secrets.csv")} {
+		if err := os.WriteFile(name, []byte("id\n1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secrets.csv"), filepath.Join(dir, "link.csv")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		path    string
+		wantErr string
+	}{
+		{"relative", dir, "orders.csv", ""},
+		{"absolute inside", dir, filepath.Join(dir, "orders.csv"), ""},
+		{"new file", dir, "later.csv", ""},
+		{"no upload directory", "", "orders.csv", "METABASE_UPLOAD_DIR"},
+		{"parent directory", dir, filepath.Join("..", filepath.Base(outside), "secrets.csv"), "outside the upload directory"},
+		{"absolute outside", dir, filepath.Join(outside, "secrets.csv"), "outside the upload directory"},
+		{"link out of the directory", dir, "link.csv", "outside the upload directory"},
+		{"the directory itself", dir, ".", "outside the upload directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := uploadPath(tt.dir, tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("uploadPath(%q) = %q, %v, want error %q", tt.path, path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("uploadPath(%q): %v", tt.path, err)
+			}
+			if filepath.Base(path) != filepath.Base(tt.path) {
+				t.Errorf("uploadPath(%q) = %q", tt.path, path)
+			}
+		})
+	}
+}
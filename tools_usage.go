@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MetabaseTable represents a table as returned by /api/table
+type MetabaseTable struct {
+	ID          int     `json:"id"`
+	DBID        int     `json:"db_id"`
+	Name        string  `json:"name"`
+	Schema      string  `json:"schema"`
+	DisplayName string  `json:"display_name"`
+	Description *string `json:"description"`
+	Visibility  *string `json:"visibility_type"`
+	// EstimatedRowCount is kept up to date by recent Metabase versions on
+	// some engines; older versions fill Rows during sync instead
+	EstimatedRowCount *int64 `json:"estimated_row_count,omitempty"`
+	Rows              *int64 `json:"rows,omitempty"`
+}
+
+// rowEstimate returns the table's estimated row count, if Metabase has one
+func (t MetabaseTable) rowEstimate() *int64 {
+	if t.EstimatedRowCount != nil {
+		return t.EstimatedRowCount
+	}
+	return t.Rows
+}
+
+// tableUsage accumulates usage figures for a single table
+type tableUsage struct {
+	DatabaseID int     `json:"database_id"`
+	Table      string  `json:"table"`
+	Cards      int     `json:"cards,omitempty"`
+	Views      int     `json:"views,omitempty"`
+	Queries    int     `json:"queries,omitempty"`
+	LastUsedAt *string `json:"last_used_at"`
+}
+
+// registerUsageTools adds the database usage reporting tools
+func registerUsageTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"database-usage",
+		mcp.WithDescription("Summarize how much each database and table is used (saved question counts, views, last used, most used cards, queries run through this server) to support deprecation decisions"),
+		mcp.WithNumber(
+			"database_id",
+			mcp.Description("Only report on this database"),
+		),
+		mcp.WithString(
+			"source",
+			mcp.Enum("auto", "metabase", "local"),
+			mcp.Description("Where usage comes from: Metabase card statistics, the local query history of this server, or auto (Metabase with local fallback)"),
+		),
+		mcp.WithNumber(
+			"top",
+			mcp.Description("Number of most used cards to include (default 10)"),
+		),
+	), r.handleDatabaseUsage)
+}
+
+func (r *toolRegistry) handleDatabaseUsage(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	databaseID := request.GetInt("database_id", 0)
+	source := request.GetString("source", "auto")
+	top := request.GetInt("top", 10)
+
+	result := map[string]interface{}{
+		"local_usage": localTableUsage(ctx, r.history.snapshot(), databaseID),
+	}
+
+	if source == "local" {
+		result["source"] = "local"
+		return jsonResult(result)
+	}
+
+	usage, topCards, err := metabaseTableUsage(ctx, client, databaseID, top)
+	if err != nil {
+		if source == "metabase" {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch usage from Metabase: %v", err)), nil
+		}
+		result["source"] = "local"
+		result["metabase_error"] = err.Error()
+		return jsonResult(result)
+	}
+
+	result["source"] = "metabase"
+	result["table_usage"] = usage
+	result["most_used_cards"] = topCards
+	return jsonResult(result)
+}
+
+// metabaseTableUsage derives per-table usage from saved question statistics.
+// Cards the profile's database policy or the calling client may not query are
+// left out.
+func metabaseTableUsage(ctx context.Context, client *MetabaseClient, databaseID, top int) ([]*tableUsage, []map[string]interface{}, error) {
+	cards, err := listCards(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tables []MetabaseTable
+	if err := client.Get(ctx, "/api/table", &tables); err != nil {
+		return nil, nil, err
+	}
+	tableNames := make(map[int]string, len(tables))
+	tableSchemas := make(map[int]string, len(tables))
+	for _, table := range tables {
+		tableSchemas[table.ID] = table.Schema
+		name := table.Name
+		if table.Schema != "" {
+			name = table.Schema + "." + table.Name
+		}
+		tableNames[table.ID] = name
+	}
+
+	byTable := make(map[string]*tableUsage)
+	usedCards := make([]Card, 0, len(cards))
+	for _, card := range cards {
+		if card.Archived || (databaseID != 0 && card.DatabaseID != databaseID) {
+			continue
+		}
+		if !cardUsageVisible(ctx, card, tableSchemas) {
+			continue
+		}
+		usedCards = append(usedCards, card)
+
+		table := "(native query)"
+		if card.TableID != nil {
+			if name, ok := tableNames[*card.TableID]; ok {
+				table = name
+			}
+		}
+		key := fmt.Sprintf("%d/%s", card.DatabaseID, table)
+		usage, ok := byTable[key]
+		if !ok {
+			usage = &tableUsage{DatabaseID: card.DatabaseID, Table: table}
+			byTable[key] = usage
+		}
+		usage.Cards++
+		usage.Views += card.ViewCount
+		if card.LastUsedAt != nil && (usage.LastUsedAt == nil || *card.LastUsedAt > *usage.LastUsedAt) {
+			usage.LastUsedAt = card.LastUsedAt
+		}
+	}
+
+	usage := make([]*tableUsage, 0, len(byTable))
+	for _, u := range byTable {
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Views > usage[j].Views })
+
+	sort.Slice(usedCards, func(i, j int) bool { return usedCards[i].ViewCount > usedCards[j].ViewCount })
+	if len(usedCards) > top {
+		usedCards = usedCards[:top]
+	}
+	topCards := make([]map[string]interface{}, 0, len(usedCards))
+	for _, card := range usedCards {
+		topCards = append(topCards, map[string]interface{}{
+			"id":           card.ID,
+			"name":         card.Name,
+			"database_id":  card.DatabaseID,
+			"views":        card.ViewCount,
+			"last_used_at": card.LastUsedAt,
+		})
+	}
+
+	return usage, topCards, nil
+}
+
+// cardUsageVisible reports whether the caller may see a card's usage: its
+// database, and the schema of its table or the tables its SQL reads, must be
+// within the profile's database policy and the calling client's scope
+func cardUsageVisible(ctx context.Context, card Card, tableSchemas map[int]string) bool {
+	return checkCardTables(ctx, card, func(tableID int) (string, error) {
+		return tableSchemas[tableID], nil
+	}) == nil
+}
+
+// localTableUsage derives per-table usage from queries executed through this
+// server on the call's profile, leaving out queries the caller would not be
+// allowed to run
+func localTableUsage(ctx context.Context, entries []QueryHistoryEntry, databaseID int) []*tableUsage {
+	var profileName string
+	if profile := profileFromContext(ctx); profile != nil {
+		profileName = profile.Name
+	}
+	byTable := make(map[string]*tableUsage)
+	for _, entry := range entries {
+		if entry.Profile != profileName || (databaseID != 0 && entry.DatabaseID != databaseID) {
+			continue
+		}
+		if checkQueryAccess(ctx, entry.DatabaseID, entry.Query) != nil {
+			continue
+		}
+		lastUsed := entry.StartedAt.Format(time.RFC3339)
+		for _, table := range referencedTables(entry.Query) {
+			key := fmt.Sprintf("%d/%s", entry.DatabaseID, table)
+			usage, ok := byTable[key]
+			if !ok {
+				usage = &tableUsage{DatabaseID: entry.DatabaseID, Table: table}
+				byTable[key] = usage
+			}
+			usage.Queries++
+			usage.LastUsedAt = &lastUsed
+		}
+	}
+
+	usage := make([]*tableUsage, 0, len(byTable))
+	for _, u := range byTable {
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Queries > usage[j].Queries })
+	return usage
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestLocalTableUsage(t *testing.T) {
+	entries := []QueryHistoryEntry{
+		{Profile: "prod", DatabaseID: 1, Query: "SELECT * FROM finance.orders"},
+		{Profile: "prod", DatabaseID: 1, Query: "SELECT * FROM finance.orders o JOIN finance.customers c ON o.customer_id = c.id"},
+		{Profile: "prod", DatabaseID: 1, Query: "SELECT * FROM hr.salaries"},
+		{Profile: "prod", DatabaseID: 2, Query: "SELECT * FROM finance.orders"},
+		// Database 1 of the staging profile is another Metabase's database
+		{Profile: "staging", DatabaseID: 1, Query: "SELECT * FROM finance.orders"},
+	}
+	ctx := withProfile(context.Background(), &Profile{Name: "prod", DatabaseID: 1})
+	ctx = withClientAccess(ctx, &ClientAccess{Name: "finance", Schemas: []string{"finance"}})
+
+	got := make(map[string]int)
+	for _, usage := range localTableUsage(ctx, entries, 1) {
+		got[usage.Table] = usage.Queries
+	}
+	want := map[string]int{"finance.orders": 2, "finance.customers": 1}
+	if len(got) != len(want) || got["finance.orders"] != 2 || got["finance.customers"] != 1 {
+		t.Errorf("usage = %v, want %v", got, want)
+	}
+}
+
+func TestCardUsageVisible(t *testing.T) {
+	ctx := withClientAccess(context.Background(), &ClientAccess{Name: "finance", Databases: []int{1}, Schemas: []string{"finance"}})
+	tableSchemas := map[int]string{10: "finance", 20: "hr"}
+	tableID := func(id int) *int { return &id }
+
+	tests := []struct {
+		name string
+		card Card
+		want bool
+	}{
+		{"table in scope", Card{DatabaseID: 1, TableID: tableID(10)}, true},
+		{"table in another schema", Card{DatabaseID: 1, TableID: tableID(20)}, false},
+		{"native in scope", Card{DatabaseID: 1, DatasetQuery: json.RawMessage(`{"type":"native","native":{"query":"SELECT * FROM finance.orders"}}`)}, true},
+		{"native in another schema", Card{DatabaseID: 1, DatasetQuery: json.RawMessage(`{"type":"native","native":{"query":"SELECT * FROM hr.salaries"}}`)}, false},
+		{"other database", Card{DatabaseID: 2, TableID: tableID(10)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cardUsageVisible(ctx, tt.card, tableSchemas); got != tt.want {
+				t.Errorf("cardUsageVisible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
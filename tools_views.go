@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerViewTools adds the session-scoped virtual view tools
+func registerViewTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"define-view",
+		mcp.WithDescription("Define a named virtual view from a SELECT query for the rest of this session. Later queries that read from the view name get its definition prepended as a CTE, emulating a temp table without warehouse DDL"),
+		mcp.WithString(
+			"name",
+			mcp.Required(),
+			mcp.Description("Name of the view, e.g. active_users"),
+		),
+		mcp.WithString(
+			"query",
+			mcp.Required(),
+			mcp.Description("SELECT query defining the view; it may reference other views of the session"),
+		),
+	), r.handleDefineView)
+
+	r.add(mcp.NewTool(
+		"drop-view",
+		mcp.WithDescription("Remove a virtual view defined in this session"),
+		mcp.WithString(
+			"name",
+			mcp.Required(),
+			mcp.Description("Name of the view to remove"),
+		),
+	), r.handleDropView)
+
+	r.add(mcp.NewTool(
+		"list-views",
+		mcp.WithDescription("List the virtual views defined in this session with their queries"),
+	), r.handleListViews)
+}
+
+func (r *toolRegistry) handleDefineView(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !viewNamePattern.MatchString(name) {
+		return mcp.NewToolResultError("view name must be a plain identifier (letters, digits and underscores)"), nil
+	}
+	if !isSelectQuery(query) {
+		return mcp.NewToolResultError("a view must be defined by a SELECT query"), nil
+	}
+	for _, table := range referencedTables(query) {
+		if table == strings.ToLower(name) {
+			return mcp.NewToolResultError(fmt.Sprintf("view %s cannot reference itself", name)), nil
+		}
+	}
+
+	session := sessionID(ctx)
+	r.views.define(session, VirtualView{Name: name, Query: query})
+	return jsonResult(map[string]interface{}{
+		"defined": name,
+		"views":   r.views.list(session),
+	})
+}
+
+func (r *toolRegistry) handleDropView(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if !r.views.drop(sessionID(ctx), name) {
+		return mcp.NewToolResultError(fmt.Sprintf("view %s is not defined in this session", name)), nil
+	}
+	return jsonResult(map[string]interface{}{
+		"dropped": name,
+	})
+}
+
+func (r *toolRegistry) handleListViews(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return jsonResult(r.views.list(sessionID(ctx)))
+}
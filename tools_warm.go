@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerWarmTools adds the cache warm-up tool
+func registerWarmTools(r *toolRegistry) {
+	r.add(mcp.NewTool(
+		"warm-cache",
+		mcp.WithDescription("Pre-execute the configured warm-up cards and queries, or the most viewed cards, at batch priority to populate the Metabase result cache and the local metadata cache before business hours"),
+		mcp.WithNumber(
+			"top",
+			mcp.Description("Also warm the N most viewed cards (default 10 when no warm-up list is configured)"),
+		),
+	), r.handleWarmCache)
+}
+
+func (r *toolRegistry) handleWarmCache(ctx context.Context, client *MetabaseClient, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	profile := profileFromContext(ctx)
+	list, err := r.warmList(ctx, profile, request.GetInt("top", 0))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	results := r.warm(ctx, profile, list)
+	failed := 0
+	for _, result := range results {
+		if result.Status != "ok" {
+			failed++
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"warmed":  len(results) - failed,
+		"failed":  failed,
+		"cards":   len(list.Cards),
+		"queries": len(list.Queries),
+		"results": results,
+	})
+}
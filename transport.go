@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// newHTTPTransport creates the transport carrying requests to Metabase. It
+// trusts the configured CA bundle in addition to the system roots, and
+// presents a client certificate when one is configured, as required by
+// gateways enforcing mutual TLS.
+func newHTTPTransport(cfg Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	// Only for testing against self-signed instances: anyone on the network
+	// path can then read the credentials and data
+	if cfg.InsecureSkipVerify {
+		log.Println("WARNING: TLS certificate verification is DISABLED (METABASE_INSECURE_SKIP_VERIFY); connections to Metabase can be intercepted")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, fmt.Errorf("METABASE_CLIENT_CERT and METABASE_CLIENT_KEY must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	// HTTPS_PROXY and NO_PROXY apply unless a proxy is configured explicitly
+	if cfg.Proxy != "" {
+		proxyURL, err := proxyURLFor(cfg)
+		if err != nil {
+			return nil, err
+		}
+		noProxy := splitList(cfg.NoProxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(req.URL.Hostname(), noProxy) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+	return transport, nil
+}
+
+// proxyURLFor parses the configured proxy, adding the proxy credentials
+// when they are set separately from the URL
+func proxyURLFor(cfg Config) (*url.URL, error) {
+	proxyURL, err := url.Parse(cfg.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid METABASE_PROXY: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks5 or socks5h", proxyURL.Scheme)
+	}
+	if cfg.ProxyUsername != "" {
+		proxyURL.User = url.UserPassword(cfg.ProxyUsername, cfg.ProxyPassword)
+	}
+	return proxyURL, nil
+}
+
+// bypassProxy reports whether host matches the no-proxy list: "*", a host
+// name that also matches its subdomains (with or without a leading dot), an
+// IP address or a CIDR range
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(entry)
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		domain := strings.TrimPrefix(entry, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// viewNamePattern matches valid virtual view names
+var viewNamePattern = regexp.MustCompile(`^[a-zA-Z_]\w*$`)
+
+// withPrefixPattern matches the WITH keyword opening a query, with an optional RECURSIVE
+var withPrefixPattern = regexp.MustCompile(`(?is)^\s*with\s+(recursive\s+)?`)
+
+// VirtualView is a named query that later queries of the same session may
+// reference like a table
+type VirtualView struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// viewStore holds the virtual views defined by each client session
+type viewStore struct {
+	mu    sync.Mutex
+	views map[string]map[string]VirtualView
+}
+
+// newViewStore creates an empty view store
+func newViewStore() *viewStore {
+	return &viewStore{views: make(map[string]map[string]VirtualView)}
+}
+
+// sessionID identifies the client session of a tool call, or "" when the
+// transport has no sessions
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// define adds or replaces a view in the session
+func (s *viewStore) define(session string, view VirtualView) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.views[session] == nil {
+		s.views[session] = make(map[string]VirtualView)
+	}
+	s.views[session][strings.ToLower(view.Name)] = view
+}
+
+// drop removes a view from the session, reporting whether it existed
+func (s *viewStore) drop(session, name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	views := s.views[session]
+	if _, ok := views[strings.ToLower(name)]; !ok {
+		return false
+	}
+	delete(views, strings.ToLower(name))
+	return true
+}
+
+// clear forgets every view of a session that has ended
+func (s *viewStore) clear(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.views, session)
+}
+
+// list returns the views of the session sorted by name
+func (s *viewStore) list(session string) []VirtualView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	views := make([]VirtualView, 0, len(s.views[session]))
+	for _, view := range s.views[session] {
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// expand prepends the session views referenced by query, directly or through
+// other views, as common table expressions. Views are emitted after the views
+// they depend on; names the query defines as CTEs itself are left alone.
+func (s *viewStore) expand(session, query string) (string, []string) {
+	s.mu.Lock()
+	views := make(map[string]VirtualView, len(s.views[session]))
+	for name, view := range s.views[session] {
+		views[name] = view
+	}
+	s.mu.Unlock()
+	if len(views) == 0 {
+		return query, nil
+	}
+
+	ctes := cteNames(query)
+	var ordered []string
+	visited := make(map[string]bool)
+	var visit func(sql string)
+	visit = func(sql string) {
+		for _, table := range referencedTables(sql) {
+			view, ok := views[table]
+			if !ok || ctes[table] || visited[table] {
+				continue
+			}
+			visited[table] = true
+			visit(view.Query)
+			ordered = append(ordered, table)
+		}
+	}
+	visit(query)
+	if len(ordered) == 0 {
+		return query, nil
+	}
+
+	definitions := make([]string, 0, len(ordered))
+	names := make([]string, 0, len(ordered))
+	for _, name := range ordered {
+		view := views[name]
+		definitions = append(definitions, fmt.Sprintf("%s AS (\n%s\n)", view.Name, strings.TrimRight(strings.TrimSpace(view.Query), ";")))
+		names = append(names, view.Name)
+	}
+	prefix := strings.Join(definitions, ",\n")
+
+	if match := withPrefixPattern.FindStringSubmatch(query); match != nil {
+		rest := query[len(match[0]):]
+		return "WITH " + match[1] + prefix + ",\n" + rest, names
+	}
+	return "WITH " + prefix + "\n" + strings.TrimSpace(query), names
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestViewStoreExpand(t *testing.T) {
+	views := newViewStore()
+	views.define("s1", VirtualView{Name: "paid", Query: "SELECT * FROM orders WHERE status = 'paid';"})
+	views.define("s1", VirtualView{Name: "big_paid", Query: "SELECT * FROM paid WHERE total > 100"})
+
+	tests := []struct {
+		name    string
+		session string
+		query   string
+		want    string
+		applied []string
+	}{
+		{
+			"no views referenced",
+			"s1", "SELECT * FROM orders", "SELECT * FROM orders", nil,
+		},
+		{
+			"other session",
+			"s2", "SELECT * FROM paid", "SELECT * FROM paid", nil,
+		},
+		{
+			"direct reference",
+			"s1", "SELECT count(*) FROM paid",
+			"WITH paid AS (\nSELECT * FROM orders WHERE status = 'paid'\n)\nSELECT count(*) FROM paid",
+			[]string{"paid"},
+		},
+		{
+			"dependencies first",
+			"s1", "SELECT * FROM BIG_PAID",
+			"WITH paid AS (\nSELECT * FROM orders WHERE status = 'paid'\n),\nbig_paid AS (\nSELECT * FROM paid WHERE total > 100\n)\nSELECT * FROM BIG_PAID",
+			[]string{"paid", "big_paid"},
+		},
+		{
+			"merged into a WITH",
+			"s1", "WITH recent AS (SELECT * FROM paid) SELECT * FROM recent",
+			"WITH paid AS (\nSELECT * FROM orders WHERE status = 'paid'\n),\nrecent AS (SELECT * FROM paid) SELECT * FROM recent",
+			[]string{"paid"},
+		},
+		{
+			"shadowed by a CTE",
+			"s1", "WITH paid AS (SELECT 1) SELECT * FROM paid",
+			"WITH paid AS (SELECT 1) SELECT * FROM paid", nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, applied := views.expand(tt.session, tt.query)
+			if got != tt.want {
+				t.Errorf("expand(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+			if !reflect.DeepEqual(applied, tt.applied) {
+				t.Errorf("applied views = %v, want %v", applied, tt.applied)
+			}
+		})
+	}
+
+	if !views.drop("s1", "PAID") || views.drop("s1", "paid") {
+		t.Errorf("drop did not remove the view exactly once")
+	}
+	views.clear("s1")
+	if list := views.list("s1"); len(list) != 0 {
+		t.Errorf("views after clear = %v", list)
+	}
+}
+
+func TestViewTools(t *testing.T) {
+	r := &toolRegistry{views: newViewStore()}
+	ctx := context.Background()
+
+	refusals := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      string
+	}{
+		{"bad name", map[string]interface{}{"name": "paid orders", "query": "SELECT 1"}, "plain identifier"},
+		{"not a select", map[string]interface{}{"name": "paid", "query": "DELETE FROM orders"}, "SELECT query"},
+		{"self reference", map[string]interface{}{"name": "paid", "query": "SELECT * FROM Paid"}, "cannot reference itself"},
+	}
+	for _, tt := range refusals {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, ctx, r.handleDefineView, nil, tt.arguments)
+			if !result.IsError || !strings.Contains(resultText(result), tt.want) {
+				t.Errorf("result = %s, want an error containing %q", resultText(result), tt.want)
+			}
+		})
+	}
+
+	defined := decodeResult(t, callTool(t, ctx, r.handleDefineView, nil, map[string]interface{}{"name": "paid", "query": "SELECT * FROM orders"}))
+	if defined["defined"] != "paid" || len(defined["views"].([]interface{})) != 1 {
+		t.Errorf("define-view = %v", defined)
+	}
+	decodeResult(t, callTool(t, ctx, r.handleDropView, nil, map[string]interface{}{"name": "paid"}))
+	if result := callTool(t, ctx, r.handleDropView, nil, map[string]interface{}{"name": "paid"}); !result.IsError {
+		t.Errorf("dropped a view that is not defined")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// WarmQuery is a native query to pre-execute when warming caches
+type WarmQuery struct {
+	DatabaseID int    `json:"database_id"`
+	Query      string `json:"query"`
+}
+
+// WarmList is the configured content to pre-execute before business hours
+type WarmList struct {
+	Cards   []int       `json:"cards"`
+	Queries []WarmQuery `json:"queries"`
+}
+
+// WarmResult reports the outcome of pre-executing one card, query or metadata fetch
+type WarmResult struct {
+	Kind       string `json:"kind"`
+	ID         int    `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Query      string `json:"query,omitempty"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// loadWarmList reads the warm-up list from a JSON file
+func loadWarmList(path string) (WarmList, error) {
+	var list WarmList
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return list, fmt.Errorf("failed to read warm-up list: %w", err)
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return list, fmt.Errorf("failed to parse warm-up list %s: %w", path, err)
+	}
+	return list, nil
+}
+
+// popularCards returns the IDs of the top most viewed cards
+func popularCards(ctx context.Context, client *MetabaseClient, top int) ([]int, error) {
+	cards, err := listCards(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	active := make([]Card, 0, len(cards))
+	for _, card := range cards {
+		if !card.Archived {
+			active = append(active, card)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].ViewCount > active[j].ViewCount })
+	if len(active) > top {
+		active = active[:top]
+	}
+	ids := make([]int, 0, len(active))
+	for _, card := range active {
+		ids = append(ids, card.ID)
+	}
+	return ids, nil
+}
+
+// warm pre-executes the cards and queries of list at batch priority, so the
+// Metabase result cache is populated, and refreshes the local metadata cache of
+// every database involved
+func (r *toolRegistry) warm(ctx context.Context, profile *Profile, list WarmList) []WarmResult {
+	ctx = withPriority(withProfile(ctx, profile), PriorityBatch)
+	client := profile.client
+	results := make([]WarmResult, 0, len(list.Cards)+len(list.Queries))
+	databases := map[int]bool{profile.DatabaseID: true}
+
+	for _, cardID := range list.Cards {
+		result := WarmResult{Kind: "card", ID: cardID, Status: "ok"}
+		startedAt := time.Now()
+		resp, err := runCard(ctx, client, cardID, nil)
+		result.DurationMS = time.Since(startedAt).Milliseconds()
+		switch {
+		case err != nil:
+			result.Status, result.Error = "error", err.Error()
+		case resp.Status == "failed":
+			result.Status = "failed"
+		default:
+			databases[resp.DatabaseID] = true
+		}
+		results = append(results, result)
+	}
+
+	for _, query := range list.Queries {
+		databaseID := query.DatabaseID
+		if databaseID == 0 {
+			databaseID = profile.DatabaseID
+		}
+		result := WarmResult{Kind: "query", ID: databaseID, Query: query.Query, Status: "ok"}
+		startedAt := time.Now()
+		outcome, err := r.executeNative(ctx, client, newNativeQuery(databaseID, query.Query))
+		result.DurationMS = time.Since(startedAt).Milliseconds()
+		switch {
+		case err != nil:
+			result.Status, result.Error = "error", err.Error()
+		case !outcome.Parsed || outcome.Response.Status == "failed":
+			result.Status = "failed"
+		default:
+			databases[databaseID] = true
+		}
+		results = append(results, result)
+	}
+
+	for databaseID := range databases {
+		if databaseID == 0 {
+			continue
+		}
+		result := WarmResult{Kind: "metadata", ID: databaseID, Status: "ok"}
+		startedAt := time.Now()
+		var metadata DatabaseMetadata
+		cachedAt, err := client.GetMetadata(ctx, fmt.Sprintf("/api/database/%d/metadata", databaseID), &metadata)
+		result.DurationMS = time.Since(startedAt).Milliseconds()
+		switch {
+		case err != nil:
+			result.Status, result.Error = "error", err.Error()
+		case cachedAt != nil:
+			result.Status, result.Error = "error", "metabase is unreachable"
+		default:
+			result.Name = metadata.Name
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// warmList returns the configured warm-up list, adding the top most viewed
+// cards when top is positive or nothing is configured
+func (r *toolRegistry) warmList(ctx context.Context, profile *Profile, top int) (WarmList, error) {
+	var list WarmList
+	if warmFile := r.currentConfig().WarmFile; warmFile != "" {
+		configured, err := loadWarmList(warmFile)
+		if err != nil {
+			return list, err
+		}
+		list = configured
+	}
+	if top <= 0 && len(list.Cards) == 0 && len(list.Queries) == 0 {
+		top = 10
+	}
+	if top > 0 {
+		popular, err := popularCards(ctx, profile.client, top)
+		if err != nil {
+			return list, fmt.Errorf("failed to find popular cards: %w", err)
+		}
+		seen := make(map[int]bool, len(list.Cards))
+		for _, id := range list.Cards {
+			seen[id] = true
+		}
+		for _, id := range popular {
+			if !seen[id] {
+				list.Cards = append(list.Cards, id)
+			}
+		}
+	}
+	return list, nil
+}
+
+// runWarmCommand implements the warm subcommand, printing the results as JSON
+// and returning a non-zero exit code when anything failed
+func runWarmCommand(r *toolRegistry, args []string) int {
+	flags := flag.NewFlagSet("warm", flag.ContinueOnError)
+	profileName := flags.String("profile", r.config.DefaultProfile, "profile to warm")
+	top := flags.Int("top", 0, "also warm the N most viewed cards (default 10 when no warm-up list is configured)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	profile, ok := r.config.Profiles[*profileName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown profile %q\n", *profileName)
+		return 2
+	}
+
+	ctx := context.Background()
+	list, err := r.warmList(ctx, profile, *top)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	results := r.warm(ctx, profile, list)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, result := range results {
+		if result.Status != "ok" {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// warmResponses serve four cards, two warehouse databases and their queries
+func warmResponses() map[string]interface{} {
+	return map[string]interface{}{
+		"/api/card": []interface{}{
+			map[string]interface{}{"id": 1, "view_count": 5},
+			map[string]interface{}{"id": 2, "view_count": 50, "archived": true},
+			map[string]interface{}{"id": 3, "view_count": 20},
+			map[string]interface{}{"id": 4, "view_count": 10},
+		},
+		"POST /api/card/3/query":   map[string]interface{}{"status": "completed", "database_id": 2},
+		"POST /api/card/4/query":   map[string]interface{}{"status": "failed", "database_id": 2},
+		"POST /api/dataset":        datasetResponse(1),
+		"/api/database/1/metadata": map[string]interface{}{"id": 1, "name": "Warehouse"},
+		"/api/database/2/metadata": map[string]interface{}{"id": 2, "name": "Marts"},
+	}
+}
+
+func TestWarmList(t *testing.T) {
+	client := newTestClient(t, warmResponses())
+	profile := &Profile{Name: "default", DatabaseID: 1, client: client}
+	warmFile := filepath.Join(t.TempDir(), "warm.json")
+	if err := os.WriteFile(warmFile, []byte(`{"cards": [4], "queries": [{"query": "SELECT 1"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		warmFile string
+		top      int
+		cards    []int
+	}{
+		{"most viewed by default", "", 0, []int{3, 4, 1}},
+		{"configured list", warmFile, 0, []int{4}},
+		{"configured list and most viewed", warmFile, 2, []int{4, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &toolRegistry{config: Config{WarmFile: tt.warmFile}}
+			list, err := r.warmList(context.Background(), profile, tt.top)
+			if err != nil {
+				t.Fatalf("warmList: %v", err)
+			}
+			if !reflect.DeepEqual(list.Cards, tt.cards) {
+				t.Errorf("cards = %v, want %v", list.Cards, tt.cards)
+			}
+		})
+	}
+}
+
+func TestWarm(t *testing.T) {
+	client, fake := newFakeMetabase(t, warmResponses())
+	r := &toolRegistry{history: newQueryHistory(10), stats: newSessionStatsStore()}
+	profile := &Profile{Name: "default", DatabaseID: 1, client: client}
+
+	results := r.warm(context.Background(), profile, WarmList{Cards: []int{3, 4, 9}, Queries: []WarmQuery{{Query: "SELECT 1"}}})
+
+	statuses := make(map[string]string)
+	for _, result := range results {
+		statuses[result.Kind+" "+result.Name+" "+strconv.Itoa(result.ID)] = result.Status
+	}
+	want := map[string]string{
+		"card  3":              "ok",
+		"card  4":              "failed",
+		"card  9":              "error",
+		"query  1":             "ok",
+		"metadata Warehouse 1": "ok",
+		"metadata Marts 2":     "ok",
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("results = %v, want %v", statuses, want)
+	}
+
+	// Queries without a database run against the profile's
+	for _, request := range fake.sent("POST") {
+		if request.Path == "/api/dataset" && request.Body["database"] != 1.0 {
+			t.Errorf("warmed %q on database %v", sentSQL(request), request.Body["database"])
+		}
+	}
+}